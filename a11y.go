@@ -0,0 +1,202 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A11yIssue is a common accessibility problem found in the output of a
+// template route. See [AuditAccessibility].
+type A11yIssue struct {
+	// Path of the page and name of the template that renders it.
+	Page     string `json:"page"`
+	Template string `json:"template"`
+
+	// Line of the rendered output the issue was found on.
+	Line int `json:"line"`
+
+	// Short name of the check that failed, like `img-alt` or `label`.
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// AuditAccessibility renders every page of the instance like [CheckLinks] and
+// checks the html with heuristics for common accessibility problems: images
+// without alt text, form fields without a label, links and buttons without an
+// accessible name, skipped heading levels, positive tabindex, and documents
+// without a title or language. It doesn't replace testing with assistive
+// technology, but catches regressions in every route cheaply.
+func AuditAccessibility(instance *Instance) []A11yIssue {
+	var issues []A11yIssue
+	instance.renderPages(func(page, pattern string, body []byte) {
+		for _, issue := range auditA11y(body) {
+			issue.Page, issue.Template = page, instance.routeSources[pattern]
+			issues = append(issues, issue)
+		}
+	})
+	return issues
+}
+
+// Input types that don't need a label.
+var unlabeledInputTypes = []string{"hidden", "submit", "button", "reset", "image"}
+
+// auditA11y returns the accessibility issues found in an html page or
+// fragment. Page and Template of the issues aren't set.
+func auditA11y(body []byte) []A11yIssue {
+	var issues []A11yIssue
+	report := func(line int, rule, format string, args ...any) {
+		issues = append(issues, A11yIssue{Line: line, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+	attr := func(token html.Token, key string) (string, bool) {
+		i := slices.IndexFunc(token.Attr, func(a html.Attribute) bool { return a.Key == key })
+		if i < 0 {
+			return "", false
+		}
+		return token.Attr[i].Val, true
+	}
+	labeled := func(token html.Token) bool {
+		for _, key := range []string{"aria-label", "aria-labelledby", "title"} {
+			if v, _ := attr(token, key); strings.TrimSpace(v) != "" {
+				return true
+			}
+		}
+		return false
+	}
+
+	// links and buttons that are open, and whether they have a name yet
+	type named struct {
+		name string
+		line int
+		ok   bool
+	}
+	var open []named
+	type field struct {
+		name, id string
+		line     int
+	}
+	var fields []field
+	labelFor := map[string]bool{}
+	var inLabel, document, hasLang, hasTitle, inTitle bool
+	heading := 0
+	line := 1
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		start := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+		token := z.Token()
+		switch tt {
+		case html.DoctypeToken:
+			document = true
+		case html.TextToken:
+			if strings.TrimSpace(token.Data) == "" {
+				continue
+			}
+			if inTitle {
+				hasTitle = true
+			}
+			for i := range open {
+				open[i].ok = true
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if v, ok := attr(token, "tabindex"); ok {
+				if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+					report(start, "tabindex", "<%s> has tabindex %d, which changes the tab order", token.Data, n)
+				}
+			}
+			switch token.Data {
+			case "html":
+				document = true
+				v, _ := attr(token, "lang")
+				hasLang = strings.TrimSpace(v) != ""
+			case "title":
+				inTitle = true
+			case "a", "button":
+				if token.Data == "a" {
+					if _, ok := attr(token, "href"); !ok {
+						continue
+					}
+				}
+				if tt == html.StartTagToken {
+					open = append(open, named{token.Data, start, labeled(token)})
+				}
+			case "img":
+				alt, ok := attr(token, "alt")
+				if !ok {
+					report(start, "img-alt", "<img> without alt attribute, use alt=\"\" for decorative images")
+				} else if strings.TrimSpace(alt) != "" {
+					for i := range open {
+						open[i].ok = true
+					}
+				}
+			case "input", "select", "textarea":
+				typ, _ := attr(token, "type")
+				if token.Data == "input" && typ == "image" {
+					if alt, _ := attr(token, "alt"); strings.TrimSpace(alt) == "" {
+						report(start, "img-alt", "<input type=\"image\"> without alt text")
+					}
+				}
+				if token.Data == "input" && slices.Contains(unlabeledInputTypes, strings.ToLower(typ)) {
+					continue
+				}
+				if inLabel || labeled(token) {
+					continue
+				}
+				id, _ := attr(token, "id")
+				fields = append(fields, field{token.Data, id, start})
+			case "label":
+				if v, ok := attr(token, "for"); ok {
+					labelFor[v] = true
+				} else if tt == html.StartTagToken {
+					inLabel = true
+				}
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				level := int(token.Data[1] - '0')
+				if heading > 0 && level > heading+1 {
+					report(start, "heading-order", "<%s> follows <h%d>, skipping a heading level", token.Data, heading)
+				}
+				heading = level
+			}
+		case html.EndTagToken:
+			switch token.Data {
+			case "title":
+				inTitle = false
+			case "label":
+				inLabel = false
+			case "a", "button":
+				i := len(open) - 1
+				for i >= 0 && open[i].name != token.Data {
+					i--
+				}
+				if i < 0 {
+					continue
+				}
+				if !open[i].ok {
+					report(open[i].line, "name", "<%s> has no text or aria-label", open[i].name)
+				}
+				open = slices.Delete(open, i, i+1)
+			}
+		}
+	}
+	for _, f := range fields {
+		if f.id == "" || !labelFor[f.id] {
+			report(f.line, "label", "<%s> has no label", f.name)
+		}
+	}
+	if document && !hasLang {
+		report(1, "html-lang", "document has no <html lang> attribute")
+	}
+	if document && !hasTitle {
+		report(1, "document-title", "document has no <title>")
+	}
+	slices.SortStableFunc(issues, func(a, b A11yIssue) int { return a.Line - b.Line })
+	return issues
+}
@@ -0,0 +1,257 @@
+package xtemplate
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"path"
+	"strings"
+)
+
+// AccessRule restricts which client ips may request paths matching a glob.
+// Rules are evaluated in order before routing and the first rule whose Path
+// matches applies: clients without a verified certificate are rejected if
+// ClientCert is set, clients matching Deny are rejected, then if Allow is not
+// empty clients not matching Allow are rejected. Rejected requests receive a
+// 403 Forbidden response.
+type AccessRule struct {
+	// A glob as used by [path.Match], like `/admin/*`. A pattern ending in
+	// `/**` also matches everything below the preceding path, like
+	// `/admin/**`.
+	Path string `json:"path"`
+
+	// IP addresses or CIDR ranges like `10.0.0.0/8`.
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+
+	// Reject clients that didn't present a TLS client certificate that was
+	// verified against [Config.TLSClientCA], which must be set.
+	ClientCert bool `json:"client_cert,omitempty"`
+}
+
+func WithAccessRules(rules ...AccessRule) Option {
+	return func(c *Config) error {
+		c.AccessRules = append(c.AccessRules, rules...)
+		return nil
+	}
+}
+
+// WithTrustedProxies sets the ip addresses or CIDR ranges of reverse proxies
+// whose X-Forwarded-For header is trusted to determine the client ip.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(c *Config) error {
+		c.TrustedProxies = append(c.TrustedProxies, proxies...)
+		return nil
+	}
+}
+
+type accessRule struct {
+	pattern     string
+	allow, deny []netip.Prefix
+	clientCert  bool
+}
+
+type accessControl struct {
+	rules   []accessRule
+	proxies []netip.Prefix
+}
+
+func newAccessControl(rules []AccessRule, proxies []string, clientCA string) (*accessControl, error) {
+	ac := &accessControl{}
+	var err error
+	if ac.proxies, err = parsePrefixes(proxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+	}
+	for _, r := range rules {
+		if _, err := path.Match(r.Path, ""); err != nil {
+			return nil, fmt.Errorf("invalid access rule path '%s': %w", r.Path, err)
+		}
+		if r.ClientCert && clientCA == "" {
+			return nil, fmt.Errorf("access rule for '%s' requires a client certificate, but tls_client_ca is not set", r.Path)
+		}
+		rule := accessRule{pattern: r.Path, clientCert: r.ClientCert}
+		if rule.allow, err = parsePrefixes(r.Allow); err != nil {
+			return nil, fmt.Errorf("invalid access rule for '%s': %w", r.Path, err)
+		}
+		if rule.deny, err = parsePrefixes(r.Deny); err != nil {
+			return nil, fmt.Errorf("invalid access rule for '%s': %w", r.Path, err)
+		}
+		ac.rules = append(ac.rules, rule)
+	}
+	return ac, nil
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, v := range values {
+		if strings.Contains(v, "/") {
+			p, err := netip.ParsePrefix(v)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(v)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches p against a glob pattern as used by [path.Match], where a
+// pattern ending in `/**` also matches all paths below the preceding path.
+func matchPath(pattern, p string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+		pattern = prefix + "/*"
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+type rulePathType struct{}
+
+var rulePathKey = rulePathType{}
+
+// rulePath returns the path of r that the path globs of rules like
+// [AccessRule] and [HeaderRule] are matched against, which is the path of the
+// route that serves it, see [Instance.canonicalPath].
+func rulePath(r *http.Request) string {
+	if p, ok := r.Context().Value(rulePathKey).(string); ok {
+		return p
+	}
+	return r.URL.Path
+}
+
+// canonicalPath returns the path of r with the case of the route that serves
+// it if [Config.CaseInsensitiveRoutes] is set, and without the locale prefix
+// of a localized route, so `/ADMIN` and `/de/admin` are matched by the rules
+// of `/admin` like the route that serves them, and can't be used to bypass
+// them.
+func (instance *Instance) canonicalPath(r *http.Request) string {
+	p := r.URL.Path
+	_, pattern := instance.router.Handler(r)
+	if instance.config.CaseInsensitiveRoutes && pattern != "" {
+		p = canonicalCase(pattern, p)
+	}
+	if instance.locales != nil {
+		if _, rest, ok := instance.locales.split(p); ok && instance.locales.prefixed[pattern] {
+			p = rest
+		}
+	}
+	return p
+}
+
+type clientAddrType struct{}
+
+var clientAddrKey = clientAddrType{}
+
+// clientAddr returns the ip of the client that made r, as determined by the
+// trusted proxies of the instance that serves it, see [accessControl.clientIP].
+func clientAddr(r *http.Request) netip.Addr {
+	if addr, ok := r.Context().Value(clientAddrKey).(netip.Addr); ok {
+		return addr
+	}
+	return (*accessControl)(nil).clientIP(r)
+}
+
+type clientSchemeType struct{}
+
+var clientSchemeKey = clientSchemeType{}
+
+// clientScheme returns the scheme, `http` or `https`, of the request the
+// client made, as determined by the trusted proxies of the instance that
+// serves it, see [accessControl.scheme].
+func clientScheme(r *http.Request) string {
+	if scheme, ok := r.Context().Value(clientSchemeKey).(string); ok {
+		return scheme
+	}
+	return (*accessControl)(nil).scheme(r)
+}
+
+// peerAddr returns the ip of the direct peer of the request.
+func peerAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// scheme returns the scheme of the request the client made. If the direct
+// peer is a trusted proxy, it's read from the X-Forwarded-Proto header, since
+// the proxy may terminate TLS.
+func (ac *accessControl) scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if ac != nil && containsAddr(ac.proxies, peerAddr(r)) {
+		proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		if strings.EqualFold(strings.TrimSpace(proto), "https") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+// clientIP returns the ip of the client that made the request. If the direct
+// peer is a trusted proxy, the X-Forwarded-For header is read from right to
+// left and the first address that isn't a trusted proxy is returned.
+func (ac *accessControl) clientIP(r *http.Request) netip.Addr {
+	addr := peerAddr(r)
+	if !addr.IsValid() || ac == nil || !containsAddr(ac.proxies, addr) {
+		return addr
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !containsAddr(ac.proxies, addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// allowed reports whether the request is allowed by the first matching rule.
+func (ac *accessControl) allowed(r *http.Request) bool {
+	for _, rule := range ac.rules {
+		if !matchPath(rule.pattern, rulePath(r)) {
+			continue
+		}
+		if rule.clientCert && !verifiedClientCert(r) {
+			return false
+		}
+		ip := ac.clientIP(r)
+		if !ip.IsValid() {
+			return false
+		}
+		if containsAddr(rule.deny, ip) {
+			return false
+		}
+		return len(rule.allow) == 0 || containsAddr(rule.allow, ip)
+	}
+	return true
+}
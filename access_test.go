@@ -0,0 +1,91 @@
+package xtemplate
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// testInstance builds an instance from templates and options, failing the
+// test if it doesn't build.
+func testInstance(t *testing.T, templates fstest.MapFS, options ...Option) *Instance {
+	t.Helper()
+	options = append([]Option{WithTemplateFS(templates), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, options...)
+	instance, _, _, err := New().Instance(options...)
+	if err != nil {
+		t.Fatalf("failed to build instance: %v", err)
+	}
+	return instance
+}
+
+// serve returns the status of a request to instance from remoteAddr.
+func serve(instance *Instance, method, target, remoteAddr string) int {
+	r := httptest.NewRequest(method, target, nil)
+	r.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	instance.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestAccessRulesLocalePrefix(t *testing.T) {
+	instance := testInstance(t, fstest.MapFS{
+		"admin/index.html": {Data: []byte("admin")},
+		"index.html":       {Data: []byte("home")},
+	},
+		WithAccessRules(AccessRule{Path: "/admin/**", Allow: []string{"10.0.0.0/8"}}),
+		WithLocales(LocaleConfig{Locales: []string{"en", "de"}}),
+	)
+	for _, tc := range []struct {
+		target, remoteAddr string
+		status             int
+	}{
+		{"/en/admin/", "192.0.2.1:1234", http.StatusForbidden},
+		{"/de/admin/", "192.0.2.1:1234", http.StatusForbidden},
+		{"/en/admin/", "10.0.0.1:1234", http.StatusOK},
+		{"/en/", "192.0.2.1:1234", http.StatusOK},
+	} {
+		if status := serve(instance, http.MethodGet, tc.target, tc.remoteAddr); status != tc.status {
+			t.Errorf("GET %s from %s: got status %d, want %d", tc.target, tc.remoteAddr, status, tc.status)
+		}
+	}
+}
+
+func TestAccessRulesCaseInsensitiveRoutes(t *testing.T) {
+	instance := testInstance(t, fstest.MapFS{
+		"admin/users.html": {Data: []byte(`users{{define "POST /admin/users"}}saved{{end}}`)},
+	},
+		WithAccessRules(AccessRule{Path: "/admin/**", Allow: []string{"10.0.0.0/8"}}),
+		func(c *Config) error {
+			c.CaseInsensitiveRoutes = true
+			return nil
+		},
+	)
+	for _, tc := range []struct {
+		method, target, remoteAddr string
+		status                     int
+	}{
+		{http.MethodGet, "/ADMIN/users", "192.0.2.1:1234", http.StatusForbidden},
+		{http.MethodPost, "/Admin/Users", "192.0.2.1:1234", http.StatusForbidden},
+		{http.MethodGet, "/admin/users", "10.0.0.1:1234", http.StatusOK},
+		{http.MethodGet, "/ADMIN/users", "10.0.0.1:1234", http.StatusMovedPermanently},
+	} {
+		if status := serve(instance, tc.method, tc.target, tc.remoteAddr); status != tc.status {
+			t.Errorf("%s %s from %s: got status %d, want %d", tc.method, tc.target, tc.remoteAddr, status, tc.status)
+		}
+	}
+}
+
+func TestAccessRulesClientCertRequiresCA(t *testing.T) {
+	templates := fstest.MapFS{"index.html": {Data: []byte("home")}}
+	rule := WithAccessRules(AccessRule{Path: "/admin/**", ClientCert: true})
+	if _, _, _, err := New().Instance(WithTemplateFS(templates), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), rule); err == nil {
+		t.Error("expected a client cert rule without tls_client_ca to fail the build")
+	}
+	testInstance(t, templates, rule, func(c *Config) error {
+		c.TLSClientCA = "ca.pem"
+		return nil
+	})
+}
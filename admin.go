@@ -0,0 +1,354 @@
+package xtemplate
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// AdminConfig configures generated admin pages that list, create, edit, and
+// delete the rows of the tables configured in a database's
+// [DotDBConfig.Tables]. Only the whitelisted columns can be written.
+//
+// The pages are rendered by the templates "ADMIN index", "ADMIN list", and
+// "ADMIN form", which are called with the page data at .Req.Admin and can be
+// overridden by defining templates with the same names. Requests must have
+// [Config.AdminToken] if it's set, otherwise they must come from a loopback
+// address without being forwarded by an untrusted proxy, and POST requests
+// from other sites are rejected. [Server.Serve] requires the token unless it
+// listens on a loopback address.
+type AdminConfig struct {
+	// Base path of the admin pages. Default `/admin`.
+	Path string `json:"path,omitempty"`
+
+	// Name of the database provider whose tables are managed. Defaults to the
+	// first database.
+	Database string `json:"database,omitempty"`
+
+	// Number of rows per page of the list page. Default 25.
+	PerPage int `json:"per_page,omitempty"`
+}
+
+func WithAdmin(admin AdminConfig) Option {
+	return func(c *Config) error {
+		c.Admin = &admin
+		return nil
+	}
+}
+
+// AdminPage is the data of an admin page, available to the admin templates as
+// .Req.Admin.
+type AdminPage struct {
+	// Base path of the admin pages.
+	Path string
+
+	// Names of the managed tables.
+	Tables []string
+
+	// The current table, empty on the index page.
+	Table string
+
+	// All columns of the current table.
+	Columns []string
+
+	// Columns of the current table that can be written.
+	Editable []string
+
+	// Primary key column of the current table.
+	Key string
+
+	// The current page of rows on the list page.
+	Rows *DBPage
+
+	// The row being edited on the form page, nil when creating a row.
+	Row map[string]any
+}
+
+type adminPageType struct{}
+
+var adminPageKey = adminPageType{}
+
+// Admin returns the data of the admin page being rendered, otherwise nil. See
+// [AdminConfig].
+func (d DotReq) Admin() *AdminPage {
+	p, _ := d.Context().Value(adminPageKey).(*AdminPage)
+	return p
+}
+
+//go:embed admin.html
+var adminTemplates string
+
+// addAdminTemplates adds the default admin templates that aren't already
+// defined by template files.
+func (b *builder) addAdminTemplates() error {
+	trees, err := parse.Parse("admin.html", adminTemplates, "{{", "}}", b.funcs, buliltinsSkeleton)
+	if err != nil {
+		return fmt.Errorf("could not parse admin templates: %w", err)
+	}
+	for name, tree := range trees {
+		if name == "admin.html" || b.templates.Lookup(name) != nil {
+			continue
+		}
+		b.injectBudgetArgs(tree)
+		if _, err := b.templates.AddParseTree(name, tree); err != nil {
+			return fmt.Errorf("could not add admin template '%s': %w", name, err)
+		}
+		b.addTemplateSource("admin.html", adminTemplates, "", name)
+	}
+	return nil
+}
+
+type admin struct {
+	instance *Instance
+	config   AdminConfig
+	db       *DotDBConfig
+	tables   []string
+}
+
+// addAdminRoutes registers the admin pages for the tables of the configured
+// database provider, which must already be initialized.
+func (b *builder) addAdminRoutes(dot []DotConfig) error {
+	a := &admin{instance: b.Instance, config: *b.config.Admin}
+	if a.config.Path == "" {
+		a.config.Path = "/admin"
+	}
+	a.config.Path = path.Clean("/" + a.config.Path)
+	if a.config.PerPage <= 0 {
+		a.config.PerPage = 25
+	}
+	a.db = findDotDB(dot, a.config.Database)
+	if a.db == nil {
+		return fmt.Errorf("admin database provider not found: '%s'", a.config.Database)
+	}
+	for table := range a.db.Tables {
+		a.tables = append(a.tables, table)
+	}
+	slices.Sort(a.tables)
+
+	base := a.config.Path
+	for _, route := range []struct {
+		pattern string
+		handler http.HandlerFunc
+	}{
+		{"GET " + base + "/{$}", a.index},
+		{"GET " + base + "/{table}", a.list},
+		{"GET " + base + "/{table}/new", a.form},
+		{"GET " + base + "/{table}/{id}", a.form},
+		{"POST " + base + "/{table}", a.save},
+		{"POST " + base + "/{table}/{id}", a.save},
+		{"POST " + base + "/{table}/{id}/delete", a.delete},
+	} {
+		pattern, handler := route.pattern, b.Instance.authorizeAdmin(route.handler)
+		if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+			return err
+		}
+		b.routes = append(b.routes, newInstanceRoute(pattern, handler, RouteBuiltin))
+		b.Routes += 1
+	}
+	return nil
+}
+
+// authorizeAdmin wraps the handler of an admin or development endpoint, which
+// can read and change anything, so it only serves requests with
+// [Config.AdminToken], or from a loopback address if there is no token, and
+// rejects requests with side effects from other sites. Responses are never
+// cached, because the response cache serves them before this check.
+func (instance *Instance) authorizeAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, no-store")
+		if token := instance.config.AdminToken; token != "" {
+			sent, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				_, sent, _ = r.BasicAuth()
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="xtemplate admin"`)
+				instance.serveError(w, r, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+		} else if ip := instance.access.clientIP(r); !ip.IsLoopback() || (ip == peerAddr(r) && forwarded(r)) {
+			// a request forwarded by a proxy on the same host that isn't
+			// in trusted_proxies comes from loopback, but not its client
+			instance.serveError(w, r, http.StatusForbidden, "admin endpoints only accept requests from loopback addresses without an admin token")
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+			instance.serveError(w, r, http.StatusForbidden, "cross-site request rejected")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// forwarded reports whether r was forwarded by a proxy for another client.
+func forwarded(r *http.Request) bool {
+	return r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("Forwarded") != ""
+}
+
+// sameOrigin reports whether r wasn't sent by a page of another site,
+// according to the Sec-Fetch-Site or Origin headers that browsers send.
+// Requests without either, like from curl, are from the same origin.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "":
+	case "same-origin", "none":
+		return true
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// withDB calls fn with a DotDB for the request and commits or rolls back
+// depending on the error it returns.
+func (a *admin) withDB(w http.ResponseWriter, r *http.Request, fn func(db *DotDB) error) error {
+	v, err := a.db.Value(Request{DotConfig: a.db, ServerCtx: a.instance.config.Ctx, W: w, R: r})
+	if err != nil {
+		return err
+	}
+	return a.db.Cleanup(v, fn(v.(*DotDB)))
+}
+
+// page returns the page data for the table in the request path, or nil if it's
+// not a managed table.
+func (a *admin) page(r *http.Request) (*AdminPage, error) {
+	p := &AdminPage{Path: a.config.Path, Tables: a.tables}
+	table := r.PathValue("table")
+	if table == "" {
+		return p, nil
+	}
+	t, ok := a.db.Tables[table]
+	if !ok {
+		return nil, nil
+	}
+	p.Table, p.Editable, p.Key = table, t.Columns, t.key()
+	rows, err := a.db.DB.QueryContext(r.Context(), "SELECT * FROM "+table+" LIMIT 0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of table '%s': %w", table, err)
+	}
+	defer rows.Close()
+	p.Columns, err = rows.Columns()
+	return p, err
+}
+
+func (a *admin) render(w http.ResponseWriter, r *http.Request, name string, p *AdminPage) {
+	tmpl := a.instance.templates.Lookup(name)
+	ctx := context.WithValue(r.Context(), adminPageKey, p)
+	bufferingTemplateHandler(a.instance, tmpl)(w, r.WithContext(ctx))
+}
+
+func (a *admin) fail(w http.ResponseWriter, r *http.Request, err error) {
+	GetLogger(r.Context()).Warn("admin request failed", "error", err)
+	a.instance.serveError(w, r, http.StatusInternalServerError, "internal server error")
+}
+
+func (a *admin) index(w http.ResponseWriter, r *http.Request) {
+	p, _ := a.page(r)
+	a.render(w, r, "ADMIN index", p)
+}
+
+func (a *admin) list(w http.ResponseWriter, r *http.Request) {
+	p, err := a.page(r)
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	} else if p == nil {
+		a.instance.serveError(w, r, http.StatusNotFound, "table not found")
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	err = a.withDB(w, r, func(db *DotDB) (err error) {
+		p.Rows, err = db.QueryPage(fmt.Sprintf("SELECT * FROM %s ORDER BY %s", p.Table, p.Key), nil, page, a.config.PerPage)
+		return
+	})
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	a.render(w, r, "ADMIN list", p)
+}
+
+func (a *admin) form(w http.ResponseWriter, r *http.Request) {
+	p, err := a.page(r)
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	} else if p == nil {
+		a.instance.serveError(w, r, http.StatusNotFound, "table not found")
+		return
+	}
+	if id := r.PathValue("id"); id != "" {
+		var rows []map[string]any
+		err = a.withDB(w, r, func(db *DotDB) (err error) {
+			rows, err = db.QueryRows(fmt.Sprintf("SELECT * FROM %s WHERE %s = ?", p.Table, p.Key), id)
+			return
+		})
+		if err != nil {
+			a.fail(w, r, err)
+			return
+		} else if len(rows) == 0 {
+			a.instance.serveError(w, r, http.StatusNotFound, "row not found")
+			return
+		}
+		p.Row = rows[0]
+	}
+	a.render(w, r, "ADMIN form", p)
+}
+
+func (a *admin) save(w http.ResponseWriter, r *http.Request) {
+	p, err := a.page(r)
+	if err == nil && p == nil {
+		a.instance.serveError(w, r, http.StatusNotFound, "table not found")
+		return
+	}
+	if err == nil {
+		err = r.ParseForm()
+	}
+	if err == nil {
+		err = a.withDB(w, r, func(db *DotDB) (err error) {
+			if id := r.PathValue("id"); id != "" {
+				_, err = db.UpdateForm(p.Table, id, r.PostForm)
+			} else {
+				_, err = db.InsertForm(p.Table, r.PostForm)
+			}
+			return
+		})
+	}
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	http.Redirect(w, r, a.config.Path+"/"+url.PathEscape(p.Table), http.StatusSeeOther)
+}
+
+func (a *admin) delete(w http.ResponseWriter, r *http.Request) {
+	p, err := a.page(r)
+	if err == nil && p == nil {
+		a.instance.serveError(w, r, http.StatusNotFound, "table not found")
+		return
+	}
+	if err == nil {
+		err = a.withDB(w, r, func(db *DotDB) (err error) {
+			_, err = db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s = ?", p.Table, p.Key), r.PathValue("id"))
+			return
+		})
+	}
+	if err != nil {
+		a.fail(w, r, err)
+		return
+	}
+	http.Redirect(w, r, a.config.Path+"/"+url.PathEscape(p.Table), http.StatusSeeOther)
+}
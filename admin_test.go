@@ -0,0 +1,123 @@
+package xtemplate
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// adminInstance returns an instance with admin pages for a users table with
+// one row named secret-row.
+func adminInstance(t *testing.T, options ...Option) *Instance {
+	t.Helper()
+	connstr := "file:" + filepath.Join(t.TempDir(), "admin.db")
+	db, err := sql.Open("sqlite3", connstr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE users(id INTEGER PRIMARY KEY, name TEXT); INSERT INTO users(name) VALUES ('secret-row')`); err != nil {
+		t.Fatal(err)
+	}
+	return testInstance(t, fstest.MapFS{"index.html": {Data: []byte("home")}}, append([]Option{
+		func(c *Config) error {
+			c.Databases = append(c.Databases, DotDBConfig{Name: "DB", Driver: "sqlite3", Connstr: connstr, Tables: map[string]DBTableConfig{"users": {Columns: []string{"name"}}}})
+			return nil
+		},
+		WithAdmin(AdminConfig{}),
+	}, options...)...)
+}
+
+func TestAdminResponseCache(t *testing.T) {
+	instance := adminInstance(t, WithResponseCache(ResponseCacheConfig{}))
+	for _, tc := range []struct {
+		remoteAddr string
+		status     int
+	}{
+		{"127.0.0.1:1234", http.StatusOK},
+		{"203.0.113.9:1234", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+		r.RemoteAddr = tc.remoteAddr
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%s: got status %d, want %d", tc.remoteAddr, w.Code, tc.status)
+		}
+		if cache := w.Header().Get("X-Cache"); cache == "HIT" {
+			t.Errorf("%s: admin page was served from the cache", tc.remoteAddr)
+		}
+		if rows := strings.Contains(w.Body.String(), "secret-row"); rows != (tc.status == http.StatusOK) {
+			t.Errorf("%s: got the rows of the table: %t, want %t", tc.remoteAddr, rows, tc.status == http.StatusOK)
+		}
+	}
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		options    []Option
+		method     string
+		remoteAddr string
+		header     map[string]string
+		status     int
+	}{
+		{"loopback", nil, http.MethodGet, "127.0.0.1:1234", nil, http.StatusOK},
+		{"ipv6 loopback", nil, http.MethodGet, "[::1]:1234", nil, http.StatusOK},
+		{"remote", nil, http.MethodGet, "203.0.113.9:1234", nil, http.StatusForbidden},
+		// forwarded by a proxy on the same host that isn't trusted
+		{"forwarded", nil, http.MethodGet, "127.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.9"}, http.StatusForbidden},
+		{"forwarded header", nil, http.MethodGet, "127.0.0.1:1234", map[string]string{"Forwarded": "for=203.0.113.9"}, http.StatusForbidden},
+		{"trusted proxy", []Option{WithTrustedProxies("10.0.0.0/8")}, http.MethodGet, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "203.0.113.9"}, http.StatusForbidden},
+		{"token", []Option{withAdminToken("secret")}, http.MethodGet, "203.0.113.9:1234", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK},
+		{"basic auth", []Option{withAdminToken("secret")}, http.MethodGet, "203.0.113.9:1234", map[string]string{"Authorization": "Basic YWRtaW46c2VjcmV0"}, http.StatusOK},
+		{"wrong token", []Option{withAdminToken("secret")}, http.MethodGet, "203.0.113.9:1234", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		// the token is required even from loopback
+		{"missing token", []Option{withAdminToken("secret")}, http.MethodGet, "127.0.0.1:1234", nil, http.StatusUnauthorized},
+		{"same origin post", nil, http.MethodPost, "127.0.0.1:1234", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusSeeOther},
+		{"cross-site post", nil, http.MethodPost, "127.0.0.1:1234", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"foreign origin post", nil, http.MethodPost, "127.0.0.1:1234", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"cross-site post with token", []Option{withAdminToken("secret")}, http.MethodPost, "127.0.0.1:1234", map[string]string{"Authorization": "Bearer secret", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			instance := adminInstance(t, tc.options...)
+			r := httptest.NewRequest(tc.method, "/admin/users", strings.NewReader("name=new-row"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.RemoteAddr = tc.remoteAddr
+			for k, v := range tc.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			instance.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdminServeRequiresToken(t *testing.T) {
+	server, err := New().Server(WithTemplateFS(fstest.MapFS{"index.html": {Data: []byte("home")}}), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), func(c *Config) error {
+		c.RenderDiffPath = "/_diff"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve("0.0.0.0:0"); err == nil || !strings.Contains(err.Error(), "admin token") {
+		t.Errorf("got %v, want an error that asks for an admin token", err)
+	}
+}
+
+func withAdminToken(token string) Option {
+	return func(c *Config) error {
+		c.AdminToken = token
+		return nil
+	}
+}
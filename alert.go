@@ -0,0 +1,180 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrorRateAlert configures basic alerting on the rate of 4xx/5xx responses
+// per route. Each route's responses are counted in a sliding window, and when
+// the fraction of error responses crosses Threshold the Callback is invoked
+// and/or an [ErrorRateEvent] is POSTed as json to WebhookURL. An alert fires
+// once when the threshold is crossed and is re-armed after the rate falls back
+// below the threshold.
+type ErrorRateAlert struct {
+	// Length of the sliding window, at least 1 second. Default 1 minute.
+	Window time.Duration `json:"window,omitempty"`
+
+	// Minimum number of requests to a route in the window before it can
+	// alert. Default 10.
+	MinRequests int `json:"min_requests,omitempty"`
+
+	// Fraction of error responses in the window that triggers an alert.
+	// Default 0.5.
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// Count 4xx responses as errors in addition to 5xx. Default false.
+	ClientErrors bool `json:"client_errors,omitempty"`
+
+	// If set, events are POSTed as json to this url.
+	WebhookURL string `json:"webhook_url,omitempty"`
+
+	// If set, called with each event. Must not block.
+	Callback func(ErrorRateEvent) `json:"-"`
+}
+
+// ErrorRateEvent describes a route whose error rate crossed the configured
+// threshold.
+type ErrorRateEvent struct {
+	Instance int64         `json:"instance"`
+	Route    string        `json:"route"`
+	Window   time.Duration `json:"window"`
+	Requests int           `json:"requests"`
+	Errors   int           `json:"errors"`
+	Rate     float64       `json:"rate"`
+	Time     time.Time     `json:"time"`
+}
+
+func WithErrorRateAlert(alert ErrorRateAlert) Option {
+	return func(c *Config) error {
+		c.ErrorAlert = &alert
+		return nil
+	}
+}
+
+const errorRateBuckets = 10
+
+type errorRateTracker struct {
+	config   ErrorRateAlert
+	instance int64
+	log      *slog.Logger
+	client   *http.Client
+
+	mutex  sync.Mutex
+	routes map[string]*routeErrorRate
+}
+
+type routeErrorRate struct {
+	requests, errors [errorRateBuckets]int
+	bucket           int64
+	alerting         bool
+}
+
+func newErrorRateTracker(config ErrorRateAlert, instance int64, log *slog.Logger) (*errorRateTracker, error) {
+	if config.Window == 0 {
+		config.Window = time.Minute
+	}
+	if config.Window < time.Second {
+		return nil, fmt.Errorf("invalid error alert window %v, expected at least 1s", config.Window)
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 0.5
+	}
+	return &errorRateTracker{
+		config:   config,
+		instance: instance,
+		log:      log.WithGroup("error_alert"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		routes:   make(map[string]*routeErrorRate),
+	}, nil
+}
+
+func (t *errorRateTracker) observe(route string, status int, now time.Time) {
+	isError := status >= 500 || (t.config.ClientErrors && status >= 400)
+	bucket := now.UnixNano() / int64(t.config.Window/errorRateBuckets)
+
+	t.mutex.Lock()
+	rate, ok := t.routes[route]
+	if !ok {
+		rate = &routeErrorRate{bucket: bucket}
+		t.routes[route] = rate
+	}
+	// clear buckets that fell out of the window since the last observation
+	for b := rate.bucket + 1; b <= bucket && b <= rate.bucket+errorRateBuckets; b++ {
+		rate.requests[b%errorRateBuckets] = 0
+		rate.errors[b%errorRateBuckets] = 0
+	}
+	if bucket > rate.bucket {
+		rate.bucket = bucket
+	}
+	rate.requests[bucket%errorRateBuckets] += 1
+	if isError {
+		rate.errors[bucket%errorRateBuckets] += 1
+	}
+	var requests, errors int
+	for i := range errorRateBuckets {
+		requests += rate.requests[i]
+		errors += rate.errors[i]
+	}
+	ratio := float64(errors) / float64(requests)
+	fire := false
+	if requests >= t.config.MinRequests && ratio >= t.config.Threshold {
+		fire = !rate.alerting
+		rate.alerting = true
+	} else if ratio < t.config.Threshold {
+		rate.alerting = false
+	}
+	t.mutex.Unlock()
+
+	if fire {
+		t.fire(ErrorRateEvent{
+			Instance: t.instance,
+			Route:    route,
+			Window:   t.config.Window,
+			Requests: requests,
+			Errors:   errors,
+			Rate:     ratio,
+			Time:     now,
+		})
+	}
+}
+
+func (t *errorRateTracker) fire(event ErrorRateEvent) {
+	t.log.Warn("error rate threshold exceeded", slog.String("route", event.Route), slog.Int("requests", event.Requests), slog.Int("errors", event.Errors), slog.Float64("rate", event.Rate))
+	if t.config.Callback != nil {
+		t.config.Callback(event)
+	}
+	if t.config.WebhookURL != "" {
+		go func() {
+			body, err := json.Marshal(event)
+			if err != nil {
+				t.log.Error("failed to encode error rate event", slog.Any("error", err))
+				return
+			}
+			req, err := http.NewRequestWithContext(context.Background(), "POST", t.config.WebhookURL, bytes.NewReader(body))
+			if err != nil {
+				t.log.Error("failed to create error rate webhook request", slog.Any("error", err))
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := t.client.Do(req)
+			if err != nil {
+				t.log.Error("failed to send error rate webhook", slog.Any("error", err))
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				t.log.Warn("error rate webhook returned non-success status", slog.Int("status", resp.StatusCode))
+			}
+		}()
+	}
+}
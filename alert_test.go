@@ -0,0 +1,27 @@
+package xtemplate
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestErrorRateAlertWindow(t *testing.T) {
+	templates := fstest.MapFS{"index.html": {Data: []byte("home")}}
+	for _, tc := range []struct {
+		window time.Duration
+		valid  bool
+	}{
+		{0, true},
+		{time.Second, true},
+		{5 * time.Nanosecond, false},
+		{-time.Minute, false},
+	} {
+		_, _, _, err := New().Instance(WithTemplateFS(templates), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), WithErrorRateAlert(ErrorRateAlert{Window: tc.window}))
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("window %v: got error %v, want valid %v", tc.window, err, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package xtemplate
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// pageAlternate is another representation of a page, see
+// [DotReq.AlternateLinks].
+type pageAlternate struct {
+	path        string
+	contentType string
+	media       string
+	handler     http.Handler
+}
+
+// addAlternates links the template files with an `alternate` front matter
+// key to their pages.
+func (b *builder) addAlternates() error {
+	for _, alt := range b.pages {
+		v, ok := alt.meta["alternate"]
+		if !ok {
+			continue
+		}
+		var of string
+		switch v := v.(type) {
+		case bool:
+			if !v {
+				continue
+			}
+			of = strings.TrimSuffix(alt.routePath, path.Ext(alt.routePath))
+			if path.Base(of) == "index" {
+				of = path.Dir(of)
+			}
+		case string:
+			of = path.Clean("/" + v)
+		default:
+			return fmt.Errorf("invalid alternate in metadata of template file '%s': '%v'", alt.templatePath, v)
+		}
+		if of == alt.routePath || !slices.ContainsFunc(b.pages, func(p pageInfo) bool { return p.routePath == of }) {
+			return fmt.Errorf("template file '%s' is an alternate of '%s', which is not a page", alt.templatePath, of)
+		}
+		contentType, _ := alt.meta["content_type"].(string)
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("alternate template file '%s' needs a valid content_type in its metadata: '%s'", alt.templatePath, contentType)
+		}
+		i := slices.IndexFunc(b.routes, func(r InstanceRoute) bool { return r.Pattern == "GET "+alt.routePath })
+		if b.alternates == nil {
+			b.alternates = map[string][]pageAlternate{}
+		}
+		b.alternates[of] = append(b.alternates[of], pageAlternate{
+			path:        alt.routePath,
+			contentType: contentType,
+			media:       cast.ToString(alt.meta["media"]),
+			handler:     b.routes[i].Handler,
+		})
+	}
+	return nil
+}
+
+// withAlternates links the responses of the page at routePath to its
+// alternates, and serves an alternate instead if the request prefers it.
+func withAlternates(instance *Instance, handler http.HandlerFunc, routePath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alts := instance.alternates[routePath]
+		if len(alts) == 0 {
+			handler(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept")
+		for _, alt := range alts {
+			link := fmt.Sprintf(`<%s>; rel="alternate"; type="%s"`, alt.path, alt.contentType)
+			if alt.media != "" {
+				link += fmt.Sprintf(`; media="%s"`, alt.media)
+			}
+			w.Header().Add("Link", link)
+		}
+		if alt := negotiateAlternate(r.Header.Values("Accept"), alts); alt != nil {
+			alt.handler.ServeHTTP(w, r)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// withContentType sets the Content-Type of responses of an alternate to the
+// type in its metadata, unless the template sets another.
+func withContentType(handler http.HandlerFunc, contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		handler(w, r)
+	}
+}
+
+// negotiateAlternate returns the alternate whose content type the Accept
+// headers list explicitly with a higher quality than html, or nil to serve
+// the page. Wildcards only match the page, so browsers always get html.
+func negotiateAlternate(acceptHeaders []string, alts []pageAlternate) *pageAlternate {
+	pageq, best, bestq := 0.0, -1, 0.0
+	for _, header := range acceptHeaders {
+		for _, accepted := range strings.Split(header, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+			if err != nil {
+				continue
+			}
+			q := 1.0
+			if v, ok := params["q"]; ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+			switch mediaType {
+			case "text/html", "text/*", "*/*":
+				pageq = math.Max(pageq, q)
+				continue
+			}
+			for i, alt := range alts {
+				if t, _, _ := mime.ParseMediaType(alt.contentType); t == mediaType && q > bestq {
+					best, bestq = i, q
+				}
+			}
+		}
+	}
+	if best < 0 || bestq <= pageq {
+		return nil
+	}
+	return &alts[best]
+}
+
+// AlternateLinks returns link elements for the alternates of the page that
+// handles the request, to add to the html head:
+//
+//	<head>{{.Req.AlternateLinks}}</head>
+//
+// Alternates are other representations of a page, like its markdown source
+// or a print version, served by template files with an `alternate` front
+// matter key:
+//
+//	---
+//	alternate: true
+//	content_type: text/markdown; charset=utf-8
+//	---
+//
+// The template file `docs/intro.md.html` is routed at `/docs/intro.md`, and
+// with `alternate: true` it's an alternate of the page at the same path
+// without the extension, `/docs/intro`. Set `alternate` to the path of the
+// page instead for variants at other paths, like `alternate: /docs/intro` in
+// `docs/intro/print.html`, and `media: print` to describe who it's for.
+//
+// The content_type of an alternate is sent as its Content-Type, and it isn't
+// minified unless it's html. Responses of the page link to its alternates
+// with a `Link` header.
+// Requests for the page that prefer the content type of an alternate over
+// html in their Accept header are served the alternate, so `curl -H 'Accept:
+// text/markdown' /docs/intro` gets the markdown.
+func (d DotReq) AlternateLinks() template.HTML {
+	if d.instance == nil {
+		return ""
+	}
+	pattern := d.Pattern()
+	var b strings.Builder
+	for _, alt := range d.instance.alternates[strings.TrimPrefix(pattern, "GET ")] {
+		fmt.Fprintf(&b, `<link rel="alternate" type="%s" href="%s"`, template.HTMLEscapeString(alt.contentType), template.HTMLEscapeString(alt.path))
+		if alt.media != "" {
+			fmt.Fprintf(&b, ` media="%s"`, template.HTMLEscapeString(alt.media))
+		}
+		b.WriteString(">")
+	}
+	return template.HTML(b.String())
+}
@@ -0,0 +1,344 @@
+package xtemplate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// APIKeysConfig requires requests to some paths, like the JSON APIs built with
+// templates, to have an API key, and limits how many requests each key makes
+// per Window. Keys are sent as `Authorization: Bearer <key>` or in Header.
+// Requests without a valid key are rejected with 401 Unauthorized, and
+// requests over the quota of their key with 429 Too Many Requests.
+// Responses have the `RateLimit-Limit`, `RateLimit-Remaining`, and
+// `RateLimit-Reset` headers, and templates read the usage of the key with
+// .Req.APIKey, see [DotReq.APIKey].
+//
+// Keys are stored by their hex sha-256 hash, so a leak of the table doesn't
+// leak the keys, in a table of a database provider with the columns
+// `key_hash`, `name`, and `quota`, which is NULL for the default Quota:
+//
+//	INSERT INTO api_keys (key_hash, name, quota) VALUES ('<sha256 of key>', 'partner', 5000);
+//
+// If Nats is set they're stored in a key value bucket of that nats provider
+// instead, at `key.<sha256 of key>` with a JSON value like
+// `{"name": "partner", "quota": 5000}`. Usage is counted in the same storage,
+// so instances that share it share quotas.
+type APIKeysConfig struct {
+	// Globs like in [AccessRule] of the paths that require a key. Default all
+	// paths.
+	Paths []string `json:"paths,omitempty"`
+
+	// Name of the request header that holds the key if the Authorization
+	// header doesn't. Default `X-API-Key`.
+	Header string `json:"header,omitempty"`
+
+	// Requests per Window of keys without their own quota. Default 1000.
+	Quota int64 `json:"quota,omitempty"`
+
+	// Length of the windows that quotas apply to. Default 1h.
+	Window time.Duration `json:"window,omitempty"`
+
+	// Name of the database provider that stores keys and usage. Defaults to
+	// the first database.
+	Database string `json:"database,omitempty"`
+
+	// Name of the table that stores keys, which is created if it doesn't
+	// exist. Usage is stored in a table of the same name with a `_usage`
+	// suffix. Default `api_keys`.
+	Table string `json:"table,omitempty"`
+
+	// Name of a nats provider whose key value bucket stores keys and usage
+	// instead of the database.
+	Nats string `json:"nats,omitempty"`
+
+	// Name of the key value bucket. Default `xtemplate_api_keys`.
+	Bucket string `json:"bucket,omitempty"`
+}
+
+func WithAPIKeys(config APIKeysConfig) Option {
+	return func(c *Config) error {
+		c.APIKeys = &config
+		return nil
+	}
+}
+
+// APIKeyUsage is the usage of the API key of a request in the current window,
+// after the request was counted. See [DotReq.APIKey].
+type APIKeyUsage struct {
+	Name      string
+	Quota     int64
+	Used      int64
+	Remaining int64
+	// When the window ends and the usage is reset.
+	Reset time.Time
+}
+
+type apiKeys struct {
+	config APIKeysConfig
+	db     *DotDBConfig
+	kv     jetstream.KeyValue
+}
+
+type apiKeyRecord struct {
+	Name  string `json:"name"`
+	Quota *int64 `json:"quota,omitempty"`
+}
+
+// addAPIKeys connects the API keys to the configured database or nats
+// provider, which must already be initialized, and removes the usage of past
+// windows every hour until the instance is retired.
+func (b *builder) addAPIKeys(dot []DotConfig) error {
+	k := &apiKeys{config: *b.config.APIKeys}
+	if k.config.Header == "" {
+		k.config.Header = "X-API-Key"
+	}
+	if k.config.Quota <= 0 {
+		k.config.Quota = 1000
+	}
+	if k.config.Window <= 0 {
+		k.config.Window = time.Hour
+	}
+	if k.config.Table == "" {
+		k.config.Table = "api_keys"
+	}
+	if k.config.Bucket == "" {
+		k.config.Bucket = "xtemplate_api_keys"
+	}
+	if k.config.Nats != "" {
+		i := slices.IndexFunc(dot, func(d DotConfig) bool {
+			n, ok := d.(*DotNatsConfig)
+			return ok && n.Name == k.config.Nats
+		})
+		if i < 0 {
+			return fmt.Errorf("api keys nats provider not found: '%s'", k.config.Nats)
+		}
+		kv, err := dot[i].(*DotNatsConfig).js.CreateOrUpdateKeyValue(b.config.Ctx, jetstream.KeyValueConfig{Bucket: k.config.Bucket})
+		if err != nil {
+			return fmt.Errorf("failed to create api keys bucket '%s': %w", k.config.Bucket, err)
+		}
+		k.kv = kv
+	} else {
+		k.db = findDotDB(dot, k.config.Database)
+		if k.db == nil {
+			return fmt.Errorf("api keys database provider not found: '%s'", k.config.Database)
+		}
+		if !sqlIdentifier.MatchString(k.config.Table) {
+			return fmt.Errorf("invalid api keys table name: '%s'", k.config.Table)
+		}
+		for _, stmt := range []string{`CREATE TABLE IF NOT EXISTS %s (
+			key_hash TEXT NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			quota INTEGER
+		)`, `CREATE TABLE IF NOT EXISTS %s_usage (
+			key_hash TEXT NOT NULL,
+			window_start INTEGER NOT NULL,
+			count INTEGER NOT NULL,
+			PRIMARY KEY (key_hash, window_start)
+		)`} {
+			if _, err := k.db.DB.ExecContext(b.config.Ctx, fmt.Sprintf(stmt, k.config.Table)); err != nil {
+				return fmt.Errorf("failed to create api keys tables: %w", err)
+			}
+		}
+	}
+	go k.expire(b.config.Ctx, b.config.Logger)
+	b.apiKeys = k
+	return nil
+}
+
+func (k *apiKeys) expire(ctx context.Context, log *slog.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		start := time.Now().Truncate(k.config.Window).Unix()
+		if k.kv != nil {
+			k.expireKV(ctx, start, log)
+			continue
+		}
+		if _, err := k.db.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s_usage WHERE window_start < ?", k.config.Table), start); err != nil {
+			log.Warn("failed to delete usage of past api key windows", slog.Any("error", err))
+		}
+	}
+}
+
+// expireKV deletes the usage keys of windows that started before start.
+func (k *apiKeys) expireKV(ctx context.Context, start int64, log *slog.Logger) {
+	lister, err := k.kv.ListKeys(ctx)
+	if err != nil {
+		log.Warn("failed to list api key usage", slog.Any("error", err))
+		return
+	}
+	defer lister.Stop()
+	for name := range lister.Keys() {
+		rest, ok := strings.CutPrefix(name, "usage.")
+		if !ok {
+			continue
+		}
+		_, window, _ := strings.Cut(rest, ".")
+		if w, err := strconv.ParseInt(window, 10, 64); err == nil && w < start {
+			if err := k.kv.Delete(ctx, name); err != nil {
+				log.Warn("failed to delete usage of past api key window", slog.String("key", name), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// wrap checks the API key of requests to the configured paths and counts
+// them against its quota before passing them to next.
+func (k *apiKeys) wrap(instance *Instance, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(k.config.Paths) > 0 && !slices.ContainsFunc(k.config.Paths, func(glob string) bool { return matchPath(glob, rulePath(r)) }) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := r.Header.Get(k.config.Header)
+		if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+			key = token
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			instance.serveError(w, r, http.StatusUnauthorized, "api key required")
+			return
+		}
+		sum := sha256.Sum256([]byte(key))
+		hash := hex.EncodeToString(sum[:])
+		ctx := r.Context()
+		log := GetLogger(ctx)
+
+		record, err := k.lookup(ctx, hash)
+		if err != nil {
+			log.Error("failed to look up api key", slog.Any("error", err))
+			instance.serveError(w, r, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		if record == nil {
+			log.Info("request with unknown api key")
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			instance.serveError(w, r, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+
+		now := time.Now()
+		window := now.Truncate(k.config.Window)
+		used, err := k.incr(ctx, hash, window)
+		if err != nil {
+			log.Error("failed to count api key usage", slog.String("api_key", record.Name), slog.Any("error", err))
+			instance.serveError(w, r, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		usage := &APIKeyUsage{Name: record.Name, Quota: k.config.Quota, Used: used, Reset: window.Add(k.config.Window)}
+		if record.Quota != nil {
+			usage.Quota = *record.Quota
+		}
+		usage.Remaining = max(usage.Quota-used, 0)
+
+		reset := strconv.Itoa(int(usage.Reset.Sub(now).Seconds() + 0.5))
+		w.Header().Set("RateLimit-Limit", strconv.FormatInt(usage.Quota, 10))
+		w.Header().Set("RateLimit-Remaining", strconv.FormatInt(usage.Remaining, 10))
+		w.Header().Set("RateLimit-Reset", reset)
+		if used > usage.Quota {
+			log.Info("api key is over its quota", slog.String("api_key", record.Name), slog.Int64("quota", usage.Quota))
+			w.Header().Set("Retry-After", reset)
+			instance.serveError(w, r, http.StatusTooManyRequests, "api key quota exceeded")
+			return
+		}
+		log = log.With(slog.String("api_key", record.Name))
+		ctx = context.WithValue(context.WithValue(ctx, loggerKey, log), apiKeyUsageKey, usage)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// lookup returns the key with the hash, or nil if there is none.
+func (k *apiKeys) lookup(ctx context.Context, hash string) (*apiKeyRecord, error) {
+	record := &apiKeyRecord{}
+	if k.kv != nil {
+		entry, err := k.kv.Get(ctx, "key."+hash)
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(entry.Value(), record); err != nil {
+			return nil, fmt.Errorf("invalid api key value: %w", err)
+		}
+		return record, nil
+	}
+	var quota sql.NullInt64
+	err := k.db.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT name, quota FROM %s WHERE key_hash = ?", k.config.Table), hash).Scan(&record.Name, &quota)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if quota.Valid {
+		record.Quota = &quota.Int64
+	}
+	return record, nil
+}
+
+// incr counts a request of the key with hash in window and returns the count
+// of the window.
+func (k *apiKeys) incr(ctx context.Context, hash string, window time.Time) (int64, error) {
+	var count int64
+	if k.kv != nil {
+		// retry if another instance counts a request of the key concurrently
+		name := fmt.Sprintf("usage.%s.%d", hash, window.Unix())
+		var err error
+		for range 5 {
+			var entry jetstream.KeyValueEntry
+			entry, err = k.kv.Get(ctx, name)
+			if errors.Is(err, jetstream.ErrKeyNotFound) {
+				if _, err = k.kv.Create(ctx, name, []byte("1")); err == nil {
+					return 1, nil
+				}
+				continue
+			} else if err != nil {
+				return 0, err
+			}
+			if count, err = strconv.ParseInt(string(entry.Value()), 10, 64); err != nil {
+				return 0, fmt.Errorf("invalid usage value: %w", err)
+			}
+			count++
+			if _, err = k.kv.Update(ctx, name, []byte(strconv.FormatInt(count, 10)), entry.Revision()); err == nil {
+				return count, nil
+			}
+		}
+		return 0, err
+	}
+	err := k.db.DB.QueryRowContext(ctx, fmt.Sprintf(`INSERT INTO %s_usage (key_hash, window_start, count) VALUES (?, ?, 1)
+		ON CONFLICT (key_hash, window_start) DO UPDATE SET count = count + 1
+		RETURNING count`, k.config.Table), hash, window.Unix()).Scan(&count)
+	return count, err
+}
+
+type apiKeyUsageKeyType struct{}
+
+var apiKeyUsageKey = apiKeyUsageKeyType{}
+
+// APIKey returns the usage of the API key that the request was made with, or
+// nil if the path doesn't require a key. See [APIKeysConfig].
+//
+//	{{with .Req.APIKey}}{"client": "{{.Name}}", "remaining": {{.Remaining}}}{{end}}
+func (d DotReq) APIKey() *APIKeyUsage {
+	usage, _ := d.Context().Value(apiKeyUsageKey).(*APIKeyUsage)
+	return usage
+}
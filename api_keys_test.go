@@ -0,0 +1,52 @@
+package xtemplate
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAPIKeysResponseCache(t *testing.T) {
+	connstr := "file:" + filepath.Join(t.TempDir(), "keys.db")
+	instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte(`{{.Req.APIKey.Name}}`)}},
+		func(c *Config) error {
+			c.Databases = append(c.Databases, DotDBConfig{Name: "DB", Driver: "sqlite3", Connstr: connstr})
+			return nil
+		},
+		WithAPIKeys(APIKeysConfig{}),
+		WithResponseCache(ResponseCacheConfig{}),
+	)
+	db, err := sql.Open("sqlite3", connstr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, name := range []string{"alice", "bob"} {
+		sum := sha256.Sum256([]byte(name + "-key"))
+		if _, err := db.Exec(`INSERT INTO api_keys (key_hash, name) VALUES (?, ?)`, hex.EncodeToString(sum[:]), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"alice", "bob", "alice"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-API-Key", name+"-key")
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, r)
+		if body := strings.TrimSpace(w.Body.String()); body != name {
+			t.Errorf("got %q for the key of %s, want the page rendered for the key", body, name)
+		}
+		if cache := w.Header().Get("X-Cache"); cache != "" {
+			t.Errorf("got X-Cache %q for the key of %s, want requests with api keys to bypass the cache", cache, name)
+		}
+		if w.Header().Get("RateLimit-Remaining") == "" {
+			t.Errorf("missing the RateLimit-Remaining of the key of %s", name)
+		}
+	}
+}
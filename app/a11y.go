@@ -0,0 +1,35 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/infogulch/xtemplate"
+)
+
+// A11yCmd is the `xtemplate a11y` subcommand which renders every GET page of
+// the site and reports common accessibility problems.
+type A11yCmd struct {
+	JSON bool `arg:"--json" help:"print issues as json"`
+}
+
+// Run audits the pages of instance, see [xtemplate.AuditAccessibility].
+func (c *A11yCmd) Run(instance *xtemplate.Instance) []xtemplate.A11yIssue {
+	return xtemplate.AuditAccessibility(instance)
+}
+
+// print writes the issues to w.
+func (c *A11yCmd) print(w io.Writer, issues []xtemplate.A11yIssue) {
+	if c.JSON {
+		if issues == nil {
+			issues = []xtemplate.A11yIssue{}
+		}
+		json.NewEncoder(w).Encode(issues)
+		return
+	}
+	for _, i := range issues {
+		fmt.Fprintf(w, "%s (%s) line %d: [%s] %s\n", i.Template, i.Page, i.Line, i.Rule, i.Message)
+	}
+	fmt.Fprintf(w, "%d accessibility issues\n", len(issues))
+}
@@ -2,9 +2,13 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/infogulch/xtemplate"
@@ -21,6 +25,15 @@ type Args struct {
 	LogLevel       int      `json:"log_level" default:"-2"`
 	Configs        []string `json:"-" arg:"-c,--config,separate"`
 	ConfigFiles    []string `json:"-" arg:"-f,--config-file,separate"`
+
+	New         *NewCmd         `json:"-" arg:"subcommand:new" help:"write a new starter site into a directory"`
+	Diff        *DiffCmd        `json:"-" arg:"subcommand:diff" help:"report route and template changes between two sites, exits 1 if they differ"`
+	Bench       *BenchCmd       `json:"-" arg:"subcommand:bench" help:"execute a route in-process and report latency and allocations"`
+	Links       *LinksCmd       `json:"-" arg:"subcommand:links" help:"render every page and report broken internal links, exits 1 if any are found"`
+	A11y        *A11yCmd        `json:"-" arg:"subcommand:a11y" help:"render every page and report common accessibility issues, exits 1 if any are found"`
+	SelfTest    *SelfTestCmd    `json:"-" arg:"subcommand:selftest" help:"render every page and report the pages that fail, exits 1 if any do"`
+	Repl        *ReplCmd        `json:"-" arg:"subcommand:repl" help:"evaluate template pipelines interactively against the dot of a route"`
+	PreviewLink *PreviewLinkCmd `json:"-" arg:"subcommand:preview-link" help:"print a signed link that shows unpublished content until it expires"`
 }
 
 var version = "development"
@@ -29,6 +42,17 @@ func (Args) Version() string {
 	return version
 }
 
+// mustParseArgs parses the command line into args. Options after a subcommand
+// belong to the subcommand, so `bench -c 8` isn't read as `--config`.
+func mustParseArgs(args *Args) {
+	p, err := arg.NewParser(arg.Config{StrictSubcommands: true}, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(-1)
+	}
+	p.MustParse(os.Args[1:])
+}
+
 var defaultWatchTemplates = "true"
 var defaultListenAddress = "0.0.0.0:8080"
 var defaultArgs = Args{WatchTemplates: defaultWatchTemplates == "true", Listen: defaultListenAddress}
@@ -41,66 +65,166 @@ var defaultArgs = Args{WatchTemplates: defaultWatchTemplates == "true", Listen:
 func Main(overrides ...xtemplate.Option) {
 	var config Args = defaultArgs
 	var log *slog.Logger
+	var level slog.LevelVar
 
 	{
-		arg.MustParse(&config)
+		mustParseArgs(&config)
 		config.Defaults()
 
-		level := config.LogLevel
-		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.Level(level)}))
-
-		var jsonConfig Args = defaultArgs
-		var decoded bool
-		for _, name := range config.ConfigFiles {
-			func() {
-				file, err := os.OpenFile(name, os.O_RDONLY, 0)
-				if err != nil {
-					log.Error("failed to open config file '%s': %w", name, err)
-					os.Exit(1)
-				}
-				defer file.Close()
-				err = json.NewDecoder(file).Decode(&jsonConfig)
-				if err != nil {
-					log.Error("failed to decode args from json file", slog.String("filename", name), slog.Any("error", err))
-					os.Exit(1)
-				}
-				decoded = true
-				log.Debug("incorporated json file", slog.String("filename", name), slog.Any("config", &jsonConfig))
-			}() // use func to close file on every iteration
-		}
-
-		for _, conf := range config.Configs {
-			err := json.NewDecoder(bytes.NewBuffer([]byte(conf))).Decode(&jsonConfig)
+		if config.New != nil {
+			written, err := config.New.Run()
+			for _, name := range written {
+				fmt.Println("created", name)
+			}
 			if err != nil {
-				log.Error("failed to decode arg from json flag", slog.Any("error", err))
+				fmt.Fprintln(os.Stderr, "error:", err)
 				os.Exit(1)
 			}
-			decoded = true
-			log.Debug("incorporated json value", slog.String("json_string", conf), slog.Any("config", &jsonConfig))
+			os.Exit(0)
 		}
 
+		if config.Diff != nil {
+			diff, err := config.Diff.Run(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(2)
+			}
+			if config.Diff.JSON {
+				json.NewEncoder(os.Stdout).Encode(diff)
+			} else {
+				fmt.Print(diff)
+			}
+			if !diff.Empty() {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
+		level.Set(slog.Level(config.LogLevel))
+		log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: &level}))
+
+		jsonConfig, decoded, err := decodeConfigs(config.ConfigFiles, config.Configs, log)
+		if err != nil {
+			log.Error("failed to load config", slog.Any("error", err))
+			os.Exit(1)
+		}
 		if decoded {
-			arg.MustParse(&jsonConfig)
+			mustParseArgs(&jsonConfig)
 			config = jsonConfig
 		}
 
-		if config.LogLevel != level {
-			log = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.Level(config.LogLevel)}))
-		}
+		level.Set(slog.Level(config.LogLevel))
 
 		config.Logger = log
 
 		log.Debug("loaded configuration", slog.Any("config", &config))
 	}
 
+	if config.PreviewLink != nil {
+		link, err := config.PreviewLink.Run(&config.Config)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		fmt.Println(link)
+		os.Exit(0)
+	}
+
+	if config.Bench != nil {
+		instance, _, _, err := config.Instance(overrides...)
+		if err != nil {
+			log.Error("failed to load xtemplate", slog.Any("error", err))
+			os.Exit(2)
+		}
+		result, err := config.Bench.Run(instance)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		result.Print(os.Stdout)
+		os.Exit(0)
+	}
+
+	if config.Links != nil {
+		instance, _, _, err := config.Instance(overrides...)
+		if err != nil {
+			log.Error("failed to load xtemplate", slog.Any("error", err))
+			os.Exit(2)
+		}
+		broken := config.Links.Run(instance)
+		config.Links.print(os.Stdout, broken)
+		if len(broken) > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if config.A11y != nil {
+		instance, _, _, err := config.Instance(overrides...)
+		if err != nil {
+			log.Error("failed to load xtemplate", slog.Any("error", err))
+			os.Exit(2)
+		}
+		issues := config.A11y.Run(instance)
+		config.A11y.print(os.Stdout, issues)
+		if len(issues) > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if config.SelfTest != nil {
+		instance, _, _, err := config.Instance(overrides...)
+		if err != nil {
+			log.Error("failed to load xtemplate", slog.Any("error", err))
+			os.Exit(2)
+		}
+		report := config.SelfTest.Run(instance, config.BuildWorkers)
+		config.SelfTest.print(os.Stdout, report)
+		if len(report.Failures) > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if config.Repl != nil {
+		instance, _, _, err := config.Instance(overrides...)
+		if err != nil {
+			log.Error("failed to load xtemplate", slog.Any("error", err))
+			os.Exit(2)
+		}
+		if err := config.Repl.Run(instance, config.LDelim, config.RDelim, os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// the dev proxy is only for development, which is when files are watched
+	if len(config.DevProxy) > 0 && !config.WatchTemplates && len(config.Watch) == 0 {
+		log.Error("dev_proxy requires watch_templates or watch_dirs, it's not intended for production")
+		os.Exit(2)
+	}
+
 	server, err := config.Server(overrides...)
 	if err != nil {
 		log.Error("failed to load xtemplate", slog.Any("error", err))
 		os.Exit(2)
 	}
 
-	if config.WatchTemplates && config.TemplatesFS == nil {
-		config.Watch = append(config.Watch, config.TemplatesDir)
+	if config.TemplatesDB != nil {
+		err := xtemplate.WatchTemplatesDB(context.Background(), *config.TemplatesDB, log.WithGroup("dbwatch"), func() { server.Reload() })
+		if err != nil {
+			log.Info("failed to watch templates database", slog.Any("error", err))
+			os.Exit(4)
+		}
+	}
+	if config.WatchTemplates && config.TemplatesFS == nil && config.TemplatesArchive == "" && config.TemplatesDB == nil {
+		// With --starter, the starter site is served if the templates dir
+		// doesn't exist
+		if _, err := os.Stat(config.TemplatesDir); err == nil {
+			config.Watch = append(config.Watch, config.TemplatesDir)
+		}
 	}
 	if len(config.Watch) != 0 {
 		_, err := watch.Watch(config.Watch, 200*time.Millisecond, log.WithGroup("fswatch"), func() bool {
@@ -113,5 +237,63 @@ func Main(overrides ...xtemplate.Option) {
 		}
 	}
 
+	go applyOnHangup(server, config.ConfigFiles, config.Configs, &level, log.WithGroup("sighup"))
+
 	log.Info("server stopped", slog.Any("exit", server.Serve(config.Listen)))
 }
+
+// decodeConfigs decodes the json config files and then the json values into
+// the default args, and reports whether there were any.
+func decodeConfigs(files, values []string, log *slog.Logger) (Args, bool, error) {
+	var jsonConfig Args = defaultArgs
+	var decoded bool
+	for _, name := range files {
+		err := func() error {
+			file, err := os.OpenFile(name, os.O_RDONLY, 0)
+			if err != nil {
+				return fmt.Errorf("failed to open config file '%s': %w", name, err)
+			}
+			defer file.Close()
+			if err := json.NewDecoder(file).Decode(&jsonConfig); err != nil {
+				return fmt.Errorf("failed to decode args from json file '%s': %w", name, err)
+			}
+			return nil
+		}() // use func to close file on every iteration
+		if err != nil {
+			return jsonConfig, false, err
+		}
+		decoded = true
+		log.Debug("incorporated json file", slog.String("filename", name), slog.Any("config", &jsonConfig))
+	}
+
+	for _, conf := range values {
+		if err := json.NewDecoder(bytes.NewBuffer([]byte(conf))).Decode(&jsonConfig); err != nil {
+			return jsonConfig, false, fmt.Errorf("failed to decode arg from json flag: %w", err)
+		}
+		decoded = true
+		log.Debug("incorporated json value", slog.String("json_string", conf), slog.Any("config", &jsonConfig))
+	}
+	return jsonConfig, decoded, nil
+}
+
+// applyOnHangup decodes the config files again on SIGHUP and applies the log
+// level and the [xtemplate.Settings] to the running server without a rebuild.
+// Other changes to the config files take effect on restart.
+func applyOnHangup(server *xtemplate.Server, files, values []string, level *slog.LevelVar, log *slog.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		config, _, err := decodeConfigs(files, values, log)
+		if err != nil {
+			log.Error("failed to reload config", slog.Any("error", err))
+			continue
+		}
+		mustParseArgs(&config)
+		level.Set(slog.Level(config.LogLevel))
+		if err := server.Apply(config.Settings()); err != nil {
+			log.Error("failed to apply settings", slog.Any("error", err))
+			continue
+		}
+		log.Info("applied config", slog.Int("log_level", config.LogLevel))
+	}
+}
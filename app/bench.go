@@ -0,0 +1,107 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/infogulch/xtemplate"
+)
+
+// BenchCmd is the `xtemplate bench` subcommand which executes a route
+// in-process, without a network listener, and reports latency percentiles and
+// allocations.
+type BenchCmd struct {
+	Path        string `arg:"positional,required" help:"url path and query to request"`
+	Method      string `arg:"-X" default:"GET" help:"request method"`
+	Requests    int    `arg:"-n" default:"1000" help:"number of requests"`
+	Concurrency int    `arg:"-c" default:"8" help:"number of concurrent requests"`
+}
+
+// BenchResult summarizes the requests executed by [BenchCmd.Run].
+type BenchResult struct {
+	Requests       int
+	Duration       time.Duration
+	Statuses       map[int]int
+	P50, P90, P99  time.Duration
+	Max            time.Duration
+	AllocsPerReq   uint64
+	BytesPerReq    uint64
+	ResponseLength int
+}
+
+// Run executes the route against instance and returns a summary.
+func (c *BenchCmd) Run(instance *xtemplate.Instance) (*BenchResult, error) {
+	if c.Requests <= 0 || c.Concurrency <= 0 {
+		return nil, fmt.Errorf("requests and concurrency must be positive")
+	}
+	if _, err := http.NewRequest(c.Method, c.Path, nil); err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	result := &BenchResult{Requests: c.Requests, Statuses: map[int]int{}}
+	latencies := make([]time.Duration, c.Requests)
+	statuses := make([]int, c.Requests)
+	lengths := make([]int, c.Requests)
+	next := make(chan int)
+	var wg sync.WaitGroup
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for range min(c.Concurrency, c.Requests) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				r := httptest.NewRequest(c.Method, c.Path, nil)
+				w := httptest.NewRecorder()
+				reqStart := time.Now()
+				instance.ServeHTTP(w, r)
+				latencies[i] = time.Since(reqStart)
+				statuses[i] = w.Code
+				lengths[i] = w.Body.Len()
+			}
+		}()
+	}
+	for i := range c.Requests {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	result.Duration = time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	result.AllocsPerReq = (after.Mallocs - before.Mallocs) / uint64(c.Requests)
+	result.BytesPerReq = (after.TotalAlloc - before.TotalAlloc) / uint64(c.Requests)
+	for _, status := range statuses {
+		result.Statuses[status]++
+	}
+	result.ResponseLength = lengths[0]
+	slices.Sort(latencies)
+	percentile := func(p int) time.Duration { return latencies[(len(latencies)-1)*p/100] }
+	result.P50, result.P90, result.P99, result.Max = percentile(50), percentile(90), percentile(99), latencies[len(latencies)-1]
+	return result, nil
+}
+
+// Print writes a human readable report of the result to w.
+func (r *BenchResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "requests:    %d in %s (%.1f req/s)\n", r.Requests, r.Duration.Round(time.Millisecond), float64(r.Requests)/r.Duration.Seconds())
+	var statuses []int
+	for status := range r.Statuses {
+		statuses = append(statuses, status)
+	}
+	slices.Sort(statuses)
+	for _, status := range statuses {
+		fmt.Fprintf(w, "status %d:  %d\n", status, r.Statuses[status])
+	}
+	fmt.Fprintf(w, "latency:     p50 %s  p90 %s  p99 %s  max %s\n", r.P50, r.P90, r.P99, r.Max)
+	fmt.Fprintf(w, "allocations: %d allocs/req  %d B/req\n", r.AllocsPerReq, r.BytesPerReq)
+	fmt.Fprintf(w, "response:    %d B\n", r.ResponseLength)
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/infogulch/xtemplate"
+)
+
+// DiffCmd is the `xtemplate diff` subcommand which builds two instances and
+// reports the differences between their routes and template definitions.
+type DiffCmd struct {
+	Old  string `arg:"positional,required" help:"templates directory or json config file of the old site"`
+	New  string `arg:"positional,required" help:"templates directory or json config file of the new site"`
+	JSON bool   `help:"print the diff as json"`
+}
+
+// Run builds both instances and returns their differences. Note that building
+// an instance runs its INIT templates.
+func (c *DiffCmd) Run(log *slog.Logger) (*xtemplate.InstanceDiff, error) {
+	old, err := diffInstance(c.Old, log)
+	if err != nil {
+		return nil, err
+	}
+	new, err := diffInstance(c.New, log)
+	if err != nil {
+		return nil, err
+	}
+	return xtemplate.DiffInstances(old, new), nil
+}
+
+func diffInstance(name string, log *slog.Logger) (*xtemplate.Instance, error) {
+	stat, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	var config Args
+	if stat.IsDir() {
+		config.TemplatesDir = name
+	} else {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, &config); err != nil {
+			return nil, fmt.Errorf("failed to decode config file '%s': %w", name, err)
+		}
+	}
+	config.Logger = log
+	instance, _, _, err := config.Instance()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build instance from '%s': %w", name, err)
+	}
+	return instance, nil
+}
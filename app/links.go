@@ -0,0 +1,44 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/infogulch/xtemplate"
+)
+
+// LinksCmd is the `xtemplate links` subcommand which renders every GET page of
+// the site and reports internal links that don't resolve to a route or static
+// file.
+type LinksCmd struct {
+	JSON bool `arg:"--json" help:"print broken links as json"`
+}
+
+// Run checks the links of instance, see [xtemplate.CheckLinks].
+func (c *LinksCmd) Run(instance *xtemplate.Instance) []xtemplate.BrokenLink {
+	return xtemplate.CheckLinks(instance)
+}
+
+// print writes the broken links to w, grouped by the template that
+// rendered them.
+func (c *LinksCmd) print(w io.Writer, broken []xtemplate.BrokenLink) {
+	if c.JSON {
+		if broken == nil {
+			broken = []xtemplate.BrokenLink{}
+		}
+		json.NewEncoder(w).Encode(broken)
+		return
+	}
+	// stable, so the links of each template stay in order of page
+	slices.SortStableFunc(broken, func(a, b xtemplate.BrokenLink) int { return strings.Compare(a.Template, b.Template) })
+	for i, l := range broken {
+		if i == 0 || l.Template != broken[i-1].Template {
+			fmt.Fprintf(w, "%s:\n", l.Template)
+		}
+		fmt.Fprintf(w, "  %s: %s -> %s %d\n", l.Page, l.Link, l.Resolved, l.Status)
+	}
+	fmt.Fprintf(w, "%d broken links\n", len(broken))
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+//go:embed all:scaffold
+var scaffolds embed.FS
+
+var scaffoldKinds = []string{"blog", "docs", "app"}
+
+// NewCmd is the `xtemplate new` subcommand which writes a starter site into a
+// directory.
+type NewCmd struct {
+	Kind  string `arg:"positional" default:"app" help:"kind of site: blog, docs, or app"`
+	Dir   string `arg:"positional" default:"." help:"directory to write the site into"`
+	Force bool   `help:"overwrite existing files"`
+}
+
+// Run writes the shared layouts and error pages followed by the files of the
+// chosen kind of site, and returns the paths that were written. Nothing is
+// written if any of the files already exist, unless Force is set.
+func (c *NewCmd) Run() ([]string, error) {
+	if !slices.Contains(scaffoldKinds, c.Kind) {
+		return nil, fmt.Errorf("unknown kind of site '%s', expected one of %v", c.Kind, scaffoldKinds)
+	}
+	files := map[string]string{}
+	for _, root := range []string{"scaffold/common", "scaffold/" + c.Kind} {
+		err := fs.WalkDir(scaffolds, root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(root, path)
+			files[filepath.Join(c.Dir, rel)] = path
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	var dests []string
+	for dest := range files {
+		dests = append(dests, dest)
+	}
+	slices.Sort(dests)
+	if !c.Force {
+		for _, dest := range dests {
+			if _, err := os.Stat(dest); err == nil {
+				return nil, fmt.Errorf("file '%s' already exists, use --force to overwrite it", dest)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	for i, dest := range dests {
+		content, err := scaffolds.ReadFile(files[dest])
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(dest), 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(dest, content, 0o644)
+		}
+		if err != nil {
+			return dests[:i], fmt.Errorf("failed to write '%s': %w", dest, err)
+		}
+	}
+	return dests, nil
+}
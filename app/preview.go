@@ -0,0 +1,19 @@
+package app
+
+import (
+	"time"
+
+	"github.com/infogulch/xtemplate"
+)
+
+// PreviewLinkCmd is the `xtemplate preview-link` subcommand which prints a
+// signed link that shows unpublished content until it expires.
+type PreviewLinkCmd struct {
+	Path string        `arg:"positional,required" help:"url path or full url of the page to preview"`
+	TTL  time.Duration `arg:"--ttl" default:"24h" help:"how long the link shows unpublished content"`
+}
+
+// Run returns the signed link, see [xtemplate.Config.PreviewLink].
+func (c *PreviewLinkCmd) Run(config *xtemplate.Config) (string, error) {
+	return config.PreviewLink(c.Path, c.TTL)
+}
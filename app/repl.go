@@ -0,0 +1,50 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/infogulch/xtemplate"
+)
+
+// ReplCmd is the `xtemplate repl` subcommand which reads template pipelines
+// from the input and prints their output, evaluated against the dot of a
+// request to Route.
+type ReplCmd struct {
+	Route  string `arg:"-r" default:"/" help:"url path and query of the request the dot is constructed for"`
+	Commit bool   `help:"commit database transactions instead of rolling them back"`
+}
+
+// Run evaluates each line of in with instance and writes the results to out
+// until in is exhausted. Lines that don't contain the left delimiter are
+// wrapped in delimiters, so `.Req.URL.Path` is evaluated as
+// `{{.Req.URL.Path}}`.
+func (c *ReplCmd) Run(instance *xtemplate.Instance, ldelim, rdelim string, in io.Reader, out io.Writer) error {
+	if _, err := http.NewRequest(http.MethodGet, c.Route, nil); err != nil {
+		return fmt.Errorf("invalid route: %w", err)
+	}
+	fmt.Fprintf(out, "evaluating against GET %s, exit with ctrl-d\n", c.Route)
+	scanner := bufio.NewScanner(in)
+	for fmt.Fprint(out, "> "); scanner.Scan(); fmt.Fprint(out, "> ") {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.Contains(line, ldelim) {
+			line = ldelim + line + rdelim
+		}
+		r, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, c.Route, nil)
+		output, err := instance.Eval(r, line, c.Commit)
+		if err != nil {
+			fmt.Fprintln(out, "error:", err)
+			continue
+		}
+		fmt.Fprintln(out, output)
+	}
+	fmt.Fprintln(out)
+	return scanner.Err()
+}
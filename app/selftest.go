@@ -0,0 +1,47 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/infogulch/xtemplate"
+)
+
+// SelfTestCmd is the `xtemplate selftest` subcommand which renders every GET
+// page of the site and reports the pages that fail.
+type SelfTestCmd struct {
+	JSON        bool `arg:"--json" help:"print the report as json"`
+	Concurrency int  `arg:"-c" help:"number of pages rendered concurrently, default --build-workers"`
+}
+
+// Run tests the pages of instance, see [xtemplate.SelfTest].
+func (c *SelfTestCmd) Run(instance *xtemplate.Instance, workers int) xtemplate.SelfTestReport {
+	if c.Concurrency > 0 {
+		workers = c.Concurrency
+	}
+	return xtemplate.SelfTest(instance, workers)
+}
+
+// print writes the report to w, with the failures grouped by the template
+// that renders them.
+func (c *SelfTestCmd) print(w io.Writer, report xtemplate.SelfTestReport) {
+	if c.JSON {
+		json.NewEncoder(w).Encode(report)
+		return
+	}
+	groups := report.ByTemplate()
+	templates := make([]string, 0, len(groups))
+	for t := range groups {
+		templates = append(templates, t)
+	}
+	slices.Sort(templates)
+	for _, t := range templates {
+		fmt.Fprintf(w, "%s:\n", t)
+		for _, f := range groups[t] {
+			fmt.Fprintf(w, "  %s %d %s\n", f.Page, f.Status, f.Error)
+		}
+	}
+	fmt.Fprintf(w, "%d of %d pages failed in %s\n", len(report.Failures), report.Pages, report.Duration)
+}
@@ -0,0 +1,268 @@
+package xtemplate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WithTemplatesArchive loads templates from a zip or tar.gz archive at a local
+// path or http(s) url, verified against a hex encoded sha256 checksum if it's
+// not empty. See [Config.TemplatesArchive].
+func WithTemplatesArchive(src, checksum string) Option {
+	return func(c *Config) error {
+		if src == "" {
+			return fmt.Errorf("empty templates archive")
+		}
+		c.TemplatesArchive = src
+		c.TemplatesArchiveSHA256 = checksum
+		return nil
+	}
+}
+
+// archiveClient fetches templates archives from urls.
+var archiveClient = &http.Client{Timeout: 5 * time.Minute}
+
+// loadArchive reads a zip or tar.gz archive of at most maxSize bytes from a
+// local path or url into memory and returns it as an fs.FS. If every file in
+// the archive is inside a single top level directory, that directory is used
+// as the root.
+func loadArchive(ctx context.Context, src, checksum string, maxSize int64) (fs.FS, error) {
+	var content []byte
+	var err error
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		content, err = fetchArchive(ctx, src, maxSize)
+	} else {
+		var f *os.File
+		if f, err = os.Open(src); err == nil {
+			content, err = readLimited(f, maxSize)
+			f.Close()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates archive '%s': %w", src, err)
+	}
+
+	if checksum != "" {
+		sum := sha256.Sum256(content)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, checksum) {
+			return nil, fmt.Errorf("templates archive '%s' checksum mismatch: expected %s, got %s", src, checksum, actual)
+		}
+	}
+
+	mfs := memFS{}
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		err = mfs.addTarGz(content, maxSize)
+	} else {
+		err = mfs.addZip(content, maxSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates archive '%s': %w", src, err)
+	}
+
+	var fsys fs.FS = mfs
+	entries, err := fs.ReadDir(mfs, ".")
+	if err == nil && len(entries) == 1 && entries[0].IsDir() {
+		fsys, err = fs.Sub(mfs, entries[0].Name())
+	}
+	return fsys, err
+}
+
+func fetchArchive(ctx context.Context, url string, maxSize int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := archiveClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return readLimited(resp.Body, maxSize)
+}
+
+// readLimited reads r to the end, or fails if it's larger than maxSize.
+func readLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err == nil && int64(len(data)) > maxSize {
+		err = fmt.Errorf("larger than the maximum of %d bytes", maxSize)
+	}
+	return data, err
+}
+
+// addTarGz adds the files of a tar.gz archive, which must be at most maxSize
+// bytes in total when extracted.
+func (m memFS) addTarGz(content []byte, maxSize int64) error {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	remaining := maxSize
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, remaining+1))
+		if err != nil {
+			return err
+		}
+		if remaining -= int64(len(data)); remaining < 0 {
+			return fmt.Errorf("extracted files are larger than the maximum of %d bytes", maxSize)
+		}
+		m.add(hdr.Name, data, hdr.ModTime)
+	}
+}
+
+// addZip adds the files of a zip archive, which must be at most maxSize bytes
+// in total when extracted.
+func (m memFS) addZip(content []byte, maxSize int64) error {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+	remaining := maxSize
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(io.LimitReader(r, remaining+1))
+		r.Close()
+		if err != nil {
+			return err
+		}
+		if remaining -= int64(len(data)); remaining < 0 {
+			return fmt.Errorf("extracted files are larger than the maximum of %d bytes", maxSize)
+		}
+		m.add(f.Name, data, f.Modified)
+	}
+	return nil
+}
+
+// memFS is a read-only in-memory fs.FS whose files are seekable, as required
+// to serve static files.
+type memFS map[string]*memEntry
+
+type memEntry struct {
+	name    string
+	data    []byte
+	modTime time.Time
+	dir     bool
+}
+
+func (e *memEntry) Name() string               { return path.Base(e.name) }
+func (e *memEntry) Size() int64                { return int64(len(e.data)) }
+func (e *memEntry) ModTime() time.Time         { return e.modTime }
+func (e *memEntry) IsDir() bool                { return e.dir }
+func (e *memEntry) Sys() any                   { return nil }
+func (e *memEntry) Type() fs.FileMode          { return e.Mode().Type() }
+func (e *memEntry) Info() (fs.FileInfo, error) { return e, nil }
+func (e *memEntry) Mode() fs.FileMode {
+	if e.dir {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+// add adds a file and its parent directories, ignoring invalid paths.
+func (m memFS) add(name string, data []byte, modTime time.Time) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if !fs.ValidPath(name) || name == "." {
+		return
+	}
+	m[name] = &memEntry{name: name, data: data, modTime: modTime}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if _, ok := m[dir]; ok {
+			break
+		}
+		m[dir] = &memEntry{name: dir, modTime: modTime, dir: true}
+		if dir == "." {
+			break
+		}
+	}
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := m[name]
+	if !ok {
+		if name != "." {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		e = &memEntry{name: ".", dir: true}
+	}
+	if !e.dir {
+		return &memFile{e, bytes.NewReader(e.data)}, nil
+	}
+	var entries []fs.DirEntry
+	for p, child := range m {
+		if p != "." && path.Dir(p) == name {
+			entries = append(entries, child)
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return &memDir{e, entries}, nil
+}
+
+type memFile struct {
+	*memEntry
+	*bytes.Reader
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.memEntry, nil }
+func (f *memFile) Close() error               { return nil }
+
+type memDir struct {
+	*memEntry
+	entries []fs.DirEntry
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.memEntry, nil }
+func (d *memDir) Close() error               { return nil }
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,64 @@
+package xtemplate
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadArchive(t *testing.T) {
+	files := map[string]string{"site/index.html": "home", "site/about.html": strings.Repeat("a", 2000)}
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+
+	var tgz bytes.Buffer
+	gw := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gw.Close()
+
+	dir := t.TempDir()
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+	for name, content := range map[string][]byte{"site.zip": zipped.Bytes(), "site.tar.gz": tgz.Bytes()} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for _, src := range []string{filepath.Join(dir, name), server.URL + "/" + name} {
+			fsys, err := loadArchive(context.Background(), src, "", 1<<20)
+			if err != nil {
+				t.Fatalf("failed to load %s: %v", src, err)
+			}
+			if data, err := fs.ReadFile(fsys, "index.html"); err != nil || string(data) != "home" {
+				t.Errorf("%s: got index.html %q, %v", src, data, err)
+			}
+
+			// the archives are smaller than 1KiB, but their files are larger
+			if _, err := loadArchive(context.Background(), src, "", 1024); err == nil || !strings.Contains(err.Error(), "larger than the maximum") {
+				t.Errorf("%s: got error %v loading files larger than the maximum", src, err)
+			}
+			if _, err := loadArchive(context.Background(), src, "", 100); err == nil || !strings.Contains(err.Error(), "larger than the maximum") {
+				t.Errorf("%s: got error %v loading an archive larger than the maximum", src, err)
+			}
+		}
+	}
+}
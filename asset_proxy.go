@@ -0,0 +1,377 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AssetProxy serves assets of a remote origin, like web fonts or third-party
+// scripts, from a path of the site, so visitors' browsers don't contact the
+// third party and its origin can be left out of the Content-Security-Policy.
+//
+//	{"path": "/vendor/htmx/", "upstream": "https://unpkg.com/htmx.org@2.0.0/dist/",
+//	 "integrity": {"htmx.min.js": "sha384-..."}, "pinned_only": true}
+//
+// Files are fetched the first time they're requested and kept in memory for
+// the life of the instance, and files that the upstream doesn't have are
+// remembered for a minute. After Revalidate, the cached file is still served
+// while it's revalidated with the upstream in the background. Fetched files
+// whose Integrity doesn't match are rejected, and the last good copy is kept
+// if there is one. Stylesheets, scripts, fonts, and raster images are served
+// as is, and any other file is served as a sandboxed download, so a file like
+// an svg or html page from the upstream can't run scripts on the site.
+type AssetProxy struct {
+	// Path prefix that the assets are served under, like `/vendor/fonts/`.
+	Path string `json:"path"`
+
+	// Base url that paths under Path are fetched from, like
+	// `https://fonts.gstatic.com/`.
+	Upstream string `json:"upstream"`
+
+	// Subresource integrity hashes like `sha384-...` of files by their path
+	// under Path. Space separated hashes match if any of them does, like the
+	// integrity attribute.
+	Integrity map[string]string `json:"integrity,omitempty"`
+
+	// Only serve the files in Integrity, so the route can't be used to fetch
+	// anything else from the upstream.
+	PinnedOnly bool `json:"pinned_only,omitempty"`
+
+	// How long a file is served from the cache before it's revalidated.
+	// Default 24h.
+	Revalidate time.Duration `json:"revalidate,omitempty"`
+
+	// Maximum size of a file in bytes. Default 10MiB.
+	MaxSize int64 `json:"max_size,omitempty"`
+}
+
+func WithAssetProxy(p AssetProxy) Option {
+	return func(c *Config) error {
+		c.AssetProxies = append(c.AssetProxies, p)
+		return nil
+	}
+}
+
+// maxAssetProxyEntries bounds the cache of a proxy that isn't PinnedOnly, so
+// requests for random paths can't grow it without limit. The cache is cleared
+// when it's full.
+const maxAssetProxyEntries = 1000
+
+// assetProxyMissTTL is how long a file that the upstream doesn't have is
+// remembered, so requests for it aren't all passed on to the upstream.
+const assetProxyMissTTL = time.Minute
+
+// assetProxyInline are the media types of files that are served as is. Any
+// other file could be a document that runs scripts with the origin of the
+// site, so it's served as a sandboxed attachment.
+var assetProxyInline = []string{
+	"text/css", "text/javascript", "application/javascript",
+	"font/woff2", "font/woff", "font/ttf", "font/otf", "application/font-woff", "application/vnd.ms-fontobject",
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif", "image/x-icon", "image/vnd.microsoft.icon",
+}
+
+type assetProxy struct {
+	AssetProxy
+	upstream *url.URL
+	client   *http.Client
+	log      *slog.Logger
+	ctx      context.Context
+
+	mu      sync.Mutex
+	entries map[string]*assetProxyEntry
+}
+
+type assetProxyEntry struct {
+	// held while the file is first fetched, so concurrent requests wait for
+	// one fetch instead of each starting their own
+	mu         sync.Mutex
+	file       *assetProxyFile
+	refreshing bool
+
+	// when the upstream last responded that it doesn't have the file
+	missed time.Time
+}
+
+// assetProxyFile is a fetched file, which isn't modified after it's cached.
+type assetProxyFile struct {
+	body         []byte
+	contentType  string
+	etag         string
+	lastModified string
+	sri          string
+	fetched      time.Time
+}
+
+// addAssetProxyRoutes registers a route for each of [Config.AssetProxies].
+func (b *builder) addAssetProxyRoutes() error {
+	for _, cfg := range b.config.AssetProxies {
+		upstream, err := url.Parse(cfg.Upstream)
+		if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+			return fmt.Errorf("invalid asset proxy upstream '%s' for '%s'", cfg.Upstream, cfg.Path)
+		}
+		if !strings.HasSuffix(upstream.Path, "/") {
+			upstream.Path += "/"
+		}
+		prefix := path.Clean("/"+cfg.Path) + "/"
+		if prefix == "//" {
+			return fmt.Errorf("asset proxy of '%s' can't be served at the root path", cfg.Upstream)
+		}
+		for name, sri := range cfg.Integrity {
+			if _, err := parseIntegrity(sri); err != nil {
+				return fmt.Errorf("invalid integrity of asset proxy file '%s%s': %w", prefix, name, err)
+			}
+		}
+		if cfg.Revalidate <= 0 {
+			cfg.Revalidate = 24 * time.Hour
+		}
+		if cfg.MaxSize <= 0 {
+			cfg.MaxSize = 10 << 20
+		}
+		p := &assetProxy{
+			AssetProxy: cfg,
+			upstream:   upstream,
+			client:     &http.Client{Timeout: 30 * time.Second},
+			log:        b.config.Logger.WithGroup("asset_proxy").With(slog.String("prefix", prefix), slog.String("upstream", upstream.String())),
+			ctx:        b.config.Ctx,
+			entries:    map[string]*assetProxyEntry{},
+		}
+		pattern := "GET " + prefix
+		route := newInstanceRoute(pattern, p.handler(b.Instance, prefix), RouteProxy)
+		route.Source = upstream.String()
+		if _, err := b.handleRoute(route); err != nil {
+			return err
+		}
+		b.routes = append(b.routes, route)
+		b.Routes += 1
+		p.log.Debug("added asset proxy", slog.Int("pinned", len(cfg.Integrity)))
+	}
+	return nil
+}
+
+func (p *assetProxy) handler(instance *Instance, prefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, prefix)
+		sri, pinned := p.Integrity[name]
+		if name == "" || !validProxyPath(name) || (p.PinnedOnly && !pinned) {
+			instance.serveError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		file, err := p.get(name, sri)
+		if err != nil {
+			GetLogger(r.Context()).Warn("asset proxy request failed", slog.String("path", r.URL.Path), slog.Any("error", err))
+			instance.serveError(w, r, http.StatusBadGateway, "bad gateway")
+			return
+		}
+		if file == nil {
+			instance.serveError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		w.Header().Set("Content-Type", file.contentType)
+		w.Header().Set("Etag", `"`+file.sri+`"`)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(p.Revalidate.Seconds())))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if mediatype, _, _ := mime.ParseMediaType(file.contentType); !slices.Contains(assetProxyInline, mediatype) {
+			w.Header().Set("Content-Security-Policy", "sandbox")
+			w.Header().Set("Content-Disposition", "attachment")
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(file.body))
+	}
+}
+
+// validProxyPath reports whether name is a clean relative path that can't
+// leave the upstream base path.
+func validProxyPath(name string) bool {
+	return !strings.ContainsAny(name, "\\?#%") && path.Clean("/"+name) == "/"+name
+}
+
+// get returns the cached file name, fetching it if it isn't cached and
+// starting a revalidation in the background if it's stale. It returns nil if
+// the upstream doesn't have the file, without asking the upstream again until
+// [assetProxyMissTTL] has passed.
+func (p *assetProxy) get(name, sri string) (*assetProxyFile, error) {
+	p.mu.Lock()
+	entry, ok := p.entries[name]
+	if !ok {
+		if len(p.entries) >= maxAssetProxyEntries {
+			clear(p.entries)
+		}
+		entry = &assetProxyEntry{}
+		p.entries[name] = entry
+	}
+	p.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.file == nil {
+		if time.Since(entry.missed) < assetProxyMissTTL {
+			return nil, nil
+		}
+		file, err := p.fetch(name, sri, nil)
+		if err != nil {
+			p.mu.Lock()
+			delete(p.entries, name)
+			p.mu.Unlock()
+			return nil, err
+		}
+		if file == nil {
+			entry.missed = time.Now()
+			return nil, nil
+		}
+		entry.file = file
+	} else if time.Since(entry.file.fetched) >= p.Revalidate && !entry.refreshing {
+		entry.refreshing = true
+		go p.revalidate(name, sri, entry, entry.file)
+	}
+	return entry.file, nil
+}
+
+// revalidate refreshes the stale cached file of entry, keeping the cached
+// copy if the upstream fails.
+func (p *assetProxy) revalidate(name, sri string, entry *assetProxyEntry, cached *assetProxyFile) {
+	file, err := p.fetch(name, sri, cached)
+	if err == nil && file == nil {
+		err = fmt.Errorf("upstream doesn't have the file anymore")
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	entry.refreshing = false
+	if err != nil {
+		p.log.Warn("failed to revalidate asset, serving the cached copy", slog.String("name", name), slog.Any("error", err))
+		// try again after another period instead of on every request
+		kept := *cached
+		kept.fetched = time.Now()
+		entry.file = &kept
+		return
+	}
+	entry.file = file
+}
+
+// fetch requests name from the upstream, conditionally if there's a cached
+// copy. It returns nil if the upstream doesn't have the file.
+func (p *assetProxy) fetch(name, sri string, cached *assetProxyFile) (*assetProxyFile, error) {
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodGet, p.upstream.JoinPath(name).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		file := *cached
+		file.fetched = time.Now()
+		return &file, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("upstream responded with status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > p.MaxSize {
+		return nil, fmt.Errorf("upstream file is larger than the maximum of %d bytes", p.MaxSize)
+	}
+	if sri != "" && !matchesIntegrity(body, sri) {
+		return nil, fmt.Errorf("upstream file doesn't match its pinned integrity '%s'", sri)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		if contentType = mime.TypeByExtension(path.Ext(name)); contentType == "" {
+			contentType = http.DetectContentType(body)
+		}
+	}
+	sum := sha512.Sum384(body)
+	p.log.Debug("fetched asset", slog.String("name", name), slog.Int("size", len(body)))
+	return &assetProxyFile{
+		body:         body,
+		contentType:  contentType,
+		etag:         resp.Header.Get("Etag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		sri:          "sha384-" + base64.StdEncoding.EncodeToString(sum[:]),
+		fetched:      time.Now(),
+	}, nil
+}
+
+type integrityHash struct {
+	new    func() hash.Hash
+	digest []byte
+}
+
+// parseIntegrity parses the space separated hashes of an integrity attribute
+// like `sha384-oqVu...`.
+func parseIntegrity(sri string) ([]integrityHash, error) {
+	var hashes []integrityHash
+	for _, h := range strings.Fields(sri) {
+		alg, digest, ok := strings.Cut(h, "-")
+		if !ok {
+			return nil, fmt.Errorf("expected a hash like 'sha384-...', got '%s'", h)
+		}
+		var ih integrityHash
+		switch alg {
+		case "sha256":
+			ih.new = sha256.New
+		case "sha384":
+			ih.new = sha512.New384
+		case "sha512":
+			ih.new = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported hash algorithm '%s'", alg)
+		}
+		var err error
+		digest, _, _ = strings.Cut(digest, "?")
+		if ih.digest, err = base64.StdEncoding.DecodeString(digest); err != nil {
+			if ih.digest, err = base64.URLEncoding.DecodeString(digest); err != nil {
+				return nil, fmt.Errorf("invalid base64 digest in '%s'", h)
+			}
+		}
+		hashes = append(hashes, ih)
+	}
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("empty integrity")
+	}
+	return hashes, nil
+}
+
+// matchesIntegrity reports whether body matches any hash of sri.
+func matchesIntegrity(body []byte, sri string) bool {
+	hashes, err := parseIntegrity(sri)
+	if err != nil {
+		return false
+	}
+	for _, ih := range hashes {
+		h := ih.new()
+		h.Write(body)
+		if subtle.ConstantTimeCompare(h.Sum(nil), ih.digest) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package xtemplate
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssetProxy(t *testing.T) {
+	var requests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css; charset=utf-8")
+			w.Write([]byte("body{}"))
+		case "/logo.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(`<svg><script>alert(1)</script></svg>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+	instance := testInstance(t, fstest.MapFS{}, WithAssetProxy(AssetProxy{Path: "/vendor/", Upstream: upstream.URL}))
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	w := get("/vendor/style.css")
+	sum := sha512.Sum384([]byte("body{}"))
+	if etag := `"sha384-` + base64.StdEncoding.EncodeToString(sum[:]) + `"`; w.Code != http.StatusOK || w.Header().Get("Etag") != etag {
+		t.Errorf("got status %d and etag %s, want 200 and %s", w.Code, w.Header().Get("Etag"), etag)
+	}
+	if w.Header().Get("Content-Disposition") != "" || w.Header().Get("Content-Security-Policy") != "" {
+		t.Errorf("stylesheet is served as a sandboxed attachment")
+	}
+
+	w = get("/vendor/logo.svg")
+	if w.Header().Get("Content-Disposition") != "attachment" || w.Header().Get("Content-Security-Policy") != "sandbox" {
+		t.Errorf("svg is not served as a sandboxed attachment, got headers %v", w.Header())
+	}
+
+	before := requests.Load()
+	for range 3 {
+		if w := get("/vendor/missing.js"); w.Code != http.StatusNotFound {
+			t.Errorf("got status %d for a missing file, want 404", w.Code)
+		}
+	}
+	if n := requests.Load() - before; n != 1 {
+		t.Errorf("missing file was requested from the upstream %d times, want once", n)
+	}
+}
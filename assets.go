@@ -0,0 +1,166 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/js"
+)
+
+// NeedsCSS registers a stylesheet that the template depends on, so component
+// templates can declare their own assets and the layout emits each one once
+// with .Resp.CSS. The url must be relative or http(s). It returns an empty
+// string.
+//
+//	{{define "datepicker"}}{{.Resp.NeedsCSS "/assets/datepicker.css"}}...{{end}}
+//
+// Since the layout renders after the page, see [DotResp.Body], it sees the
+// assets registered by every template in the page.
+func (h *DotResp) NeedsCSS(url string) (string, error) {
+	if err := checkAssetURL(url); err != nil {
+		return "", fmt.Errorf("NeedsCSS: %w", err)
+	}
+	if !slices.Contains(h.css, url) {
+		h.css = append(h.css, url)
+	}
+	return "", nil
+}
+
+// NeedsJS registers a script that the template depends on, to be emitted once
+// with .Resp.JS. The url must be relative or http(s). It returns an empty
+// string.
+func (h *DotResp) NeedsJS(url string) (string, error) {
+	if err := checkAssetURL(url); err != nil {
+		return "", fmt.Errorf("NeedsJS: %w", err)
+	}
+	if !slices.Contains(h.js, url) {
+		h.js = append(h.js, url)
+	}
+	return "", nil
+}
+
+// checkAssetURL rejects asset urls with a scheme other than http(s), like
+// `javascript:`, since CSS and JS emit them without the escaping that
+// html/template applies to urls.
+func checkAssetURL(asset string) error {
+	u, err := url.Parse(asset)
+	if err != nil {
+		return fmt.Errorf("invalid asset url '%s': %w", asset, err)
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid asset url '%s', it must be relative or http(s)", asset)
+	}
+	return nil
+}
+
+// CSS returns a <link> element for each stylesheet registered with NeedsCSS,
+// in the order they were first registered.
+//
+//	<head>{{.Resp.CSS}}</head>
+func (h *DotResp) CSS() template.HTML {
+	var b strings.Builder
+	for _, url := range h.css {
+		fmt.Fprintf(&b, `<link rel="stylesheet" href="%s">`, template.HTMLEscapeString(url))
+	}
+	return template.HTML(b.String())
+}
+
+// JS returns a <script> element for each script registered with NeedsJS, in
+// the order they were first registered.
+//
+//	{{.Resp.JS}}</body>
+func (h *DotResp) JS() template.HTML {
+	var b strings.Builder
+	for _, url := range h.js {
+		fmt.Fprintf(&b, `<script src="%s"></script>`, template.HTMLEscapeString(url))
+	}
+	return template.HTML(b.String())
+}
+
+// Inline returns the contents of the css or js static file at urlpath in a
+// <style> or <script> element, to embed critical styles and scripts of
+// performance-sensitive pages without a request for them:
+//
+//	<head>{{.X.Inline "/assets/critical.css"}}</head>
+//
+// Contents are minified if [Config.Minify] is enabled. Files larger than
+// [Config.MaxInlineSize] after minifying, or that contain the end tag of the
+// element, are linked instead with the hash of the file like
+// `/assets/critical.css?hash=...`, so they're cached and the link changes
+// when the file does. The element is built once per version of a file.
+func (d DotX) Inline(urlpath string) (template.HTML, error) {
+	urlpath = path.Clean("/" + urlpath)
+	file, ok := d.instance.file(urlpath)
+	if !ok {
+		return "", fmt.Errorf("file does not exist: '%s'", urlpath)
+	}
+	key := urlpath + "\x00" + file.hash
+	if el, ok := d.instance.inlined.Load(key); ok {
+		return el.(template.HTML), nil
+	}
+	el, err := d.instance.inline(urlpath, file)
+	if err != nil {
+		return "", err
+	}
+	d.instance.inlined.Store(key, el)
+	return el, nil
+}
+
+func (x *Instance) inline(urlpath string, file *fileInfo) (template.HTML, error) {
+	mediatype, _, _ := strings.Cut(file.contentType, ";")
+	var open, end, link string
+	href := template.HTMLEscapeString(urlpath + "?hash=" + file.hash)
+	integrity := ""
+	if !file.weak {
+		integrity = fmt.Sprintf(` integrity="%s"`, template.HTMLEscapeString(file.hash))
+	}
+	switch mediatype {
+	case "text/css":
+		open, end = "<style>", "</style"
+		link = fmt.Sprintf(`<link rel="stylesheet" href="%s"%s>`, href, integrity)
+	case "text/javascript":
+		open, end = "<script>", "</script"
+		link = fmt.Sprintf(`<script src="%s"%s></script>`, href, integrity)
+	default:
+		return "", fmt.Errorf("inline: only css and js files can be inlined, '%s' is %s", urlpath, file.contentType)
+	}
+
+	var identity string
+	for _, enc := range file.encodings {
+		if enc.encoding == "identity" {
+			identity = enc.path
+		}
+	}
+	if identity == "" {
+		return template.HTML(link), nil
+	}
+	content, err := fs.ReadFile(x.config.TemplatesFS, identity)
+	if err != nil {
+		return "", fmt.Errorf("inline: failed to read '%s': %w", urlpath, err)
+	}
+	if x.config.Minify {
+		m := minify.New()
+		m.AddFunc("text/css", css.Minify)
+		m.AddFunc("text/javascript", js.Minify)
+		if minified, err := m.Bytes(mediatype, content); err == nil {
+			content = minified
+		} else {
+			x.config.Logger.Warn("failed to minify inlined file", slog.String("path", urlpath), slog.Any("error", err))
+		}
+	}
+	// the contents of style and script elements aren't escaped, so a file
+	// that could end the element early is linked
+	if int64(len(content)) > x.config.MaxInlineSize || bytes.Contains(bytes.ToLower(content), []byte(end)) {
+		return template.HTML(link), nil
+	}
+	return template.HTML(open + string(bytes.TrimSpace(content)) + end + ">"), nil
+}
@@ -4,8 +4,6 @@ package xtemplate
 
 import (
 	"compress/gzip"
-	"crypto/sha512"
-	"encoding/base64"
 	"fmt"
 	"io"
 	"io/fs"
@@ -14,6 +12,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"text/template/parse"
@@ -21,14 +20,35 @@ import (
 
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/cast"
 	"github.com/tdewolff/minify/v2"
 )
 
 type builder struct {
 	*Instance
 	*InstanceStats
-	m      *minify.M
-	routes []InstanceRoute
+	m     *minify.M
+	pages []pageInfo
+
+	schemaPaths []string
+
+	// directory on disk that TemplatesFS reads, if any
+	sourceDir string
+
+	// content hashes of static files, see Config.StaticHashCache
+	hashes *hashCache
+
+	// the step of the build in progress, see BuildFailure.Stage
+	stage string
+}
+
+// pageInfo describes a template file that is routed by its path.
+type pageInfo struct {
+	routePath    string
+	templatePath string
+	meta         map[string]any
+	visibility   visibility
+	publish      publishState
 }
 
 type InstanceStats struct {
@@ -38,16 +58,19 @@ type InstanceStats struct {
 	TemplateInitializers          int
 	StaticFiles                   int
 	StaticFilesAlternateEncodings int
-}
 
-type InstanceRoute struct {
-	Pattern string
-	Handler http.Handler
+	// Metrics of the dot providers by field name and operation, like DB
+	// queries, fetch requests, and response cache hits and misses. Only set
+	// by [Instance.Stats].
+	Providers map[string]map[string]OperationMetrics `json:",omitempty"`
 }
 
 type fileInfo struct {
 	identityPath, hash, contentType string
 	encodings                       []encodingInfo
+	// hash is a version token derived from the modtime instead of the
+	// contents, served as a weak etag
+	weak bool
 }
 
 type encodingInfo struct {
@@ -63,65 +86,103 @@ var extensionContentTypes = map[string]string{
 }
 
 func (b *builder) addStaticFileHandler(path_ string) error {
+	ext := filepath.Ext(path_)
+	identityPath := strings.TrimSuffix(path.Clean("/"+path_), ext)
+	file, exists := b.files[identityPath]
+	if !exists {
+		file = nil
+	}
+	file, encoding, err := loadStaticFile(b.config.TemplatesFS, path_, file, b.config.StaticValidator == "modtime", b.hashes)
+	if err != nil {
+		return err
+	}
+
+	if encoding.encoding == "identity" {
+		identityPath = file.identityPath
+		pattern := "GET " + identityPath
+		handler := staticFileHandler(b.config.TemplatesFS, file)
+		route := newInstanceRoute(pattern, handler, RouteStatic)
+		route.Source, route.File, route.ContentType = identityPath, path.Clean("/"+path_), file.contentType
+		if added, err := b.handleRoute(route); !added {
+			return err
+		}
+		b.StaticFiles += 1
+		b.Routes += 1
+		b.files[identityPath] = file
+		b.routes = append(b.routes, route)
+		b.routeSources[pattern] = identityPath
+
+		b.config.Logger.Debug("added static file handler", slog.String("path", identityPath), slog.String("filepath", path_), slog.String("contenttype", file.contentType), slog.Int64("size", encoding.size), slog.Time("modtime", encoding.modtime), slog.String("hash", file.hash))
+	} else {
+		b.StaticFilesAlternateEncodings += 1
+		b.config.Logger.Debug("added static file encoding", slog.String("path", identityPath), slog.String("filepath", path_), slog.String("encoding", encoding.encoding), slog.Int64("size", encoding.size), slog.Time("modtime", encoding.modtime))
+	}
+	return nil
+}
+
+// loadStaticFile reads the metadata of the static file at path_. If file is
+// nil, path_ is loaded as the identity encoding of a new file, otherwise it's
+// added to file as an alternate encoding like gzip, which must have the same
+// contents as the identity file unless weak is set. Content hashes are looked
+// up in and added to hashes, and files that are too large to hash according to
+// hashes get a weak version token as if weak was set.
+func loadStaticFile(fsys fs.FS, path_ string, file *fileInfo, weak bool, hashes *hashCache) (*fileInfo, encodingInfo, error) {
 	// Open and stat the file
-	fsfile, err := b.config.TemplatesFS.Open(path_)
+	fsfile, err := fsys.Open(path_)
 	if err != nil {
-		return fmt.Errorf("failed to open static file '%s': %w", path_, err)
+		return nil, encodingInfo{}, fmt.Errorf("failed to open static file '%s': %w", path_, err)
 	}
 	defer fsfile.Close()
 	seeker := fsfile.(io.ReadSeeker)
 	stat, err := fsfile.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to stat file '%s': %w", path_, err)
+		return nil, encodingInfo{}, fmt.Errorf("failed to stat file '%s': %w", path_, err)
 	}
 	size := stat.Size()
 
-	var file *fileInfo
-	var encoding string
-	var sri string
 	// Calculate the file hash. If there's a compressed file with the same
 	// prefix, calculate the hash of the contents and check that they match.
 	ext := filepath.Ext(path_)
-	identityPath := strings.TrimSuffix(path.Clean("/"+path_), ext)
 	var reader io.Reader = fsfile
-	encoding = "identity"
-	var exists bool
-	file, exists = b.files[identityPath]
-	if exists {
-		switch ext {
-		case ".gz":
-			reader, err = gzip.NewReader(seeker)
-			encoding = "gzip"
-		case ".zst":
-			reader, err = zstd.NewReader(seeker)
-			encoding = "zstd"
-		case ".br":
-			reader = brotli.NewReader(seeker)
-			encoding = "br"
-		}
+	encoding := "identity"
+	if file != nil {
+		reader, encoding, err = decodingReader(ext, seeker)
 		if err != nil {
-			return fmt.Errorf("failed to create decompressor for file `%s`: %w", path_, err)
+			return nil, encodingInfo{}, fmt.Errorf("failed to create decompressor for file `%s`: %w", path_, err)
 		}
 	} else {
-		identityPath = path.Clean("/" + path_)
 		file = &fileInfo{}
 	}
 
-	{
-		hash := sha512.New384()
-		_, err = io.Copy(hash, reader)
+	if file.identityPath != "" {
+		weak = weak || file.weak
+	} else if hashes.tooLarge(size) {
+		weak = true
+	}
+
+	var sri string
+	if weak {
+		// the version token is derived from the identity file, alternate
+		// encodings are assumed to match it without reading them
+		sri = fmt.Sprintf("mtime-%x-%x", stat.ModTime().UnixNano(), size)
+	} else if cached, ok := hashes.get(path_, stat); ok {
+		sri = cached
+	} else {
+		sri, err = contentHash(reader)
 		if err != nil {
-			return fmt.Errorf("failed to hash file %w", err)
+			return nil, encodingInfo{}, fmt.Errorf("failed to hash file %w", err)
 		}
-		sri = "sha384-" + base64.URLEncoding.EncodeToString(hash.Sum(nil))
+		hashes.put(path_, stat, sri)
 	}
 
 	// Save precalculated file size, modtime, hash, content type, and encoding
 	// info to enable efficient content negotiation at request time.
+	info := encodingInfo{encoding: encoding, path: path_, size: size, modtime: stat.ModTime()}
 	if encoding == "identity" {
 		// note: identity file will always be found first because fs.WalkDir sorts files in lexical order
 		file.hash = sri
-		file.identityPath = identityPath
+		file.weak = weak
+		file.identityPath = path.Clean("/" + path_)
 		if ctype, ok := extensionContentTypes[ext]; ok {
 			file.contentType = ctype
 		} else {
@@ -129,33 +190,36 @@ func (b *builder) addStaticFileHandler(path_ string) error {
 			seeker.Seek(0, io.SeekStart)
 			count, err := seeker.Read(content)
 			if err != nil && err != io.EOF {
-				return fmt.Errorf("failed to read file to guess content type '%s': %w", path_, err)
+				return nil, encodingInfo{}, fmt.Errorf("failed to read file to guess content type '%s': %w", path_, err)
 			}
 			file.contentType = http.DetectContentType(content[:count])
 		}
-		file.encodings = []encodingInfo{{encoding: encoding, path: path_, size: size, modtime: stat.ModTime()}}
-
-		pattern := "GET " + identityPath
-		handler := staticFileHandler(b.config.TemplatesFS, file)
-		if err = catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.HandleFunc(pattern, handler) }); err != nil {
-			return err
-		}
-		b.StaticFiles += 1
-		b.Routes += 1
-		b.files[identityPath] = file
-		b.routes = append(b.routes, InstanceRoute{pattern, handler})
-
-		b.config.Logger.Debug("added static file handler", slog.String("path", identityPath), slog.String("filepath", path_), slog.String("contenttype", file.contentType), slog.Int64("size", size), slog.Time("modtime", stat.ModTime()), slog.String("hash", sri))
+		file.encodings = []encodingInfo{info}
 	} else {
-		if file.hash != sri {
-			return fmt.Errorf("encoded file contents did not match original file '%s': expected %s, got %s", path_, file.hash, sri)
+		if !weak && file.hash != sri {
+			return nil, encodingInfo{}, fmt.Errorf("encoded file contents did not match original file '%s': expected %s, got %s", path_, file.hash, sri)
 		}
-		file.encodings = append(file.encodings, encodingInfo{encoding: encoding, path: path_, size: size, modtime: stat.ModTime()})
+		file.encodings = append(file.encodings, info)
 		sort.Slice(file.encodings, func(i, j int) bool { return file.encodings[i].size < file.encodings[j].size })
-		b.StaticFilesAlternateEncodings += 1
-		b.config.Logger.Debug("added static file encoding", slog.String("path", identityPath), slog.String("filepath", path_), slog.String("encoding", encoding), slog.Int64("size", size), slog.Time("modtime", stat.ModTime()))
 	}
-	return nil
+	return file, info, nil
+}
+
+// decodingReader returns a reader of the decompressed contents of the file
+// with extension ext and the name of its encoding. Files with other extensions
+// are read as is with the identity encoding.
+func decodingReader(ext string, seeker io.ReadSeeker) (io.Reader, string, error) {
+	switch ext {
+	case ".gz":
+		r, err := gzip.NewReader(seeker)
+		return r, "gzip", err
+	case ".zst":
+		r, err := zstd.NewReader(seeker)
+		return r, "zstd", err
+	case ".br":
+		return brotli.NewReader(seeker), "br", nil
+	}
+	return seeker, "identity", nil
 }
 
 func catch(description string, fn func()) (err error) {
@@ -168,6 +232,22 @@ func catch(description string, fn func()) (err error) {
 	return
 }
 
+// skipMinify reports whether the template file at path_ opts out of
+// minification with the front matter meta or [Config.MinifyExclude].
+func (b *builder) skipMinify(path_ string, meta map[string]any) (bool, error) {
+	if v, ok := meta["minify"]; ok {
+		minify, err := cast.ToBoolE(v)
+		if err != nil {
+			return false, err
+		}
+		if !minify {
+			return true, nil
+		}
+	}
+	p := path.Clean("/" + path_)
+	return slices.ContainsFunc(b.config.MinifyExclude, func(glob string) bool { return matchPath(glob, p) }), nil
+}
+
 var routeMatcher *regexp.Regexp = regexp.MustCompile("^(GET|POST|PUT|PATCH|DELETE|SSE) (.*)$")
 
 func (b *builder) addTemplateHandler(path_ string) error {
@@ -175,13 +255,49 @@ func (b *builder) addTemplateHandler(path_ string) error {
 	if err != nil {
 		return fmt.Errorf("could not read template file '%s': %v", path_, err)
 	}
-	if b.m != nil {
+	// template files may start with a front matter metadata block
+	meta, body, err := extractTemplateFrontMatter(string(content))
+	if err != nil {
+		return fmt.Errorf("could not parse metadata of template file '%s': %v", path_, err)
+	}
+	if meta != nil {
+		// replace the metadata block with blank lines to preserve line numbers
+		skipped := len(content) - len(body)
+		content = []byte(strings.Repeat("\n", strings.Count(string(content[:skipped]), "\n")) + body)
+	}
+	source := string(content)
+	skip, err := b.skipMinify(path_, meta)
+	if err != nil {
+		return fmt.Errorf("invalid minify in metadata of template file '%s': %v", path_, err)
+	}
+	// templates that declare another content type, like a markdown alternate,
+	// aren't html
+	if ct, ok := meta["content_type"].(string); b.m != nil && !skip && (!ok || strings.HasPrefix(ct, "text/html")) {
 		content, err = b.m.Bytes("text/html", content)
 		if err != nil {
 			return fmt.Errorf("could not minify template file '%s': %v", path_, err)
 		}
 	}
 	path_ = path.Clean("/" + path_)
+	if meta != nil {
+		b.templateMeta[path_] = meta
+	}
+	limits, overridden, err := b.metaLimits(meta)
+	if err != nil {
+		return fmt.Errorf("invalid limits in metadata of template file '%s': %v", path_, err)
+	}
+	layout, err := metaLayout(meta)
+	if err != nil {
+		return fmt.Errorf("invalid metadata of template file '%s': %v", path_, err)
+	}
+	visible, err := metaVisibility(meta)
+	if err != nil {
+		return fmt.Errorf("invalid metadata of template file '%s': %v", path_, err)
+	}
+	publish, err := metaPublishState(meta)
+	if err != nil {
+		return fmt.Errorf("invalid metadata of template file '%s': %v", path_, err)
+	}
 	// parse each template file manually to have more control over its final
 	// names in the template namespace.
 	newtemplates, err := parse.Parse(path_, string(content), b.config.LDelim, b.config.RDelim, b.funcs, buliltinsSkeleton)
@@ -192,6 +308,8 @@ func (b *builder) addTemplateHandler(path_ string) error {
 
 	// add parsed templates, register handlers
 	for name, tree := range newtemplates {
+		injectLogArgs(tree)
+		b.injectBudgetArgs(tree)
 		if b.templates.Lookup(name) != nil {
 			b.config.Logger.Debug("overriding named template '%s' with definition from file: %s", name, path_)
 		}
@@ -200,9 +318,11 @@ func (b *builder) addTemplateHandler(path_ string) error {
 			return fmt.Errorf("could not add template '%s' from '%s': %v", name, path_, err)
 		}
 		b.TemplateDefinitions += 1
+		b.addTemplateSource(path_, source, b.sourceDir, name)
 
-		var pattern string
+		var pattern, page string
 		var handler http.HandlerFunc
+		kind := RouteTemplate
 		if name == path_ {
 			// don't register routes to hidden files
 			_, file := filepath.Split(path_)
@@ -220,12 +340,12 @@ func (b *builder) addTemplateHandler(path_ string) error {
 				routePath = path.Dir(routePath) + "/{$}"
 			}
 			routePath = path.Clean(routePath)
-			pattern = "GET " + routePath
+			pattern, page = "GET "+routePath, routePath
 			handler = bufferingTemplateHandler(b.Instance, tmpl)
 		} else if matches := routeMatcher.FindStringSubmatch(name); len(matches) == 3 {
 			method, path_ := matches[1], matches[2]
 			if method == "SSE" {
-				pattern = "GET " + path_
+				pattern, kind = "GET "+path_, RouteStream
 				handler = flushingTemplateHandler(b.Instance, tmpl)
 			} else {
 				pattern = method + " " + path_
@@ -234,11 +354,47 @@ func (b *builder) addTemplateHandler(path_ string) error {
 		} else {
 			continue
 		}
+		if overridden {
+			handler = withLimits(handler, limits)
+			b.routeLimits[pattern] = limits
+		}
+		if layout != "" && !strings.HasPrefix(name, "SSE ") {
+			handler = withLayout(handler, layout)
+		}
+		if visible.noindex {
+			handler = withNoIndex(handler)
+		}
+		if publish.scheduled() && !b.config.ShowDrafts {
+			handler = withPublishing(b.Instance, handler, publish)
+		}
+		if fn, ok := b.config.ViewModels[pattern]; ok {
+			handler = withViewModel(b.Instance, handler, fn)
+		}
+		if ct, ok := meta["content_type"].(string); ok && page != "" && meta["alternate"] != nil {
+			handler = withContentType(handler, ct)
+		}
+		if page != "" {
+			handler = withAlternates(b.Instance, handler, page)
+		}
 
-		if err = catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.HandleFunc(pattern, handler) }); err != nil {
+		route := newInstanceRoute(pattern, handler, kind)
+		route.Source, route.File, route.Metadata = name, path_, meta
+		route.NoIndex, route.Private = visible.noindex, visible.private
+		if ct, ok := meta["content_type"].(string); ok {
+			route.ContentType = ct
+		} else if kind == RouteStream {
+			route.ContentType = "text/event-stream"
+		}
+		if added, err := b.handleRoute(route); err != nil {
 			return err
+		} else if !added {
+			continue
+		}
+		if page != "" {
+			b.pages = append(b.pages, pageInfo{page, path_, meta, visible, publish})
 		}
-		b.routes = append(b.routes, InstanceRoute{pattern, handler})
+		b.routes = append(b.routes, route)
+		b.routeSources[pattern] = name
 		b.Routes += 1
 		b.config.Logger.Debug("added template handler", "method", "GET", "pattern", pattern, "template_path", path_)
 	}
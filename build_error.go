@@ -0,0 +1,107 @@
+package xtemplate
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BuildError is returned by [Config.Instance] when an instance fails to build.
+// It lists every failure that was found so they can be fixed at once, except
+// that the build stops at the first failing INIT template, and
+// marshals to JSON so the CLI, admin UIs, and other tools can present them
+// without parsing messages.
+type BuildError struct {
+	Failures []BuildFailure `json:"failures"`
+}
+
+// BuildFailure is one reason that an instance failed to build.
+type BuildFailure struct {
+	// Step of the build that failed: `config`, `files`, `templates`,
+	// `providers`, `init`, `routes`, or `selftest`.
+	Stage string `json:"stage"`
+
+	// Path of the template file or page that failed like `/blog/post.html`,
+	// and the line of the file if it's known.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+
+	Message string `json:"message"`
+
+	Err error `json:"-"`
+}
+
+func (e *BuildError) Error() string {
+	if len(e.Failures) == 1 {
+		return e.Failures[0].Message
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d failures:", len(e.Failures))
+	for _, f := range e.Failures {
+		b.WriteString("\n")
+		b.WriteString(f.Message)
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the failures.
+func (e *BuildError) Unwrap() []error {
+	var errs []error
+	for _, f := range e.Failures {
+		if f.Err != nil {
+			errs = append(errs, f.Err)
+		}
+	}
+	return errs
+}
+
+// LogValue logs each failure as a group of attributes.
+func (e *BuildError) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(e.Failures))
+	for i, f := range e.Failures {
+		group := []any{slog.String("stage", f.Stage), slog.String("message", f.Message)}
+		if f.File != "" {
+			group = append(group, slog.String("file", f.File))
+		}
+		if f.Line > 0 {
+			group = append(group, slog.Int("line", f.Line))
+		}
+		attrs = append(attrs, slog.Group(strconv.Itoa(i), group...))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+var _ slog.LogValuer = &BuildError{}
+
+// parseErrorLine finds the line in parse errors like `template: /a.html:3:
+// unexpected "}" in operand`.
+var parseErrorLine = regexp.MustCompile(`template: [^:]+:(\d+):`)
+
+// buildFailure describes err, which happened in file if it's not empty, in the
+// current stage of the build.
+func (b *builder) buildFailure(file string, err error) BuildFailure {
+	f := BuildFailure{Stage: b.stage, File: file, Message: err.Error(), Err: err}
+	var tmplErr *TemplateError
+	if errors.As(b.templateError(err), &tmplErr) {
+		if f.File == "" {
+			f.File = tmplErr.File
+		}
+		f.Line = tmplErr.Line
+	} else if m := parseErrorLine.FindStringSubmatch(f.Message); m != nil {
+		f.Line, _ = strconv.Atoi(m[1])
+	}
+	return f
+}
+
+// buildError returns err as a BuildError of the current stage, unless it
+// already is one.
+func (b *builder) buildError(err error) *BuildError {
+	var buildErr *BuildError
+	if errors.As(err, &buildErr) {
+		return buildErr
+	}
+	return &BuildError{Failures: []BuildFailure{b.buildFailure("", err)}}
+}
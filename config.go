@@ -8,6 +8,11 @@ import (
 	"html/template"
 	"io/fs"
 	"log/slog"
+	"net/http"
+	"path"
+	"runtime"
+	"strings"
+	"time"
 )
 
 func New() (c *Config) {
@@ -23,17 +28,252 @@ type Config struct {
 	// The FS to load templates from. Overrides TemplatesDir if not nil.
 	TemplatesFS fs.FS `json:"-" arg:"-"`
 
+	// A zip or tar.gz archive at a local path or http(s) url to load templates
+	// from, which overrides TemplatesDir. It's fetched again on every reload,
+	// allowing immutable versioned deploys of template trees.
+	TemplatesArchive string `json:"templates_archive,omitempty" arg:"--templates-archive"`
+
+	// Hex encoded sha256 checksum that TemplatesArchive must match, if set.
+	TemplatesArchiveSHA256 string `json:"templates_archive_sha256,omitempty" arg:"--templates-archive-sha256"`
+
+	// Maximum size in bytes of TemplatesArchive, and of the files extracted
+	// from it in total. Default 100MiB.
+	TemplatesArchiveMaxSize int64 `json:"templates_archive_max_size,omitempty" arg:"--templates-archive-max-size"`
+
+	// Load templates from a database table instead of TemplatesDir.
+	TemplatesDB *TemplatesDBConfig `json:"templates_db,omitempty" arg:"-"`
+
+	// Layer the templates directory on top of the built-in starter site, or
+	// serve just the starter site if the templates directory doesn't exist.
+	// Without it, a missing templates directory fails the build. Default
+	// `false`.
+	Starter bool `json:"starter,omitempty" arg:"--starter"`
+
+	// How static file validators are computed: `hash` hashes the contents of
+	// every file at load time and serves a strong ETag, `modtime` uses the
+	// modification time and size from the FS and serves a weak ETag, which
+	// avoids reading every file for backends where that is slow, like object
+	// storage. With `modtime` the value returned by .X.StaticFileHash is a
+	// version token that can't be used for subresource integrity. Default
+	// `hash`.
+	StaticValidator string `json:"static_validator,omitempty" arg:"--static-validator" default:"hash"`
+
+	// Path of a file where the content hashes of static files are saved
+	// between builds, keyed by path, size, and modification time, so rebuilds
+	// of large asset trees only hash the files that changed. Static files
+	// are hashed in parallel either way. Default disabled.
+	StaticHashCache string `json:"static_hash_cache,omitempty" arg:"--static-hash-cache"`
+
+	// Static files larger than this many bytes aren't read to hash them, and
+	// are served with a weak ETag derived from their modification time and
+	// size like with the `modtime` StaticValidator, so huge media files don't
+	// slow down builds. Default no limit.
+	StaticHashMaxSize int64 `json:"static_hash_max_size,omitempty" arg:"--static-hash-max-size"`
+
+	// Sizes of the worker pools of an instance, so its CPU and connection use
+	// is predictable in containers with CPU limits. Set GOMAXPROCS to the CPU
+	// limit of the container to scale all defaults together.
+	//
+	// Number of static files hashed concurrently while building an instance.
+	// Default GOMAXPROCS.
+	BuildWorkers int `json:"build_workers,omitempty" arg:"--build-workers"`
+	// Number of webhooks that the outbox delivers concurrently. Default
+	// GOMAXPROCS.
+	WebhookWorkers int `json:"webhook_workers,omitempty" arg:"--webhook-workers"`
+	// Number of background jobs run concurrently, like verifying received
+	// webmentions. Default GOMAXPROCS.
+	JobWorkers int `json:"job_workers,omitempty" arg:"--job-workers"`
+	// Number of images read concurrently by .Image of fs dot providers.
+	// Default GOMAXPROCS.
+	ImageWorkers int `json:"image_workers,omitempty" arg:"--image-workers"`
+
+	// Resolve static files against the FS when they're requested instead of
+	// registering a route for each file when the instance is built, so large
+	// static trees load quickly and files can be added or changed without a
+	// reload. Routes with an exact path take precedence over static files.
+	// Default `false`.
+	DynamicStatic bool `json:"dynamic_static,omitempty" arg:"--dynamic-static"`
+
+	// How long the result of looking up a static file is cached with
+	// DynamicStatic, including for files that don't exist. Default 5s.
+	DynamicStaticTTL time.Duration `json:"dynamic_static_ttl,omitempty" arg:"--dynamic-static-ttl"`
+
 	// File extension to search for to find template files. Default `.html`.
 	TemplateExtension string `json:"template_extension,omitempty" arg:"--template-ext" default:".html"`
 
+	// Directory in the templates dir whose `.json`, `.yaml`, and `.toml` files
+	// are parsed when the instance is built and available to all templates at
+	// [DotX.Data], for site-wide data like menus, authors, or pricing tables.
+	// Files in it aren't routed. Default `_data`.
+	DataDir string `json:"data_dir,omitempty" arg:"--data-dir" default:"_data"`
+
 	// Whether html templates are minified at load time. Default `true`.
 	Minify bool `json:"minify,omitempty" arg:"-m,--minify" default:"true"`
 
-	Databases       []DotDBConfig    `json:"databases" arg:"-"`
-	Flags           []DotFlagsConfig `json:"flags" arg:"-"`
-	Directories     []DotDirConfig   `json:"directories" arg:"-"`
-	Nats            []DotNatsConfig  `json:"nats" arg:"-"`
-	CustomProviders []DotConfig      `json:"-" arg:"-"`
+	// Globs like in [AccessRule] of template files like `/embeds/**` that
+	// aren't minified, for pages with inline scripts or templates that the
+	// minifier mangles. A template file can also opt out with `minify: false`
+	// in its front matter.
+	MinifyExclude []string `json:"minify_exclude,omitempty" arg:"--minify-exclude,separate"`
+
+	Databases       []DotDBConfig       `json:"databases" arg:"-"`
+	Flags           []DotFlagsConfig    `json:"flags" arg:"-"`
+	Directories     []DotDirConfig      `json:"directories" arg:"-"`
+	Nats            []DotNatsConfig     `json:"nats" arg:"-"`
+	LDAP            []DotLDAPConfig     `json:"ldap,omitempty" arg:"-"`
+	WebAuthn        []DotWebAuthnConfig `json:"webauthn,omitempty" arg:"-"`
+	Audit           []DotAuditConfig    `json:"audit,omitempty" arg:"-"`
+	GraphQL         []DotGraphQLConfig  `json:"graphql,omitempty" arg:"-"`
+	GRPC            []DotGRPCConfig     `json:"grpc,omitempty" arg:"-"`
+	Fetch           []DotFetchConfig    `json:"fetch,omitempty" arg:"-"`
+	CustomProviders []DotConfig         `json:"-" arg:"-"`
+
+	// Alert when the rate of error responses for a route exceeds a threshold.
+	ErrorAlert *ErrorRateAlert `json:"error_alert,omitempty" arg:"-"`
+
+	// Record requests to disk so they can be replayed for debugging.
+	Record *RecordConfig `json:"record,omitempty" arg:"-"`
+
+	// Mirror a sample of matched requests to another server or handler.
+	Mirror *MirrorConfig `json:"mirror,omitempty" arg:"-"`
+
+	// Generate admin pages for the tables of a database.
+	Admin *AdminConfig `json:"admin,omitempty" arg:"-"`
+
+	// Accept authenticated content webhooks that purge caches or reload.
+	Webhook *WebhookConfig `json:"webhook,omitempty" arg:"-"`
+
+	// Send outbound webhooks through an outbox table in a database.
+	Outbox *OutboxConfig `json:"outbox,omitempty" arg:"-"`
+
+	// Count page views, downloads, and the like in a database or a shared
+	// bucket.
+	Counters *CountersConfig `json:"counters,omitempty" arg:"-"`
+
+	// Give each request a temporary directory as the .Tmp dot field that is
+	// removed when the request completes.
+	Tmp *TmpConfig `json:"tmp,omitempty" arg:"-"`
+
+	// Cache the responses of template routes in memory or a shared bucket.
+	ResponseCache *ResponseCacheConfig `json:"response_cache,omitempty" arg:"-"`
+
+	// Replay the stored response to requests that repeat an idempotency key.
+	Idempotency *IdempotencyConfig `json:"idempotency,omitempty" arg:"-"`
+
+	// Require API keys with quotas for some paths. See [APIKeysConfig].
+	APIKeys *APIKeysConfig `json:"api_keys,omitempty" arg:"-"`
+
+	// Delay and fail requests to some paths to use templates as a mock API
+	// server. See [MockConfig].
+	Mock *MockConfig `json:"mock,omitempty" arg:"-"`
+
+	// Receive webmentions and store them in a database.
+	Webmention *WebmentionConfig `json:"webmention,omitempty" arg:"-"`
+
+	// Receive Content-Security-Policy violation reports, and log and store
+	// them.
+	CSPReport *CSPReportConfig `json:"csp_report,omitempty" arg:"-"`
+
+	// Serve a WebFinger document for the site owner.
+	WebFinger *WebFingerConfig `json:"webfinger,omitempty" arg:"-"`
+
+	// Generate a sitemap of the site's pages.
+	Sitemap *SitemapConfig `json:"sitemap,omitempty" arg:"-"`
+
+	// Serve template routes under a path prefix for each locale.
+	Locale *LocaleConfig `json:"locale,omitempty" arg:"-"`
+
+	// The default timezone of requests used by .Req.Date and related methods.
+	// Default `UTC`.
+	Timezone string `json:"timezone,omitempty" arg:"--timezone"`
+
+	// If set, the name of a cookie that holds the IANA timezone name of the
+	// client, which overrides Timezone for that request.
+	TimezoneCookie string `json:"timezone_cookie,omitempty" arg:"--timezone-cookie"`
+
+	// Url template used by the avatar func, with {hash}, {size}, and {default}
+	// placeholders. Default [DefaultAvatarURL] (gravatar).
+	AvatarURL string `json:"avatar_url,omitempty" arg:"--avatar-url"`
+
+	// Path of an endpoint that serves the stats of the instance and the
+	// metrics of its dot providers in the Prometheus text format, like
+	// `/metrics`. See [MetricsDotProvider]. Default disabled.
+	MetricsPath string `json:"metrics_path,omitempty" arg:"--metrics-path"`
+
+	// Serve the operational endpoints that container orchestrators like
+	// Kubernetes expect with [Server.Serve]: `/livez`, `/readyz`, `/metrics`,
+	// and `/buildz`, and drain requests gracefully on SIGTERM. Requires
+	// OpsListen. Default `false`.
+	Ops bool `json:"ops,omitempty" arg:"--ops"`
+
+	// Address like `:9090` of the listener for the Ops endpoints, which is
+	// separate from the site's so metrics and build errors aren't exposed with
+	// the site. Required with Ops.
+	OpsListen string `json:"ops_listen,omitempty" arg:"--ops-listen"`
+
+	// How long the server keeps serving requests after SIGTERM while
+	// `/readyz` fails, before it stops accepting connections, so the
+	// orchestrator notices and stops routing new requests to it first, with
+	// Ops. Default 5s.
+	ShutdownDelay time.Duration `json:"shutdown_delay,omitempty" arg:"--shutdown-delay"`
+
+	// How long requests in flight may take to complete after SIGTERM before
+	// they're cancelled, with Ops. Keep it below the termination grace period
+	// of the orchestrator. Default 25s.
+	ShutdownGracePeriod time.Duration `json:"shutdown_grace_period,omitempty" arg:"--shutdown-grace-period"`
+
+	// Log only the first this many occurrences of each distinct template
+	// execution error, and then every ErrorLogSample-th occurrence with a
+	// count, so a broken page with a lot of traffic doesn't flood the logs.
+	// Default 0, every error is logged.
+	ErrorLogBurst int `json:"error_log_burst,omitempty" arg:"--error-log-burst"`
+
+	// How often repeated template errors are logged after ErrorLogBurst
+	// occurrences. Default 100.
+	ErrorLogSample int `json:"error_log_sample,omitempty" arg:"--error-log-sample"`
+
+	// Maximum duration of writing a response by [Server.Serve], which protects
+	// against slow clients. Streaming routes like SSE are exempt, see
+	// StreamWriteTimeout. Default no limit.
+	WriteTimeout time.Duration `json:"write_timeout,omitempty" arg:"--write-timeout"`
+
+	// Maximum duration of each flush of streaming routes like SSE. The write
+	// deadline of their connection is extended by this before every flush, so
+	// long lived streams aren't cut off by WriteTimeout but a client that
+	// stops reading is. Default no deadline for streaming routes.
+	StreamWriteTimeout time.Duration `json:"stream_write_timeout,omitempty" arg:"--stream-write-timeout"`
+
+	// Average duration of flushes of streaming routes above which the client
+	// is considered slow, see [DotFlush.Slow]. Default 100ms.
+	StreamSlowFlush time.Duration `json:"stream_slow_flush,omitempty" arg:"--stream-slow-flush"`
+
+	// Certificate and key files to serve HTTPS with [Server.Serve] instead of
+	// HTTP.
+	TLSCert string `json:"tls_cert,omitempty" arg:"--tls-cert"`
+	TLSKey  string `json:"tls_key,omitempty" arg:"--tls-key"`
+
+	// Also serve HTTP/3 over QUIC on the same UDP port, advertised to HTTPS
+	// clients with the Alt-Svc header. Requires TLSCert.
+	HTTP3 bool `json:"http3,omitempty" arg:"--http3"`
+
+	// File of PEM encoded CA certificates that TLS client certificates are
+	// verified against. Clients aren't required to present a certificate
+	// unless an [AccessRule] requires it.
+	TLSClientCA string `json:"tls_client_ca,omitempty" arg:"--tls-client-ca"`
+
+	// Restrict access to paths by client ip, evaluated before routing.
+	AccessRules []AccessRule `json:"access_rules,omitempty" arg:"-"`
+
+	// IP addresses or CIDR ranges of reverse proxies whose X-Forwarded-For
+	// header is trusted to determine the client ip.
+	TrustedProxies []string `json:"trusted_proxies,omitempty" arg:"--trusted-proxy,separate"`
+
+	// Static response headers added to paths matching a glob.
+	HeaderRules []HeaderRule `json:"header_rules,omitempty" arg:"-"`
+
+	// Whether to provide a navigation tree generated from the template file
+	// hierarchy as the .Nav dot field. Default `false`.
+	Navigation bool `json:"navigation,omitempty" arg:"--nav"`
 
 	// Left template action delimiter. Default `{{`.
 	LDelim string `json:"left,omitempty" arg:"--ldelim" default:"{{"`
@@ -41,15 +281,224 @@ type Config struct {
 	// Right template action delimiter. Default `}}`.
 	RDelim string `json:"right,omitempty" arg:"--rdelim" default:"}}"`
 
+	// Deadline for executing buffered templates, after which the request
+	// fails with 503 Service Unavailable. Templates can override it with the
+	// `timeout` front matter key. Default no deadline.
+	Timeout time.Duration `json:"timeout,omitempty" arg:"--timeout"`
+
+	// Maximum size in bytes of request bodies read by buffered templates,
+	// larger bodies fail with 413 Request Entity Too Large. Templates can
+	// override it with the `max_request_body` front matter key. Default no
+	// limit.
+	MaxRequestBody int64 `json:"max_request_body,omitempty" arg:"--max-request-body"`
+
+	// Maximum size in bytes of the output of buffered templates. Templates can
+	// override it with the `max_buffer` front matter key. Default no limit.
+	MaxBufferSize int64 `json:"max_buffer,omitempty" arg:"--max-buffer"`
+
+	// What happens when a template file and a static file are routed at the
+	// same pattern, like `about.html` and `about`: `fail` the build, or
+	// prefer the `template` or the `static` file and log a warning about the
+	// other. Conflicts between routes of the same kind always fail the build.
+	// Either way the error or warning names the files of both routes.
+	// Default `fail`.
+	RouteConflicts string `json:"route_conflicts,omitempty" arg:"--route-conflicts"`
+
+	// Files of redirects to serve, for migrations of legacy sites: `.csv`
+	// files with rows of `from,to[,status]`, or nginx map snippets in `.map`
+	// or `.conf` files with entries like `/old-page /new-page;`. The status
+	// defaults to 301. Invalid rules, redirects from the same path to
+	// different targets, loops, and redirects that conflict with other routes
+	// fail the build with the file and line of each.
+	RedirectFiles []string `json:"redirect_files,omitempty" arg:"--redirects,separate"`
+
+	// Maximum number of rows that a database query returns to a template,
+	// queries with more rows fail instead of ranging over all of them. Page
+	// through large results with [DotDB.QueryPage]. Default no limit.
+	MaxQueryRows int `json:"max_query_rows,omitempty" arg:"--max-query-rows"`
+
+	// Maximum depth of nested .X.Template and .X.TryTemplate calls, which
+	// stops templates that invoke themselves from recursing until the stack
+	// overflows. Default 100.
+	MaxTemplateDepth int `json:"max_template_depth,omitempty" arg:"--max-template-depth"`
+
+	// Maximum number of template func calls in a request, which stops
+	// templates that call expensive funcs in a loop. Calls of builtins like
+	// `len` and of methods of the dot aren't counted. Default no limit.
+	MaxFuncCalls int `json:"max_func_calls,omitempty" arg:"--max-func-calls"`
+
+	// Maximum number of range iterations in a request, which stops templates
+	// that loop over huge values. Ranges over slices, maps, and integers count
+	// their length before they start, ranges over channels aren't counted.
+	// Default no limit.
+	//
+	// Func calls and range iterations are counted in templates executed with
+	// the dot of the route, in templates executed with a different dot by
+	// .X.Template each range is limited on its own and func calls aren't
+	// counted.
+	MaxRangeIterations int `json:"max_range_iterations,omitempty" arg:"--max-range-iterations"`
+
 	// Additional functions to add to the template execution context.
 	FuncMaps []template.FuncMap `json:"-" arg:"-"`
 
+	// Called at build time to get additional routes that are served by shared
+	// templates. See [VirtualRoute].
+	VirtualRoutes func(ctx context.Context) ([]VirtualRoute, error) `json:"-" arg:"-"`
+
+	// Called for each request to get providers that replace the dot fields
+	// with the same field names for that request, like a database chosen by
+	// tenant middleware. See [WithDotOverrides].
+	DotOverrides func(ctx context.Context, r *http.Request) []DotConfig `json:"-" arg:"-"`
+
+	// Keys of request context values that templates can read with
+	// [DotReq.ContextValue], keyed by the name used in templates. See
+	// [WithContextKey].
+	ContextKeys map[string]any `json:"-" arg:"-"`
+
+	// Match the literal segments of route paths regardless of case, and
+	// redirect GET and HEAD requests to the path with the case of the route,
+	// for content migrated from sites with case-insensitive urls. Path globs
+	// of rules, like [AccessRule], match the path with the case of the route.
+	// Ignored if NewRouter is set. See [NewCaseInsensitiveRouter]. Default
+	// `false`.
+	CaseInsensitiveRoutes bool `json:"case_insensitive_routes,omitempty" arg:"--case-insensitive-routes"`
+
+	// Redirect GET and HEAD requests whose path isn't in Unicode
+	// normalization form C to the normalized path, and route other requests
+	// by the normalized path, so paths typed or linked in decomposed form
+	// match routes. Default `false`.
+	NormalizeUnicode bool `json:"normalize_unicode,omitempty" arg:"--normalize-unicode"`
+
+	// Creates the router of each instance. Default [http.NewServeMux]. See
+	// [Router].
+	NewRouter func() Router `json:"-" arg:"-"`
+
+	// Funcs that prepare the data of template routes, keyed by route pattern.
+	// See [WithViewModel].
+	ViewModels map[string]ViewModelFunc `json:"-" arg:"-"`
+
+	// Path prefixes like `/api/*` that are proxied to an upstream server like
+	// `http://localhost:3000`, so a separate API can be served from the same
+	// origin during development. Paths aren't rewritten. Not intended for
+	// production, so the xtemplate command refuses to start with it unless it
+	// watches templates or directories for changes.
+	DevProxy map[string]string `json:"dev_proxy,omitempty" arg:"--dev-proxy"`
+
+	// Remote assets like web fonts and third-party scripts that are cached
+	// and served from a path of the site. See [AssetProxy].
+	AssetProxies []AssetProxy `json:"asset_proxies,omitempty" arg:"-"`
+
+	// Check the html output of buffered template handlers for unclosed tags,
+	// duplicate ids, and images without alt text, and log the problems with
+	// the name of the template. Also warns about structured data rendered with
+	// the jsonld func that lacks required properties. Output of templates
+	// stopped with the halt or abort funcs isn't checked, since it's usually
+	// incomplete. Intended for development. Default `false`.
+	ValidateHTML bool `json:"validate_html,omitempty" arg:"--validate-html"`
+
+	// Render every GET page after building an instance like [SelfTest], and
+	// fail the build if any page fails, so a reload with a broken page keeps
+	// the current instance and a deploy with one fails to start. Pages are
+	// rendered like any other request, so only enable it for sites without
+	// side effects on GET. Default `false`.
+	BuildSelfTest bool `json:"build_self_test,omitempty" arg:"--build-self-test"`
+
+	// Wrap every template func, including those of FuncMaps, with a shim that
+	// logs calls that take longer than this duration, calls that panic, and
+	// calls that modify a map or slice passed as an argument, which is shared
+	// state that other requests may use concurrently. Modifying an argument
+	// while another call is using the same map or slice is logged as a data
+	// race. Helps find bugs in custom funcs. Intended for development. Default
+	// disabled.
+	AuditFuncs time.Duration `json:"audit_funcs,omitempty" arg:"--audit-funcs"`
+
+	// Serve template files marked as `draft` or with a future `publishDate`
+	// in their front matter like published ones, and include them in the
+	// sitemap and navigation, for previewing content during development.
+	// Default `false`, unpublished templates respond with 404 Not Found.
+	ShowDrafts bool `json:"show_drafts,omitempty" arg:"--show-drafts"`
+
+	// A secret that shows unpublished content to requests that pass it in the
+	// `preview` query parameter, which is remembered in a cookie, like
+	// `/blog/next-post?preview=...`. Default disabled.
+	PreviewToken string `json:"preview_token,omitempty" arg:"--preview-token"`
+
+	// Key that signs expiring preview links, which show unpublished content
+	// like PreviewToken, but only at the linked path and the paths below it,
+	// and stop working after their ttl. Create them with
+	// [Config.PreviewLink], .Req.PreviewLink, or the preview-link command.
+	// Responses to preview requests aren't cached. Default disabled.
+	PreviewSecret string `json:"preview_secret,omitempty" arg:"--preview-secret"`
+
+	// Secret that authenticates requests to the admin pages, the template
+	// playground, and the render diff endpoint, sent as `Authorization: Bearer
+	// <token>` or as the password of basic auth. Without it, they only accept
+	// requests from loopback addresses, and the server must listen on a
+	// loopback address. See [AdminConfig]. Default disabled.
+	AdminToken string `json:"admin_token,omitempty" arg:"--admin-token"`
+
+	// Path of an endpoint like `/_diff?path=/blog` that renders a route with
+	// both the current instance and the instance it replaced on the last
+	// reload, and responds with a diff of the html structure. The previous
+	// instance is kept running until the next reload. Only available when
+	// serving with a [Server], and authorized like the admin endpoints with
+	// AdminToken. Intended for development. Default disabled.
+	RenderDiffPath string `json:"render_diff_path,omitempty" arg:"--render-diff-path"`
+
+	// Path of a page where template source can be submitted and executed with
+	// the templates and funcs of the instance, against the dot of a selected
+	// route. Runs are limited by the route's timeout and buffer size, and their
+	// database transactions are rolled back, but other side effects like KV
+	// writes and published messages are not. It requires AdminToken unless the
+	// server only listens on a loopback address, and rejects runs submitted by
+	// other sites. Never enable it in production. Default disabled.
+	PlaygroundPath string `json:"playground_path,omitempty" arg:"--playground-path"`
+
+	// Rewriters applied in order to the output of buffered template handlers.
+	OutputRewriters []OutputRewriter `json:"-" arg:"-"`
+
+	// If set, references to fingerprinted static files (those with a `hash`
+	// query parameter) in src and href attributes of template output are
+	// rewritten to be served from this base url, e.g. a CDN origin.
+	AssetBaseURL string `json:"asset_base_url,omitempty" arg:"--asset-base-url"`
+
+	// Maximum size in bytes of a css or js file, after it's minified, that
+	// .X.Inline embeds in the page. Larger files are linked instead, see
+	// [DotX.Inline]. Default 8KiB.
+	MaxInlineSize int64 `json:"max_inline_size,omitempty" arg:"--max-inline-size"`
+
 	// The instance context that is threaded through dot providers and can
 	// cancel the server. Defaults to `context.Background()`.
 	Ctx context.Context `json:"-" arg:"-"`
 
 	// The default logger. Defaults to `slog.Default()`.
 	Logger *slog.Logger `json:"-" arg:"-"`
+
+	// RequestLogAttrs is called at the start of every request to add custom
+	// attributes like tenant, user, or region to the request-scoped logger.
+	RequestLogAttrs func(r *http.Request) []slog.Attr `json:"-" arg:"-"`
+
+	// Where the id that is logged with every message of a request comes from,
+	// so logs can be correlated with the services in front of xtemplate. The
+	// first source that returns an id is used, then RequestIDHeaders, or else
+	// RequestIDGenerator makes a new one. Default [CaddyRequestID].
+	RequestIDSources []RequestIDSource `json:"-" arg:"-"`
+
+	// Request headers like `X-Request-Id` that hold an id assigned by a proxy.
+	// Only list headers that trusted proxies set, since clients can send any
+	// value. Ids longer than 128 bytes or with spaces or control characters
+	// are ignored.
+	RequestIDHeaders []string `json:"request_id_headers,omitempty" arg:"--request-id-header,separate"`
+
+	// Generates ids for requests that don't have one. Default random uuids.
+	RequestIDGenerator func() string `json:"-" arg:"-"`
+
+	// Response header like `X-Request-Id` that the request id is sent in, so
+	// users can reference it when they report a problem. Default none.
+	RequestIDResponseHeader string `json:"request_id_response_header,omitempty" arg:"--request-id-response-header"`
+
+	// reload is set by [Server] to reload the instance in the background.
+	reload func()
 }
 
 // FillDefaults sets default values for unset fields
@@ -78,6 +527,43 @@ func (config *Config) Defaults() *Config {
 		config.Ctx = context.Background()
 	}
 
+	if config.DataDir == "" {
+		config.DataDir = "_data"
+	}
+	config.DataDir = strings.Trim(path.Clean("/"+config.DataDir), "/")
+
+	if config.RouteConflicts == "" {
+		config.RouteConflicts = "fail"
+	}
+
+	if config.MaxInlineSize <= 0 {
+		config.MaxInlineSize = 8 << 10
+	}
+
+	if config.MaxTemplateDepth <= 0 {
+		config.MaxTemplateDepth = 100
+	}
+
+	if config.TemplatesArchiveMaxSize <= 0 {
+		config.TemplatesArchiveMaxSize = 100 << 20
+	}
+
+	if config.BuildWorkers <= 0 {
+		config.BuildWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	if config.WebhookWorkers <= 0 {
+		config.WebhookWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	if config.JobWorkers <= 0 {
+		config.JobWorkers = runtime.GOMAXPROCS(0)
+	}
+
+	if config.ImageWorkers <= 0 {
+		config.ImageWorkers = runtime.GOMAXPROCS(0)
+	}
+
 	return config
 }
 
@@ -112,6 +598,16 @@ func WithLogger(logger *slog.Logger) Option {
 	}
 }
 
+func WithRequestLogAttrs(fn func(r *http.Request) []slog.Attr) Option {
+	return func(c *Config) error {
+		if fn == nil {
+			return fmt.Errorf("nil request log attrs func")
+		}
+		c.RequestLogAttrs = fn
+		return nil
+	}
+}
+
 func WithFuncMaps(fm ...template.FuncMap) Option {
 	return func(c *Config) error {
 		c.FuncMaps = append(c.FuncMaps, fm...)
@@ -125,3 +621,39 @@ func WithProvider(p DotConfig) Option {
 		return nil
 	}
 }
+
+// WithContextKey lets templates read the request context value of key by name
+// with [DotReq.ContextValue]. Only registered keys can be read, since context
+// values can be internal to the middleware that sets them.
+func WithContextKey(name string, key any) Option {
+	return func(c *Config) error {
+		if name == "" || key == nil {
+			return fmt.Errorf("context key name and key must be set")
+		}
+		if c.ContextKeys == nil {
+			c.ContextKeys = make(map[string]any)
+		}
+		c.ContextKeys[name] = key
+		return nil
+	}
+}
+
+// WithDotOverrides sets a hook that returns providers to use instead of the
+// configured providers with the same field names for a request. The dot fields
+// are fixed when the instance is built, so every overriding provider must have
+// the field name of a configured provider and return values of the same type.
+// Init isn't called on overriding providers, so initialize them beforehand, for
+// example once per tenant:
+//
+//	xtemplate.WithDotOverrides(func(ctx context.Context, r *http.Request) []xtemplate.DotConfig {
+//		if tenant, ok := r.Context().Value(tenantKey).(*Tenant); ok {
+//			return []xtemplate.DotConfig{tenant.DB} // *xtemplate.DotDBConfig named "DB"
+//		}
+//		return nil
+//	})
+func WithDotOverrides(fn func(ctx context.Context, r *http.Request) []DotConfig) Option {
+	return func(c *Config) error {
+		c.DotOverrides = fn
+		return nil
+	}
+}
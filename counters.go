@@ -0,0 +1,284 @@
+package xtemplate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// CountersConfig configures persistent counters, like page view or download
+// counts, that templates increment with the .Counters dot field. Increments
+// are kept in memory and written in batches every FlushInterval, so counting
+// a request doesn't cost a write, and at most the increments of the last
+// interval are lost if the process exits before they're written.
+//
+// Counts are stored in a table of a database provider, or in a key value
+// bucket of a nats provider if Nats is set, which instances that share the
+// bucket update together.
+type CountersConfig struct {
+	// Name of the database provider that stores counts. Defaults to the first
+	// database.
+	Database string `json:"database,omitempty"`
+
+	// Name of the table that stores counts, which is created if it doesn't
+	// exist. Default `counters`.
+	Table string `json:"table,omitempty"`
+
+	// Name of a nats provider whose key value bucket stores counts instead of
+	// the database.
+	Nats string `json:"nats,omitempty"`
+
+	// Name of the key value bucket. Default `xtemplate_counters`.
+	Bucket string `json:"bucket,omitempty"`
+
+	// How often increments are written. Default 5s.
+	FlushInterval time.Duration `json:"flush_interval,omitempty"`
+}
+
+func WithCounters(config CountersConfig) Option {
+	return func(c *Config) error {
+		c.Counters = &config
+		return nil
+	}
+}
+
+type counters struct {
+	config CountersConfig
+	db     *DotDBConfig
+	kv     jetstream.KeyValue
+
+	// increments that weren't written yet, by counter name
+	mu      sync.Mutex
+	pending map[string]int64
+}
+
+func newCounters(config CountersConfig) *counters {
+	if config.Table == "" {
+		config.Table = "counters"
+	}
+	if config.Bucket == "" {
+		config.Bucket = "xtemplate_counters"
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	return &counters{config: config, pending: map[string]int64{}}
+}
+
+// dotCountersProvider provides the .Counters dot field. Its storage is set
+// when the counters are started.
+type dotCountersProvider struct {
+	*counters
+}
+
+func (dotCountersProvider) FieldName() string            { return "Counters" }
+func (dotCountersProvider) Init(_ context.Context) error { return nil }
+func (p dotCountersProvider) Value(r Request) (any, error) {
+	return DotCounters{p.counters, r.R.Context()}, nil
+}
+
+var _ DotConfig = dotCountersProvider{}
+
+// DotCounters is used as the .Counters dot field when [Config.Counters] is
+// set, and increments and reads persistent counters:
+//
+//	<p>{{.Counters.Incr "pageviews:home"}} views</p>
+//	<p>{{.Counters.Get "downloads:report"}} downloads</p>
+type DotCounters struct {
+	c   *counters
+	ctx context.Context
+}
+
+// Incr adds 1, or by if it's given, to the counter name, and returns its new
+// count.
+func (d DotCounters) Incr(name string, by ...int64) (int64, error) {
+	if len(by) > 1 {
+		return 0, fmt.Errorf("too many increment arguments")
+	}
+	if name == "" {
+		return 0, fmt.Errorf("counter name is required")
+	}
+	delta := int64(1)
+	if len(by) == 1 {
+		delta = by[0]
+	}
+	d.c.mu.Lock()
+	d.c.pending[name] += delta
+	d.c.mu.Unlock()
+	return d.Get(name)
+}
+
+// Get returns the count of the counter name, which is 0 if it was never
+// incremented.
+func (d DotCounters) Get(name string) (int64, error) {
+	count, _, err := d.c.stored(d.ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read counter '%s': %w", name, err)
+	}
+	d.c.mu.Lock()
+	count += d.c.pending[name]
+	d.c.mu.Unlock()
+	return count, nil
+}
+
+// startCounters connects the counters to the configured database or nats
+// provider, which must already be initialized, and writes increments every
+// FlushInterval until the instance is retired.
+func (b *builder) startCounters(c *counters, dot []DotConfig) error {
+	if c.config.Nats != "" {
+		i := slices.IndexFunc(dot, func(d DotConfig) bool {
+			n, ok := d.(*DotNatsConfig)
+			return ok && n.Name == c.config.Nats
+		})
+		if i < 0 {
+			return fmt.Errorf("counters nats provider not found: '%s'", c.config.Nats)
+		}
+		kv, err := dot[i].(*DotNatsConfig).js.CreateOrUpdateKeyValue(b.config.Ctx, jetstream.KeyValueConfig{Bucket: c.config.Bucket})
+		if err != nil {
+			return fmt.Errorf("failed to create counters bucket '%s': %w", c.config.Bucket, err)
+		}
+		c.kv = kv
+	} else {
+		c.db = findDotDB(dot, c.config.Database)
+		if c.db == nil {
+			return fmt.Errorf("counters database provider not found: '%s'", c.config.Database)
+		}
+		if !sqlIdentifier.MatchString(c.config.Table) {
+			return fmt.Errorf("invalid counters table name: '%s'", c.config.Table)
+		}
+		_, err := c.db.DB.ExecContext(b.config.Ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			name TEXT NOT NULL PRIMARY KEY,
+			count INTEGER NOT NULL
+		)`, c.config.Table))
+		if err != nil {
+			return fmt.Errorf("failed to create counters table: %w", err)
+		}
+	}
+	go c.run(b.config.Ctx, b.config.Logger.WithGroup("counters"))
+	return nil
+}
+
+// run writes pending increments every FlushInterval, and once more when ctx
+// is cancelled.
+func (c *counters) run(ctx context.Context, log *slog.Logger) {
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.flush(context.WithoutCancel(ctx), log)
+			return
+		case <-ticker.C:
+			c.flush(ctx, log)
+		}
+	}
+}
+
+// flush writes the pending increments. Increments that fail to be written
+// are kept to retry with the next flush.
+func (c *counters) flush(ctx context.Context, log *slog.Logger) {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = map[string]int64{}
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	var failed map[string]int64
+	var err error
+	if c.kv != nil {
+		failed = map[string]int64{}
+		for name, delta := range pending {
+			if e := c.addKV(ctx, name, delta); e != nil {
+				failed[name], err = delta, e
+			}
+		}
+	} else if err = c.addDB(ctx, pending); err != nil {
+		failed = pending
+	}
+	if len(failed) > 0 {
+		log.Warn("failed to write counters", slog.Int("counters", len(failed)), slog.Any("error", err))
+		c.mu.Lock()
+		for name, delta := range failed {
+			c.pending[name] += delta
+		}
+		c.mu.Unlock()
+		return
+	}
+	log.Debug("wrote counters", slog.Int("counters", len(pending)))
+}
+
+func (c *counters) addDB(ctx context.Context, pending map[string]int64) error {
+	tx, err := c.db.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt := fmt.Sprintf("INSERT INTO %s (name, count) VALUES (?, ?) ON CONFLICT (name) DO UPDATE SET count = count + excluded.count", c.config.Table)
+	for name, delta := range pending {
+		if _, err := tx.ExecContext(ctx, stmt, name, delta); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// addKV adds delta to the count in the bucket, retrying if another instance
+// updates it concurrently.
+func (c *counters) addKV(ctx context.Context, name string, delta int64) (err error) {
+	key := counterKey(name)
+	for range 5 {
+		var count int64
+		var revision uint64
+		count, revision, err = c.stored(ctx, name)
+		if err != nil {
+			return err
+		}
+		value := []byte(strconv.FormatInt(count+delta, 10))
+		if revision == 0 {
+			_, err = c.kv.Create(ctx, key, value)
+		} else {
+			_, err = c.kv.Update(ctx, key, value, revision)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// stored returns the written count of the counter name, and its revision in
+// the bucket.
+func (c *counters) stored(ctx context.Context, name string) (count int64, revision uint64, err error) {
+	if c.kv != nil {
+		entry, err := c.kv.Get(ctx, counterKey(name))
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			return 0, 0, nil
+		} else if err != nil {
+			return 0, 0, err
+		}
+		count, err = strconv.ParseInt(string(entry.Value()), 10, 64)
+		return count, entry.Revision(), err
+	}
+	err = c.db.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT count FROM %s WHERE name = ?", c.config.Table), name).Scan(&count)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	return count, 0, err
+}
+
+// counterKey encodes a counter name as a valid bucket key, since names like
+// `pageviews:home` contain characters that keys can't.
+func counterKey(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
@@ -0,0 +1,251 @@
+package xtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CSPReportConfig configures an endpoint that receives the reports browsers
+// send when a page violates its Content-Security-Policy, so operators see
+// what a policy breaks before enforcing it. Point the policy at the endpoint
+// with a [HeaderRule], preferably as Content-Security-Policy-Report-Only
+// while a policy is new:
+//
+//	{"path": "/**", "headers": {
+//	  "Content-Security-Policy-Report-Only": "default-src 'self'; report-uri /csp-report; report-to csp",
+//	  "Reporting-Endpoints": "csp=\"/csp-report\""}}
+//
+// Both the legacy `application/csp-report` format of report-uri and the
+// `application/reports+json` format of the Reporting API are accepted. Each
+// report is logged, and stored in a table of a database provider if Database
+// is set, which is created if it doesn't exist.
+type CSPReportConfig struct {
+	// Path of the receiving endpoint. Default `/csp-report`.
+	Path string `json:"path,omitempty"`
+
+	// Name of the database provider that stores reports. Default reports are
+	// only logged.
+	Database string `json:"database,omitempty"`
+
+	// Name of the table that stores reports. Default `csp_reports`.
+	Table string `json:"table,omitempty"`
+
+	// Maximum number of reports accepted per minute, beyond which reports are
+	// dropped with 429 Too Many Requests, since a single page view can
+	// trigger many reports. Default 60.
+	RateLimit int `json:"rate_limit,omitempty"`
+}
+
+func WithCSPReport(report CSPReportConfig) Option {
+	return func(c *Config) error {
+		c.CSPReport = &report
+		return nil
+	}
+}
+
+// CSPReport is a Content-Security-Policy violation reported by a browser.
+type CSPReport struct {
+	// The url of the page that violated the policy.
+	DocumentURL string `json:"document_url"`
+	// The url or kind of the resource that was blocked, like `inline` or
+	// `eval`.
+	BlockedURL string `json:"blocked_url"`
+	// The directive that was violated, like `script-src-elem`.
+	Directive string `json:"directive"`
+	// `enforce` or `report`, if the browser sent it.
+	Disposition string `json:"disposition,omitempty"`
+	// The location of the violation and the first characters of the inline
+	// script or style that caused it, if the browser sent them.
+	SourceFile string `json:"source_file,omitempty"`
+	Line       int    `json:"line,omitempty"`
+	Column     int    `json:"column,omitempty"`
+	Sample     string `json:"sample,omitempty"`
+}
+
+// cspReportBodyLimit is the maximum size of the body of a report request.
+const cspReportBodyLimit = 64 << 10
+
+type cspReports struct {
+	instance *Instance
+	config   CSPReportConfig
+	db       *DotDBConfig
+
+	mutex  sync.Mutex
+	minute int64
+	count  int
+}
+
+func newCSPReports(instance *Instance, config CSPReportConfig) *cspReports {
+	if config.Path == "" {
+		config.Path = "/csp-report"
+	}
+	if config.Table == "" {
+		config.Table = "csp_reports"
+	}
+	if config.RateLimit <= 0 {
+		config.RateLimit = 60
+	}
+	return &cspReports{instance: instance, config: config}
+}
+
+// addCSPReportRoute registers the CSP report endpoint and creates the table
+// in the configured database provider, if any, which must already be
+// initialized.
+func (b *builder) addCSPReportRoute(dot []DotConfig) error {
+	c := newCSPReports(b.Instance, *b.config.CSPReport)
+	if c.config.Database != "" {
+		c.db = findDotDB(dot, c.config.Database)
+		if c.db == nil {
+			return fmt.Errorf("csp report database provider not found: '%s'", c.config.Database)
+		}
+		if !sqlIdentifier.MatchString(c.config.Table) {
+			return fmt.Errorf("invalid csp report table name: '%s'", c.config.Table)
+		}
+		_, err := c.db.DB.ExecContext(b.config.Ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			received TIMESTAMP NOT NULL,
+			document_url TEXT NOT NULL,
+			blocked_url TEXT NOT NULL,
+			directive TEXT NOT NULL,
+			disposition TEXT NOT NULL,
+			source_file TEXT NOT NULL,
+			line INTEGER NOT NULL,
+			col INTEGER NOT NULL,
+			sample TEXT NOT NULL,
+			user_agent TEXT NOT NULL
+		)`, c.config.Table))
+		if err != nil {
+			return fmt.Errorf("failed to create csp report table: %w", err)
+		}
+	}
+	pattern := "POST " + c.config.Path
+	if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, c) }); err != nil {
+		return err
+	}
+	b.routes = append(b.routes, newInstanceRoute(pattern, c, RouteBuiltin))
+	b.Routes += 1
+	return nil
+}
+
+// allow reports whether another report is accepted in the current minute.
+func (c *cspReports) allow(now time.Time) bool {
+	minute := now.Unix() / 60
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if minute != c.minute {
+		c.minute, c.count = minute, 0
+	}
+	if c.count >= c.config.RateLimit {
+		return false
+	}
+	c.count += 1
+	return true
+}
+
+func (c *cspReports) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := GetLogger(r.Context())
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cspReportBodyLimit))
+	if err != nil {
+		c.instance.serveError(w, r, http.StatusRequestEntityTooLarge, "report too large")
+		return
+	}
+	reports, err := parseCSPReports(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		c.instance.serveError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, report := range reports {
+		if !c.allow(time.Now()) {
+			log.Debug("dropped csp report over rate limit")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		log.Warn("content security policy violation",
+			slog.String("document_url", report.DocumentURL),
+			slog.String("blocked_url", report.BlockedURL),
+			slog.String("directive", report.Directive),
+			slog.String("disposition", report.Disposition),
+			slog.String("source_file", report.SourceFile),
+			slog.Int("line", report.Line),
+			slog.String("sample", report.Sample))
+		if c.db == nil {
+			continue
+		}
+		_, err := c.db.DB.ExecContext(r.Context(), fmt.Sprintf(`INSERT INTO %s (received, document_url, blocked_url, directive, disposition, source_file, line, col, sample, user_agent)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, c.config.Table),
+			time.Now().UTC(), report.DocumentURL, report.BlockedURL, report.Directive, report.Disposition, report.SourceFile, report.Line, report.Column, report.Sample, r.UserAgent())
+		if err != nil {
+			log.Warn("failed to store csp report", slog.Any("error", err))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseCSPReports decodes the body of a report request in either the legacy
+// report-uri format or the Reporting API format, ignoring reports of other
+// types than CSP violations.
+func parseCSPReports(contentType string, body []byte) ([]CSPReport, error) {
+	mediatype, _, _ := mime.ParseMediaType(contentType)
+	switch mediatype {
+	case "application/csp-report", "application/json":
+		var legacy struct {
+			Report struct {
+				DocumentURI        string `json:"document-uri"`
+				BlockedURI         string `json:"blocked-uri"`
+				ViolatedDirective  string `json:"violated-directive"`
+				EffectiveDirective string `json:"effective-directive"`
+				Disposition        string `json:"disposition"`
+				SourceFile         string `json:"source-file"`
+				LineNumber         int    `json:"line-number"`
+				ColumnNumber       int    `json:"column-number"`
+				ScriptSample       string `json:"script-sample"`
+			} `json:"csp-report"`
+		}
+		if err := json.Unmarshal(body, &legacy); err != nil {
+			return nil, fmt.Errorf("invalid csp report: %w", err)
+		}
+		l := legacy.Report
+		directive := l.EffectiveDirective
+		if directive == "" {
+			directive = l.ViolatedDirective
+		}
+		return []CSPReport{{l.DocumentURI, l.BlockedURI, directive, l.Disposition, l.SourceFile, l.LineNumber, l.ColumnNumber, l.ScriptSample}}, nil
+	case "application/reports+json":
+		var batch []struct {
+			Type string `json:"type"`
+			URL  string `json:"url"`
+			Body struct {
+				DocumentURL        string `json:"documentURL"`
+				BlockedURL         string `json:"blockedURL"`
+				EffectiveDirective string `json:"effectiveDirective"`
+				Disposition        string `json:"disposition"`
+				SourceFile         string `json:"sourceFile"`
+				LineNumber         int    `json:"lineNumber"`
+				ColumnNumber       int    `json:"columnNumber"`
+				Sample             string `json:"sample"`
+			} `json:"body"`
+		}
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, fmt.Errorf("invalid reports: %w", err)
+		}
+		var reports []CSPReport
+		for _, r := range batch {
+			if r.Type != "csp-violation" {
+				continue
+			}
+			b := r.Body
+			if b.DocumentURL == "" {
+				b.DocumentURL = r.URL
+			}
+			reports = append(reports, CSPReport{b.DocumentURL, b.BlockedURL, b.EffectiveDirective, b.Disposition, b.SourceFile, b.LineNumber, b.ColumnNumber, b.Sample})
+		}
+		return reports, nil
+	default:
+		return nil, fmt.Errorf("unsupported report content type: '%s'", contentType)
+	}
+}
@@ -0,0 +1,86 @@
+package xtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// dataFileParsers parse the files in [Config.DataDir] by their extension.
+var dataFileParsers = map[string]func([]byte, any) error{
+	".json": json.Unmarshal,
+	".yaml": yaml.Unmarshal,
+	".yml":  yaml.Unmarshal,
+	".toml": toml.Unmarshal,
+}
+
+// isDataPath reports whether the file at path in the templates FS is in the
+// data dir, so it isn't routed.
+func isDataPath(dataDir, path string) bool {
+	return dataDir != "" && (path == dataDir || strings.HasPrefix(path, dataDir+"/"))
+}
+
+// loadData parses the files at paths in the data dir into a map by their
+// path relative to it without the extension, so `_data/authors/jane.yaml`
+// is at `authors.jane`, and returns the files that failed to parse.
+func (b *builder) loadData(paths []string) []BuildFailure {
+	data, dirs := map[string]any{}, map[string]bool{}
+	var failures []BuildFailure
+	for _, p := range paths {
+		if _, ok := dataFileParsers[path.Ext(p)]; !ok {
+			b.config.Logger.Warn("ignoring data file with an unsupported extension, expected .json, .yaml, .yml, or .toml", slog.String("path", "/"+p))
+			continue
+		}
+		if err := addDataFile(b.config.TemplatesFS, b.config.DataDir, p, data, dirs); err != nil {
+			failures = append(failures, b.buildFailure("/"+p, err))
+		}
+	}
+	b.data = data
+	return failures
+}
+
+// addDataFile parses the file at p into data. dirs holds the keys of the maps
+// in data that were created for directories, so a file can't merge into one.
+func addDataFile(fsys fs.FS, dataDir, p string, data map[string]any, dirs map[string]bool) error {
+	ext := path.Ext(p)
+	parse := dataFileParsers[ext]
+	content, err := fs.ReadFile(fsys, p)
+	if err != nil {
+		return fmt.Errorf("failed to read data file: %w", err)
+	}
+	var v any
+	if ext == ".toml" {
+		// toml documents are always tables and can't decode into any
+		m := map[string]any{}
+		err = parse(content, &m)
+		v = m
+	} else {
+		err = parse(content, &v)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse data file: %w", err)
+	}
+
+	keys := strings.Split(strings.TrimSuffix(strings.TrimPrefix(p, dataDir+"/"), ext), "/")
+	m := data
+	for i, key := range keys[:len(keys)-1] {
+		dir := strings.Join(keys[:i+1], "/")
+		if _, exists := m[key]; !exists {
+			m[key], dirs[dir] = map[string]any{}, true
+		} else if !dirs[dir] {
+			return fmt.Errorf("data directory '%s' conflicts with a data file of the same name", dir)
+		}
+		m = m[key].(map[string]any)
+	}
+	if _, exists := m[keys[len(keys)-1]]; exists {
+		return fmt.Errorf("data file conflicts with another data file or directory named '%s'", strings.Join(keys, "/"))
+	}
+	m[keys[len(keys)-1]] = v
+	return nil
+}
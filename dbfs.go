@@ -0,0 +1,179 @@
+package xtemplate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// TemplatesDBConfig configures loading template files from a database table
+// with columns `path`, `content`, and `updated_at`, instead of TemplatesDir.
+// This lets hosted setups edit templates without filesystem access. Each
+// Instance loads a consistent snapshot of the table, use [WatchTemplatesDB] to
+// reload the server when the table changes.
+type TemplatesDBConfig struct {
+	Driver  string `json:"driver"`
+	Connstr string `json:"connstr"`
+
+	// Name of the table. Default `templates`.
+	Table string `json:"table,omitempty"`
+
+	// How often WatchTemplatesDB checks the table for changes. Default 2s.
+	PollInterval time.Duration `json:"poll_interval,omitempty"`
+}
+
+func WithTemplatesDB(cfg TemplatesDBConfig) Option {
+	return func(c *Config) error {
+		c.TemplatesDB = &cfg
+		return nil
+	}
+}
+
+func (cfg *TemplatesDBConfig) table() (string, error) {
+	if cfg.Table == "" {
+		return "templates", nil
+	}
+	if !sqlIdentifier.MatchString(cfg.Table) {
+		return "", fmt.Errorf("invalid templates table name: '%s'", cfg.Table)
+	}
+	return cfg.Table, nil
+}
+
+// loadTemplatesDB reads every row of the templates table into an in-memory fs.
+func loadTemplatesDB(ctx context.Context, cfg *TemplatesDBConfig) (fs.FS, error) {
+	table, err := cfg.table()
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(cfg.Driver, cfg.Connstr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open templates database with driver name '%s': %w", cfg.Driver, err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, `SELECT path, content, updated_at FROM `+table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query templates table: %w", err)
+	}
+	defer rows.Close()
+	mfs := memFS{}
+	for rows.Next() {
+		var path string
+		var content []byte
+		var updated any
+		if err := rows.Scan(&path, &content, &updated); err != nil {
+			return nil, fmt.Errorf("failed to read templates table: %w", err)
+		}
+		modTime, _ := cast.ToTimeE(updated)
+		mfs.add(path, content, modTime)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read templates table: %w", err)
+	}
+	return mfs, nil
+}
+
+// WatchTemplatesDB polls the templates table configured in cfg and calls
+// onChange when rows are added, removed, or updated, until ctx is cancelled.
+// For example, call [Server.Reload] in onChange.
+//
+// With the sqlite drivers it polls `PRAGMA data_version`, which changes
+// whenever another connection commits to the database. Other drivers compare
+// a checksum of every path and content in the table, so changes are detected
+// even if updated_at isn't.
+func WatchTemplatesDB(ctx context.Context, cfg TemplatesDBConfig, log *slog.Logger, onChange func()) error {
+	table, err := cfg.table()
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open(cfg.Driver, cfg.Connstr)
+	if err != nil {
+		return fmt.Errorf("failed to open templates database with driver name '%s': %w", cfg.Driver, err)
+	}
+	interval := cfg.PollInterval
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(new(int64)); err != nil {
+		db.Close()
+		return fmt.Errorf("failed to query templates table: %w", err)
+	}
+	version, err := templatesDBVersion(ctx, db, cfg.Driver, table)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	last, err := version()
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to query templates table: %w", err)
+	}
+	go func() {
+		defer db.Close()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, err := version()
+			if err != nil {
+				log.Warn("failed to poll templates table", slog.Any("error", err))
+				continue
+			}
+			if current != last {
+				last = current
+				log.Debug("templates table changed")
+				onChange()
+			}
+		}
+	}()
+	return nil
+}
+
+// templatesDBVersion returns a func that returns a value that changes when
+// the templates table changes.
+func templatesDBVersion(ctx context.Context, db *sql.DB, driver, table string) (func() (string, error), error) {
+	switch driver {
+	case "sqlite3", "sqlite":
+		// data_version is per connection, so keep using the same one
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to templates database: %w", err)
+		}
+		context.AfterFunc(ctx, func() { conn.Close() })
+		return func() (string, error) {
+			var v int64
+			err := conn.QueryRowContext(ctx, `PRAGMA data_version`).Scan(&v)
+			return fmt.Sprint(v), err
+		}, nil
+	default:
+		return func() (string, error) {
+			rows, err := db.QueryContext(ctx, `SELECT path, content FROM `+table+` ORDER BY path`)
+			if err != nil {
+				return "", err
+			}
+			defer rows.Close()
+			h := sha256.New()
+			for rows.Next() {
+				var path string
+				var content []byte
+				if err := rows.Scan(&path, &content); err != nil {
+					return "", err
+				}
+				fmt.Fprintf(h, "%d:%s%d:", len(path), path, len(content))
+				h.Write(content)
+			}
+			return hex.EncodeToString(h.Sum(nil)), rows.Err()
+		}, nil
+	}
+}
@@ -0,0 +1,58 @@
+package xtemplate
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	// exercise the checksum fallback that other drivers use
+	sql.Register("sqlite3_checksum", &sqlite3.SQLiteDriver{})
+}
+
+func TestWatchTemplatesDB(t *testing.T) {
+	for _, driver := range []string{"sqlite3", "sqlite3_checksum"} {
+		t.Run(driver, func(t *testing.T) {
+			connstr := "file:" + filepath.Join(t.TempDir(), "templates.db")
+			db, err := sql.Open(driver, connstr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if _, err := db.Exec(`CREATE TABLE templates(path TEXT PRIMARY KEY, content TEXT, updated_at TEXT);
+				INSERT INTO templates VALUES ('/index.html', 'a', '2024-01-01'), ('/about.html', 'b', '2024-01-01')`); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			changed := make(chan struct{}, 10)
+			cfg := TemplatesDBConfig{Driver: driver, Connstr: connstr, PollInterval: 10 * time.Millisecond}
+			if err := WatchTemplatesDB(ctx, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), func() { changed <- struct{}{} }); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, stmt := range []string{
+				// neither the count nor the latest updated_at change
+				`UPDATE templates SET content = 'c' WHERE path = '/index.html'`,
+				`DELETE FROM templates WHERE path = '/about.html'; INSERT INTO templates VALUES ('/contact.html', 'b', '2024-01-01')`,
+			} {
+				if _, err := db.Exec(stmt); err != nil {
+					t.Fatal(err)
+				}
+				select {
+				case <-changed:
+				case <-time.After(2 * time.Second):
+					t.Fatalf("change not detected after: %s", stmt)
+				}
+			}
+		})
+	}
+}
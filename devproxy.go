@@ -0,0 +1,51 @@
+package xtemplate
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+)
+
+// addDevProxyRoutes registers a reverse proxy to the upstream server of each
+// path prefix in [Config.DevProxy].
+func (b *builder) addDevProxyRoutes() error {
+	var prefixes []string
+	for prefix := range b.config.DevProxy {
+		prefixes = append(prefixes, prefix)
+	}
+	slices.Sort(prefixes)
+	for _, prefix := range prefixes {
+		upstream := b.config.DevProxy[prefix]
+		target, err := url.Parse(upstream)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			return fmt.Errorf("invalid dev proxy upstream '%s' for '%s'", upstream, prefix)
+		}
+		pattern := path.Clean("/"+strings.TrimSuffix(prefix, "*")) + "/"
+		if pattern == "//" {
+			pattern = "/"
+		}
+		log := b.config.Logger.With(slog.String("prefix", pattern), slog.String("upstream", upstream))
+		handler := &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.SetURL(target)
+				pr.SetXForwarded()
+			},
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				GetLogger(r.Context()).Warn("dev proxy request failed", slog.String("upstream", upstream), slog.Any("error", err))
+				b.Instance.serveError(w, r, http.StatusBadGateway, "bad gateway")
+			},
+		}
+		if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+			return err
+		}
+		b.routes = append(b.routes, newInstanceRoute(pattern, handler, RouteProxy))
+		b.Routes += 1
+		log.Warn("added dev proxy, don't use it in production")
+	}
+	return nil
+}
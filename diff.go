@@ -0,0 +1,108 @@
+package xtemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// InstanceDiff lists the routes and template definitions that differ between
+// two instances. A route is changed if the template definition or static file
+// that handles it changed. See [DiffInstances].
+type InstanceDiff struct {
+	AddedRoutes      []string `json:"added_routes"`
+	RemovedRoutes    []string `json:"removed_routes"`
+	ChangedRoutes    []string `json:"changed_routes"`
+	AddedTemplates   []string `json:"added_templates"`
+	RemovedTemplates []string `json:"removed_templates"`
+	ChangedTemplates []string `json:"changed_templates"`
+}
+
+// DiffInstances compares the routes and template definitions of two instances,
+// for example to catch accidental route removals before deploying a new
+// template tree.
+func DiffInstances(old, new *Instance) *InstanceDiff {
+	d := &InstanceDiff{}
+	d.AddedRoutes, d.RemovedRoutes, d.ChangedRoutes = diffDigests(old.routeDigests(), new.routeDigests())
+	d.AddedTemplates, d.RemovedTemplates, d.ChangedTemplates = diffDigests(old.templateDigests(), new.templateDigests())
+	return d
+}
+
+// Empty reports whether the instances have the same routes and templates.
+func (d *InstanceDiff) Empty() bool {
+	return len(d.AddedRoutes)+len(d.RemovedRoutes)+len(d.ChangedRoutes)+
+		len(d.AddedTemplates)+len(d.RemovedTemplates)+len(d.ChangedTemplates) == 0
+}
+
+// String formats the diff with one line per difference, prefixed by + for
+// added, - for removed, and ~ for changed.
+func (d *InstanceDiff) String() string {
+	var b strings.Builder
+	for _, section := range []struct {
+		kind                    string
+		added, removed, changed []string
+	}{
+		{"route", d.AddedRoutes, d.RemovedRoutes, d.ChangedRoutes},
+		{"template", d.AddedTemplates, d.RemovedTemplates, d.ChangedTemplates},
+	} {
+		for _, line := range []struct {
+			prefix string
+			names  []string
+		}{{"+", section.added}, {"-", section.removed}, {"~", section.changed}} {
+			for _, name := range line.names {
+				fmt.Fprintf(&b, "%s %s %s\n", line.prefix, section.kind, name)
+			}
+		}
+	}
+	return b.String()
+}
+
+// templateDigests returns a hash of the parsed body of each template
+// definition, keyed by template name.
+func (instance *Instance) templateDigests() map[string]string {
+	digests := make(map[string]string)
+	for _, tmpl := range instance.templates.Templates() {
+		if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+			continue
+		}
+		sum := sha256.Sum256([]byte(tmpl.Tree.Root.String()))
+		digests[tmpl.Name()] = hex.EncodeToString(sum[:])
+	}
+	return digests
+}
+
+// routeDigests returns the digest of the template or the hash of the static
+// file that handles each route, keyed by route pattern.
+func (instance *Instance) routeDigests() map[string]string {
+	templates := instance.templateDigests()
+	digests := make(map[string]string, len(instance.routeSources))
+	for pattern, source := range instance.routeSources {
+		if file, ok := instance.files[source]; ok {
+			digests[pattern] = file.hash
+		} else {
+			digests[pattern] = templates[source]
+		}
+	}
+	return digests
+}
+
+func diffDigests(old, new map[string]string) (added, removed, changed []string) {
+	for name, digest := range new {
+		if oldDigest, ok := old[name]; !ok {
+			added = append(added, name)
+		} else if oldDigest != digest {
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(changed)
+	return
+}
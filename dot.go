@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"slices"
 	"sync"
 )
 
@@ -16,6 +17,16 @@ type Request struct {
 	R         *http.Request
 }
 
+// ResponseController returns a controller of W, which finds the Flush,
+// Hijack, SetReadDeadline, SetWriteDeadline, and EnableFullDuplex methods of
+// the underlying writer even if it's wrapped by middleware, as long as the
+// wrappers implement `Unwrap() http.ResponseWriter`. Its methods return an
+// error matching [http.ErrNotSupported] if the writer doesn't support them, and
+// writes to a hijacked connection fail with [http.ErrHijacked].
+func (r Request) ResponseController() *http.ResponseController {
+	return http.NewResponseController(r.W)
+}
+
 type DotConfig interface {
 	FieldName() string
 	Init(context.Context) error
@@ -49,13 +60,19 @@ func makeDot(dps []DotConfig) dot {
 		}
 	}
 	typ := reflect.StructOf(fields)
-	return dot{dps, cleanups, &sync.Pool{New: func() any { v := reflect.New(typ).Elem(); return &v }}}
+	return dot{dps: dps, cleanups: cleanups, pool: &sync.Pool{New: func() any { v := reflect.New(typ).Elem(); return &v }}, overridden: &sync.Map{}}
 }
 
 type dot struct {
 	dps      []DotConfig
 	cleanups []cleanup
 	pool     *sync.Pool
+
+	// override returns providers that replace fields for one request, see
+	// [Config.DotOverrides]
+	override func(context.Context, *http.Request) []DotConfig
+	// providers of values with overridden fields, keyed by value
+	overridden *sync.Map
 }
 
 type cleanup struct {
@@ -64,11 +81,20 @@ type cleanup struct {
 }
 
 func (d *dot) value(sctx context.Context, w http.ResponseWriter, r *http.Request) (val *reflect.Value, err error) {
+	dps, overridden := d.dps, false
+	if d.override != nil {
+		if dps, overridden, err = d.overrides(sctx, r); err != nil {
+			return nil, err
+		}
+	}
 	val = d.pool.Get().(*reflect.Value)
 	val.SetZero()
-	for i, dp := range d.dps {
+	for i, dp := range dps {
 		var a any
 		a, err = dp.Value(Request{dp, sctx, w, r})
+		if t := reflect.TypeOf(a); err == nil && t != val.Field(i).Type() && (t == nil || !t.AssignableTo(val.Field(i).Type())) {
+			err = fmt.Errorf("value of type %T is not assignable to field of type %s", a, val.Field(i).Type())
+		}
 		if err != nil {
 			err = fmt.Errorf("failed to construct dot value for %s (%v): %w", dp.FieldName(), dp, err)
 			val.SetZero()
@@ -78,11 +104,41 @@ func (d *dot) value(sctx context.Context, w http.ResponseWriter, r *http.Request
 		}
 		val.Field(i).Set(reflect.ValueOf(a))
 	}
+	if overridden {
+		d.overridden.Store(val, dps)
+	}
 	return
 }
 
+// overrides returns the providers for the request with the fields returned by
+// the override hook replaced, and whether any were replaced.
+func (d *dot) overrides(sctx context.Context, r *http.Request) ([]DotConfig, bool, error) {
+	overrides := d.override(sctx, r)
+	if len(overrides) == 0 {
+		return d.dps, false, nil
+	}
+	dps := slices.Clone(d.dps)
+	for _, o := range overrides {
+		i := slices.IndexFunc(dps, func(dp DotConfig) bool { return dp.FieldName() == o.FieldName() })
+		if i < 0 {
+			return nil, false, fmt.Errorf("dot override field '%s' is not a configured dot field", o.FieldName())
+		}
+		dps[i] = o
+	}
+	return dps, true, nil
+}
+
 func (d *dot) cleanup(v *reflect.Value, err error) error {
-	for _, cleanup := range d.cleanups {
+	cleanups := d.cleanups
+	if dps, ok := d.overridden.LoadAndDelete(v); ok {
+		cleanups = nil
+		for i, dp := range dps.([]DotConfig) {
+			if cdp, ok := dp.(CleanupDotProvider); ok {
+				cleanups = append(cleanups, cleanup{i, cdp})
+			}
+		}
+	}
+	for _, cleanup := range cleanups {
 		err = cleanup.Cleanup(v.Field(cleanup.idx).Interface(), err)
 	}
 	v.SetZero()
@@ -0,0 +1,89 @@
+package xtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DotAudit is used to create a dot field value that records audit events of
+// actions taken by users. Each event includes the request id, user, client ip
+// behind [Config.TrustedProxies], and the request method and path. For
+// example:
+//
+//	{{.Audit.SetUser $user.Name}}
+//	{{.Audit.Log "contact.delete" (.Req.PathValue "id") (dict "name" $contact.name)}}
+type DotAudit struct {
+	config *DotAuditConfig
+	r      *http.Request
+	user   string
+}
+
+// AuditEvent is a recorded audit event.
+type AuditEvent struct {
+	Time      time.Time      `json:"time"`
+	RequestID string         `json:"request_id"`
+	User      string         `json:"user,omitempty"`
+	IP        string         `json:"ip"`
+	Method    string         `json:"method"`
+	Path      string         `json:"path"`
+	Action    string         `json:"action"`
+	Target    string         `json:"target,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// SetUser sets the user identity recorded with subsequent events in this
+// request.
+func (d *DotAudit) SetUser(user string) string {
+	d.user = user
+	return ""
+}
+
+// Log records an audit event of action performed on target, with optional
+// details. The event is written immediately, so it is recorded even if the
+// request fails later.
+func (d *DotAudit) Log(action string, target any, details ...map[string]any) (string, error) {
+	event := AuditEvent{
+		Time:      time.Now().UTC(),
+		RequestID: GetRequestId(d.r.Context()),
+		User:      d.user,
+		IP:        clientAddr(d.r).String(),
+		Method:    d.r.Method,
+		Path:      d.r.URL.Path,
+		Action:    action,
+	}
+	if target != nil {
+		event.Target = fmt.Sprint(target)
+	}
+	if len(details) > 0 {
+		event.Details = details[0]
+	}
+	if err := d.config.write(&event); err != nil {
+		return "", fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return "", nil
+}
+
+func (c *DotAuditConfig) write(e *AuditEvent) error {
+	if c.db != nil {
+		var details []byte
+		if e.Details != nil {
+			var err error
+			if details, err = json.Marshal(e.Details); err != nil {
+				return err
+			}
+		}
+		_, err := c.db.Exec(`INSERT INTO `+c.Table+` VALUES(?,?,?,?,?,?,?,?,?)`,
+			e.Time.Format(time.RFC3339Nano), e.RequestID, e.User, e.IP, e.Method, e.Path, e.Action, e.Target, string(details))
+		return err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.file.Write(append(line, '\n'))
+	return err
+}
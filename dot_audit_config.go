@@ -0,0 +1,125 @@
+package xtemplate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+)
+
+func WithAudit(name string, cfg DotAuditConfig) Option {
+	return func(c *Config) error {
+		cfg.Name = name
+		c.Audit = append(c.Audit, cfg)
+		return nil
+	}
+}
+
+// DotAuditConfig configures a dot provider that records audit events. Events
+// are appended as json lines to File, or inserted into Table of the database
+// given by Driver and Connstr. See [DotAudit].
+type DotAuditConfig struct {
+	Name string `json:"name"`
+
+	File string `json:"file,omitempty"`
+
+	Driver  string `json:"driver,omitempty"`
+	Connstr string `json:"connstr,omitempty"`
+	// The table to insert events into, created if it doesn't exist. The
+	// statement uses `?` placeholders. Default `audit_log`.
+	Table string `json:"table,omitempty"`
+
+	// The name of a request header set by an authenticating proxy that
+	// identifies the user, used unless the template calls SetUser.
+	UserHeader string `json:"user_header,omitempty"`
+
+	mu   *sync.Mutex
+	file *os.File
+	db   *sql.DB
+
+	// requests that can still log, and whether the instance was cancelled,
+	// so the file or database is only closed after they're done
+	active  int
+	closing bool
+}
+
+var _ DotConfig = &DotAuditConfig{}
+
+func (d *DotAuditConfig) FieldName() string { return d.Name }
+func (d *DotAuditConfig) Init(ctx context.Context) error {
+	if d.mu != nil {
+		return nil
+	}
+	d.mu = &sync.Mutex{}
+	switch {
+	case d.File != "" && d.Driver != "":
+		return fmt.Errorf("audit provider must have only one of file or driver")
+	case d.File != "":
+		f, err := os.OpenFile(d.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log file: %w", err)
+		}
+		d.file = f
+	case d.Driver != "":
+		if d.Table == "" {
+			d.Table = "audit_log"
+		}
+		if !sqlIdentifier.MatchString(d.Table) {
+			return fmt.Errorf("invalid audit table name: '%s'", d.Table)
+		}
+		db, err := sql.Open(d.Driver, d.Connstr)
+		if err != nil {
+			return fmt.Errorf("failed to open audit database with driver name '%s': %w", d.Driver, err)
+		}
+		_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+d.Table+`(time TEXT NOT NULL, request_id TEXT, user TEXT, ip TEXT, method TEXT, path TEXT, action TEXT NOT NULL, target TEXT, details TEXT)`)
+		if err != nil {
+			return fmt.Errorf("failed to create audit table: %w", err)
+		}
+		d.db = db
+	default:
+		return fmt.Errorf("audit provider requires a file or driver")
+	}
+	context.AfterFunc(ctx, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.closing = true
+		d.closeIfDone()
+	})
+	return nil
+}
+func (d *DotAuditConfig) Value(r Request) (any, error) {
+	user := ""
+	if d.UserHeader != "" {
+		user = r.R.Header.Get(d.UserHeader)
+	}
+	// requests still being served when the instance is replaced can log
+	// until they're done
+	if ctx := r.R.Context(); ctx.Done() != nil {
+		d.mu.Lock()
+		d.active++
+		d.mu.Unlock()
+		context.AfterFunc(ctx, func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			d.active--
+			d.closeIfDone()
+		})
+	}
+	return &DotAudit{d, r.R, user}, nil
+}
+
+// closeIfDone closes the file or database after the instance was cancelled
+// and the last request that could log is done. It must be called with mu
+// held.
+func (d *DotAuditConfig) closeIfDone() {
+	if !d.closing || d.active > 0 {
+		return
+	}
+	if d.file != nil {
+		d.file.Close()
+	}
+	if d.db != nil {
+		d.db.Close()
+	}
+}
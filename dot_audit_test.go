@@ -0,0 +1,75 @@
+package xtemplate
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestAuditClientIP(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+	instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte(`{{.Audit.Log "view" "home"}}`)}},
+		WithAudit("Audit", DotAuditConfig{File: file}),
+		func(c *Config) error {
+			c.TrustedProxies = []string{"10.0.0.0/8"}
+			return nil
+		},
+	)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "192.0.2.7")
+	w := httptest.NewRecorder()
+	instance.ServeHTTP(w, r)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event AuditEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("invalid audit event %q: %v", data, err)
+	}
+	if event.IP != "192.0.2.7" {
+		t.Errorf("got ip %s, want the client ip 192.0.2.7", event.IP)
+	}
+}
+
+func TestAuditDrain(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.jsonl")
+	d := &DotAuditConfig{Name: "Audit", File: file}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := d.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reqCtx, done := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(reqCtx)
+	v, _ := d.Value(Request{d, ctx, httptest.NewRecorder(), r})
+	audit := v.(*DotAudit)
+
+	// the instance is replaced while the request is still being served
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := audit.Log("late", nil); err != nil {
+		t.Fatalf("failed to log before the request is done: %v", err)
+	}
+
+	done()
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := audit.Log("after", nil)
+		if err != nil && strings.Contains(err.Error(), "closed") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("audit file wasn't closed after the last request was done, got error %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
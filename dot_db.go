@@ -5,7 +5,11 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/spf13/cast"
 )
 
 // DotDB is used to create a dot field value that can query a SQL database. When
@@ -14,12 +18,43 @@ import (
 // automatically commits any uncommitted transactions remaining after template
 // execution completes, but if there were errors then it calls rollback on the
 // transaction.
+//
+// If the database is configured with read replicas, each request picks one
+// healthy replica and queries run against it until the first call to Exec,
+// which opens the transaction on the primary. After that all statements use
+// the transaction so the request can read its own writes. If no replica is
+// healthy, all statements use the primary.
 type DotDB struct {
-	db  *sql.DB
-	log *slog.Logger
-	ctx context.Context
-	opt *sql.TxOptions
-	tx  *sql.Tx
+	db    *sql.DB
+	read  *sql.DB
+	log   *slog.Logger
+	ctx   context.Context
+	opt   *sql.TxOptions
+	tx    *sql.Tx
+	slow  time.Duration
+	stats *dbStats
+	// see [Config.MaxQueryRows]
+	maxRows int
+
+	tables map[string]DBTableConfig
+	// see [DotDBConfig.TypedColumns]
+	typed bool
+}
+
+// logStatement logs an executed statement at debug level, or at warn level if
+// it took longer than the slow query threshold, and adds it to the stats.
+// Slow statements are logged without their params, which can contain
+// personal data.
+func (c *DotDB) logStatement(msg, query string, params []any, replica bool, rows int64, err error, start time.Time) {
+	dur := time.Since(start)
+	slow := c.slow > 0 && dur >= c.slow
+	c.stats.record(msg == "Exec", rows, err, slow, dur)
+	attrs := []any{slog.String("query", query), slog.Any("params", params), slog.Bool("replica", replica), slog.Int64("rows", rows), slog.Any("error", err), slog.Duration("queryduration", dur)}
+	if slow {
+		c.log.Log(c.ctx, slog.LevelWarn, "slow "+msg, append(attrs[:1], attrs[2:]...)...)
+		return
+	}
+	c.log.Log(c.ctx, slog.LevelDebug, msg, attrs...)
 }
 
 func (d *DotDB) makeTx() (err error) {
@@ -32,38 +67,62 @@ func (d *DotDB) makeTx() (err error) {
 // Exec executes a statement with parameters and returns the raw [sql.Result].
 // Note: this can be a bit difficult to use inside a template, consider using
 // other methods that provide easier to use return values.
-func (c *DotDB) Exec(query string, params ...any) (result sql.Result, err error) {
+//
+// All statement executing methods accept either a query string followed by
+// its parameters, or a single [SQLQuery] built with the sql funcs.
+func (c *DotDB) Exec(q any, params ...any) (result sql.Result, err error) {
+	query, params, err := sqlArgs(q, params)
+	if err != nil {
+		return nil, err
+	}
 	if err = c.makeTx(); err != nil {
 		return
 	}
 
 	defer func(start time.Time) {
-		c.log.Debug("Exec", slog.String("query", query), slog.Any("params", params), slog.Any("error", err), slog.Duration("queryduration", time.Since(start)))
+		var rows int64
+		if err == nil {
+			rows, _ = result.RowsAffected()
+		}
+		c.logStatement("Exec", query, params, false, rows, err, start)
 	}(time.Now())
 
 	return c.tx.Exec(query, params...)
 }
 
 // QueryRows executes a query and buffers all rows into a []map[string]any object.
-func (c *DotDB) QueryRows(query string, params ...any) (rows []map[string]any, err error) {
-	if err = c.makeTx(); err != nil {
-		return
+// With [DotDBConfig.TypedColumns], column values are converted based on the
+// column's declared type: text as string, booleans as bool, dates and times as
+// time.Time, decimals as string, and NULL as nil.
+func (c *DotDB) QueryRows(q any, params ...any) (rows []map[string]any, err error) {
+	query, params, err := sqlArgs(q, params)
+	if err != nil {
+		return nil, err
+	}
+	var queryer interface {
+		QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+	}
+	if c.tx == nil && c.read != nil {
+		queryer = c.read
+	} else {
+		if err = c.makeTx(); err != nil {
+			return
+		}
+		queryer = c.tx
 	}
 
 	defer func(start time.Time) {
-		c.log.Debug("QueryRows", slog.String("query", query), slog.Any("params", params), slog.Any("error", err), slog.Duration("queryduration", time.Since(start)))
+		c.logStatement("QueryRows", query, params, queryer != c.tx, int64(len(rows)), err, start)
 	}(time.Now())
 
-	result, err := c.tx.Query(query, params...)
+	result, err := queryer.QueryContext(c.ctx, query, params...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer result.Close()
 
-	var columns []string
-
 	// prepare scan output array
-	columns, err = result.Columns()
+	columns, err := result.ColumnTypes()
 	if err != nil {
 		return nil, err
 	}
@@ -74,22 +133,93 @@ func (c *DotDB) QueryRows(query string, params ...any) (rows []map[string]any, e
 	}
 
 	for result.Next() {
+		if c.maxRows > 0 && len(rows) >= c.maxRows {
+			return nil, fmt.Errorf("query returned more than the maximum of %d rows", c.maxRows)
+		}
 		err = result.Scan(out...)
 		if err != nil {
 			return nil, err
 		}
 		row := make(map[string]any, n)
-		for i, c := range columns {
-			row[c] = *out[i].(*any)
+		for i, col := range columns {
+			if c.typed {
+				row[col.Name()] = convertColumn(col, *out[i].(*any))
+			} else {
+				row[col.Name()] = *out[i].(*any)
+			}
 		}
 		rows = append(rows, row)
 	}
 	return rows, result.Err()
 }
 
+var dbTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// convertColumn converts a value scanned by the driver into a more useful type
+// for templates based on the declared type of its column: text is returned as
+// a string instead of []byte, boolean columns as bool, date and time columns as
+// time.Time, and decimal columns as a string to preserve their precision. NULL
+// is always returned as nil, which prints as an empty string and is falsy in
+// template conditions.
+func convertColumn(c *sql.ColumnType, v any) any {
+	if v == nil {
+		return nil
+	}
+	typ := strings.ToUpper(c.DatabaseTypeName())
+	if i := strings.IndexByte(typ, '('); i >= 0 {
+		typ = typ[:i]
+	}
+	switch typ {
+	case "BOOL", "BOOLEAN":
+		switch b := v.(type) {
+		case int64:
+			return b != 0
+		case []byte, string:
+			if parsed, err := cast.ToBoolE(cast.ToString(b)); err == nil {
+				return parsed
+			}
+		}
+	case "DATE", "DATETIME", "TIMESTAMP", "TIMESTAMPTZ", "TIMESTAMP WITH TIME ZONE":
+		var s string
+		switch t := v.(type) {
+		case []byte:
+			s = string(t)
+		case string:
+			s = t
+		default:
+			return v
+		}
+		for _, layout := range dbTimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t
+			}
+		}
+	case "DECIMAL", "NUMERIC", "MONEY":
+		switch d := v.(type) {
+		case []byte:
+			return string(d)
+		case float64:
+			return strconv.FormatFloat(d, 'f', -1, 64)
+		}
+	case "BLOB", "BYTEA", "BINARY", "VARBINARY", "LONGBLOB", "MEDIUMBLOB", "TINYBLOB":
+		return v
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
 // QueryRow executes a query, which must return one row, and returns it as a
 // map[string]any.
-func (c *DotDB) QueryRow(query string, params ...any) (map[string]any, error) {
+func (c *DotDB) QueryRow(query any, params ...any) (map[string]any, error) {
 	rows, err := c.QueryRows(query, params...)
 	if err != nil {
 		return nil, err
@@ -102,7 +232,7 @@ func (c *DotDB) QueryRow(query string, params ...any) (map[string]any, error) {
 
 // QueryVal executes a query, which must return one row with one column, and
 // returns the value of the column.
-func (c *DotDB) QueryVal(query string, params ...any) (any, error) {
+func (c *DotDB) QueryVal(query any, params ...any) (any, error) {
 	row, err := c.QueryRow(query, params...)
 	if err != nil {
 		return nil, err
@@ -116,6 +246,47 @@ func (c *DotDB) QueryVal(query string, params ...any) (any, error) {
 	panic("impossible condition")
 }
 
+// DBPage is one page of query results with its pagination state. See
+// [DotDB.QueryPage].
+type DBPage struct {
+	Rows []map[string]any
+	Pagination
+}
+
+// QueryPage executes a query for one page of results, along with a query that
+// counts the total number of rows, and returns the rows with pagination state
+// that can be used like the result of the paginate func. Out of range page
+// numbers are clamped. args may be nil, for example when query is a [SQLQuery].
+// The query is run as a subquery, so it may have its own LIMIT.
+//
+//	{{$p := .DB.QueryPage "SELECT * FROM contacts ORDER BY name" nil (.Req.URL.Query.Get "page" | atoi) 20}}
+//	{{range $p.Rows}}...{{end}}
+//	{{with $p.Next}}<a href="{{pageURL $.Req.URL .}}">Next</a>{{end}}
+func (c *DotDB) QueryPage(q any, args []any, page, perPage int) (*DBPage, error) {
+	query, args, err := sqlArgs(q, args)
+	if err != nil {
+		return nil, err
+	}
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	count, err := c.QueryVal("SELECT COUNT(*) FROM ("+query+") AS page_count", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rows: %w", err)
+	}
+	total, err := cast.ToIntE(count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count rows: %w", err)
+	}
+	p, err := FuncPaginate(total, page, perPage)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.QueryRows(&SQLQuery{query: "SELECT * FROM (" + query + ") AS page_rows", args: args, limit: p.PerPage, offset: p.Offset})
+	if err != nil {
+		return nil, err
+	}
+	return &DBPage{Rows: rows, Pagination: p}, nil
+}
+
 // Commit manually commits any implicit transactions opened by this DotDB. This
 // is called automatically if there were no errors at the end of template
 // execution.
@@ -5,6 +5,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 func WithDB(name string, db *sql.DB, opt *sql.TxOptions) Option {
@@ -18,34 +23,267 @@ func WithDB(name string, db *sql.DB, opt *sql.TxOptions) Option {
 }
 
 type DotDBConfig struct {
-	*sql.DB        `json:"-"`
-	*sql.TxOptions `json:"-"`
-	Name           string `json:"name"`
-	Driver         string `json:"driver"`
-	Connstr        string `json:"connstr"`
-	MaxOpenConns   int    `json:"max_open_conns"`
+	*sql.DB         `json:"-"`
+	*sql.TxOptions  `json:"-"`
+	Name            string        `json:"name"`
+	Driver          string        `json:"driver"`
+	Connstr         string        `json:"connstr"`
+	MaxOpenConns    int           `json:"max_open_conns"`
+	MaxIdleConns    int           `json:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `json:"conn_max_idle_time"`
+	SQLite          *SQLiteConfig `json:"sqlite,omitempty"`
+
+	// Replicas are connection strings of read replicas of the database using
+	// the same driver. See [DotDB] for how queries are routed to replicas.
+	Replicas []string `json:"replicas,omitempty"`
+	// HealthCheckInterval is how often replicas are pinged to check that they
+	// are available. Defaults to 10s.
+	HealthCheckInterval time.Duration `json:"health_check_interval,omitempty"`
+
+	// SlowQueryThreshold is the duration after which executed statements are
+	// logged at warn level instead of debug level, without their params. Zero
+	// disables it.
+	SlowQueryThreshold time.Duration `json:"slow_query_threshold,omitempty"`
+
+	// Tables that can be written from form values with [DotDB.InsertForm] and
+	// [DotDB.UpdateForm], keyed by table name.
+	Tables map[string]DBTableConfig `json:"tables,omitempty"`
+
+	// TypedColumns converts the values of query results by the declared type
+	// of their column, see [DotDB.QueryRows]. Without it values are returned
+	// as the driver scans them, like []byte for text with some drivers.
+	// Default `false`.
+	TypedColumns bool `json:"typed_columns,omitempty"`
+
+	replicas []*dbReplica
+	next     *atomic.Uint32
+	stats    *dbStats
+	maxRows  int
+}
+
+// DBStats are aggregate statistics of the statements executed by a database
+// provider over the lifetime of an instance. See [Instance.DBStats].
+type DBStats struct {
+	Queries     int64
+	Execs       int64
+	Rows        int64
+	Errors      int64
+	SlowQueries int64
+	Duration    time.Duration
+}
+
+type dbStats struct {
+	queries, execs, rows, errors, slow, duration atomic.Int64
+	ops                                          ProviderMetrics
+}
+
+func (s *dbStats) record(exec bool, rows int64, err error, slow bool, dur time.Duration) {
+	if s == nil {
+		return
+	}
+	if exec {
+		s.execs.Add(1)
+		s.ops.Observe("exec", dur, err)
+	} else {
+		s.queries.Add(1)
+		s.ops.Observe("query", dur, err)
+	}
+	s.rows.Add(rows)
+	if err != nil {
+		s.errors.Add(1)
+	}
+	if slow {
+		s.slow.Add(1)
+	}
+	s.duration.Add(int64(dur))
+}
+
+func (s *dbStats) snapshot() DBStats {
+	return DBStats{
+		Queries:     s.queries.Load(),
+		Execs:       s.execs.Load(),
+		Rows:        s.rows.Load(),
+		Errors:      s.errors.Load(),
+		SlowQueries: s.slow.Load(),
+		Duration:    time.Duration(s.duration.Load()),
+	}
+}
+
+type dbReplica struct {
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// SQLiteConfig configures common sqlite pragmas for every connection in the
+// pool. They are added to the connection string in the form expected by the
+// driver: `_journal_mode=WAL` style parameters for the "sqlite3" driver
+// (mattn/go-sqlite3), and `_pragma=journal_mode(WAL)` for the "sqlite" driver
+// (modernc.org/sqlite).
+type SQLiteConfig struct {
+	JournalMode string `json:"journal_mode,omitempty"` // e.g. "WAL"
+	BusyTimeout int    `json:"busy_timeout,omitempty"` // milliseconds
+	ForeignKeys *bool  `json:"foreign_keys,omitempty"`
+	Synchronous string `json:"synchronous,omitempty"` // e.g. "NORMAL"
+}
+
+func (s *SQLiteConfig) connstr(driver, connstr string) (string, error) {
+	var pragmas [][2]string
+	if s.JournalMode != "" {
+		pragmas = append(pragmas, [2]string{"journal_mode", s.JournalMode})
+	}
+	if s.BusyTimeout > 0 {
+		pragmas = append(pragmas, [2]string{"busy_timeout", strconv.Itoa(s.BusyTimeout)})
+	}
+	if s.ForeignKeys != nil {
+		pragmas = append(pragmas, [2]string{"foreign_keys", strconv.FormatBool(*s.ForeignKeys)})
+	}
+	if s.Synchronous != "" {
+		pragmas = append(pragmas, [2]string{"synchronous", s.Synchronous})
+	}
+	if len(pragmas) == 0 {
+		return connstr, nil
+	}
+	q := url.Values{}
+	for _, p := range pragmas {
+		switch driver {
+		case "sqlite3":
+			q.Add("_"+p[0], p[1])
+		case "sqlite":
+			q.Add("_pragma", fmt.Sprintf("%s(%s)", p[0], p[1]))
+		default:
+			return "", fmt.Errorf("sqlite options are not supported with driver '%s'", driver)
+		}
+	}
+	sep := "?"
+	if strings.Contains(connstr, "?") {
+		sep = "&"
+	}
+	return connstr + sep + q.Encode(), nil
 }
 
 var _ CleanupDotProvider = &DotDBConfig{}
 
 func (d *DotDBConfig) FieldName() string { return d.Name }
+
+// Metrics returns the number and duration of queries and execs, see
+// [MetricsDotProvider].
+func (d *DotDBConfig) Metrics() map[string]OperationMetrics {
+	if d.stats == nil {
+		return nil
+	}
+	return d.stats.ops.Snapshot()
+}
 func (d *DotDBConfig) Init(ctx context.Context) error {
-	if d.DB != nil {
+	for table, t := range d.Tables {
+		if err := t.validate(table); err != nil {
+			return fmt.Errorf("invalid table config of database '%s': %w", d.Name, err)
+		}
+	}
+	if d.stats == nil {
+		d.stats = &dbStats{}
+	}
+	if d.DB == nil {
+		db, err := d.open(d.Connstr)
+		if err != nil {
+			return err
+		}
+		if err := db.Ping(); err != nil {
+			return fmt.Errorf("failed to ping database on open: %w", err)
+		}
+		d.DB = db
+	}
+	if len(d.Replicas) == 0 || d.replicas != nil {
 		return nil
 	}
-	db, err := sql.Open(d.Driver, d.Connstr)
+	d.next = &atomic.Uint32{}
+	for i, connstr := range d.Replicas {
+		db, err := d.open(connstr)
+		if err != nil {
+			return fmt.Errorf("failed to open replica %d: %w", i, err)
+		}
+		r := &dbReplica{db: db}
+		r.healthy.Store(db.PingContext(ctx) == nil)
+		d.replicas = append(d.replicas, r)
+	}
+	interval := d.HealthCheckInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	go d.checkReplicas(ctx, interval)
+	return nil
+}
+
+func (d *DotDBConfig) open(connstr string) (*sql.DB, error) {
+	if d.SQLite != nil {
+		var err error
+		if connstr, err = d.SQLite.connstr(d.Driver, connstr); err != nil {
+			return nil, fmt.Errorf("failed to configure database '%s': %w", d.Name, err)
+		}
+	}
+	db, err := sql.Open(d.Driver, connstr)
 	if err != nil {
-		return fmt.Errorf("failed to open database with driver name '%s': %w", d.Driver, err)
+		return nil, fmt.Errorf("failed to open database with driver name '%s': %w", d.Driver, err)
 	}
 	db.SetMaxOpenConns(d.MaxOpenConns)
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database on open: %w", err)
+	if d.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(d.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(d.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(d.ConnMaxIdleTime)
+	return db, nil
+}
+
+// checkReplicas pings each replica every interval until ctx is cancelled, so
+// that unavailable replicas are skipped until they recover.
+func (d *DotDBConfig) checkReplicas(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			for _, r := range d.replicas {
+				r.db.Close()
+			}
+			return
+		case <-ticker.C:
+		}
+		for _, r := range d.replicas {
+			pctx, cancel := context.WithTimeout(ctx, interval)
+			r.healthy.Store(r.db.PingContext(pctx) == nil)
+			cancel()
+		}
+	}
+}
+
+// replica picks the next healthy replica, or returns nil if there are none.
+func (d *DotDBConfig) replica() *sql.DB {
+	if len(d.replicas) == 0 {
+		return nil
+	}
+	start := d.next.Add(1)
+	for i := range uint32(len(d.replicas)) {
+		r := d.replicas[(start+i)%uint32(len(d.replicas))]
+		if r.healthy.Load() {
+			return r.db
+		}
 	}
-	d.DB = db
 	return nil
 }
+
 func (d *DotDBConfig) Value(r Request) (any, error) {
-	return &DotDB{d.DB, GetLogger(r.R.Context()), r.R.Context(), d.TxOptions, nil}, nil
+	return &DotDB{
+		db:      d.DB,
+		read:    d.replica(),
+		log:     GetLogger(r.R.Context()),
+		ctx:     r.R.Context(),
+		opt:     d.TxOptions,
+		slow:    d.SlowQueryThreshold,
+		stats:   d.stats,
+		maxRows: d.maxRows,
+		tables:  d.Tables,
+		typed:   d.TypedColumns,
+	}, nil
 }
 func (dp *DotDBConfig) Cleanup(v any, err error) error {
 	d := v.(*DotDB)
@@ -55,3 +293,14 @@ func (dp *DotDBConfig) Cleanup(v any, err error) error {
 		return errors.Join(err, d.commit())
 	}
 }
+
+// findDotDB returns the database provider with the given name, or the first
+// database provider if name is empty.
+func findDotDB(dot []DotConfig, name string) *DotDBConfig {
+	for _, d := range dot {
+		if db, ok := d.(*DotDBConfig); ok && (name == "" || db.Name == name) {
+			return db
+		}
+	}
+	return nil
+}
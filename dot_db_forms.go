@@ -0,0 +1,107 @@
+package xtemplate
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// DBTableConfig lists the columns of a table that can be set from form values.
+// See [DotDBConfig.Tables].
+type DBTableConfig struct {
+	// Columns that may be set from form fields of the same name. Other fields
+	// are ignored.
+	Columns []string `json:"columns"`
+
+	// Primary key column used by UpdateForm. Default `id`.
+	Key string `json:"key,omitempty"`
+}
+
+func (t DBTableConfig) validate(table string) error {
+	if !sqlIdentifier.MatchString(table) {
+		return fmt.Errorf("invalid table name: '%s'", table)
+	}
+	if len(t.Columns) == 0 {
+		return fmt.Errorf("table '%s' has no columns", table)
+	}
+	for _, column := range append(slices.Clone(t.Columns), t.key()) {
+		if !sqlIdentifier.MatchString(column) {
+			return fmt.Errorf("invalid column name of table '%s': '%s'", table, column)
+		}
+	}
+	return nil
+}
+
+func (t DBTableConfig) key() string {
+	if t.Key == "" {
+		return "id"
+	}
+	return t.Key
+}
+
+// formColumns returns the configured columns of table that are present in
+// form and their values, in configuration order.
+func (c *DotDB) formColumns(table string, form any) (DBTableConfig, []string, []any, error) {
+	t, ok := c.tables[table]
+	if !ok {
+		return t, nil, nil, fmt.Errorf("table '%s' is not configured for form binding", table)
+	}
+	var lookup func(string) (any, bool)
+	switch f := form.(type) {
+	case url.Values:
+		lookup = func(k string) (any, bool) { return f.Get(k), f.Has(k) }
+	case map[string]any:
+		lookup = func(k string) (any, bool) { v, ok := f[k]; return v, ok }
+	case map[string]string:
+		lookup = func(k string) (any, bool) { v, ok := f[k]; return v, ok }
+	default:
+		return t, nil, nil, fmt.Errorf("expected form values or a map, got %T", form)
+	}
+	var columns []string
+	var values []any
+	for _, column := range t.Columns {
+		if v, ok := lookup(column); ok {
+			columns = append(columns, column)
+			values = append(values, v)
+		}
+	}
+	if len(columns) == 0 {
+		return t, nil, nil, fmt.Errorf("form has no fields for the columns of table '%s'", table)
+	}
+	return t, columns, values, nil
+}
+
+// InsertForm inserts a row into table, which must be configured in
+// [DotDBConfig.Tables], with the values of form fields that match its
+// whitelisted columns. Form can be url values like .Req.PostForm or a map of
+// validated values. Fields that don't match a column are ignored, and columns
+// without a field get their default value.
+//
+//	{{.Req.ParseForm}}
+//	{{$result := .DB.InsertForm "posts" .Req.PostForm}}
+//	{{$id := $result.LastInsertId}}
+func (c *DotDB) InsertForm(table string, form any) (sql.Result, error) {
+	_, columns, values, err := c.formColumns(table, form)
+	if err != nil {
+		return nil, err
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return c.Exec(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders), values...)
+}
+
+// UpdateForm updates the row of table with the given primary key value like
+// InsertForm, setting only the whitelisted columns present in form.
+//
+//	{{.DB.UpdateForm "posts" (.Req.PathValue "id") .Req.PostForm}}
+func (c *DotDB) UpdateForm(table string, key any, form any) (sql.Result, error) {
+	t, columns, values, err := c.formColumns(table, form)
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range columns {
+		columns[i] = column + " = ?"
+	}
+	return c.Exec(fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?", table, strings.Join(columns, ", "), t.key()), append(values, key)...)
+}
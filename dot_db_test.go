@@ -0,0 +1,80 @@
+package xtemplate
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDBSlowQueries(t *testing.T) {
+	var logs syncBuffer
+	instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte(`{{.DB.QueryVal "SELECT ?" "secret-param"}}`)}},
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		func(c *Config) error {
+			c.Databases = append(c.Databases, DotDBConfig{Name: "DB", Driver: "sqlite3", Connstr: "file::memory:", SlowQueryThreshold: time.Nanosecond})
+			return nil
+		},
+	)
+	w := httptest.NewRecorder()
+	instance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := strings.TrimSpace(w.Body.String()); body != "secret-param" {
+		t.Fatalf("got %q, want the queried value", body)
+	}
+	if out := logs.String(); !strings.Contains(out, `msg="slow QueryRows"`) || !strings.Contains(out, `query="SELECT ?"`) {
+		t.Errorf("expected a slow query warning with the query, got logs:\n%s", out)
+	} else if strings.Contains(out, "secret-param") {
+		t.Errorf("slow query warning contains the query params:\n%s", out)
+	}
+	if stats := instance.DBStats()["DB"]; stats.Queries != 1 || stats.SlowQueries != 1 || stats.Rows != 1 {
+		t.Errorf("got stats %+v, want 1 slow query of 1 row", stats)
+	}
+}
+
+func TestDBReplicas(t *testing.T) {
+	for _, tc := range []struct {
+		name, replica, body string
+	}{
+		// reads before the first write go to the replica, reads after it to
+		// the transaction on the primary
+		{"healthy", "replica.db", "replica written"},
+		{"unavailable", "missing.db", "primary written"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"primary", "replica"} {
+				db, err := sql.Open("sqlite3", "file:"+filepath.Join(dir, name+".db"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := db.Exec(`CREATE TABLE v(x TEXT); INSERT INTO v VALUES (?)`, name); err != nil {
+					t.Fatal(err)
+				}
+				db.Close()
+			}
+			instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte(
+				`{{.DB.QueryVal "SELECT x FROM v"}} {{$_ := .DB.Exec "UPDATE v SET x = 'written'"}}{{.DB.QueryVal "SELECT x FROM v"}}`,
+			)}},
+				func(c *Config) error {
+					c.Databases = append(c.Databases, DotDBConfig{
+						Name:     "DB",
+						Driver:   "sqlite3",
+						Connstr:  "file:" + filepath.Join(dir, "primary.db"),
+						Replicas: []string{"file:" + filepath.Join(dir, tc.replica) + "?mode=ro"},
+					})
+					return nil
+				},
+			)
+			w := httptest.NewRecorder()
+			instance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if body := strings.TrimSpace(w.Body.String()); body != tc.body {
+				t.Errorf("got %q, want %q", body, tc.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DotFetch is used to create a dot field value that calls HTTP APIs through
+// the profiles of its config, which hold the base url, credentials, and TLS
+// settings of each upstream:
+//
+//	{{$r := (.Fetch.Profile "crm").Get (print "contacts/" (.Req.PathValue "id"))}}
+//	{{if $r.OK}}{{$c := $r.JSON}}<h1>{{$c.name}}</h1>{{else}}<p>status {{$r.Status}}</p>{{end}}
+//
+// GET requests without a body are sent once per request to the site: when
+// several components of a page fetch the same path of a profile, the later
+// calls wait for and share the response of the first. Requests with other
+// methods may change what the upstream responds, so after one is sent the
+// next GET of each path of the profile is sent again.
+type DotFetch struct {
+	config *DotFetchConfig
+	ctx    context.Context
+	log    *slog.Logger
+	w      http.ResponseWriter
+	r      *http.Request
+
+	// GET requests by profile and path
+	mu    sync.Mutex
+	calls map[string]*fetchCall
+}
+
+// fetchCall is a GET request that later identical calls share.
+type fetchCall struct {
+	done chan struct{}
+	resp *FetchResponse
+	err  error
+}
+
+// FetchClient sends requests to the upstream of a profile, see
+// [DotFetch.Profile].
+type FetchClient struct {
+	fetch    *DotFetch
+	name     string
+	upstream *fetchUpstream
+}
+
+// FetchResponse is the response of an upstream. Responses with error statuses
+// don't stop template execution, check them with OK.
+type FetchResponse struct {
+	Status int
+	Header http.Header
+	Body   string
+}
+
+// OK reports whether the status is 2xx.
+func (r *FetchResponse) OK() bool {
+	return r.Status >= 200 && r.Status < 300
+}
+
+// JSON decodes the body as JSON.
+func (r *FetchResponse) JSON() (any, error) {
+	var v any
+	if err := json.Unmarshal([]byte(r.Body), &v); err != nil {
+		return nil, fmt.Errorf("failed to decode response as json: %w", err)
+	}
+	return v, nil
+}
+
+// Profile returns a client for the upstream of the named profile.
+func (d *DotFetch) Profile(name string) (*FetchClient, error) {
+	upstream, ok := d.config.upstreams[name]
+	if !ok {
+		return nil, fmt.Errorf("no fetch profile named '%s'", name)
+	}
+	return &FetchClient{d, name, upstream}, nil
+}
+
+// Get sends a GET request to path relative to the base url of the profile.
+func (c *FetchClient) Get(path string) (*FetchResponse, error) {
+	return c.Do(http.MethodGet, path, nil)
+}
+
+// Post sends a POST request with body, see [FetchClient.Do].
+func (c *FetchClient) Post(path string, body any) (*FetchResponse, error) {
+	return c.Do(http.MethodPost, path, body)
+}
+
+// Do sends a request to path relative to the base url of the profile. A
+// string body is sent as is with the `text/plain` content type, [url.Values]
+// as a form, and any other non-nil body as JSON. An error is returned only if
+// the request fails or leaves the base url.
+func (c *FetchClient) Do(method, path string, body any) (*FetchResponse, error) {
+	if method != http.MethodGet || body != nil {
+		if method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions {
+			defer c.fetch.forget(c.name + " ")
+		}
+		return c.do(method, path, body)
+	}
+	return c.fetch.coalesce(c.name+" "+path, func() (*FetchResponse, error) {
+		return c.do(method, path, nil)
+	})
+}
+
+// coalesce returns the result of the call with key if it was made already in
+// this request, waiting for it if it's in progress, or else makes it with
+// fetch.
+func (d *DotFetch) coalesce(key string, fetch func() (*FetchResponse, error)) (*FetchResponse, error) {
+	d.mu.Lock()
+	if call, ok := d.calls[key]; ok {
+		d.mu.Unlock()
+		<-call.done
+		d.log.Debug("coalesced fetch request", slog.String("request", key))
+		return call.resp, call.err
+	}
+	if d.calls == nil {
+		d.calls = map[string]*fetchCall{}
+	}
+	call := &fetchCall{done: make(chan struct{})}
+	d.calls[key] = call
+	d.mu.Unlock()
+
+	defer close(call.done)
+	call.resp, call.err = fetch()
+	return call.resp, call.err
+}
+
+// forget removes the calls whose key starts with prefix, so they're made
+// again.
+func (d *DotFetch) forget(prefix string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	maps.DeleteFunc(d.calls, func(key string, _ *fetchCall) bool { return strings.HasPrefix(key, prefix) })
+}
+
+func (c *FetchClient) do(method, path string, body any) (_ *FetchResponse, err error) {
+	start := time.Now()
+	defer func() {
+		c.fetch.config.metrics.Observe(c.name, time.Since(start), err)
+		c.fetch.log.Debug("fetch request", slog.String("profile", c.name), slog.String("method", method), slog.String("path", path), slog.Duration("duration", time.Since(start)), slog.Any("error", err))
+	}()
+
+	u := c.upstream
+	req, err := c.newRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, u.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fetch response: %w", err)
+	}
+	if int64(len(content)) > u.MaxBodySize {
+		return nil, fmt.Errorf("fetch response is larger than %d bytes", u.MaxBodySize)
+	}
+	return &FetchResponse{Status: resp.StatusCode, Header: resp.Header, Body: string(content)}, nil
+}
+
+// newRequest creates a request to path relative to the base url of the
+// profile with the headers and credentials of the profile.
+func (c *FetchClient) newRequest(method, path string, body any) (*http.Request, error) {
+	u := c.upstream
+	target, err := u.base.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fetch path '%s': %w", path, err)
+	}
+	prefix := strings.TrimSuffix(u.base.Path, "/")
+	if target.Scheme != u.base.Scheme || target.Host != u.base.Host || (target.Path != prefix && !strings.HasPrefix(target.Path, prefix+"/")) {
+		return nil, fmt.Errorf("fetch path '%s' is outside of the base url of profile '%s'", path, c.name)
+	}
+
+	var reader io.Reader
+	var contentType string
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader, contentType = strings.NewReader(b), "text/plain; charset=utf-8"
+	case url.Values:
+		reader, contentType = strings.NewReader(b.Encode()), "application/x-www-form-urlencoded"
+	default:
+		payload, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode fetch body: %w", err)
+		}
+		reader, contentType = bytes.NewReader(payload), "application/json"
+	}
+	req, err := http.NewRequestWithContext(c.fetch.ctx, method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range u.Headers {
+		req.Header.Set(k, v)
+	}
+	switch {
+	case u.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+u.BearerToken)
+	case u.BasicAuth != nil:
+		req.SetBasicAuth(u.BasicAuth.Username, u.BasicAuth.Password)
+	case u.OAuth != nil:
+		token, err := u.accessToken(c.fetch.ctx)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// Stream responds to the request with the response of a GET request to path,
+// copying the body to the client as it arrives instead of buffering it, and
+// stops executing the template like .Resp.ServeContent. Use it to serve large
+// files or media from an authenticated upstream behind the access checks of a
+// template route:
+//
+//	{{if not .User}}{{.Resp.ReturnStatus 403}}{{end}}
+//	{{(.Fetch.Profile "media").Stream (print "videos/" (.Req.PathValue "id"))}}
+//
+// The conditional and range headers of the client request are forwarded, so
+// caching and seeking work, and only the response headers listed in
+// [FetchProfile.StreamHeaders] are copied. Headers set with .Resp aren't sent.
+// Stream must be called before the template writes any output to a flushing
+// response.
+func (c *FetchClient) Stream(path string) (_ string, err error) {
+	start := time.Now()
+	defer func() {
+		c.fetch.config.metrics.Observe(c.name, time.Since(start), err)
+		c.fetch.log.Debug("fetch stream", slog.String("profile", c.name), slog.String("path", path), slog.Duration("duration", time.Since(start)), slog.Any("error", err))
+	}()
+
+	u := c.upstream
+	req, err := c.newRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range streamRequestHeaders {
+		if v := c.fetch.r.Header.Values(h); len(v) > 0 {
+			req.Header[h] = v
+		}
+	}
+	resp, err := u.stream.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	header := c.fetch.w.Header()
+	for _, h := range u.StreamHeaders {
+		h = http.CanonicalHeaderKey(h)
+		if v := resp.Header.Values(h); len(v) > 0 {
+			header[h] = v
+		}
+	}
+	c.fetch.w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(c.fetch.w, resp.Body); err != nil {
+		// the status was already sent, the client sees a truncated body
+		c.fetch.log.Warn("fetch stream interrupted", slog.String("profile", c.name), slog.String("path", path), slog.Any("error", err))
+	}
+	return "", ReturnError{}
+}
+
+// streamRequestHeaders are forwarded from the client request by Stream.
+var streamRequestHeaders = []string{"Accept", "Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"}
+
+// accessToken returns the cached oauth access token, requesting a new one
+// with the client credentials grant if it expires within a minute.
+func (u *fetchUpstream) accessToken(ctx context.Context) (string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.token != "" && time.Now().Add(time.Minute).Before(u.expires) {
+		return u.token, nil
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(u.OAuth.Scopes) > 0 {
+		form.Set("scope", strings.Join(u.OAuth.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.OAuth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(u.OAuth.ClientID), url.QueryEscape(u.OAuth.ClientSecret))
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oauth token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil || resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", fmt.Errorf("oauth token endpoint responded with status %d and no access token", resp.StatusCode)
+	}
+	u.token = result.AccessToken
+	u.expires = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	if result.ExpiresIn <= 0 {
+		// no expiration given, request a new token every hour
+		u.expires = time.Now().Add(time.Hour)
+	}
+	return u.token, nil
+}
@@ -0,0 +1,207 @@
+package xtemplate
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+func WithFetch(name string, cfg DotFetchConfig) Option {
+	return func(c *Config) error {
+		if len(cfg.Profiles) == 0 {
+			return fmt.Errorf("cannot create fetch provider without profiles. name: %s", name)
+		}
+		cfg.Name = name
+		c.Fetch = append(c.Fetch, cfg)
+		return nil
+	}
+}
+
+// DotFetchConfig configures a dot provider that calls HTTP APIs through named
+// upstream profiles, so credentials and connection settings live in the
+// config instead of in template files. See [DotFetch].
+type DotFetchConfig struct {
+	Name string `json:"name"`
+
+	// Upstreams by the name templates select them with.
+	Profiles map[string]FetchProfile `json:"profiles"`
+
+	upstreams map[string]*fetchUpstream
+	metrics   *ProviderMetrics
+}
+
+// FetchProfile configures an upstream of a fetch provider.
+type FetchProfile struct {
+	// URL that request paths are resolved against, like
+	// `https://crm.example.com/api/`. Requests can't leave it, so the
+	// credentials of the profile are only sent to this upstream.
+	BaseURL string `json:"base_url"`
+	// Headers added to every request.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Authenticate with a static bearer token, HTTP basic auth, or an access
+	// token obtained with the OAuth 2 client credentials grant. At most one
+	// may be set.
+	BearerToken string          `json:"bearer_token,omitempty"`
+	BasicAuth   *FetchBasicAuth `json:"basic_auth,omitempty"`
+	OAuth       *FetchOAuth     `json:"oauth,omitempty"`
+
+	// Keep the cookies set by the upstream and send them with later requests.
+	// The jar is shared by all requests to the profile, so it's for upstream
+	// sessions of the site, not of its visitors.
+	CookieJar bool `json:"cookie_jar,omitempty"`
+
+	// TLS settings to connect to the upstream.
+	TLS *FetchTLS `json:"tls,omitempty"`
+
+	// Timeout of each request. Default 10s.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Maximum size of a response body. Default 10MiB. Streamed responses
+	// aren't limited.
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+
+	// Headers of the upstream response that [FetchClient.Stream] copies to
+	// the client. Default Content-Type, Content-Length, Content-Range,
+	// Content-Disposition, Accept-Ranges, ETag, Last-Modified, Cache-Control,
+	// and Expires.
+	StreamHeaders []string `json:"stream_headers,omitempty"`
+}
+
+type FetchBasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// FetchOAuth configures the OAuth 2 client credentials grant. The
+// access token is cached until shortly before it expires.
+type FetchOAuth struct {
+	TokenURL     string   `json:"token_url"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+type FetchTLS struct {
+	// PEM file of CA certificates that verify the upstream instead of the
+	// system roots.
+	CAFile string `json:"ca_file,omitempty"`
+	// PEM files of a client certificate and its key for mutual TLS.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// Server name to verify instead of the host of BaseURL.
+	ServerName string `json:"server_name,omitempty"`
+	// Skip verifying the upstream's certificate. Only for testing.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// fetchUpstream is an initialized profile.
+type fetchUpstream struct {
+	FetchProfile
+	base   *url.URL
+	client *http.Client
+	// client without a timeout for streamed responses, which take as long as
+	// the client takes to read them
+	stream *http.Client
+
+	// the cached oauth access token
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+var _ MetricsDotProvider = &DotFetchConfig{}
+
+func (d *DotFetchConfig) FieldName() string { return d.Name }
+
+// Metrics returns the number and duration of requests by profile, see
+// [MetricsDotProvider].
+func (d *DotFetchConfig) Metrics() map[string]OperationMetrics {
+	return d.metrics.Snapshot()
+}
+
+func (d *DotFetchConfig) Init(_ context.Context) error {
+	if len(d.Profiles) == 0 {
+		return fmt.Errorf("fetch profiles are required")
+	}
+	d.upstreams = make(map[string]*fetchUpstream, len(d.Profiles))
+	for name, p := range d.Profiles {
+		u, err := p.upstream()
+		if err != nil {
+			return fmt.Errorf("invalid fetch profile '%s': %w", name, err)
+		}
+		d.upstreams[name] = u
+	}
+	d.metrics = &ProviderMetrics{}
+	return nil
+}
+func (d *DotFetchConfig) Value(r Request) (any, error) {
+	return &DotFetch{config: d, ctx: r.R.Context(), log: GetLogger(r.R.Context()), w: r.W, r: r.R}, nil
+}
+
+func (p FetchProfile) upstream() (*fetchUpstream, error) {
+	base, err := url.Parse(p.BaseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("base_url must be an absolute http or https url: '%s'", p.BaseURL)
+	}
+	auths := 0
+	for _, set := range []bool{p.BearerToken != "", p.BasicAuth != nil, p.OAuth != nil} {
+		if set {
+			auths += 1
+		}
+	}
+	if auths > 1 {
+		return nil, fmt.Errorf("only one of bearer_token, basic_auth, and oauth may be set")
+	}
+	if p.OAuth != nil && (p.OAuth.TokenURL == "" || p.OAuth.ClientID == "") {
+		return nil, fmt.Errorf("oauth token_url and client_id are required")
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = 10 * time.Second
+	}
+	if p.MaxBodySize <= 0 {
+		p.MaxBodySize = 10 << 20
+	}
+	if len(p.StreamHeaders) == 0 {
+		p.StreamHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Content-Disposition", "Accept-Ranges", "ETag", "Last-Modified", "Cache-Control", "Expires"}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.TLS != nil {
+		tlsConfig := &tls.Config{ServerName: p.TLS.ServerName, InsecureSkipVerify: p.TLS.InsecureSkipVerify}
+		if p.TLS.CAFile != "" {
+			pem, err := os.ReadFile(p.TLS.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ca_file: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in ca_file '%s'", p.TLS.CAFile)
+			}
+		}
+		if p.TLS.CertFile != "" || p.TLS.KeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(p.TLS.CertFile, p.TLS.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	client := &http.Client{Transport: transport, Timeout: p.Timeout}
+	if p.CookieJar {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		client.Jar = jar
+	}
+	stream := &http.Client{Transport: transport, Jar: client.Jar}
+	return &fetchUpstream{FetchProfile: p, base: base, client: client, stream: stream}, nil
+}
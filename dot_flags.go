@@ -3,6 +3,7 @@ package xtemplate
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 )
 
 type DotFlags struct {
@@ -18,7 +19,7 @@ func WithFlags(name string, flags map[string]string) Option {
 		if flags == nil {
 			return fmt.Errorf("cannot create DotKVProvider with null map with name %s", name)
 		}
-		c.Flags = append(c.Flags, DotFlagsConfig{name, flags})
+		c.Flags = append(c.Flags, DotFlagsConfig{Name: name, Values: flags})
 		return nil
 	}
 }
@@ -26,10 +27,22 @@ func WithFlags(name string, flags map[string]string) Option {
 type DotFlagsConfig struct {
 	Name   string            `json:"name"`
 	Values map[string]string `json:"values"`
+
+	// the current values, which [Server.Apply] can change
+	values *atomic.Pointer[map[string]string]
 }
 
 var _ DotConfig = &DotFlagsConfig{}
 
-func (d *DotFlagsConfig) FieldName() string            { return d.Name }
-func (d *DotFlagsConfig) Init(_ context.Context) error { return nil }
-func (d *DotFlagsConfig) Value(_ Request) (any, error) { return DotFlags{d.Values}, nil }
+func (d *DotFlagsConfig) FieldName() string { return d.Name }
+func (d *DotFlagsConfig) Init(_ context.Context) error {
+	d.values = &atomic.Pointer[map[string]string]{}
+	d.values.Store(&d.Values)
+	return nil
+}
+func (d *DotFlagsConfig) Value(_ Request) (any, error) {
+	if d.values == nil {
+		return DotFlags{d.Values}, nil
+	}
+	return DotFlags{*d.values.Load()}, nil
+}
@@ -2,6 +2,7 @@ package xtemplate
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
@@ -9,36 +10,144 @@ import (
 	"time"
 )
 
-type dotFlushProvider struct{}
+type dotFlushProvider struct {
+	// see Config.StreamWriteTimeout
+	writeTimeout time.Duration
+	// see Config.StreamSlowFlush
+	slowFlush time.Duration
+}
 
 func (dotFlushProvider) FieldName() string            { return "Flush" }
 func (dotFlushProvider) Init(_ context.Context) error { return nil }
-func (dotFlushProvider) Value(r Request) (any, error) {
-	f, ok := r.W.(flusher)
-	if !ok {
-		return &DotFlush{}, fmt.Errorf("response writer could not cast to http.Flusher")
+func (p dotFlushProvider) Value(r Request) (any, error) {
+	if !canFlush(r.W) {
+		return &DotFlush{}, fmt.Errorf("response writer does not support flushing")
+	}
+	slowFlush := p.slowFlush
+	if slowFlush <= 0 {
+		slowFlush = 100 * time.Millisecond
 	}
-	return &DotFlush{flusher: f, serverCtx: r.ServerCtx, requestCtx: r.R.Context()}, nil
+	d := &DotFlush{w: r.W, rc: r.ResponseController(), writeTimeout: p.writeTimeout, slowFlush: slowFlush, serverCtx: r.ServerCtx, requestCtx: r.R.Context()}
+	d.extendDeadline()
+	return d, nil
 }
 
 func (dotFlushProvider) Cleanup(v any, err error) error {
 	if err == nil {
-		v.(*DotFlush).flusher.Flush()
+		err = v.(*DotFlush).flush()
 	}
 	return err
 }
 
 var _ CleanupDotProvider = dotFlushProvider{}
 
-type flusher interface {
-	http.ResponseWriter
-	http.Flusher
+// canFlush reports whether w or any writer it wraps implements http.Flusher,
+// like http.ResponseController would find it.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		if _, ok := w.(http.Flusher); ok {
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
 }
 
 // DotFlush is used as the .Flush field for flushing template handlers (SSE).
 type DotFlush struct {
-	flusher               flusher
+	w                     http.ResponseWriter
+	rc                    *http.ResponseController
+	writeTimeout          time.Duration
+	slowFlush             time.Duration
 	serverCtx, requestCtx context.Context
+
+	stats FlushStats
+}
+
+// FlushStats describes how fast the client of a stream receives it, see
+// [DotFlush.Stats].
+type FlushStats struct {
+	// Bytes written to the stream so far.
+	Bytes int64
+	// Number of flushes, and the duration of the last one, the slowest one,
+	// and a moving average that weighs recent flushes more.
+	Flushes   int64
+	LastFlush time.Duration
+	MaxFlush  time.Duration
+	AvgFlush  time.Duration
+}
+
+// flushWriter counts the bytes that the template writes to the stream.
+type flushWriter struct {
+	*DotFlush
+}
+
+func (f flushWriter) Write(b []byte) (int, error) {
+	n, err := f.w.Write(b)
+	f.stats.Bytes += int64(n)
+	return n, err
+}
+
+// extendDeadline moves the write deadline of the connection to writeTimeout
+// from now, or removes it if there's no writeTimeout, so the stream outlives
+// the server's WriteTimeout. Writers that don't support deadlines are ignored.
+func (f *DotFlush) extendDeadline() {
+	var deadline time.Time
+	if f.writeTimeout > 0 {
+		deadline = time.Now().Add(f.writeTimeout)
+	}
+	f.rc.SetWriteDeadline(deadline)
+}
+
+// flush extends the write deadline and flushes buffered output to the client.
+// After the connection was hijacked, it returns ReturnError to stop the
+// template since nothing can be written anymore.
+func (f *DotFlush) flush() error {
+	f.extendDeadline()
+	start := time.Now()
+	err := f.rc.Flush()
+	f.observe(time.Since(start))
+	if errors.Is(err, http.ErrHijacked) {
+		return ReturnError{}
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// observe records the duration of a flush. A flush blocks while the network
+// buffers are full, so slow flushes mean the client can't keep up.
+func (f *DotFlush) observe(d time.Duration) {
+	s := &f.stats
+	s.Flushes += 1
+	s.LastFlush = d
+	s.MaxFlush = max(s.MaxFlush, d)
+	if s.Flushes == 1 {
+		s.AvgFlush = d
+	} else {
+		s.AvgFlush += (d - s.AvgFlush) / 4
+	}
+}
+
+// Stats returns the bytes written to the stream and the durations of its
+// flushes so far.
+func (f *DotFlush) Stats() FlushStats {
+	return f.stats
+}
+
+// Slow reports whether the average flush takes longer than
+// [Config.StreamSlowFlush], which means the client or its network can't keep
+// up with the stream. Templates can send fewer or smaller updates while it's
+// slow:
+//
+//	{{range .Nats.Subscribe "prices"}}
+//	  {{if not $.Flush.Slow}}{{$.Flush.SendSSE "price" (toString .Data)}}{{end}}
+//	{{end}}
+func (f *DotFlush) Slow() bool {
+	return f.stats.AvgFlush > f.slowFlush
 }
 
 // SendSSE sends an sse message by formatting the provided args as an sse event:
@@ -63,34 +172,33 @@ func (f *DotFlush) SendSSE(args ...string) error {
 	}
 	written := false
 	if event != "" {
-		fmt.Fprintf(f.flusher, "event: %s\n", strings.SplitN(event, "\n", 2)[0])
+		fmt.Fprintf(flushWriter{f}, "event: %s\n", strings.SplitN(event, "\n", 2)[0])
 		written = true
 	}
 	if data != "" {
 		for _, line := range strings.Split(data, "\n") {
-			fmt.Fprintf(f.flusher, "data: %s\n", line)
+			fmt.Fprintf(flushWriter{f}, "data: %s\n", line)
 			written = true
 		}
 	}
 	if id != "" {
-		fmt.Fprintf(f.flusher, "id: %s\n", strings.SplitN(id, "\n", 2)[0])
+		fmt.Fprintf(flushWriter{f}, "id: %s\n", strings.SplitN(id, "\n", 2)[0])
 		written = true
 	}
 	if retry != "" {
-		fmt.Fprintf(f.flusher, "retry: %s\n", strings.SplitN(retry, "\n", 2)[0])
+		fmt.Fprintf(flushWriter{f}, "retry: %s\n", strings.SplitN(retry, "\n", 2)[0])
 		written = true
 	}
 	if written {
-		fmt.Fprintf(f.flusher, "\n\n")
-		f.flusher.Flush()
+		fmt.Fprintf(flushWriter{f}, "\n\n")
+		return f.flush()
 	}
 	return nil
 }
 
 // Flush flushes any content waiting to written to the client.
-func (f *DotFlush) Flush() string {
-	f.flusher.Flush()
-	return ""
+func (f *DotFlush) Flush() (string, error) {
+	return "", f.flush()
 }
 
 // Repeat generates numbers up to max, using math.MaxInt64 if no max is provided.
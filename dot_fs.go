@@ -2,17 +2,25 @@ package xtemplate
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
 	"path"
+	"path/filepath"
+	"strings"
 )
 
 type dotFS struct {
 	fs     fs.FS
 	log    *slog.Logger
 	opened map[fs.File]struct{}
+	cache  *fsMetaCache
+	// see DotDirConfig.root
+	root string
+	// limits concurrent reads of images, see [Config.ImageWorkers]
+	images chan struct{}
 }
 
 // Dir
@@ -21,32 +29,99 @@ type Dir struct {
 	path string
 }
 
-// Dir returns a
+// Resolve returns the path of name relative to the root of the fs, or an
+// error if it leaves the root with `..` or, unless
+// [DotDirConfig.AllowSymlinkEscape] is set, through a symlink. All methods
+// resolve names like this, use Resolve to check a path from a request
+// before using it elsewhere, like in a link:
+//
+//	{{$path := .FS.Resolve (.Req.URL.Query.Get "file")}}
+//
+// Names are relative to the directory, which is the root of the fs unless it
+// was returned by Dir.
+func (d Dir) Resolve(name string) (string, error) {
+	p := path.Join(d.path, name)
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("path is outside of the directory: '%s'", name)
+	}
+	if d.dot.root == "" {
+		return p, nil
+	}
+	_, err := d.dot.cache.get("resolve", p, func() (any, error) { return nil, d.dot.checkSymlinks(p) })
+	if err != nil {
+		return "", fmt.Errorf("path is outside of the directory: '%s': %w", name, err)
+	}
+	return p, nil
+}
+
+// checkSymlinks returns an error if p resolves outside of the root through a
+// symlink. Paths that don't exist are allowed, opening them fails anyway.
+func (d *dotFS) checkSymlinks(p string) error {
+	real, err := filepath.EvalSymlinks(filepath.Join(d.root, filepath.FromSlash(p)))
+	if err != nil {
+		return nil
+	}
+	if rel, err := filepath.Rel(d.root, real); err != nil || !filepath.IsLocal(rel) && rel != "." {
+		return errors.New("it resolves through a symlink")
+	}
+	return nil
+}
+
+// Glob returns the paths relative to the directory of the files that match
+// pattern, in the syntax of [path.Match] like `photos/*.jpg`. Files that
+// resolve outside of the fs are skipped.
+func (d Dir) Glob(pattern string) ([]string, error) {
+	p, err := d.Resolve(pattern)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := fs.Glob(d.dot.fs, p)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		if d.dot.root != "" && d.dot.checkSymlinks(m) != nil {
+			continue
+		}
+		if d.path != "." {
+			m = strings.TrimPrefix(m, d.path+"/")
+		}
+		names = append(names, m)
+	}
+	return names, nil
+}
+
+// Dir returns the subdirectory name, whose methods take names relative to it.
 func (d Dir) Dir(name string) (Dir, error) {
-	name = path.Clean(name)
+	p, err := d.Resolve(name)
+	if err != nil {
+		return Dir{}, err
+	}
 	if st, err := d.Stat(name); err != nil {
 		return Dir{}, err
 	} else if !st.IsDir() {
 		return Dir{}, fmt.Errorf("not a directory: %s", name)
 	}
-	return Dir{dot: d.dot, path: path.Join(d.path, name)}, nil
+	return Dir{dot: d.dot, path: p}, nil
 }
 
 // List reads and returns a slice of names from the given directory relative to
 // the FS root.
 func (d Dir) List(name string) ([]fs.DirEntry, error) {
-	return fs.ReadDir(d.dot.fs, path.Join(d.path, path.Clean(name)))
+	name, err := d.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := d.dot.cache.get("readdir", name, func() (any, error) { return fs.ReadDir(d.dot.fs, name) })
+	list, _ := entries.([]fs.DirEntry)
+	return list, err
 }
 
-// Exists returns true if filename can be opened successfully.
+// Exists returns true if filename exists inside of the fs.
 func (d Dir) Exists(name string) bool {
-	name = path.Join(d.path, path.Clean(name))
-	file, err := d.Open(name)
-	if err == nil {
-		file.Close()
-		return true
-	}
-	return false
+	_, err := d.Stat(name)
+	return err == nil
 }
 
 // Stat returns Stat of a filename.
@@ -54,18 +129,21 @@ func (d Dir) Exists(name string) bool {
 // Note: if you intend to read the file, afterwards, calling .Open instead may
 // be more efficient.
 func (d Dir) Stat(name string) (fs.FileInfo, error) {
-	name = path.Join(d.path, path.Clean(name))
-	file, err := d.dot.fs.Open(name)
+	name, err := d.Resolve(name)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	return file.Stat()
+	info, err := d.dot.cache.get("stat", name, func() (any, error) { return fs.Stat(d.dot.fs, name) })
+	stat, _ := info.(fs.FileInfo)
+	return stat, err
 }
 
 // Read returns the contents of a filename relative to the FS root as a string.
 func (d Dir) Read(name string) (string, error) {
-	name = path.Join(d.path, path.Clean(name))
+	name, err := d.Resolve(name)
+	if err != nil {
+		return "", err
+	}
 
 	buf := bufPool.Get().(*bytes.Buffer)
 	buf.Reset()
@@ -87,7 +165,10 @@ func (d Dir) Read(name string) (string, error) {
 
 // Open opens the file
 func (d Dir) Open(name string) (fs.File, error) {
-	name = path.Join(d.path, path.Clean(name))
+	name, err := d.Resolve(name)
+	if err != nil {
+		return nil, err
+	}
 
 	file, err := d.dot.fs.Open(name)
 	if err != nil {
@@ -97,5 +178,5 @@ func (d Dir) Open(name string) (fs.File, error) {
 	d.dot.log.Debug("opened file", slog.String("path", name))
 	d.dot.opened[file] = struct{}{}
 
-	return d.dot.fs.Open(name)
+	return file, nil
 }
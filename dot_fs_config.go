@@ -7,6 +7,9 @@ import (
 	"io/fs"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
 // WithDir creates an [xtemplate.Option] that can be used with
@@ -30,12 +33,39 @@ type DotDirConfig struct {
 	Name  string `json:"name"`
 	fs.FS `json:"-"`
 	Path  string `json:"path"`
+
+	// How long the results of Stat, List, Dir, and Exists are cached and
+	// shared by all requests, for templates that build listings from
+	// directories on every request. The cache is dropped when the instance is
+	// reloaded. Default no caching.
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+
+	// Whether files can be read through symlinks that point outside of Path.
+	// By default paths that resolve outside of it are rejected like paths
+	// with `..` that leave it, so paths from requests can be used safely.
+	AllowSymlinkEscape bool `json:"allow_symlink_escape,omitempty"`
+
+	cache *fsMetaCache
+	// Path with symlinks evaluated, empty if symlinks aren't checked
+	root string
+	// see [Config.ImageWorkers]
+	images chan struct{}
 }
 
 var _ CleanupDotProvider = &DotDirConfig{}
 
 func (c *DotDirConfig) FieldName() string { return c.Name }
 func (p *DotDirConfig) Init(ctx context.Context) error {
+	if p.CacheTTL > 0 {
+		p.cache = &fsMetaCache{ttl: p.CacheTTL, entries: map[fsMetaKey]fsMetaEntry{}}
+	}
+	if p.Path != "" && !p.AllowSymlinkEscape {
+		root, err := filepath.EvalSymlinks(p.Path)
+		if err != nil {
+			return fmt.Errorf("failed to resolve fs directory '%s': %w", p.Path, err)
+		}
+		p.root = root
+	}
 	if p.FS != nil {
 		return nil
 	}
@@ -49,7 +79,7 @@ func (p *DotDirConfig) Init(ctx context.Context) error {
 	return nil
 }
 func (p *DotDirConfig) Value(r Request) (any, error) {
-	return Dir{dot: &dotFS{p.FS, GetLogger(r.R.Context()), make(map[fs.File]struct{})}, path: "."}, nil
+	return Dir{dot: &dotFS{p.FS, GetLogger(r.R.Context()), make(map[fs.File]struct{}), p.cache, p.root, p.images}, path: "."}, nil
 }
 func (p *DotDirConfig) Cleanup(a any, err error) error {
 	v := a.(Dir).dot
@@ -69,3 +99,57 @@ func (p *DotDirConfig) Cleanup(a any, err error) error {
 	}
 	return err
 }
+
+// maxFSMetaEntries bounds the number of cached results of a [DotDirConfig].
+const maxFSMetaEntries = 10000
+
+// fsMetaCache caches the results of Stat and ReadDir, see
+// [DotDirConfig.CacheTTL]. Errors are cached too, so checking for files that
+// don't exist is cached.
+type fsMetaCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[fsMetaKey]fsMetaEntry
+}
+
+type fsMetaKey struct {
+	op, path string
+}
+
+type fsMetaEntry struct {
+	value   any
+	err     error
+	expires time.Time
+}
+
+// get returns the cached result of op on path, or loads and caches it. If c
+// is nil, it always loads.
+func (c *fsMetaCache) get(op, path string, load func() (any, error)) (any, error) {
+	if c == nil {
+		return load()
+	}
+	key := fsMetaKey{op, path}
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.value, e.err
+	}
+	value, err := load()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxFSMetaEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxFSMetaEntries {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = fsMetaEntry{value, err, now.Add(c.ttl)}
+	return value, err
+}
@@ -0,0 +1,304 @@
+package xtemplate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+// maxImageHeader is how much of an image file is read to find its dimensions
+// and EXIF metadata, which are stored before the pixel data.
+const maxImageHeader = 256 << 10
+
+// ImageInfo describes an image file, see [Dir.Image].
+type ImageInfo struct {
+	// The format of the image: `jpeg`, `png`, or `gif`.
+	Format string
+
+	// The dimensions of the image as it's displayed, after applying its EXIF
+	// orientation, which is what the width and height attributes of an img
+	// element should be set to.
+	Width, Height int
+
+	// The EXIF orientation from 1 to 8, 1 if the image has none. Orientations
+	// 5 to 8 are rotated by 90 degrees, so Width and Height are swapped
+	// relative to the stored pixels.
+	Orientation int
+
+	// Selected EXIF fields of a JPEG image by their EXIF tag names: Make,
+	// Model, Software, DateTime, DateTimeOriginal, LensModel, ExposureTime
+	// (like `1/250`), FNumber, FocalLength, ISO, and GPSLatitude and
+	// GPSLongitude in decimal degrees. Fields the image doesn't have are
+	// missing.
+	EXIF map[string]any
+}
+
+// Image reads the dimensions, orientation, and selected EXIF fields of a
+// JPEG, PNG, or GIF image file without decoding its pixels:
+//
+//	{{$img := .FS.Image "photos/lake.jpg"}}
+//	<img src="/photos/lake.jpg" width="{{$img.Width}}" height="{{$img.Height}}" alt="">
+//	{{with $img.EXIF.Model}}<figcaption>Shot on {{.}}</figcaption>{{end}}
+func (d Dir) Image(name string) (ImageInfo, error) {
+	name, err := d.Resolve(name)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+
+	if d.dot.images != nil {
+		d.dot.images <- struct{}{}
+		defer func() { <-d.dot.images }()
+	}
+
+	file, err := d.dot.fs.Open(name)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxImageHeader))
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to read image '%s': %w", name, err)
+	}
+
+	info := ImageInfo{Format: format, Width: config.Width, Height: config.Height, Orientation: 1, EXIF: map[string]any{}}
+	if format == "jpeg" {
+		if tiff := jpegExif(data); tiff != nil {
+			readExif(tiff, info.EXIF)
+		}
+	}
+	if o, ok := info.EXIF["Orientation"].(int); ok && o >= 1 && o <= 8 {
+		info.Orientation = o
+	}
+	delete(info.EXIF, "Orientation")
+	if info.Orientation >= 5 {
+		info.Width, info.Height = info.Height, info.Width
+	}
+	return info, nil
+}
+
+// jpegExif returns the TIFF structure of the EXIF APP1 segment of a JPEG
+// file, or nil if it has none.
+func jpegExif(data []byte) []byte {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 || marker == 0xFF {
+			// markers without a length
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			// start of scan or end of image, the metadata segments are before
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		if segment := data[i+4 : end]; marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i = end
+	}
+	return nil
+}
+
+var (
+	exifTags = map[uint16]string{
+		0x010F: "Make",
+		0x0110: "Model",
+		0x0112: "Orientation",
+		0x0131: "Software",
+		0x0132: "DateTime",
+		0x829A: "ExposureTime",
+		0x829D: "FNumber",
+		0x8827: "ISO",
+		0x9003: "DateTimeOriginal",
+		0x920A: "FocalLength",
+		0xA434: "LensModel",
+	}
+	gpsTags = map[uint16]string{
+		0x0001: "GPSLatitudeRef",
+		0x0002: "GPSLatitude",
+		0x0003: "GPSLongitudeRef",
+		0x0004: "GPSLongitude",
+	}
+)
+
+const (
+	exifIFDPointer = 0x8769
+	gpsIFDPointer  = 0x8825
+)
+
+// readExif reads the tags of exifTags from IFD0 and the EXIF sub-IFD of a
+// TIFF structure into fields, and the GPS position from the GPS sub-IFD.
+// Malformed entries are skipped.
+func readExif(tiff []byte, fields map[string]any) {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(tiff, []byte("II*\x00")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(tiff, []byte("MM\x00*")):
+		order = binary.BigEndian
+	default:
+		return
+	}
+	t := tiffReader{tiff, order}
+	ifd0 := t.uint32(4)
+	for _, e := range t.entries(ifd0) {
+		switch e.tag {
+		case exifIFDPointer:
+			for _, e := range t.entries(t.uint32(e.offset)) {
+				t.readTag(e, exifTags, fields)
+			}
+		case gpsIFDPointer:
+			gps := map[string]any{}
+			for _, e := range t.entries(t.uint32(e.offset)) {
+				t.readTag(e, gpsTags, gps)
+			}
+			lat, latOk := gps["GPSLatitude"].(float64)
+			lon, lonOk := gps["GPSLongitude"].(float64)
+			if latOk && lonOk {
+				if gps["GPSLatitudeRef"] == "S" {
+					lat = -lat
+				}
+				if gps["GPSLongitudeRef"] == "W" {
+					lon = -lon
+				}
+				fields["GPSLatitude"], fields["GPSLongitude"] = lat, lon
+			}
+		default:
+			t.readTag(e, exifTags, fields)
+		}
+	}
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// tiffEntry is an IFD entry, offset is the position of its value field.
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	offset   uint32
+}
+
+func (t tiffReader) uint16(offset uint32) uint16 {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return 0
+	}
+	return t.order.Uint16(t.data[offset:])
+}
+
+func (t tiffReader) uint32(offset uint32) uint32 {
+	if uint64(offset)+4 > uint64(len(t.data)) {
+		return 0
+	}
+	return t.order.Uint32(t.data[offset:])
+}
+
+func (t tiffReader) entries(ifd uint32) []tiffEntry {
+	if ifd == 0 || uint64(ifd)+2 > uint64(len(t.data)) {
+		return nil
+	}
+	n := uint32(t.uint16(ifd))
+	if uint64(ifd)+2+uint64(n)*12 > uint64(len(t.data)) {
+		return nil
+	}
+	entries := make([]tiffEntry, n)
+	for i := range entries {
+		pos := ifd + 2 + uint32(i)*12
+		entries[i] = tiffEntry{t.uint16(pos), t.uint16(pos + 2), t.uint32(pos + 4), pos + 8}
+	}
+	return entries
+}
+
+// value returns the bytes of the value of an entry, which are stored in the
+// entry if they fit into 4 bytes and at an offset otherwise.
+func (t tiffReader) value(e tiffEntry) []byte {
+	sizes := map[uint16]uint64{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+	size, ok := sizes[e.typ]
+	if !ok {
+		return nil
+	}
+	n := size * uint64(e.count)
+	offset := uint64(e.offset)
+	if n > 4 {
+		offset = uint64(t.uint32(e.offset))
+	}
+	if offset+n > uint64(len(t.data)) {
+		return nil
+	}
+	return t.data[offset : offset+n]
+}
+
+// readTag stores the value of an entry into fields if its tag is one of
+// names. Strings are trimmed, single integers and rationals are stored as
+// int and float64, except ExposureTime which is formatted like `1/250`, and
+// GPS coordinates are converted from degrees, minutes, and seconds to
+// decimal degrees.
+func (t tiffReader) readTag(e tiffEntry, names map[uint16]string, fields map[string]any) {
+	name, ok := names[e.tag]
+	if !ok {
+		return
+	}
+	v := t.value(e)
+	if v == nil || e.count == 0 {
+		return
+	}
+	switch e.typ {
+	case 2: // ascii
+		if s := strings.TrimSpace(strings.TrimRight(string(v), "\x00")); s != "" {
+			fields[name] = s
+		}
+	case 3: // short
+		fields[name] = int(t.order.Uint16(v))
+	case 4: // long
+		fields[name] = int(t.order.Uint32(v))
+	case 5, 10: // rational, signed rational
+		rationals := make([][2]float64, e.count)
+		for i := range rationals {
+			num, den := t.order.Uint32(v[i*8:]), t.order.Uint32(v[i*8+4:])
+			if e.typ == 10 {
+				rationals[i] = [2]float64{float64(int32(num)), float64(int32(den))}
+			} else {
+				rationals[i] = [2]float64{float64(num), float64(den)}
+			}
+			if rationals[i][1] == 0 {
+				return
+			}
+		}
+		switch {
+		case name == "ExposureTime":
+			if r := rationals[0]; r[0] < r[1] && r[0] > 0 {
+				fields[name] = fmt.Sprintf("1/%.0f", r[1]/r[0])
+			} else {
+				fields[name] = fmt.Sprintf("%g", r[0]/r[1])
+			}
+		case len(rationals) == 3:
+			deg, mins, secs := rationals[0], rationals[1], rationals[2]
+			fields[name] = deg[0]/deg[1] + mins[0]/mins[1]/60 + secs[0]/secs[1]/3600
+		default:
+			fields[name] = rationals[0][0] / rationals[0][1]
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package xtemplate
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestImageWorkers(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	images := fstest.MapFS{"a.png": {Data: img.Bytes()}}
+	instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte(`{{range 3}}{{with $.Images.Image "a.png"}}{{.Width}}x{{.Height}} {{end}}{{end}}`)}},
+		WithDir("Images", images),
+		func(c *Config) error {
+			c.ImageWorkers = 1
+			return nil
+		},
+	)
+	w := httptest.NewRecorder()
+	instance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if body := strings.TrimSpace(w.Body.String()); body != "3x2 3x2 3x2" {
+		t.Errorf("got %q, want the size of each image read one at a time", body)
+	}
+}
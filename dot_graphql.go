@@ -0,0 +1,142 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DotGraphQL is used to create a dot field value that queries a GraphQL
+// endpoint. Responses with GraphQL errors don't stop template execution, check
+// them with OK, ErrorMessage, and Errors:
+//
+//	{{$r := .CMS.Query `query($slug: String!) { post(slug: $slug) { title body } }` (dict "slug" (.Req.PathValue "slug"))}}
+//	{{if $r.OK}}<h1>{{$r.Data.post.title}}</h1>{{else}}<p>{{$r.ErrorMessage}}</p>{{end}}
+type DotGraphQL struct {
+	config *DotGraphQLConfig
+	ctx    context.Context
+	log    *slog.Logger
+}
+
+// GraphQLResponse is the result of a GraphQL query. Data may be partially
+// populated even if there are Errors.
+type GraphQLResponse struct {
+	Data       map[string]any `json:"data"`
+	Errors     []GraphQLError `json:"errors"`
+	Extensions map[string]any `json:"extensions"`
+}
+
+// OK reports whether the response has no errors.
+func (r *GraphQLResponse) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// ErrorMessage returns the messages of all errors joined by "; ", or an empty
+// string if there are no errors.
+func (r *GraphQLResponse) ErrorMessage() string {
+	messages := make([]string, len(r.Errors))
+	for i, e := range r.Errors {
+		messages[i] = e.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// GraphQLError is an error returned by a GraphQL server.
+type GraphQLError struct {
+	Message   string `json:"message"`
+	Path      []any  `json:"path"`
+	Locations []struct {
+		Line   int `json:"line"`
+		Column int `json:"column"`
+	} `json:"locations"`
+	Extensions map[string]any `json:"extensions"`
+}
+
+// Code returns the `code` extension of the error that many servers use to
+// classify errors, like "UNAUTHENTICATED", or an empty string.
+func (e GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// Query sends a query or mutation with optional variables and returns the
+// response. An error is returned only if the request fails or the response
+// isn't a GraphQL response.
+func (d *DotGraphQL) Query(query string, variables ...map[string]any) (*GraphQLResponse, error) {
+	if len(variables) > 1 {
+		return nil, fmt.Errorf("too many variables arguments")
+	}
+	body := map[string]any{"query": query}
+	if len(variables) == 1 {
+		body["variables"] = variables[0]
+	}
+	if !d.config.PersistedQueries {
+		return d.post(body)
+	}
+
+	sum := sha256.Sum256([]byte(query))
+	body["extensions"] = map[string]any{"persistedQuery": map[string]any{"version": 1, "sha256Hash": hex.EncodeToString(sum[:])}}
+	delete(body, "query")
+	resp, err := d.post(body)
+	if err != nil || !persistedQueryNotFound(resp) {
+		return resp, err
+	}
+	body["query"] = query
+	return d.post(body)
+}
+
+func persistedQueryNotFound(resp *GraphQLResponse) bool {
+	for _, e := range resp.Errors {
+		if e.Message == "PersistedQueryNotFound" || e.Code() == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DotGraphQL) post(body map[string]any) (_ *GraphQLResponse, err error) {
+	start := time.Now()
+	defer func() {
+		d.config.metrics.Observe("request", time.Since(start), err)
+		d.log.Debug("graphql request", slog.String("url", d.config.URL), slog.Bool("persisted", body["query"] == nil), slog.Duration("duration", time.Since(start)), slog.Any("error", err))
+	}()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode graphql request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, d.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/graphql-response+json, application/json")
+	for k, v := range d.config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := d.config.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("graphql request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	content, err := io.ReadAll(io.LimitReader(resp.Body, d.config.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read graphql response: %w", err)
+	}
+	if int64(len(content)) > d.config.MaxBodySize {
+		return nil, fmt.Errorf("graphql response is larger than %d bytes", d.config.MaxBodySize)
+	}
+	var result GraphQLResponse
+	if err := json.Unmarshal(content, &result); err != nil || (result.Data == nil && result.Errors == nil) {
+		return nil, fmt.Errorf("graphql endpoint responded with status %d and no graphql result", resp.StatusCode)
+	}
+	return &result, nil
+}
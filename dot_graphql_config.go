@@ -0,0 +1,68 @@
+package xtemplate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func WithGraphQL(name string, cfg DotGraphQLConfig) Option {
+	return func(c *Config) error {
+		if cfg.URL == "" {
+			return fmt.Errorf("cannot create graphql provider without a url. name: %s", name)
+		}
+		cfg.Name = name
+		c.GraphQL = append(c.GraphQL, cfg)
+		return nil
+	}
+}
+
+// DotGraphQLConfig configures a dot provider that queries a GraphQL endpoint,
+// like a headless CMS or an internal API. See [DotGraphQL].
+type DotGraphQLConfig struct {
+	Name string `json:"name"`
+
+	// URL of the GraphQL endpoint.
+	URL string `json:"url"`
+	// Headers added to every request, like `Authorization`.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Send automatic persisted queries: the sha256 hash of the query is sent
+	// instead of its text, and the text is only sent if the server doesn't know
+	// the hash yet. Supported by Apollo Server and many hosted APIs.
+	PersistedQueries bool `json:"persisted_queries,omitempty"`
+	// Timeout of each request. Default 10s.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// Maximum size of a response body. Default 10MiB.
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+
+	client  *http.Client
+	metrics *ProviderMetrics
+}
+
+var _ MetricsDotProvider = &DotGraphQLConfig{}
+
+func (d *DotGraphQLConfig) FieldName() string { return d.Name }
+
+// Metrics returns the number and duration of requests, see
+// [MetricsDotProvider].
+func (d *DotGraphQLConfig) Metrics() map[string]OperationMetrics {
+	return d.metrics.Snapshot()
+}
+func (d *DotGraphQLConfig) Init(_ context.Context) error {
+	if d.URL == "" {
+		return fmt.Errorf("graphql url is required")
+	}
+	if d.Timeout <= 0 {
+		d.Timeout = 10 * time.Second
+	}
+	if d.MaxBodySize <= 0 {
+		d.MaxBodySize = 10 << 20
+	}
+	d.client = &http.Client{Timeout: d.Timeout}
+	d.metrics = &ProviderMetrics{}
+	return nil
+}
+func (d *DotGraphQLConfig) Value(r Request) (any, error) {
+	return &DotGraphQL{d, r.R.Context(), GetLogger(r.R.Context())}, nil
+}
@@ -0,0 +1,96 @@
+package xtemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGraphQL(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	known := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Query      string         `json:"query"`
+			Variables  map[string]any `json:"variables"`
+			Extensions struct {
+				PersistedQuery struct {
+					Hash string `json:"sha256Hash"`
+				} `json:"persistedQuery"`
+			} `json:"extensions"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		hash := body.Extensions.PersistedQuery.Hash
+		requests = append(requests, hash[:8]+" "+body.Query)
+		if body.Query == "" {
+			if body.Query = known[hash]; body.Query == "" {
+				w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound"}]}`))
+				return
+			}
+		}
+		known[hash] = body.Query
+		switch body.Query {
+		case "{ hello }":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"hello": "hi " + body.Variables["name"].(string)}})
+		case "{ fail }":
+			w.Write([]byte(`{"data":null,"errors":[{"message":"boom","extensions":{"code":"BAD_INPUT"}}]}`))
+		case "{ big }":
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"big": strings.Repeat("x", 2048)}})
+		default:
+			http.Error(w, "<html>bad gateway</html>", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte(
+		`{{with .CMS.Query (.Req.FormValue "q") (dict "name" "ann")}}{{.OK}} {{.Data.hello}} {{.ErrorMessage}} {{range .Errors}}{{.Code}}{{end}}{{end}}`,
+	)}},
+		WithGraphQL("CMS", DotGraphQLConfig{
+			URL:              server.URL,
+			Headers:          map[string]string{"Authorization": "Bearer token"},
+			PersistedQueries: true,
+			MaxBodySize:      1024,
+		}),
+	)
+	for _, tc := range []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"{ hello }", http.StatusOK, "true hi ann"},
+		// the server knows the hash now, so the query isn't sent again
+		{"{ hello }", http.StatusOK, "true hi ann"},
+		{"{ fail }", http.StatusOK, "false  boom BAD_INPUT"},
+		{"{ big }", http.StatusInternalServerError, ""},
+		{"{ unknown }", http.StatusInternalServerError, ""},
+	} {
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?"+url.Values{"q": {tc.query}}.Encode(), nil))
+		if w.Code != tc.status {
+			t.Errorf("%s: got status %d, want %d", tc.query, w.Code, tc.status)
+		}
+		if body := strings.TrimSpace(w.Body.String()); tc.status == http.StatusOK && body != tc.body {
+			t.Errorf("%s: got %q, want %q", tc.query, body, tc.body)
+		}
+	}
+	sum := sha256.Sum256([]byte("{ hello }"))
+	hash := hex.EncodeToString(sum[:])[:8]
+	mu.Lock()
+	defer mu.Unlock()
+	if got, want := strings.Join(requests[:3], ", "), hash+" , "+hash+" { hello }, "+hash+" "; got != want {
+		t.Errorf("got requests %q, want a persisted query, the query after it wasn't found, and the persisted query again", got)
+	}
+}
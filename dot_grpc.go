@@ -0,0 +1,199 @@
+package xtemplate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// DotGRPC is used to create a dot field value that calls unary methods of a
+// gRPC server. Requests are given as maps and responses are returned as maps,
+// using the protobuf JSON mapping for field names and values:
+//
+//	{{$order := .Orders.Call "shop.v1.Orders/GetOrder" (dict "id" (.Req.PathValue "id"))}}
+//	<h1>Order {{$order.id}}</h1>
+//	{{range $order.items}}<li>{{.name}} × {{.quantity}}{{end}}
+type DotGRPC struct {
+	config *DotGRPCConfig
+	ctx    context.Context
+	log    *slog.Logger
+}
+
+// GRPCError is returned when a call fails with a gRPC status.
+type GRPCError struct {
+	Code    string
+	Message string
+}
+
+func (e *GRPCError) Error() string {
+	return fmt.Sprintf("grpc error %s: %s", e.Code, e.Message)
+}
+
+// Call invokes the unary method named like `package.Service/Method` with the
+// request, which may be a map or any value that marshals to a JSON object, and
+// returns the response. If the call fails with a gRPC status the error is a
+// [*GRPCError].
+func (d *DotGRPC) Call(method string, request any) (_ map[string]any, err error) {
+	start := time.Now()
+	defer func() {
+		d.config.metrics.Observe(method, time.Since(start), err)
+		d.log.Debug("grpc call", slog.String("method", method), slog.Duration("duration", time.Since(start)), slog.Any("error", err))
+	}()
+
+	method = strings.TrimPrefix(method, "/")
+	ctx, cancel := context.WithTimeout(d.ctx, d.config.Timeout)
+	defer cancel()
+	desc, err := d.config.method(ctx, method)
+	if err != nil {
+		return nil, err
+	}
+	if desc.IsStreamingClient() || desc.IsStreamingServer() {
+		return nil, fmt.Errorf("grpc method '%s' is streaming, only unary methods can be called", method)
+	}
+
+	in := dynamicpb.NewMessage(desc.Input())
+	if request != nil {
+		content, err := json.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode grpc request: %w", err)
+		}
+		if err := protojson.Unmarshal(content, in); err != nil {
+			return nil, fmt.Errorf("request doesn't match %s: %w", desc.Input().FullName(), err)
+		}
+	}
+	for k, v := range d.config.Metadata {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+	out := dynamicpb.NewMessage(desc.Output())
+	if err := d.config.conn.Invoke(ctx, "/"+method, in, out); err != nil {
+		if s, ok := status.FromError(err); ok {
+			return nil, &GRPCError{Code: s.Code().String(), Message: s.Message()}
+		}
+		return nil, err
+	}
+
+	content, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode grpc response: %w", err)
+	}
+	var response map[string]any
+	if err := json.Unmarshal(content, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode grpc response: %w", err)
+	}
+	return response, nil
+}
+
+// method returns the descriptor of the method named like
+// `package.Service/Method`, looking it up in the configured descriptor sets or
+// with server reflection.
+func (d *DotGRPCConfig) method(ctx context.Context, name string) (protoreflect.MethodDescriptor, error) {
+	if m, ok := d.methods.Load(name); ok {
+		return m.(protoreflect.MethodDescriptor), nil
+	}
+	service, methodName, ok := strings.Cut(name, "/")
+	if !ok {
+		return nil, fmt.Errorf("grpc method must be named like 'package.Service/Method', got '%s'", name)
+	}
+	files := d.files
+	if files == nil {
+		var err error
+		if files, err = d.reflect(ctx, service); err != nil {
+			return nil, fmt.Errorf("failed to resolve grpc service '%s' with server reflection: %w", service, err)
+		}
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, fmt.Errorf("grpc service '%s' not found: %w", service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a grpc service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(methodName))
+	if md == nil {
+		return nil, fmt.Errorf("grpc service '%s' has no method '%s'", service, methodName)
+	}
+	d.methods.Store(name, md)
+	return md, nil
+}
+
+// reflect fetches the file that defines service and all its dependencies from
+// the server reflection service.
+func (d *DotGRPCConfig) reflect(ctx context.Context, service string) (*protoregistry.Files, error) {
+	stream, err := rpb.NewServerReflectionClient(d.conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	protos := map[string]*descriptorpb.FileDescriptorProto{}
+	var order []string
+	request := &rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service}}
+	for request != nil {
+		if err := stream.Send(request); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil, fmt.Errorf("reflection stream closed")
+		} else if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, status.Error(codes.Code(e.ErrorCode), e.ErrorMessage)
+		}
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			var fd descriptorpb.FileDescriptorProto
+			if err := proto.Unmarshal(raw, &fd); err != nil {
+				return nil, err
+			}
+			if _, ok := protos[fd.GetName()]; !ok {
+				protos[fd.GetName()] = &fd
+				order = append(order, fd.GetName())
+			}
+		}
+
+		// Request the next missing dependency. Well-known types that are
+		// compiled into this binary don't have to be fetched.
+		request = nil
+		for _, name := range order {
+			for _, dep := range protos[name].GetDependency() {
+				if _, ok := protos[dep]; ok {
+					continue
+				}
+				if fd, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					protos[dep] = protodesc.ToFileDescriptorProto(fd)
+					order = append(order, dep)
+					continue
+				}
+				request = &rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep}}
+				break
+			}
+			if request != nil {
+				break
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range order {
+		set.File = append(set.File, protos[name])
+	}
+	return protodesc.NewFiles(set)
+}
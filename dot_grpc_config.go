@@ -0,0 +1,109 @@
+package xtemplate
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func WithGRPC(name string, cfg DotGRPCConfig) Option {
+	return func(c *Config) error {
+		if cfg.Target == "" {
+			return fmt.Errorf("cannot create grpc provider without a target. name: %s", name)
+		}
+		cfg.Name = name
+		c.GRPC = append(c.GRPC, cfg)
+		return nil
+	}
+}
+
+// DotGRPCConfig configures a dot provider that calls the methods of a gRPC
+// server with JSON-shaped requests and responses. Method types are read from
+// descriptor sets if any are configured, otherwise they are fetched with
+// server reflection. See [DotGRPC].
+type DotGRPCConfig struct {
+	Name string `json:"name"`
+
+	// Address of the server like `dns:///orders.internal:443`.
+	Target string `json:"target"`
+	// Connect without TLS.
+	Insecure bool `json:"insecure,omitempty"`
+	// Paths of binary FileDescriptorSet files describing the services, as
+	// written by `protoc --include_imports --descriptor_set_out`.
+	Descriptors []string `json:"descriptors,omitempty"`
+	// Metadata sent with every call, like `authorization`.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Timeout of each call. Default 10s.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	conn *grpc.ClientConn
+	// methods caches resolved method descriptors by full method name.
+	methods *sync.Map
+	files   *protoregistry.Files
+	metrics *ProviderMetrics
+}
+
+var _ MetricsDotProvider = &DotGRPCConfig{}
+
+// Metrics returns the number and duration of calls by method, see
+// [MetricsDotProvider].
+func (d *DotGRPCConfig) Metrics() map[string]OperationMetrics {
+	return d.metrics.Snapshot()
+}
+
+func (d *DotGRPCConfig) FieldName() string { return d.Name }
+func (d *DotGRPCConfig) Init(ctx context.Context) error {
+	if d.Target == "" {
+		return fmt.Errorf("grpc target is required")
+	}
+	if d.Timeout <= 0 {
+		d.Timeout = 10 * time.Second
+	}
+	d.metrics = &ProviderMetrics{}
+	if len(d.Descriptors) > 0 {
+		var all descriptorpb.FileDescriptorSet
+		for _, path := range d.Descriptors {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read descriptor set '%s': %w", path, err)
+			}
+			var set descriptorpb.FileDescriptorSet
+			if err := proto.Unmarshal(content, &set); err != nil {
+				return fmt.Errorf("failed to parse descriptor set '%s': %w", path, err)
+			}
+			all.File = append(all.File, set.File...)
+		}
+		files, err := protodesc.NewFiles(&all)
+		if err != nil {
+			return fmt.Errorf("failed to load descriptor sets: %w", err)
+		}
+		d.files = files
+	}
+	creds := insecure.NewCredentials()
+	if !d.Insecure {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(d.Target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("failed to create grpc client: %w", err)
+	}
+	// close the connection when the instance is retired by a reload
+	context.AfterFunc(ctx, func() { conn.Close() })
+	d.conn = conn
+	d.methods = &sync.Map{}
+	return nil
+}
+func (d *DotGRPCConfig) Value(r Request) (any, error) {
+	return &DotGRPC{d, r.R.Context(), GetLogger(r.R.Context())}, nil
+}
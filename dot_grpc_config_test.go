@@ -0,0 +1,28 @@
+package xtemplate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestDotGRPCConfigClosesConnWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &DotGRPCConfig{Name: "GRPC", Target: "localhost:1", Insecure: true}
+	if err := d.Init(ctx); err != nil {
+		t.Fatalf("failed to init: %v", err)
+	}
+	if state := d.conn.GetState(); state == connectivity.Shutdown {
+		t.Fatalf("connection is shut down before the instance is retired")
+	}
+	cancel()
+	wait, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	for state := d.conn.GetState(); state != connectivity.Shutdown; state = d.conn.GetState() {
+		if !d.conn.WaitForStateChange(wait, state) {
+			t.Fatalf("connection wasn't closed after the instance was retired, state %s", state)
+		}
+	}
+}
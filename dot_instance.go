@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"log/slog"
 	"path"
 )
 
@@ -15,7 +16,9 @@ type dotXProvider struct {
 
 func (dotXProvider) FieldName() string            { return "X" }
 func (dotXProvider) Init(_ context.Context) error { return nil }
-func (p dotXProvider) Value(Request) (any, error) { return DotX(p), nil }
+func (p dotXProvider) Value(Request) (any, error) {
+	return DotX{instance: p.instance, depth: new(int), budget: &requestBudget{}}, nil
+}
 
 func (dotXProvider) Cleanup(_ any, err error) error {
 	if errors.As(err, &ReturnError{}) {
@@ -29,13 +32,18 @@ var _ CleanupDotProvider = dotXProvider{}
 // DotX is used as the field at .X in all template invocations.
 type DotX struct {
 	instance *Instance
+	// the number of Template calls that are executing in the request
+	depth *int
+	// the func calls and range iterations of the request
+	budget *requestBudget
 }
 
 // StaticFileHash returns the sha-384 hash of the named asset file to be used
-// for integrity or caching behavior.
+// for integrity or caching behavior. If [Config.StaticValidator] is `modtime`
+// it returns a version token instead, which is only suitable for caching.
 func (d DotX) StaticFileHash(urlpath string) (string, error) {
 	urlpath = path.Clean("/" + urlpath)
-	fileinfo, ok := d.instance.files[urlpath]
+	fileinfo, ok := d.instance.file(urlpath)
 	if !ok {
 		return "", fmt.Errorf("file does not exist: '%s'", urlpath)
 	}
@@ -53,15 +61,81 @@ func (c DotX) Template(name string, dot any) (template.HTML, error) {
 	if t == nil {
 		return "", fmt.Errorf("failed to lookup template name: '%s'", name)
 	}
+	if c.depth != nil {
+		if *c.depth >= c.instance.config.MaxTemplateDepth {
+			return "", &templateDepthError{name, c.instance.config.MaxTemplateDepth}
+		}
+		*c.depth++
+		defer func() { *c.depth-- }()
+	}
 	if err := t.Execute(buf, dot); err != nil {
+		// return the innermost error instead of one wrapped by every level
+		var depthErr *templateDepthError
+		if errors.As(err, &depthErr) {
+			return "", depthErr
+		}
 		return "", fmt.Errorf("failed to execute template '%s': %w", name, err)
 	}
 	return template.HTML(buf.String()), nil
 }
 
+// templateDepthError is returned by Template calls nested deeper than
+// [Config.MaxTemplateDepth].
+type templateDepthError struct {
+	name  string
+	depth int
+}
+
+func (e *templateDepthError) Error() string {
+	return fmt.Sprintf("failed to execute template '%s': exceeded the maximum template depth of %d", e.name, e.depth)
+}
+
+// TryTemplate invokes the template name like Template, but if it fails it
+// discards its partial output and returns the error in a result object instead
+// of failing the whole response, so one broken widget can degrade gracefully:
+//
+//	{{with .X.TryTemplate "weather" .}}{{if .OK}}{{.Value}}{{else}}<p>Weather unavailable</p>{{end}}{{end}}
+//
+// If a fallback template name is given, it's invoked with the same dot when
+// name fails and its output is used as the Value, which is like a catch block:
+//
+//	{{(.X.TryTemplate "weather" . "weather-unavailable").Value}}
+//
+// Calls that stop execution normally, like .Resp.ReturnStatus, are not caught.
+func (c DotX) TryTemplate(name string, dot any, fallback ...string) (*result, error) {
+	if len(fallback) > 1 {
+		return nil, fmt.Errorf("too many fallback templates")
+	}
+	value, err := c.tryTemplate(name, dot)
+	if err == nil || errors.As(err, &ReturnError{}) {
+		return &result{Value: value}, err
+	}
+	res := &result{Value: template.HTML(""), Error: c.instance.templateError(err)}
+	c.instance.errorLog.log(c.instance.config.Ctx, c.instance.config.Logger.With(slog.String("template_name", name)), slog.LevelWarn, "recovered from failed template", res.Error)
+	if len(fallback) == 1 {
+		res.Value, err = c.Template(fallback[0], dot)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (c DotX) tryTemplate(name string, dot any) (_ template.HTML, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("template '%s' panicked: %v", name, p)
+		}
+	}()
+	return c.Template(name, dot)
+}
+
 // Func returns a function by name to call manually. Can be used in combination
 // with the call and try funcs.
 func (c DotX) Func(name string) any {
+	if fn, ok := c.instance.budgetedFuncs[name]; ok {
+		return fn
+	}
 	return c.instance.funcs[name]
 }
 
@@ -73,3 +147,13 @@ type ReturnError struct{}
 func (ReturnError) Error() string { return "returned" }
 
 var _ error = ReturnError{}
+
+// Data returns the contents of the files in [Config.DataDir], which are parsed
+// once when the instance is built. They're keyed by their path in the data
+// dir without the extension, so `_data/menu.yaml` is at `.X.Data.menu` and
+// `_data/authors/jane.toml` at `.X.Data.authors.jane`:
+//
+//	{{range .X.Data.menu}}<a href="{{.url}}">{{.title}}</a>{{end}}
+func (d DotX) Data() map[string]any {
+	return d.instance.data
+}
@@ -0,0 +1,131 @@
+package xtemplate
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// DotLDAP is used to create a dot field value that can authenticate users
+// against an LDAP directory. For example, to handle a login form:
+//
+//	{{define "POST /login"}}
+//	{{with .LDAP.Authenticate (.Req.FormValue "username") (.Req.FormValue "password")}}
+//	  {{if .InGroup "admins"}}...{{end}}
+//	{{else}}
+//	  <p>Invalid username or password</p>
+//	{{end}}
+//	{{end}}
+type DotLDAP struct {
+	config *DotLDAPConfig
+	log    *slog.Logger
+}
+
+// LDAPUser is an authenticated directory user. See [DotLDAP.Authenticate].
+type LDAPUser struct {
+	DN         string
+	Username   string
+	Groups     []string // DNs of the user's groups
+	Attributes map[string][]string
+}
+
+// GroupNames returns the common names of the user's groups.
+func (u *LDAPUser) GroupNames() []string {
+	names := make([]string, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		names = append(names, groupName(g))
+	}
+	return names
+}
+
+// InGroup returns true if the user is a member of a group with the given DN or
+// common name.
+func (u *LDAPUser) InGroup(group string) bool {
+	return slices.ContainsFunc(u.Groups, func(g string) bool {
+		return strings.EqualFold(g, group) || strings.EqualFold(groupName(g), group)
+	})
+}
+
+// Attribute returns the first value of the named attribute, or the empty
+// string if the user doesn't have it.
+func (u *LDAPUser) Attribute(name string) string {
+	if vals := u.Attributes[name]; len(vals) > 0 {
+		return vals[0]
+	}
+	return ""
+}
+
+func groupName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return dn
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return dn
+}
+
+// Authenticate looks up the user by username and verifies password by binding
+// as the user. It returns the user with their group memberships, or nil if the
+// username or password is wrong. An error is only returned if the directory
+// can't be queried.
+func (d *DotLDAP) Authenticate(username, password string) (*LDAPUser, error) {
+	// an empty password would perform an unauthenticated bind, which succeeds
+	if username == "" || password == "" {
+		return nil, nil
+	}
+	conn, err := d.config.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if d.config.BindDN != "" {
+		if err := conn.Bind(d.config.BindDN, d.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("failed to bind ldap service account: %w", err)
+		}
+	}
+
+	attributes := append([]string{d.config.GroupAttribute}, d.config.Attributes...)
+	filter := strings.ReplaceAll(d.config.UserFilter, "{username}", ldap.EscapeFilter(username))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		d.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("failed to search for ldap user: %w", err)
+	}
+	if result == nil || len(result.Entries) != 1 {
+		d.log.Debug("ldap user not found or not unique", slog.String("username", username))
+		return nil, nil
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		var lerr *ldap.Error
+		if errors.As(err, &lerr) && lerr.ResultCode == ldap.LDAPResultInvalidCredentials {
+			d.log.Debug("ldap authentication failed", slog.String("username", username))
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to bind ldap user: %w", err)
+	}
+
+	user := &LDAPUser{
+		DN:         entry.DN,
+		Username:   username,
+		Groups:     entry.GetAttributeValues(d.config.GroupAttribute),
+		Attributes: map[string][]string{},
+	}
+	for _, attr := range d.config.Attributes {
+		user.Attributes[attr] = entry.GetAttributeValues(attr)
+	}
+	d.log.Debug("ldap authentication succeeded", slog.String("username", username), slog.String("dn", entry.DN))
+	return user, nil
+}
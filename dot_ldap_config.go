@@ -0,0 +1,91 @@
+package xtemplate
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func WithLDAP(name string, cfg DotLDAPConfig) Option {
+	return func(c *Config) error {
+		if cfg.URL == "" {
+			return fmt.Errorf("cannot create ldap provider without a url. name: %s", name)
+		}
+		cfg.Name = name
+		c.LDAP = append(c.LDAP, cfg)
+		return nil
+	}
+}
+
+// DotLDAPConfig configures a dot provider that authenticates users against an
+// LDAP directory like OpenLDAP or Active Directory. See [DotLDAP].
+type DotLDAPConfig struct {
+	Name string `json:"name"`
+
+	// URL of the directory server like `ldaps://ldap.example.com:636`.
+	URL string `json:"url"`
+	// Upgrade `ldap://` connections with StartTLS.
+	StartTLS bool `json:"start_tls,omitempty"`
+	// Skip verifying the server's certificate. Only for testing.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+
+	// Credentials of a service account used to search for users. If empty,
+	// searches are performed anonymously.
+	BindDN       string `json:"bind_dn,omitempty"`
+	BindPassword string `json:"bind_password,omitempty"`
+
+	// The DN under which to search for users.
+	BaseDN string `json:"base_dn"`
+	// Search filter to find a user, where `{username}` is replaced with the
+	// escaped username. Default `(uid={username})`; for Active Directory use
+	// `(sAMAccountName={username})`.
+	UserFilter string `json:"user_filter,omitempty"`
+	// Attribute of the user entry that lists the DNs of its groups. Default
+	// `memberOf`.
+	GroupAttribute string `json:"group_attribute,omitempty"`
+	// Additional attributes of the user entry to fetch.
+	Attributes []string `json:"attributes,omitempty"`
+	// Timeout for connecting and each operation. Default 10s.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+var _ DotConfig = &DotLDAPConfig{}
+
+func (d *DotLDAPConfig) FieldName() string { return d.Name }
+func (d *DotLDAPConfig) Init(_ context.Context) error {
+	if d.URL == "" {
+		return fmt.Errorf("ldap url is required")
+	}
+	if d.UserFilter == "" {
+		d.UserFilter = "(uid={username})"
+	}
+	if d.GroupAttribute == "" {
+		d.GroupAttribute = "memberOf"
+	}
+	if d.Timeout <= 0 {
+		d.Timeout = 10 * time.Second
+	}
+	return nil
+}
+func (d *DotLDAPConfig) Value(r Request) (any, error) {
+	return &DotLDAP{d, GetLogger(r.R.Context())}, nil
+}
+
+func (d *DotLDAPConfig) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.InsecureSkipVerify}
+	conn, err := ldap.DialURL(d.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap server: %w", err)
+	}
+	conn.SetTimeout(d.Timeout)
+	if d.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
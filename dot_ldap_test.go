@@ -0,0 +1,169 @@
+package xtemplate
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeLDAP is a directory server that supports just enough of the protocol
+// for DotLDAP: simple binds, and searches by the exact filter of a user.
+type fakeLDAP struct {
+	// passwords by DN, including the service account's
+	passwords map[string]string
+	// entries by the filter that finds them
+	entries map[string]*ldap.Entry
+}
+
+func (f *fakeLDAP) serve(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn)
+		}
+	}()
+	return "ldap://" + l.Addr().String()
+}
+
+func (f *fakeLDAP) handle(conn net.Conn) {
+	defer conn.Close()
+	bound := ""
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+		id, op := p.Children[0].Value.(int64), p.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Value.(string), op.Children[2].Data.String()
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			if pw, ok := f.passwords[dn]; ok && pw == password {
+				code, bound = ldap.LDAPResultSuccess, dn
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			if bound == "" {
+				conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				return
+			}
+			if entry, ok := f.entries[filter]; ok {
+				conn.Write(ldapEntry(id, entry).Bytes())
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	p.AppendChild(op)
+	return p
+}
+
+func ldapResult(id int64, tag ber.Tag, code int64) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return ldapMessage(id, op)
+}
+
+func ldapEntry(id int64, entry *ldap.Entry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, ""))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	for _, attr := range entry.Attributes {
+		a := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		a.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, attr.Name, ""))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range attr.Values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		a.AppendChild(vals)
+		attrs.AppendChild(a)
+	}
+	op.AppendChild(attrs)
+	return ldapMessage(id, op)
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	const alice = "uid=alice,ou=people,dc=example,dc=com"
+	server := &fakeLDAP{
+		passwords: map[string]string{
+			"cn=service,dc=example,dc=com": "service-secret",
+			alice:                          "alice-secret",
+		},
+		entries: map[string]*ldap.Entry{
+			"(uid=alice)": ldap.NewEntry(alice, map[string][]string{
+				"memberOf": {"cn=admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"},
+				"mail":     {"alice@example.com"},
+			}),
+		},
+	}
+	// what an unescaped username of `*` would find
+	server.entries["(uid=*)"] = server.entries["(uid=alice)"]
+	addr := server.serve(t)
+
+	for _, tc := range []struct {
+		name, bindPassword, username, password string
+		status                                 int
+		body                                   string
+	}{
+		{"valid", "service-secret", "alice", "alice-secret", http.StatusOK, alice + " true false [admins staff] alice@example.com"},
+		{"wrong password", "service-secret", "alice", "wrong", http.StatusOK, "invalid"},
+		{"unknown user", "service-secret", "bob", "alice-secret", http.StatusOK, "invalid"},
+		// would be an unauthenticated bind, which succeeds
+		{"empty password", "service-secret", "alice", "", http.StatusOK, "invalid"},
+		// escaped, so it doesn't match every user
+		{"filter injection", "service-secret", "*", "alice-secret", http.StatusOK, "invalid"},
+		{"wrong service account password", "wrong", "alice", "alice-secret", http.StatusInternalServerError, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte(
+				`{{with .LDAP.Authenticate (.Req.FormValue "u") (.Req.FormValue "p")}}` +
+					`{{.DN}} {{.InGroup "admins"}} {{.InGroup "users"}} {{.GroupNames}} {{.Attribute "mail"}}` +
+					`{{else}}invalid{{end}}`,
+			)}},
+				WithLDAP("LDAP", DotLDAPConfig{
+					URL:          addr,
+					BindDN:       "cn=service,dc=example,dc=com",
+					BindPassword: tc.bindPassword,
+					BaseDN:       "ou=people,dc=example,dc=com",
+					Attributes:   []string{"mail"},
+				}),
+			)
+			w := httptest.NewRecorder()
+			instance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?"+url.Values{"u": {tc.username}, "p": {tc.password}}.Encode(), nil))
+			if w.Code != tc.status {
+				t.Fatalf("got status %d, want %d", w.Code, tc.status)
+			}
+			if body := strings.TrimSpace(w.Body.String()); tc.status == http.StatusOK && body != tc.body {
+				t.Errorf("got %q, want %q", body, tc.body)
+			}
+		})
+	}
+}
@@ -58,7 +58,9 @@ func (d *DotNatsConfig) Init(ctx context.Context) error {
 		connOpt = *d.NatsConfig.ConnOptions
 	}
 	if d.NatsConfig.InProcessServerOptions != nil {
-		// start an internal server for this instance
+		// start an internal server for this instance. It must not exit the
+		// process on SIGTERM, the server drains requests first.
+		d.NatsConfig.InProcessServerOptions.NoSigs = true
 		d.server, err = server.NewServer(d.NatsConfig.InProcessServerOptions)
 		if err != nil {
 			return fmt.Errorf("failed to start in-process nats server: %w", err)
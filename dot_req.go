@@ -2,15 +2,34 @@ package xtemplate
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 )
 
-type dotReqProvider struct{}
+type dotReqProvider struct {
+	location       *time.Location
+	timezoneCookie string
+	contextKeys    map[string]any
+	locales        *locales
+	instance       *Instance
+}
 
 func (dotReqProvider) FieldName() string            { return "Req" }
 func (dotReqProvider) Init(_ context.Context) error { return nil }
-func (dotReqProvider) Value(r Request) (any, error) {
-	return DotReq{r.R}, nil
+func (p dotReqProvider) Value(r Request) (any, error) {
+	loc := p.location
+	if p.timezoneCookie != "" {
+		if c, err := r.R.Cookie(p.timezoneCookie); err == nil {
+			if l, err := loadLocation(c.Value); err == nil {
+				loc = l
+			}
+		}
+	}
+	return DotReq{r.R, loc, p.contextKeys, p.locales, p.instance}, nil
 }
 
 var _ DotConfig = dotReqProvider{}
@@ -28,4 +47,120 @@ var _ DotConfig = dotReqProvider{}
 // [http.Request.Form], [http.Request.PostForm], and [http.Request.PostValue].
 type DotReq struct {
 	*http.Request
+	location    *time.Location
+	contextKeys map[string]any
+	locales     *locales
+	instance    *Instance
+}
+
+// ContextValue returns the value of the request context for the key registered
+// with name by [WithContextKey], so templates can use values added to the
+// request by middleware in front of xtemplate, like the authenticated user:
+//
+//	{{with .Req.ContextValue "user"}}Hello {{.Name}}{{end}}
+//
+// It returns nil if the context doesn't have a value for the key.
+func (d DotReq) ContextValue(name string) (any, error) {
+	key, ok := d.contextKeys[name]
+	if !ok {
+		return nil, fmt.Errorf("context key '%s' is not registered", name)
+	}
+	return d.Context().Value(key), nil
+}
+
+// Location returns the timezone of the current request, which is the zone
+// named by the [Config.TimezoneCookie] cookie if it is set and valid,
+// otherwise [Config.Timezone].
+func (d DotReq) Location() *time.Location {
+	if d.location == nil {
+		return time.UTC
+	}
+	return d.location
+}
+
+// Now returns the current time in the request's timezone.
+func (d DotReq) Now() time.Time {
+	return time.Now().In(d.Location())
+}
+
+// InZone converts t to the request's timezone. t may be a time.Time, a unix
+// timestamp, or a string in a common date format.
+func (d DotReq) InZone(t any) (time.Time, error) {
+	return FuncInZone(d.Location(), t)
+}
+
+// Date formats t with layout in the request's timezone. Use this instead of
+// sprig's date func, which always formats in the server's local timezone. For
+// example:
+//
+//	{{.Req.Date "Jan 2, 2006 3:04 PM MST" .row.created_at}}
+func (d DotReq) Date(layout string, t any) (string, error) {
+	tm, err := d.InZone(t)
+	if err != nil {
+		return "", err
+	}
+	return tm.Format(layout), nil
+}
+
+// ExpectsContinue reports whether the client sent `Expect: 100-continue` and
+// is waiting to send the request body. The 100 Continue response is only sent
+// when the template first reads the body, so a template can check headers and
+// fail early to reject a large upload before the client sends it:
+//
+//	{{if and .Req.ExpectsContinue (not (.Req.Header.Get "Authorization"))}}{{.Resp.ReturnStatus 401}}{{end}}
+func (d DotReq) ExpectsContinue() bool {
+	return strings.EqualFold(d.Header.Get("Expect"), "100-continue")
+}
+
+// maxTrailersDrain is the most of the unread body that Trailers discards.
+const maxTrailersDrain = 10 << 20
+
+// Trailers returns the trailer fields sent after a chunked request body. Any
+// part of the body that wasn't read yet is read and discarded first, up to
+// 10MiB, since trailers are only received after the body, so call it after
+// reading the body with ParseForm or similar.
+func (d DotReq) Trailers() (http.Header, error) {
+	if d.Body != nil {
+		n, err := io.CopyN(io.Discard, d.Body, maxTrailersDrain+1)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if n > maxTrailersDrain {
+			return nil, fmt.Errorf("unread request body is larger than %d bytes", maxTrailersDrain)
+		}
+	}
+	return d.Trailer, nil
+}
+
+// Pattern returns the pattern of the route that matched the request, like
+// `GET /blog/{slug}`, which identifies the page regardless of its path values
+// for per-route analytics or active navigation links:
+//
+//	<a href="/blog" {{if hasPrefix "GET /blog" .Req.Pattern}}aria-current="page"{{end}}>Blog</a>
+//
+// It's empty if no route matches, like for the not found page.
+func (d DotReq) Pattern() string {
+	if d.instance == nil {
+		return ""
+	}
+	_, pattern := d.instance.router.Handler(d.Request)
+	return pattern
+}
+
+// Route returns the description of the route that matched the request, which
+// has the template and file that serve it and their front matter:
+//
+//	{{with .Req.Route}}{{with .Metadata.canonical}}<link rel="canonical" href="{{.}}">{{end}}{{end}}
+//
+// It returns nil if no route matches.
+func (d DotReq) Route() *InstanceRoute {
+	pattern := d.Pattern()
+	if pattern == "" {
+		return nil
+	}
+	i := slices.IndexFunc(d.instance.routes, func(r InstanceRoute) bool { return r.Pattern == pattern })
+	if i < 0 {
+		return nil
+	}
+	return &d.instance.routes[i]
 }
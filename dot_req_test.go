@@ -0,0 +1,24 @@
+package xtemplate
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTrailersBoundsDrain(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("small body"))
+	r.Trailer = http.Header{"Checksum": {"abc"}}
+	trailers, err := DotReq{Request: r}.Trailers()
+	if err != nil || trailers.Get("Checksum") != "abc" {
+		t.Errorf("got trailers %v, error %v", trailers, err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/", io.MultiReader(bytes.NewReader(make([]byte, maxTrailersDrain)), strings.NewReader("x")))
+	if _, err := (DotReq{Request: r}).Trailers(); err == nil {
+		t.Error("expected an error for a body larger than the drain limit")
+	}
+}
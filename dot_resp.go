@@ -3,6 +3,8 @@ package xtemplate
 import (
 	"context"
 	"errors"
+	"fmt"
+	"html/template"
 	"io"
 	"log/slog"
 	"maps"
@@ -17,9 +19,13 @@ type dotRespProvider struct{}
 func (dotRespProvider) FieldName() string            { return "Resp" }
 func (dotRespProvider) Init(_ context.Context) error { return nil }
 func (dotRespProvider) Value(r Request) (any, error) {
+	status := http.StatusOK
+	if e, ok := r.R.Context().Value(requestErrorKey).(*RequestError); ok {
+		status = e.Status
+	}
 	return DotResp{
 		Header: make(http.Header),
-		status: http.StatusOK,
+		status: status,
 		w:      r.W, r: r.R,
 		log: GetLogger(r.R.Context()),
 	}, nil
@@ -31,7 +37,7 @@ func (dotRespProvider) Cleanup(v any, err error) error {
 	if errors.As(err, &errSt) {
 		// headers?
 		d.w.WriteHeader(int(errSt))
-	} else if err == nil {
+	} else if err == nil && !d.served {
 		maps.Copy(d.w.Header(), d.Header)
 		d.w.WriteHeader(d.status)
 	}
@@ -47,6 +53,34 @@ type DotResp struct {
 	w      http.ResponseWriter
 	r      *http.Request
 	log    *slog.Logger
+
+	// out-of-band swaps appended to the response body, see SwapOOB
+	oob []string
+
+	// output of the first pass of a template with a layout
+	body template.HTML
+
+	// assets registered with NeedsCSS and NeedsJS
+	css, js []string
+
+	// the response was written by ServeContent
+	served bool
+}
+
+// Body returns the output of the page while its layout renders. Template files
+// choose a layout with the front matter key `layout`:
+//
+//	---
+//	layout: site
+//	---
+//	{{.Vars.Set "title" "About"}}
+//	<h1>About</h1>
+//
+//	{{define "site"}}<title>{{.Vars.title}}</title><main>{{.Resp.Body}}</main>{{end}}
+//
+// Otherwise Body is empty.
+func (h *DotResp) Body() template.HTML {
+	return h.body
 }
 
 // ServeContent aborts execution of the template and instead responds to the
@@ -64,6 +98,7 @@ func (d *DotResp) ServeContent(path_ string, modtime time.Time, content any) (st
 	d.log.Debug("serving content response", slog.String("path", path_))
 	maps.Copy(d.w.Header(), d.Header)
 	http.ServeContent(d.w, d.r, path_, modtime, reader)
+	d.served = true
 	return "", ReturnError{}
 }
 
@@ -89,6 +124,17 @@ func (h *DotResp) DelHeader(field string) string {
 	return ""
 }
 
+// CachePreset sets the Cache-Control header to a named preset, see
+// [CachePresets]. It returns an empty string.
+func (h *DotResp) CachePreset(name string) (string, error) {
+	cc, ok := CachePresets[name]
+	if !ok {
+		return "", fmt.Errorf("unknown cache preset '%s'", name)
+	}
+	h.Header.Set("Cache-Control", cc)
+	return "", nil
+}
+
 // SetStatus sets the HTTP response status. It returns an empty string.
 func (h *DotResp) SetStatus(status int) string {
 	h.status = status
@@ -102,6 +148,27 @@ func (h *DotResp) ReturnStatus(status int) (string, error) {
 	return "", ReturnError{}
 }
 
+// Redirect responds with a redirect to url and exits template rendering
+// immediately. The status defaults to 302 Found, and may be 301, 302, 303,
+// 307, or 308.
+func (h *DotResp) Redirect(url string, status ...int) (string, error) {
+	if len(status) > 1 {
+		return "", fmt.Errorf("too many status arguments")
+	}
+	code := http.StatusFound
+	if len(status) == 1 {
+		code = status[0]
+	}
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return "", fmt.Errorf("%d is not a redirect status", code)
+	}
+	h.status = code
+	h.Header.Set("Location", url)
+	return "", ReturnError{}
+}
+
 type ErrorStatus int
 
 func (e ErrorStatus) Error() string {
@@ -0,0 +1,186 @@
+package xtemplate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// TmpConfig configures the .Tmp dot field, which gives each request a
+// temporary directory for uploads, generated files, and archives that is
+// removed with everything in it when the request completes. See [DotTmp].
+type TmpConfig struct {
+	// Directory that request directories are created in. Default
+	// [os.TempDir].
+	Dir string `json:"dir,omitempty"`
+}
+
+func WithTmp(config TmpConfig) Option {
+	return func(c *Config) error {
+		c.Tmp = &config
+		return nil
+	}
+}
+
+type dotTmpProvider struct {
+	TmpConfig
+}
+
+func (dotTmpProvider) FieldName() string { return "Tmp" }
+func (p dotTmpProvider) Init(_ context.Context) error {
+	if p.Dir == "" {
+		return nil
+	}
+	if st, err := os.Stat(p.Dir); err != nil {
+		return fmt.Errorf("tmp dir: %w", err)
+	} else if !st.IsDir() {
+		return fmt.Errorf("tmp dir is not a directory: '%s'", p.Dir)
+	}
+	return nil
+}
+func (p dotTmpProvider) Value(r Request) (any, error) {
+	return &DotTmp{parent: p.Dir, r: r.R, log: GetLogger(r.R.Context())}, nil
+}
+
+// Cleanup closes the files opened in the directory of the request and removes
+// it.
+func (dotTmpProvider) Cleanup(v any, err error) error {
+	d := v.(*DotTmp)
+	for _, f := range d.opened {
+		f.Close()
+	}
+	if d.dir != "" {
+		if rerr := os.RemoveAll(d.dir); rerr != nil {
+			d.log.Warn("failed to remove temporary directory", slog.String("path", d.dir), slog.Any("error", rerr))
+		} else {
+			d.log.Debug("removed temporary directory", slog.String("path", d.dir))
+		}
+	}
+	return err
+}
+
+var _ CleanupDotProvider = dotTmpProvider{}
+
+// DotTmp is used as the .Tmp dot field when [Config.Tmp] is set. It's a
+// temporary directory that is created the first time it's used in a request
+// and removed when the request completes, even if the template fails, so
+// files generated by templates don't leak:
+//
+//	{{$path := .Tmp.Write "report.csv" $csv}}
+//	{{.Resp.SetHeader "Content-Disposition" "attachment; filename=report.csv"}}
+//	{{serveFile (.Tmp.Open "report.csv")}}
+//
+// Names are relative to the directory and can't leave it.
+type DotTmp struct {
+	parent string
+	r      *http.Request
+	log    *slog.Logger
+
+	dir    string
+	opened []*os.File
+}
+
+// Dir returns the path of the directory.
+func (d *DotTmp) Dir() (string, error) {
+	if d.dir == "" {
+		dir, err := os.MkdirTemp(d.parent, "xtemplate-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		d.dir = dir
+		d.log.Debug("created temporary directory", slog.String("path", dir))
+	}
+	return d.dir, nil
+}
+
+// Path returns the path of name in the directory, for funcs that write a
+// file to a path.
+func (d *DotTmp) Path(name string) (string, error) {
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("temporary file name must be a relative path inside the directory: '%s'", name)
+	}
+	dir, err := d.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Write writes data, a string or bytes, to the file name and returns its
+// path. Parent directories are created as needed.
+func (d *DotTmp) Write(name string, data any) (string, error) {
+	var b []byte
+	switch v := data.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return "", fmt.Errorf("expected a string or bytes, got %T", data)
+	}
+	p, err := d.Path(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return "", err
+	}
+	return p, os.WriteFile(p, b, 0o600)
+}
+
+// Read returns the contents of the file name.
+func (d *DotTmp) Read(name string) (string, error) {
+	p, err := d.Path(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(p)
+	return string(b), err
+}
+
+// Open opens the file name for reading, like to respond with it with
+// serveFile. It's closed when the request completes.
+func (d *DotTmp) Open(name string) (fs.File, error) {
+	p, err := d.Path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	d.opened = append(d.opened, f)
+	return f, nil
+}
+
+// Upload saves the file uploaded in the multipart form field to the
+// directory under its base name, and returns its path.
+func (d *DotTmp) Upload(field string) (string, error) {
+	src, header, err := d.r.FormFile(field)
+	if err != nil {
+		return "", fmt.Errorf("failed to read uploaded file '%s': %w", field, err)
+	}
+	defer src.Close()
+	name := filepath.Base(filepath.Clean("/" + header.Filename))
+	if name == "/" || name == "." {
+		name = field
+	}
+	p, err := d.Path(name)
+	if err != nil {
+		return "", err
+	}
+	dst, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return "", fmt.Errorf("failed to save uploaded file '%s': %w", field, err)
+	}
+	return p, dst.Close()
+}
@@ -0,0 +1,221 @@
+package xtemplate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// DotWebAuthn is used to create a dot field value that performs WebAuthn
+// (passkey) registration and login ceremonies. Each ceremony has a begin step
+// that returns options to pass to the browser's `navigator.credentials` api,
+// and a finish step that verifies the browser's json response in the request
+// body. The state between the two steps is kept in a signed cookie.
+//
+// Credentials are returned as json strings to be stored by the application,
+// for example with the DB provider, and passed back in to later ceremonies:
+//
+//	{{define "POST /passkey/register/begin"}}
+//	{{.WebAuthn.BeginRegistration $userID $username $displayName}}
+//	{{end}}
+//
+//	{{define "POST /passkey/register/finish"}}
+//	{{$cred := .WebAuthn.FinishRegistration}}
+//	{{.DB.Exec "INSERT INTO passkeys(id, user_id, credential) VALUES(?,?,?)" (.WebAuthn.CredentialID $cred) $userID $cred}}
+//	{{end}}
+type DotWebAuthn struct {
+	config *DotWebAuthnConfig
+	w      http.ResponseWriter
+	r      *http.Request
+}
+
+type webauthnUser struct {
+	id, name, displayName string
+	credentials           []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte                         { return []byte(u.id) }
+func (u *webauthnUser) WebAuthnName() string                       { return u.name }
+func (u *webauthnUser) WebAuthnDisplayName() string                { return u.displayName }
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+func (u *webauthnUser) WebAuthnIcon() string                       { return "" }
+
+func parseCredentials(credentials []string) ([]webauthn.Credential, error) {
+	creds := make([]webauthn.Credential, 0, len(credentials))
+	for _, c := range credentials {
+		var cred webauthn.Credential
+		if err := json.Unmarshal([]byte(c), &cred); err != nil {
+			return nil, fmt.Errorf("failed to parse webauthn credential: %w", err)
+		}
+		creds = append(creds, cred)
+	}
+	return creds, nil
+}
+
+// BeginRegistration starts registering a new passkey for the user and returns
+// the options to pass to `navigator.credentials.create()`. userID must be a
+// stable identifier of the user that doesn't contain personal information.
+// Pass the user's existing credentials to prevent registering the same
+// authenticator twice.
+func (d *DotWebAuthn) BeginRegistration(userID, name, displayName string, credentials ...string) (template.JS, error) {
+	creds, err := parseCredentials(credentials)
+	if err != nil {
+		return "", err
+	}
+	user := &webauthnUser{userID, name, displayName, creds}
+	exclude := make([]webauthn.RegistrationOption, 0, 1)
+	if len(creds) > 0 {
+		descriptors := make([]protocol.CredentialDescriptor, 0, len(creds))
+		for _, c := range creds {
+			descriptors = append(descriptors, c.Descriptor())
+		}
+		exclude = append(exclude, webauthn.WithExclusions(descriptors))
+	}
+	options, session, err := d.config.webauthn.BeginRegistration(user, exclude...)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin webauthn registration: %w", err)
+	}
+	return d.begin("register", session, options)
+}
+
+// FinishRegistration verifies the response of `navigator.credentials.create()`
+// in the request body and returns the new credential as a json string to be
+// stored for the user.
+func (d *DotWebAuthn) FinishRegistration() (string, error) {
+	session, err := d.session("register")
+	if err != nil {
+		return "", err
+	}
+	user := &webauthnUser{id: string(session.UserID)}
+	cred, err := d.config.webauthn.FinishRegistration(user, *session, d.r)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify webauthn registration: %w", err)
+	}
+	out, err := json.Marshal(cred)
+	return string(out), err
+}
+
+// BeginLogin starts logging in the user with one of their stored credentials
+// and returns the options to pass to `navigator.credentials.get()`.
+func (d *DotWebAuthn) BeginLogin(userID string, credentials ...string) (template.JS, error) {
+	creds, err := parseCredentials(credentials)
+	if err != nil {
+		return "", err
+	}
+	options, session, err := d.config.webauthn.BeginLogin(&webauthnUser{id: userID, credentials: creds})
+	if err != nil {
+		return "", fmt.Errorf("failed to begin webauthn login: %w", err)
+	}
+	return d.begin("login", session, options)
+}
+
+// FinishLogin verifies the response of `navigator.credentials.get()` in the
+// request body against the user's stored credentials. It returns the json of
+// the credential that was used with its updated signature counter, which
+// should replace the stored credential.
+func (d *DotWebAuthn) FinishLogin(userID string, credentials ...string) (string, error) {
+	session, err := d.session("login")
+	if err != nil {
+		return "", err
+	}
+	if string(session.UserID) != userID {
+		return "", fmt.Errorf("webauthn login was started for a different user")
+	}
+	creds, err := parseCredentials(credentials)
+	if err != nil {
+		return "", err
+	}
+	cred, err := d.config.webauthn.FinishLogin(&webauthnUser{id: userID, credentials: creds}, *session, d.r)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify webauthn login: %w", err)
+	}
+	if cred.Authenticator.CloneWarning {
+		return "", fmt.Errorf("webauthn authenticator may be cloned: signature counter went backwards")
+	}
+	out, err := json.Marshal(cred)
+	return string(out), err
+}
+
+// CredentialID returns the base64url encoded id of a credential json string,
+// for use as a database key.
+func (d *DotWebAuthn) CredentialID(credential string) (string, error) {
+	creds, err := parseCredentials([]string{credential})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(creds[0].ID), nil
+}
+
+type webauthnState struct {
+	Kind    string                `json:"kind"`
+	Session *webauthn.SessionData `json:"session"`
+}
+
+func (d *DotWebAuthn) begin(kind string, session *webauthn.SessionData, options any) (template.JS, error) {
+	payload, err := json.Marshal(webauthnState{kind, session})
+	if err != nil {
+		return "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(payload)
+	cookie := &http.Cookie{
+		Name:     d.config.CookieName,
+		Value:    value + "." + d.sign(value),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   d.r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int((5 * time.Minute).Seconds()),
+	}
+	if !session.Expires.IsZero() {
+		cookie.MaxAge = int(time.Until(session.Expires).Seconds()) + 1
+	}
+	http.SetCookie(d.w, cookie)
+
+	out, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+	return template.JS(out), nil
+}
+
+func (d *DotWebAuthn) session(kind string) (*webauthn.SessionData, error) {
+	cookie, err := d.r.Cookie(d.config.CookieName)
+	if err != nil {
+		return nil, fmt.Errorf("no webauthn ceremony in progress")
+	}
+	http.SetCookie(d.w, &http.Cookie{Name: d.config.CookieName, Path: "/", MaxAge: -1})
+
+	value, sig, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(d.sign(value))) {
+		return nil, fmt.Errorf("invalid webauthn ceremony cookie")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn ceremony cookie: %w", err)
+	}
+	var state webauthnState
+	if err := json.Unmarshal(payload, &state); err != nil || state.Session == nil {
+		return nil, fmt.Errorf("invalid webauthn ceremony cookie")
+	}
+	if state.Kind != kind {
+		return nil, fmt.Errorf("expected webauthn %s ceremony, got %s", kind, state.Kind)
+	}
+	return state.Session, nil
+}
+
+func (d *DotWebAuthn) sign(value string) string {
+	mac := hmac.New(sha256.New, d.config.key)
+	mac.Write([]byte(d.config.CookieName))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
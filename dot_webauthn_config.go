@@ -0,0 +1,95 @@
+package xtemplate
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"slices"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+func WithWebAuthn(name string, cfg DotWebAuthnConfig) Option {
+	return func(c *Config) error {
+		cfg.Name = name
+		c.WebAuthn = append(c.WebAuthn, cfg)
+		return nil
+	}
+}
+
+// DotWebAuthnConfig configures a dot provider that performs WebAuthn (passkey)
+// registration and login ceremonies. See [DotWebAuthn].
+type DotWebAuthnConfig struct {
+	Name string `json:"name"`
+
+	// The relying party id, usually the site's domain like `example.com`.
+	RPID string `json:"rp_id"`
+	// The site name shown to users by their authenticator.
+	RPDisplayName string `json:"rp_display_name"`
+	// The fully qualified origins allowed to perform ceremonies, like
+	// `https://example.com`.
+	RPOrigins []string `json:"rp_origins"`
+
+	// Secret used to sign the cookie that holds ceremony state between the
+	// begin and finish requests. If empty a random secret is generated when
+	// the [Server] is created, which is kept across reloads, so ceremonies in
+	// progress only fail after a restart or when requests are load balanced
+	// across multiple servers.
+	Secret string `json:"secret,omitempty"`
+	// Name of the ceremony state cookie. Default `webauthn_session`.
+	CookieName string `json:"cookie_name,omitempty"`
+
+	webauthn *webauthn.WebAuthn
+	key      []byte
+}
+
+var _ DotConfig = &DotWebAuthnConfig{}
+
+// withWebAuthnSecrets returns a copy of configs with a random secret for each
+// config without one, so every instance of a server signs ceremony state with
+// the same key.
+func withWebAuthnSecrets(configs []DotWebAuthnConfig) ([]DotWebAuthnConfig, error) {
+	configs = slices.Clone(configs)
+	for i := range configs {
+		if configs[i].Secret != "" {
+			continue
+		}
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate webauthn secret: %w", err)
+		}
+		configs[i].Secret = string(key)
+	}
+	return configs, nil
+}
+
+func (d *DotWebAuthnConfig) FieldName() string { return d.Name }
+func (d *DotWebAuthnConfig) Init(_ context.Context) error {
+	if d.webauthn != nil {
+		return nil
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          d.RPID,
+		RPDisplayName: d.RPDisplayName,
+		RPOrigins:     d.RPOrigins,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid webauthn config: %w", err)
+	}
+	d.webauthn = w
+	if d.Secret != "" {
+		d.key = []byte(d.Secret)
+	} else {
+		d.key = make([]byte, 32)
+		if _, err := rand.Read(d.key); err != nil {
+			return fmt.Errorf("failed to generate webauthn secret: %w", err)
+		}
+	}
+	if d.CookieName == "" {
+		d.CookieName = "webauthn_session"
+	}
+	return nil
+}
+func (d *DotWebAuthnConfig) Value(r Request) (any, error) {
+	return &DotWebAuthn{d, r.W, r.R}, nil
+}
@@ -0,0 +1,31 @@
+package xtemplate
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWebAuthnSecretKeptAcrossReloads(t *testing.T) {
+	config := New()
+	config.WebAuthn = []DotWebAuthnConfig{{Name: "Passkeys", RPID: "example.com", RPDisplayName: "Example", RPOrigins: []string{"https://example.com"}}}
+	server, err := config.Server(WithTemplateFS(fstest.MapFS{"index.html": {Data: []byte("home")}}), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Stop()
+	secret := server.Instance().config.WebAuthn[0].Secret
+	if len(secret) != 32 {
+		t.Fatalf("got a secret of %d bytes, want 32", len(secret))
+	}
+	if err := server.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	if server.Instance().config.WebAuthn[0].Secret != secret {
+		t.Errorf("secret changed on reload")
+	}
+	if config.WebAuthn[0].Secret != "" {
+		t.Errorf("secret was written to the config of the caller")
+	}
+}
@@ -0,0 +1,77 @@
+package xtemplate
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// errorLogMaxKeys bounds the number of distinct errors that are counted. When
+// it's reached the counts are reset, so at worst distinct errors are logged
+// again.
+const errorLogMaxKeys = 1024
+
+// errorLogLimiter suppresses repeated identical template errors: the first
+// burst occurrences of an error are logged, then only every sample-th
+// occurrence with the number of occurrences so far and how many were
+// suppressed since the last one was logged. See [Config.ErrorLogBurst]. A nil
+// *errorLogLimiter logs every error.
+type errorLogLimiter struct {
+	burst, sample int64
+
+	mutex  sync.Mutex
+	counts map[string]*errorLogCount
+}
+
+type errorLogCount struct {
+	total, suppressed int64
+}
+
+func newErrorLogLimiter(burst, sample int) *errorLogLimiter {
+	if burst <= 0 {
+		return nil
+	}
+	if sample <= 0 {
+		sample = 100
+	}
+	return &errorLogLimiter{burst: int64(burst), sample: int64(sample), counts: map[string]*errorLogCount{}}
+}
+
+// log logs err with msg at level unless it was already logged too often, in
+// which case it's counted instead.
+func (l *errorLogLimiter) log(ctx context.Context, log *slog.Logger, level slog.Level, msg string, err error) {
+	if l == nil {
+		log.Log(ctx, level, msg, slog.Any("error", err))
+		return
+	}
+	key := err.Error()
+
+	l.mutex.Lock()
+	c, ok := l.counts[key]
+	if !ok {
+		if len(l.counts) >= errorLogMaxKeys {
+			clear(l.counts)
+		}
+		c = &errorLogCount{}
+		l.counts[key] = c
+	}
+	c.total += 1
+	total, suppressed := c.total, c.suppressed
+	logged := total <= l.burst || (total-l.burst)%l.sample == 0
+	if logged {
+		c.suppressed = 0
+	} else {
+		c.suppressed += 1
+	}
+	l.mutex.Unlock()
+
+	switch {
+	case !logged:
+	case total < l.burst:
+		log.Log(ctx, level, msg, slog.Any("error", err))
+	case total == l.burst:
+		log.Log(ctx, level, msg, slog.Any("error", err), slog.Int64("occurrences", total), slog.String("note", "further identical errors are sampled"))
+	default:
+		log.Log(ctx, level, msg, slog.Any("error", err), slog.Int64("occurrences", total), slog.Int64("suppressed", suppressed))
+	}
+}
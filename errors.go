@@ -0,0 +1,147 @@
+package xtemplate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"text/template"
+)
+
+// RequestError describes why a request was rejected before reaching its
+// handler, like by access rules. It is available to error templates as
+// .Req.Error.
+type RequestError struct {
+	Status int
+	Reason string
+
+	// The template execution failure that caused the error, if any.
+	Template *TemplateError
+}
+
+// StatusText returns the standard text of the error's status code, like
+// "Forbidden".
+func (e *RequestError) StatusText() string {
+	return http.StatusText(e.Status)
+}
+
+type requestErrorType struct{}
+
+var requestErrorKey = requestErrorType{}
+
+// Error returns the reason the request was rejected if the current template
+// is rendering an error response, otherwise nil.
+func (d DotReq) Error() *RequestError {
+	e, _ := d.Context().Value(requestErrorKey).(*RequestError)
+	return e
+}
+
+// serveError responds to a rejected request with status. If there is a
+// template named like "ERROR 403" for the status, or else one named "ERROR",
+// it's rendered with the rejection in .Req.Error and the response status
+// defaulting to status. Otherwise a plain text error is sent.
+func (instance *Instance) serveError(w http.ResponseWriter, r *http.Request, status int, reason string) {
+	instance.serveRequestError(w, r, &RequestError{Status: status, Reason: reason})
+}
+
+func (instance *Instance) serveRequestError(w http.ResponseWriter, r *http.Request, reqErr *RequestError) {
+	tmpl := instance.templates.Lookup(fmt.Sprintf("ERROR %d", reqErr.Status))
+	if tmpl == nil {
+		tmpl = instance.templates.Lookup("ERROR")
+	}
+	// don't render error templates recursively if they fail themselves
+	if tmpl == nil || r.Context().Value(requestErrorKey) != nil {
+		http.Error(w, reqErr.Reason, reqErr.Status)
+		return
+	}
+	ctx := context.WithValue(r.Context(), requestErrorKey, reqErr)
+	bufferingTemplateHandler(instance, tmpl)(w, r.WithContext(ctx))
+}
+
+// TemplateError describes where template execution failed. Errors returned by
+// template execution are wrapped in a TemplateError when the location can be
+// determined, and it's available to error templates as .Req.Error.Template.
+type TemplateError struct {
+	// Name of the template being executed, like "GET /items" or "/index.html".
+	Name string
+
+	// Path of the template file where the failure happened, which may differ
+	// from the file that defines Name if it calls other templates. Line and
+	// Column refer to the minified source if [Config.Minify] is enabled.
+	File   string
+	Line   int
+	Column int
+
+	// Text of the template action that failed, possibly truncated.
+	Node string
+
+	// Description of the failure without the location.
+	Message string
+
+	// Path of File on disk if it was loaded from [Config.TemplatesDir].
+	Path string
+
+	// Where the template Name is defined, which can be in another file than
+	// the one that calls it.
+	Definition *TemplateSource
+
+	Err error
+}
+
+func (e *TemplateError) Error() string { return e.Err.Error() }
+func (e *TemplateError) Unwrap() error { return e.Err }
+
+// LogValue logs the location of the failure as separate attributes.
+func (e *TemplateError) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("name", e.Name),
+		slog.String("file", e.File),
+		slog.Int("line", e.Line),
+		slog.Int("column", e.Column),
+		slog.String("node", e.Node),
+		slog.String("message", e.Message),
+	}
+	if e.Path != "" {
+		attrs = append(attrs, slog.String("path", e.Path))
+	}
+	if e.Definition != nil {
+		attrs = append(attrs, slog.String("defined_at", e.Definition.String()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+var _ slog.LogValuer = &TemplateError{}
+
+var execErrorLocation = regexp.MustCompile(`(?s)^template: (.+?):(\d+):(\d+): executing "(?:[^"\\]|\\.)*" at <(.*?)>: (.*)$`)
+
+// wrapTemplateError returns err wrapped in a TemplateError if it contains a
+// template execution or escaping error, otherwise err unchanged.
+func wrapTemplateError(err error) error {
+	var tmplErr *TemplateError
+	if err == nil || errors.As(err, &tmplErr) {
+		return err
+	}
+	var execErr template.ExecError
+	var escapeErr *htmltemplate.Error
+	switch {
+	case errors.As(err, &execErr):
+		tmplErr = &TemplateError{Name: execErr.Name, Message: execErr.Err.Error(), Err: err}
+		if m := execErrorLocation.FindStringSubmatch(execErr.Err.Error()); m != nil {
+			tmplErr.File, tmplErr.Node, tmplErr.Message = m[1], m[4], m[5]
+			tmplErr.Line, _ = strconv.Atoi(m[2])
+			tmplErr.Column, _ = strconv.Atoi(m[3])
+		}
+	case errors.As(err, &escapeErr):
+		tmplErr = &TemplateError{Name: escapeErr.Name, File: escapeErr.Name, Line: escapeErr.Line, Message: escapeErr.Description, Err: err}
+		if escapeErr.Node != nil {
+			tmplErr.Node = escapeErr.Node.String()
+		}
+	default:
+		return err
+	}
+	return tmplErr
+}
@@ -0,0 +1,83 @@
+package xtemplate
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// errEvalRollback is passed to the dot cleanup of evaluations that don't
+// commit so database transactions are rolled back.
+var errEvalRollback = errors.New("evaluation changes are rolled back")
+
+// Eval executes template source, which can call all templates and funcs of
+// the instance, against the dot of r like the route that handles r would, and
+// returns the output. The path values of r are set from the route's pattern if
+// r wasn't routed by the instance. The output is limited by the route's buffer
+// size and r's context. Database transactions are committed only if commit is
+// true. Eval is intended for development tools like the template playground
+// and the `xtemplate repl` command.
+func (instance *Instance) Eval(r *http.Request, source string, commit bool) (string, error) {
+	tmpl := template.New("EVAL").Delims(instance.config.LDelim, instance.config.RDelim).Funcs(instance.funcs)
+	for _, t := range instance.templates.Templates() {
+		if t.Tree == nil || t.Name() == "EVAL" {
+			continue
+		}
+		if _, err := tmpl.AddParseTree(t.Name(), t.Tree.Copy()); err != nil {
+			return "", err
+		}
+	}
+	if _, err := tmpl.Parse(source); err != nil {
+		return "", err
+	}
+	injectLogArgs(tmpl.Tree)
+	instance.injectBudgetArgs(tmpl.Tree)
+
+	if _, pattern := instance.router.Handler(r); pattern != "" {
+		setPathValues(r, pattern)
+	}
+	dot, err := instance.bufferDot.value(instance.config.Ctx, httptest.NewRecorder(), r)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(limitedBuffer{&buf, instance.limits(r).maxBuffer, r.Context()}, *dot)
+	if commit {
+		err = instance.bufferDot.cleanup(dot, err)
+	} else {
+		// the joined error is never nil, so only the execution error is useful
+		instance.bufferDot.cleanup(dot, errors.Join(errEvalRollback, err))
+	}
+	return buf.String(), instance.templateError(err)
+}
+
+// setPathValues sets the path values of r that are matched by the wildcards of
+// the servemux pattern, because [Router.Handler] doesn't set them.
+func setPathValues(r *http.Request, pattern string) {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+	if i := strings.Index(pattern, "/"); i > 0 {
+		// strip the host
+		pattern = pattern[i:]
+	}
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	for i, seg := range strings.Split(strings.TrimPrefix(pattern, "/"), "/") {
+		name, ok := strings.CutPrefix(seg, "{")
+		if !ok || i >= len(segments) {
+			continue
+		}
+		name = strings.TrimSuffix(name, "}")
+		if name == "$" {
+			continue
+		}
+		if name, ok := strings.CutSuffix(name, "..."); ok {
+			r.SetPathValue(name, strings.Join(segments[i:], "/"))
+			return
+		}
+		r.SetPathValue(name, segments[i])
+	}
+}
@@ -0,0 +1,53 @@
+package xtemplate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+)
+
+// Response is the buffered result of serving a request with
+// [Instance.Execute].
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type executeErrorType struct{}
+
+var executeErrorKey = executeErrorType{}
+
+// Execute serves req through the full request pipeline without a network
+// listener and returns the buffered response, for example in Go fuzz tests or
+// property tests of routing and escaping. The error is not nil if a template
+// failed to execute or a handler panicked, in which case the response contains
+// what was written before the failure.
+func (instance *Instance) Execute(req *http.Request) (resp *Response, err error) {
+	if req == nil || req.URL == nil {
+		return nil, fmt.Errorf("request must have a url")
+	}
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	w := httptest.NewRecorder()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+		result := w.Result()
+		resp = &Response{Status: result.StatusCode, Header: result.Header, Body: w.Body.Bytes()}
+	}()
+	var execErr error
+	instance.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), executeErrorKey, &execErr)))
+	return nil, execErr
+}
+
+// reportExecuteError passes err to the caller of Execute if the request is
+// being served by it.
+func reportExecuteError(ctx context.Context, err error) {
+	if p, ok := ctx.Value(executeErrorKey).(*error); ok && *p == nil {
+		*p = err
+	}
+}
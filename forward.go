@@ -0,0 +1,57 @@
+package xtemplate
+
+import (
+	"fmt"
+	"html/template"
+	"path"
+)
+
+// maxForwards is the number of times a request can be forwarded, so templates
+// that forward to each other fail instead of looping forever.
+const maxForwards = 8
+
+// forwardReturn stops template execution like ReturnError and renders another
+// template file as the response instead, see Instance.forward.
+type forwardReturn struct {
+	tmpl *template.Template
+	data any
+}
+
+func (forwardReturn) Error() string { return "forwarded" }
+func (forwardReturn) Unwrap() error { return ReturnError{} }
+
+// forward discards the output of the current template and renders the
+// template file at name as the response with the same dot, without a redirect,
+// which lets a route dispatch to another page:
+//
+//	{{if ne (.Flags.Value "editor") "new"}}{{forward "/error/upgrade-required.html" (dict "feature" "editor")}}{{end}}
+//
+// The forwarded template sees data as .Vars.forward, and the variables,
+// headers, and status set so far. It's rendered with its own layout, and can
+// be a hidden file that has no route of its own. forward only works in
+// buffered templates.
+func (x *Instance) forward(name string, data ...any) (string, error) {
+	if len(data) > 1 {
+		return "", fmt.Errorf("too many forward arguments")
+	}
+	name = path.Clean("/" + name)
+	tmpl := x.templates.Lookup(name)
+	if tmpl == nil {
+		return "", fmt.Errorf("forward template file not found: '%s'", name)
+	}
+	f := forwardReturn{tmpl: tmpl}
+	if len(data) == 1 {
+		f.data = data[0]
+	}
+	return "", f
+}
+
+// forwardLayout returns the layout of the template file at name, if its front
+// matter chooses one.
+func (x *Instance) forwardLayout(name string) *template.Template {
+	layout, _ := metaLayout(x.templateMeta[name])
+	if layout == "" {
+		return nil
+	}
+	return x.templates.Lookup(layout)
+}
@@ -77,6 +77,19 @@ func extractFrontMatter(input string) (map[string]any, string, error) {
 	return fm, body, nil
 }
 
+// extractTemplateFrontMatter returns the metadata block of a template file
+// and the rest of it. Unlike documents read with splitFrontMatter, a template
+// only has a metadata block if its very first line is a `---` (yaml) or `+++`
+// (toml) fence, so templates that start with a blank line, a json object, or a
+// horizontal rule are left as they are.
+func extractTemplateFrontMatter(input string) (map[string]any, string, error) {
+	firstLine, _, _ := strings.Cut(input, "\n")
+	if fence := strings.TrimRight(firstLine, "\r"); fence != "---" && fence != "+++" {
+		return nil, input, nil
+	}
+	return extractFrontMatter(input)
+}
+
 func yamlFrontMatter(input []byte) (map[string]any, error) {
 	m := make(map[string]any)
 	err := yaml.Unmarshal(input, &m)
@@ -0,0 +1,29 @@
+package xtemplate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractTemplateFrontMatter(t *testing.T) {
+	for _, tc := range []struct {
+		name, input, body string
+		meta              map[string]any
+	}{
+		{"yaml", "---\ntitle: Home\n---\n<p>home", "\n<p>home", map[string]any{"title": "Home"}},
+		{"toml", "+++\ntitle = \"Home\"\n+++\n<p>home", "\n<p>home", map[string]any{"title": "Home"}},
+		{"crlf", "---\r\ntitle: Home\r\n---\r\n<p>home", "\r\n<p>home", map[string]any{"title": "Home"}},
+		{"json template", "{\n  \"name\": {{.Name | json}}\n}\n", "{\n  \"name\": {{.Name | json}}\n}\n", nil},
+		{"leading blank line", "\n---\ntitle: Home\n---\n<p>home", "\n---\ntitle: Home\n---\n<p>home", nil},
+		{"no front matter", "<p>a</p>\n---\n<p>b</p>", "<p>a</p>\n---\n<p>b</p>", nil},
+	} {
+		meta, body, err := extractTemplateFrontMatter(tc.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+			continue
+		}
+		if body != tc.body || !reflect.DeepEqual(meta, tc.meta) {
+			t.Errorf("%s: got meta %v and body %q, want %v and %q", tc.name, meta, body, tc.meta, tc.body)
+		}
+	}
+}
@@ -24,6 +24,9 @@ var xtemplateFuncs template.FuncMap = template.FuncMap{
 	"markdown":         FuncMarkdown,
 	"splitFrontMatter": FuncSplitFrontMatter,
 	"return":           FuncReturn,
+	"halt":             FuncHalt,
+	"abort":            FuncAbort,
+	"serveBytes":       FuncServeBytes,
 	"failf":            FuncFailf,
 	"humanize":         FuncHumanize,
 	"trustHtml":        FuncTrustHtml,
@@ -33,6 +36,39 @@ var xtemplateFuncs template.FuncMap = template.FuncMap{
 	"trustSrcSet":      FuncTrustSrcSet,
 	"idx":              FuncIdx,
 	"try":              FuncTry,
+	"paginate":         FuncPaginate,
+	"pageURL":          FuncPageURL,
+	"setQuery":         FuncSetQuery,
+	"delQuery":         FuncDelQuery,
+	"toggleQuery":      FuncToggleQuery,
+	"toc":              FuncToc,
+	"humanizeBytes":    FuncHumanizeBytes,
+	"humanizeTime":     FuncHumanizeTime,
+	"humanizeDuration": FuncHumanizeDuration,
+	"humanizeOrdinal":  FuncHumanizeOrdinal,
+	"humanizeNumber":   FuncHumanizeNumber,
+	"slugify":          FuncSlugify,
+	"uniqueSlug":       FuncUniqueSlug,
+	"uuidv7":           FuncUUIDv7,
+	"ulid":             FuncULID,
+	"inZone":           FuncInZone,
+	"parseInZone":      FuncParseInZone,
+	"avatar":           FuncAvatar,
+	"sql":              FuncSQL,
+	"sqlIn":            FuncSQLIn,
+	"sqlNamed":         FuncSQLNamed,
+	"totpSecret":       FuncTOTPSecret,
+	"totpURI":          FuncTOTPURI,
+	"totpCode":         FuncTOTPCode,
+	"totpVerify":       FuncTOTPVerify,
+	"ical":             FuncICal,
+	"icalEscape":       FuncICalEscape,
+	"vcard":            FuncVCard,
+	"nodeinfo":         FuncNodeinfo,
+	"nodeinfoLinks":    FuncNodeinfoLinks,
+	"webfinger":        FuncWebfinger,
+	"setVar":           FuncSetVar,
+	"getVar":           FuncGetVar,
 }
 
 // blueMondayPolicies is the map of names of bluemonday policies available to
@@ -142,6 +178,48 @@ func FuncReturn() (string, error) {
 	return "", ReturnError{}
 }
 
+// halt stops executing the template immediately, even from a nested template,
+// and sends the response as is: the output so far with the headers set with
+// .Resp, and the given status or the status set with .Resp. Layouts and
+// out-of-band swaps are skipped.
+//
+//	{{if not .Vars.items}}<p>Nothing here yet.{{halt}}{{end}}
+func FuncHalt(status ...int) (string, error) {
+	if len(status) > 1 {
+		return "", fmt.Errorf("too many status arguments")
+	}
+	h := haltReturn{}
+	if len(status) == 1 {
+		h.status = status[0]
+		if h.status < 100 || h.status > 999 {
+			return "", fmt.Errorf("invalid status code: %d", h.status)
+		}
+	}
+	return "", h
+}
+
+// abort stops executing the template immediately like halt, but discards the
+// output so far and sends an empty body with status and the headers set with
+// .Resp.
+//
+//	{{if not (.Req.FormValue "q")}}{{abort 204}}{{end}}
+func FuncAbort(status int) (string, error) {
+	if status < 100 || status > 999 {
+		return "", fmt.Errorf("invalid status code: %d", status)
+	}
+	return "", haltReturn{status: status, discard: true}
+}
+
+// haltReturn stops template execution like ReturnError and sets the status of
+// the response, see FuncHalt and FuncAbort.
+type haltReturn struct {
+	status  int
+	discard bool
+}
+
+func (haltReturn) Error() string { return "halted" }
+func (haltReturn) Unwrap() error { return ReturnError{} }
+
 func FuncFailf(format string, args ...any) (string, error) {
 	return "", fmt.Errorf(format, args...)
 }
@@ -0,0 +1,146 @@
+package xtemplate
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+// mutatingFuncs are funcs that modify their arguments by design, which
+// auditFuncs doesn't report.
+var mutatingFuncs = map[string]bool{
+	"setVar":         true,
+	"set":            true,
+	"unset":          true,
+	"merge":          true,
+	"mergeOverwrite": true,
+}
+
+// funcAudit is the state shared by the audited funcs of an instance.
+type funcAudit struct {
+	// funcs that were reported as modifying an argument
+	reported sync.Map
+
+	mu sync.Mutex
+	// number of calls in progress by the address of each map or slice
+	// argument, to detect calls that use the same value concurrently
+	inUse map[uintptr]int
+}
+
+// acquire records that a call is using the maps and slices in ptrs, and
+// reports whether another call is already using one of them.
+func (a *funcAudit) acquire(ptrs []uintptr) (shared bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, p := range ptrs {
+		shared = shared || a.inUse[p] > 0
+		a.inUse[p] += 1
+	}
+	return shared
+}
+
+// release records that a call is done using ptrs, and reports whether
+// another call is still using one of them.
+func (a *funcAudit) release(ptrs []uintptr) (shared bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, p := range ptrs {
+		shared = shared || a.inUse[p] > 1
+		if a.inUse[p] -= 1; a.inUse[p] == 0 {
+			delete(a.inUse, p)
+		}
+	}
+	return shared
+}
+
+// auditFuncs replaces each func in funcs with a shim that logs slow calls,
+// panics, modified arguments, and data races, see [Config.AuditFuncs].
+func auditFuncs(funcs map[string]any, slow time.Duration, log *slog.Logger) {
+	audit := &funcAudit{inUse: map[uintptr]int{}}
+	for name, fn := range funcs {
+		v := reflect.ValueOf(fn)
+		if v.Kind() != reflect.Func {
+			continue
+		}
+		funcs[name] = auditFunc(name, v, slow, log.With(slog.String("func", name)), audit).Interface()
+	}
+}
+
+func auditFunc(name string, fn reflect.Value, slow time.Duration, log *slog.Logger, audit *funcAudit) reflect.Value {
+	t := fn.Type()
+	return reflect.MakeFunc(t, func(args []reflect.Value) (out []reflect.Value) {
+		var before []string
+		var ptrs []uintptr
+		shared := false
+		if !mutatingFuncs[name] {
+			before = snapshotArgs(args)
+			ptrs = argPointers(args)
+			shared = audit.acquire(ptrs)
+		}
+		start := time.Now()
+		defer func() {
+			if ptrs != nil {
+				shared = audit.release(ptrs) || shared
+			}
+			if p := recover(); p != nil {
+				log.Warn("template func panicked", slog.Any("panic", p))
+				panic(p)
+			}
+			if d := time.Since(start); d > slow {
+				log.Warn("template func is slow", slog.Duration("duration", d), slog.Duration("threshold", slow))
+			}
+			if before == nil {
+				return
+			}
+			for i, s := range snapshotArgs(args) {
+				if s != before[i] {
+					if shared {
+						log.Error("template func modified an argument while another call was using it, which is a data race", slog.Int("argument", i))
+						break
+					}
+					// once per func, the same call usually repeats on every request
+					if _, loaded := audit.reported.LoadOrStore(name, true); !loaded {
+						log.Warn("template func modified an argument, which is shared state if other requests use the same value", slog.Int("argument", i))
+					}
+					break
+				}
+			}
+		}()
+		if t.IsVariadic() {
+			return fn.CallSlice(args)
+		}
+		return fn.Call(args)
+	})
+}
+
+// argPointers returns the addresses of the maps and slices in args.
+func argPointers(args []reflect.Value) []uintptr {
+	var ptrs []uintptr
+	for _, arg := range args {
+		for arg.Kind() == reflect.Interface && !arg.IsNil() {
+			arg = arg.Elem()
+		}
+		if (arg.Kind() == reflect.Map || arg.Kind() == reflect.Slice) && arg.Pointer() != 0 && !slices.Contains(ptrs, arg.Pointer()) {
+			ptrs = append(ptrs, arg.Pointer())
+		}
+	}
+	return ptrs
+}
+
+// snapshotArgs formats the maps and slices in args, so changes made by a call
+// can be detected. Other arguments are formatted as empty strings.
+func snapshotArgs(args []reflect.Value) []string {
+	snapshot := make([]string, len(args))
+	for i, arg := range args {
+		for arg.Kind() == reflect.Interface && !arg.IsNil() {
+			arg = arg.Elem()
+		}
+		if arg.Kind() == reflect.Map || arg.Kind() == reflect.Slice {
+			snapshot[i] = fmt.Sprintf("%#v", arg.Interface())
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,84 @@
+package xtemplate
+
+import (
+	"bytes"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestAuditFuncsFinalFuncMap(t *testing.T) {
+	var logs syncBuffer
+	instance, _, _, err := New().Instance(
+		WithTemplateFS(fstest.MapFS{"index.html": {Data: []byte(`{{$m := dict "a" 1}}{{addKey $m}}{{nap}}`)}}),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		WithFuncMaps(template.FuncMap{
+			"addKey": func(m map[string]any) string { m["b"] = 2; return "" },
+			"nap":    func() string { time.Sleep(5 * time.Millisecond); return "" },
+		}),
+		func(c *Config) error {
+			c.AuditFuncs = time.Millisecond
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, want := range []string{"func=addKey", "template func modified an argument", "func=nap", "template func is slow"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("expected the logs to contain %q, got: %s", want, logs.String())
+		}
+	}
+}
+
+func TestAuditFuncsDataRace(t *testing.T) {
+	var logs syncBuffer
+	log := slog.New(slog.NewTextHandler(&logs, nil))
+	started, release := make(chan struct{}), make(chan struct{})
+	funcs := map[string]any{
+		"wait": func(m map[string]any) string { started <- struct{}{}; <-release; return "" },
+		"put":  func(m map[string]any) string { m["x"] = 1; return "" },
+	}
+	auditFuncs(funcs, time.Minute, log)
+
+	shared := map[string]any{}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reflect.ValueOf(funcs["wait"]).Call([]reflect.Value{reflect.ValueOf(shared)})
+	}()
+	<-started
+	reflect.ValueOf(funcs["put"]).Call([]reflect.Value{reflect.ValueOf(shared)})
+	close(release)
+	wg.Wait()
+	if !strings.Contains(logs.String(), "data race") {
+		t.Errorf("expected a data race to be logged, got: %s", logs.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.String()
+}
@@ -0,0 +1,51 @@
+package xtemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultAvatarURL is the url template used by the avatar func unless
+// overridden by [Config.AvatarURL].
+const DefaultAvatarURL = "https://www.gravatar.com/avatar/{hash}?s={size}&d={default}"
+
+// avatar returns the url of the avatar image for an email address using the
+// gravatar hashing scheme: the hex sha256 of the trimmed, lowercased email.
+// The optional third argument is the image to use if there is no avatar for
+// the email, either a keyword like "mp", "identicon", or "retro", or a url.
+// Default "mp". For example:
+//
+//	<img src="{{avatar .user.email 80}}" width="80" height="80" alt="">
+func FuncAvatar(email string, size int, defaultImage ...string) (string, error) {
+	return avatarURL(DefaultAvatarURL, email, size, defaultImage)
+}
+
+func avatarFunc(urlTemplate string) func(string, int, ...string) (string, error) {
+	return func(email string, size int, defaultImage ...string) (string, error) {
+		return avatarURL(urlTemplate, email, size, defaultImage)
+	}
+}
+
+func avatarURL(urlTemplate, email string, size int, defaultImage []string) (string, error) {
+	def := "mp"
+	switch len(defaultImage) {
+	case 0:
+	case 1:
+		def = defaultImage[0]
+	default:
+		return "", fmt.Errorf("avatar: too many arguments")
+	}
+	if size <= 0 {
+		return "", fmt.Errorf("avatar: size must be positive, got %d", size)
+	}
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return strings.NewReplacer(
+		"{hash}", hex.EncodeToString(hash[:]),
+		"{size}", strconv.Itoa(size),
+		"{default}", url.QueryEscape(def),
+	).Replace(urlTemplate), nil
+}
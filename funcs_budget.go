@@ -0,0 +1,197 @@
+package xtemplate
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"text/template/parse"
+)
+
+// rangeBudgetFunc is the name of the func that injectBudgetArgs appends to the
+// pipeline of every range to count its iterations.
+const rangeBudgetFunc = "_rangeBudget"
+
+// requestBudget counts the template func calls and range iterations of a
+// request, see [Config.MaxFuncCalls] and [Config.MaxRangeIterations].
+type requestBudget struct {
+	calls      atomic.Int64
+	iterations atomic.Int64
+}
+
+// dotBudget returns the budget of a dot value, or nil if it isn't the dot of
+// a route.
+func dotBudget(dot any) *requestBudget {
+	v := reflect.ValueOf(dot)
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	f := v.FieldByName("X")
+	if !f.IsValid() || !f.CanInterface() {
+		return nil
+	}
+	if x, ok := f.Interface().(DotX); ok {
+		return x.budget
+	}
+	return nil
+}
+
+var errorType = reflect.TypeFor[error]()
+
+// budgetFuncs replaces each func in funcs with a shim that takes the dot as
+// its first argument and counts the call against the budget of the request,
+// failing the call once there are more than max. It returns the original
+// funcs by name.
+func budgetFuncs(funcs map[string]any, max int) map[string]any {
+	originals := map[string]any{}
+	for name, fn := range funcs {
+		v := reflect.ValueOf(fn)
+		if v.Kind() != reflect.Func {
+			continue
+		}
+		originals[name] = fn
+		funcs[name] = budgetFunc(name, v, int64(max)).Interface()
+	}
+	return originals
+}
+
+func budgetFunc(name string, fn reflect.Value, max int64) reflect.Value {
+	t := fn.Type()
+	in := []reflect.Type{reflect.TypeFor[any]()}
+	for i := range t.NumIn() {
+		in = append(in, t.In(i))
+	}
+	out := make([]reflect.Type, t.NumOut())
+	for i := range out {
+		out[i] = t.Out(i)
+	}
+	return reflect.MakeFunc(reflect.FuncOf(in, out, t.IsVariadic()), func(args []reflect.Value) []reflect.Value {
+		if budget := dotBudget(args[0].Interface()); budget != nil && budget.calls.Add(1) > max {
+			err := fmt.Errorf("func '%s' exceeded the maximum of %d func calls in a request", name, max)
+			if len(out) == 0 || out[len(out)-1] != errorType {
+				// text/template turns panics of funcs into errors
+				panic(err)
+			}
+			results := make([]reflect.Value, len(out))
+			for i, typ := range out {
+				results[i] = reflect.Zero(typ)
+			}
+			results[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return results
+		}
+		if t.IsVariadic() {
+			return fn.CallSlice(args[1:])
+		}
+		return fn.Call(args[1:])
+	})
+}
+
+// rangeBudget returns a func that counts the iterations of a range over value
+// against the budget of the request, and fails if there would be more than
+// limit. Ranges over slices, arrays, maps, and integers are counted before they
+// start. Ranges over channels and iterator funcs aren't counted. In templates
+// executed with a different dot than the route's, each range is limited on its
+// own.
+func rangeBudget(limit int) func(dot, value any) (any, error) {
+	return func(dot, value any) (any, error) {
+		var n int64
+		switch v := reflect.ValueOf(value); v.Kind() {
+		case reflect.Array, reflect.Slice, reflect.Map:
+			n = int64(v.Len())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = max(v.Int(), 0)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n = int64(min(v.Uint(), uint64(limit)+1))
+		}
+		total := n
+		if budget := dotBudget(dot); budget != nil {
+			total = budget.iterations.Add(n)
+		}
+		if total > int64(limit) {
+			return nil, fmt.Errorf("range over %d items exceeded the maximum of %d range iterations in a request", n, limit)
+		}
+		return value, nil
+	}
+}
+
+// injectBudgetArgs prepares tree to count against the budgets of the request
+// if the instance limits func calls or range iterations.
+func (x *Instance) injectBudgetArgs(tree *parse.Tree) {
+	if x.budgetedFuncs != nil || x.config.MaxRangeIterations > 0 {
+		injectBudgetArgs(tree, x.budgetedFuncs, x.config.MaxRangeIterations > 0)
+	}
+}
+
+// injectBudgetArgs adds the root dot `$` as the first argument of every call
+// to a func in funcs in tree, and if ranges is true, appends a call to the
+// range budget func to the pipeline of every range, so they can count against
+// the budget of the request. Funcs used as arguments without parentheses are
+// wrapped in a pipeline to pass the dot.
+func injectBudgetArgs(tree *parse.Tree, funcs map[string]any, ranges bool) {
+	dot := func(pos parse.Pos) *parse.VariableNode {
+		return &parse.VariableNode{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{"$"}}
+	}
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for i, arg := range n.Args {
+				ident, ok := arg.(*parse.IdentifierNode)
+				if !ok {
+					walk(arg)
+					continue
+				}
+				if _, ok := funcs[ident.Ident]; !ok || i == 0 {
+					continue
+				}
+				n.Args[i] = &parse.PipeNode{NodeType: parse.NodePipe, Pos: ident.Pos, Cmds: []*parse.CommandNode{
+					{NodeType: parse.NodeCommand, Pos: ident.Pos, Args: []parse.Node{ident, dot(ident.Pos)}},
+				}}
+			}
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok {
+				if _, ok := funcs[ident.Ident]; ok {
+					n.Args = append([]parse.Node{ident, dot(n.Position())}, n.Args[1:]...)
+				}
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+			if ranges {
+				pos := n.Pipe.Position()
+				n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: pos, Args: []parse.Node{
+					parse.NewIdentifier(rangeBudgetFunc).SetPos(pos),
+					dot(pos),
+				}})
+			}
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(tree.Root)
+}
@@ -0,0 +1,45 @@
+package xtemplate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBudgets(t *testing.T) {
+	instance := testInstance(t, fstest.MapFS{
+		"index.html": {Data: []byte(`{{define "x"}}{{range .}}{{upper "x"}}{{end}}{{end}}` +
+			`{{lower (upper "a")}} {{list now | len}} {{call (.X.Func "upper") "b"}} {{template "x" (list 1 2)}}`)},
+		"calls.html":  {Data: []byte(`{{range 3}}{{upper "a"}}{{end}}`)},
+		"over.html":   {Data: []byte(strings.Repeat(`{{upper "a"}}`, 6))},
+		"ranges.html": {Data: []byte(`{{range 2}}a{{end}}{{range list 1 2}}b{{end}}`)},
+	},
+		func(c *Config) error {
+			c.MaxFuncCalls = 5
+			c.MaxRangeIterations = 3
+			return nil
+		},
+	)
+	for _, tc := range []struct {
+		target, body string
+		status       int
+	}{
+		{"/", "a 1 B XX", http.StatusOK},
+		// the budgets are per request
+		{"/", "a 1 B XX", http.StatusOK},
+		{"/calls", "AAA", http.StatusOK},
+		{"/over", "", http.StatusInternalServerError},
+		{"/ranges", "", http.StatusInternalServerError},
+	} {
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if w.Code != tc.status {
+			t.Errorf("%s: got status %d, want %d", tc.target, w.Code, tc.status)
+		}
+		if body := strings.TrimSpace(w.Body.String()); tc.status == http.StatusOK && body != tc.body {
+			t.Errorf("%s: got %q, want %q", tc.target, body, tc.body)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package xtemplate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cast"
+)
+
+// humanizeBytes formats a number of bytes like "2.3 MB". Pass true as the
+// second argument to use IEC units like "2.2 MiB" instead.
+func FuncHumanizeBytes(size any, iec ...bool) (string, error) {
+	n, err := cast.ToUint64E(size)
+	if err != nil {
+		return "", fmt.Errorf("humanizeBytes: %w", err)
+	}
+	if len(iec) > 0 && iec[0] {
+		return humanize.IBytes(n), nil
+	}
+	return humanize.Bytes(n), nil
+}
+
+// humanizeTime formats a time relative to now like "3 hours ago" or "2 days
+// from now". t may be a time.Time, a unix timestamp, or a string in a common
+// date format like RFC3339.
+func FuncHumanizeTime(t any) (string, error) {
+	tm, err := cast.ToTimeE(t)
+	if err != nil {
+		return "", fmt.Errorf("humanizeTime: %w", err)
+	}
+	return humanize.Time(tm), nil
+}
+
+var durationUnits = []struct {
+	name string
+	size time.Duration
+}{
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+	{"second", time.Second},
+}
+
+// humanizeDuration formats a duration with its two most significant units like
+// "2 hours, 5 minutes". d may be a time.Duration, a number of nanoseconds, or
+// a duration string like "1h30m".
+func FuncHumanizeDuration(d any) (string, error) {
+	dur, err := cast.ToDurationE(d)
+	if err != nil {
+		return "", fmt.Errorf("humanizeDuration: %w", err)
+	}
+	prefix := ""
+	if dur < 0 {
+		prefix = "-"
+		dur = -dur
+	}
+	if dur < time.Second {
+		return prefix + dur.String(), nil
+	}
+	var parts []string
+	for _, unit := range durationUnits {
+		if len(parts) == 2 {
+			break
+		}
+		n := dur / unit.size
+		if n == 0 {
+			if len(parts) > 0 {
+				break
+			}
+			continue
+		}
+		dur -= n * unit.size
+		if n == 1 {
+			parts = append(parts, fmt.Sprintf("1 %s", unit.name))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d %ss", n, unit.name))
+		}
+	}
+	return prefix + strings.Join(parts, ", "), nil
+}
+
+// humanizeOrdinal formats a number as an ordinal like "1st", "2nd", or "23rd".
+func FuncHumanizeOrdinal(n any) (string, error) {
+	i, err := cast.ToIntE(n)
+	if err != nil {
+		return "", fmt.Errorf("humanizeOrdinal: %w", err)
+	}
+	return humanize.Ordinal(i), nil
+}
+
+// humanizeNumber formats a number with thousands separators like "1,234,567".
+// Floats are formatted with their fractional part, optionally rounded to the
+// number of decimals given as the second argument.
+func FuncHumanizeNumber(n any, decimals ...int) (string, error) {
+	switch n.(type) {
+	case float32, float64:
+		f, _ := cast.ToFloat64E(n)
+		if len(decimals) > 0 {
+			return humanize.CommafWithDigits(f, decimals[0]), nil
+		}
+		return humanize.Commaf(f), nil
+	}
+	i, err := cast.ToInt64E(n)
+	if err != nil {
+		f, ferr := cast.ToFloat64E(n)
+		if ferr != nil {
+			return "", fmt.Errorf("humanizeNumber: %w", err)
+		}
+		return FuncHumanizeNumber(f, decimals...)
+	}
+	return humanize.Comma(i), nil
+}
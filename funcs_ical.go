@@ -0,0 +1,293 @@
+package xtemplate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cast"
+)
+
+// ICalEvent is an event of an iCalendar feed. The ical func also accepts maps
+// with the same keys in snake case, like rows returned by a database query.
+type ICalEvent struct {
+	// Unique id of the event. Defaults to a hash of Summary and Start.
+	UID string `json:"uid"`
+	// Title of the event.
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	Location    string `json:"location"`
+	URL         string `json:"url"`
+	// Start and end of the event, as a time.Time or a string in a common date
+	// format like `2006-01-02 15:04`. End defaults to Start, or the next day for all day events.
+	Start any `json:"start"`
+	End   any `json:"end"`
+	// The event lasts whole days, only the date of Start and End are used, and
+	// End is exclusive.
+	AllDay bool `json:"all_day"`
+	// IANA timezone name like `Europe/Berlin` that Start and End are emitted
+	// in, so recurring events keep their local time across DST changes.
+	// Strings without an offset are interpreted in this zone. If empty, times
+	// are emitted in UTC.
+	Timezone string `json:"timezone"`
+	// Recurrence rule like `FREQ=WEEKLY;BYDAY=TU;COUNT=10`.
+	RRule string `json:"rrule"`
+}
+
+// ical renders an iCalendar feed named name with the events, which is a slice
+// of [ICalEvent] or maps with the same keys. Serve it with ServeContent so the
+// output isn't escaped or minified:
+//
+//	{{$events := .DB.QueryRows "SELECT uid, summary, start, end, timezone FROM events"}}
+//	{{.Resp.SetHeader "Content-Type" "text/calendar; charset=utf-8"}}
+//	{{.Resp.ServeContent "events.ics" .Req.Now (ical "Meetups" $events)}}
+//
+// Text is escaped, long lines are folded, and a VTIMEZONE component is
+// included for each timezone that is used.
+func FuncICal(name string, events any) (string, error) {
+	var evs []ICalEvent
+	if events != nil {
+		v := reflect.ValueOf(events)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return "", fmt.Errorf("ical: events must be a list, got %T", events)
+		}
+		for i := 0; i < v.Len(); i++ {
+			ev, err := toICalEvent(v.Index(i).Interface())
+			if err != nil {
+				return "", fmt.Errorf("ical: event %d: %w", i, err)
+			}
+			evs = append(evs, ev)
+		}
+	}
+
+	var b icalBuilder
+	b.line("BEGIN:VCALENDAR")
+	b.line("VERSION:2.0")
+	b.line("PRODID:-//xtemplate//ical//EN")
+	b.line("CALSCALE:GREGORIAN")
+	if name != "" {
+		b.line("X-WR-CALNAME:" + FuncICalEscape(name))
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	var lines []string
+	zones := map[string][2]int{}
+	var zoneNames []string
+	for i, ev := range evs {
+		loc := time.UTC
+		if ev.Timezone != "" {
+			var err error
+			if loc, err = loadLocation(ev.Timezone); err != nil {
+				return "", fmt.Errorf("ical: event %d: %w", i, err)
+			}
+		}
+		start, err := icalParseTime(ev.Start, loc)
+		if err != nil {
+			return "", fmt.Errorf("ical: event %d: invalid start: %w", i, err)
+		}
+		start = start.In(loc)
+		end := start
+		if ev.AllDay {
+			end = start.AddDate(0, 0, 1)
+		}
+		if ev.End != nil && ev.End != "" {
+			if end, err = icalParseTime(ev.End, loc); err != nil {
+				return "", fmt.Errorf("ical: event %d: invalid end: %w", i, err)
+			}
+			end = end.In(loc)
+		}
+		if ev.Timezone != "" && !ev.AllDay {
+			years, ok := zones[ev.Timezone]
+			if !ok {
+				years = [2]int{start.Year(), end.Year()}
+				zoneNames = append(zoneNames, ev.Timezone)
+			}
+			zones[ev.Timezone] = [2]int{min(years[0], start.Year()), max(years[1], end.Year())}
+		}
+		if strings.ContainsAny(ev.RRule+ev.URL, "\r\n") {
+			return "", fmt.Errorf("ical: event %d: rrule and url must not contain newlines", i)
+		}
+		uid := ev.UID
+		if uid == "" {
+			sum := sha256.Sum256([]byte(ev.Summary + "\x00" + start.UTC().Format(time.RFC3339)))
+			uid = hex.EncodeToString(sum[:16]) + "@xtemplate"
+		}
+
+		lines = append(lines, "BEGIN:VEVENT", "UID:"+FuncICalEscape(uid), "DTSTAMP:"+stamp)
+		lines = append(lines, icalTime("DTSTART", start, ev), icalTime("DTEND", end, ev))
+		if ev.RRule != "" {
+			lines = append(lines, "RRULE:"+strings.TrimPrefix(ev.RRule, "RRULE:"))
+		}
+		for _, prop := range []struct{ name, value string }{
+			{"SUMMARY", ev.Summary}, {"DESCRIPTION", ev.Description}, {"LOCATION", ev.Location},
+		} {
+			if prop.value != "" {
+				lines = append(lines, prop.name+":"+FuncICalEscape(prop.value))
+			}
+		}
+		if ev.URL != "" {
+			lines = append(lines, "URL:"+ev.URL)
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+
+	for _, zone := range zoneNames {
+		loc, _ := loadLocation(zone)
+		years := zones[zone]
+		for _, l := range icalTimezone(zone, loc, years[0], years[1]) {
+			b.line(l)
+		}
+	}
+	for _, l := range lines {
+		b.line(l)
+	}
+	b.line("END:VCALENDAR")
+	return b.String(), nil
+}
+
+// icalEscape escapes s for use as an iCalendar text value.
+func FuncICalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+func toICalEvent(v any) (ICalEvent, error) {
+	switch e := v.(type) {
+	case ICalEvent:
+		return e, nil
+	case *ICalEvent:
+		return *e, nil
+	}
+	m, err := cast.ToStringMapE(v)
+	if err != nil {
+		return ICalEvent{}, fmt.Errorf("expected an event or a map, got %T", v)
+	}
+	str := func(key string) string {
+		if m[key] == nil {
+			return ""
+		}
+		return cast.ToString(m[key])
+	}
+	return ICalEvent{
+		UID:         str("uid"),
+		Summary:     str("summary"),
+		Description: str("description"),
+		Location:    str("location"),
+		URL:         str("url"),
+		Start:       m["start"],
+		End:         m["end"],
+		AllDay:      cast.ToBool(m["all_day"]),
+		Timezone:    str("timezone"),
+		RRule:       str("rrule"),
+	}, nil
+}
+
+// icalParseTime converts v to a time, also accepting the minute precision
+// layouts that datetime-local inputs and sql databases commonly use.
+func icalParseTime(v any, loc *time.Location) (time.Time, error) {
+	t, err := cast.ToTimeInDefaultLocationE(v, loc)
+	if err == nil {
+		return t, nil
+	}
+	if s, ok := v.(string); ok {
+		for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04"} {
+			if t, perr := time.ParseInLocation(layout, s, loc); perr == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, err
+}
+
+func icalTime(prop string, t time.Time, ev ICalEvent) string {
+	switch {
+	case ev.AllDay:
+		return prop + ";VALUE=DATE:" + t.Format("20060102")
+	case ev.Timezone != "":
+		return prop + ";TZID=" + ev.Timezone + ":" + t.Format("20060102T150405")
+	default:
+		return prop + ":" + t.UTC().Format("20060102T150405Z")
+	}
+}
+
+// icalTimezone returns a VTIMEZONE component describing the offset
+// transitions of loc between the start of the first year and the end of the
+// last year.
+func icalTimezone(name string, loc *time.Location, first, last int) []string {
+	lines := []string{"BEGIN:VTIMEZONE", "TZID:" + name}
+	component := func(t time.Time, from int) {
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		abbr, to := t.Zone()
+		lines = append(lines,
+			"BEGIN:"+kind,
+			"DTSTART:"+t.In(time.FixedZone("", from)).Format("20060102T150405"),
+			"TZOFFSETFROM:"+icalOffset(from),
+			"TZOFFSETTO:"+icalOffset(to),
+			"TZNAME:"+FuncICalEscape(abbr),
+			"END:"+kind,
+		)
+	}
+
+	t := time.Date(first, 1, 1, 0, 0, 0, 0, loc)
+	end := time.Date(last+1, 1, 1, 0, 0, 0, 0, loc)
+	_, offset := t.Zone()
+	initial := len(lines)
+	for t.Before(end) {
+		next := t.Add(24 * time.Hour)
+		if _, o := next.Zone(); o != offset {
+			// binary search for the second the offset changes
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, o := mid.Zone(); o == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			component(hi, offset)
+			_, offset = hi.Zone()
+		}
+		t = next
+	}
+	if len(lines) == initial {
+		component(time.Date(1970, 1, 1, 0, 0, 0, 0, loc), offset)
+	}
+	return append(lines, "END:VTIMEZONE")
+}
+
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// icalBuilder writes content lines terminated by CRLF, folded to at most 75
+// octets without splitting utf-8 sequences.
+type icalBuilder struct {
+	strings.Builder
+}
+
+func (b *icalBuilder) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = 74
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
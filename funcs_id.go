@@ -0,0 +1,46 @@
+package xtemplate
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// uuidv7 generates a time-sortable version 7 UUID. Unlike the random v4 UUIDs
+// generated by sprig's uuidv4, v7 UUIDs generated later sort after earlier
+// ones which keeps database indexes compact. For example:
+//
+//	{{.DB.Exec "INSERT INTO posts(id, title) VALUES (?, ?)" uuidv7 .title}}
+func FuncUUIDv7() (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulid generates a time-sortable ULID: a 48-bit millisecond timestamp
+// followed by 80 random bits, encoded as 26 characters of Crockford's base32.
+// See https://github.com/ulid/spec
+func FuncULID() (string, error) {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	// encode 128 bits as 26 base32 characters, the first character only
+	// holds the top 3 bits
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
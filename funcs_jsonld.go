@@ -0,0 +1,183 @@
+package xtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// jsonLDType describes how the jsonld func builds a schema.org type.
+type jsonLDType struct {
+	// schema.org type that is emitted, if it's different from the name
+	schema string
+	// properties that search engines require
+	required []string
+	// at least one of these properties is required
+	oneOf []string
+	// properties whose string values are expanded to an object of this type
+	objects map[string]string
+	// adds or rewrites properties before the type is validated
+	build func(props map[string]any) error
+}
+
+var jsonLDArticle = jsonLDType{
+	required: []string{"headline", "datePublished", "author"},
+	objects:  map[string]string{"author": "Person", "publisher": "Organization"},
+}
+
+// jsonLDTypes are the schema.org types with builders. Other types are
+// emitted as given.
+var jsonLDTypes = map[string]jsonLDType{
+	"Article":     jsonLDArticle,
+	"NewsArticle": jsonLDArticle,
+	"BlogPosting": jsonLDArticle,
+	"Product": {
+		required: []string{"name"},
+		oneOf:    []string{"offers", "review", "aggregateRating"},
+		objects:  map[string]string{"brand": "Brand"},
+		build: func(props map[string]any) error {
+			// a price and currency are shorthand for a single offer
+			if price, ok := props["price"]; ok {
+				offer := map[string]any{"@type": "Offer", "price": price}
+				for _, key := range []string{"priceCurrency", "availability", "url"} {
+					if v, ok := props[key]; ok {
+						offer[key] = v
+						delete(props, key)
+					}
+				}
+				delete(props, "price")
+				props["offers"] = offer
+			}
+			return nil
+		},
+	},
+	"Event": {
+		required: []string{"name", "startDate", "location"},
+		objects:  map[string]string{"location": "Place", "organizer": "Organization", "performer": "Person"},
+	},
+	"Breadcrumb": {
+		schema:   "BreadcrumbList",
+		required: []string{"itemListElement"},
+		build: func(props map[string]any) error {
+			items, ok := props["items"]
+			if !ok {
+				return nil
+			}
+			delete(props, "items")
+			v := reflect.ValueOf(items)
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				return fmt.Errorf("breadcrumb items must be a list, got %T", items)
+			}
+			var elements []any
+			for i := 0; i < v.Len(); i++ {
+				item, err := cast.ToStringMapE(v.Index(i).Interface())
+				if err != nil {
+					return fmt.Errorf("breadcrumb item %d must be a map with a name and url, got %T", i, v.Index(i).Interface())
+				}
+				element := map[string]any{"@type": "ListItem", "position": i + 1, "name": item["name"]}
+				if url, ok := item["url"]; ok && url != "" {
+					element["item"] = url
+				}
+				elements = append(elements, element)
+			}
+			props["itemListElement"] = elements
+			return nil
+		},
+	},
+}
+
+// jsonLD renders a script element with the schema.org structured data of a
+// typ with the properties of data, which is a map like a row returned by a
+// database query. Keys in snake case are converted to the camel case of
+// schema.org, and time values to ISO 8601:
+//
+//	{{jsonld "Article" (dict "headline" .title "date_published" .published "author" .author_name)}}
+//	{{jsonld "Product" (dict "name" .name "price" .price "price_currency" "EUR")}}
+//	{{jsonld "Event" (dict "name" .name "start_date" .starts "location" .venue)}}
+//	{{jsonld "Breadcrumb" (dict "items" (list (dict "name" "Docs" "url" "/docs") (dict "name" .title)))}}
+//
+// Article, NewsArticle, BlogPosting, Product, Event, and Breadcrumb have
+// builders that expand shorthands, like a string author to a Person or a
+// price to an Offer. If [Config.ValidateHTML] is enabled, a warning is
+// logged when they lack properties that search engines require. Other types
+// are emitted as given.
+func (x *Instance) jsonLD(typ string, data any) (template.HTML, error) {
+	props := map[string]any{}
+	if data != nil {
+		m, err := cast.ToStringMapE(data)
+		if err != nil {
+			return "", fmt.Errorf("jsonld: properties must be a map, got %T", data)
+		}
+		for k, v := range m {
+			props[jsonLDKey(k)] = v
+		}
+	}
+
+	t, ok := jsonLDTypes[typ]
+	if ok && t.build != nil {
+		if err := t.build(props); err != nil {
+			return "", fmt.Errorf("jsonld: %w", err)
+		}
+	}
+	for key, objType := range t.objects {
+		if s, ok := props[key].(string); ok {
+			props[key] = map[string]any{"@type": objType, "name": s}
+		}
+	}
+	if t.schema != "" {
+		typ = t.schema
+	}
+	props["@context"] = "https://schema.org"
+	props["@type"] = typ
+
+	if ok && x.config.ValidateHTML {
+		var missing []string
+		for _, key := range t.required {
+			if isEmptyJSONLD(props[key]) {
+				missing = append(missing, key)
+			}
+		}
+		if len(t.oneOf) > 0 && !slices.ContainsFunc(t.oneOf, func(key string) bool { return !isEmptyJSONLD(props[key]) }) {
+			missing = append(missing, strings.Join(t.oneOf, " or "))
+		}
+		if len(missing) > 0 {
+			x.config.Logger.Warn("structured data is missing required properties", slog.String("type", typ), slog.Any("missing", missing))
+		}
+	}
+
+	// json.Marshal escapes <, >, and & so the data can't close the script
+	payload, err := json.Marshal(props)
+	if err != nil {
+		return "", fmt.Errorf("jsonld: failed to encode properties: %w", err)
+	}
+	return template.HTML(`<script type="application/ld+json">` + string(payload) + `</script>`), nil
+}
+
+// jsonLDKey converts a snake case key like `date_published` to camel case.
+func jsonLDKey(key string) string {
+	parts := strings.Split(key, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+func isEmptyJSONLD(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return false
+}
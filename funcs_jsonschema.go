@@ -0,0 +1,135 @@
+package xtemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// schemaFileSuffix identifies json schema files in the templates directory,
+// which are compiled when the instance is built.
+const schemaFileSuffix = ".schema.json"
+
+// JSONValidation is the result of validating a json value against a schema.
+// See [FuncValidateJSON].
+type JSONValidation struct {
+	Valid  bool                  `json:"valid"`
+	Errors []JSONValidationError `json:"errors,omitempty"`
+}
+
+// JSONValidationError describes one way a value failed validation.
+type JSONValidationError struct {
+	// Json pointer to the invalid value, like "/items/2/name".
+	Path string `json:"path"`
+	// Schema file and json pointer to the keyword that failed, like
+	// "/schemas/contact.schema.json#/properties/name/minLength".
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+// compileSchemas compiles all json schema files found in the templates fs.
+// Schemas can refer to each other with relative $ref urls.
+func compileSchemas(fsys fs.FS, paths []string) (map[string]*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	for _, p := range paths {
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read json schema '%s': %w", p, err)
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode json schema '%s': %w", p, err)
+		}
+		if err := c.AddResource(schemaURL(p), doc); err != nil {
+			return nil, fmt.Errorf("failed to add json schema '%s': %w", p, err)
+		}
+	}
+	schemas := make(map[string]*jsonschema.Schema, len(paths))
+	for _, p := range paths {
+		schema, err := c.Compile(schemaURL(p))
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile json schema '%s': %w", p, err)
+		}
+		schemas[path.Clean("/"+p)] = schema
+	}
+	return schemas, nil
+}
+
+func schemaURL(p string) string {
+	return "xtemplate://" + path.Clean("/"+p)
+}
+
+// validateJSON validates payload against the json schema file at schemaPath
+// in the templates directory. Schema files must have the extension
+// `.schema.json` and are compiled when the instance is loaded. payload may be
+// a string or byte slice of json, or any value that can be encoded as json. It
+// returns a result with Valid and a list of Errors, and only fails if the
+// schema doesn't exist or the payload isn't valid json. For example:
+//
+//	{{$v := validateJSON "/schemas/contact.schema.json" (.Req.FormValue "data")}}
+//	{{if not $v.Valid}}{{.Resp.SetStatus 422}}{{range $v.Errors}}<p>{{.Path}}: {{.Message}}{{end}}{{end}}
+func (x *Instance) validateJSON(schemaPath string, payload any) (*JSONValidation, error) {
+	schema, ok := x.schemas[path.Clean("/"+schemaPath)]
+	if !ok {
+		return nil, fmt.Errorf("validateJSON: no json schema at '%s'", schemaPath)
+	}
+	var raw []byte
+	switch p := payload.(type) {
+	case string:
+		raw = []byte(p)
+	case []byte:
+		raw = p
+	default:
+		var err error
+		if raw, err = json.Marshal(payload); err != nil {
+			return nil, fmt.Errorf("validateJSON: failed to encode payload: %w", err)
+		}
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("validateJSON: failed to decode payload: %w", err)
+	}
+	err = schema.Validate(doc)
+	if err == nil {
+		return &JSONValidation{Valid: true}, nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, fmt.Errorf("validateJSON: %w", err)
+	}
+	result := &JSONValidation{}
+	var collect func(*jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, cause := range e.Causes {
+				collect(cause)
+			}
+			return
+		}
+		result.Errors = append(result.Errors, JSONValidationError{
+			Path:    jsonPointer(e.InstanceLocation),
+			Keyword: strings.TrimPrefix(e.SchemaURL, "xtemplate://") + jsonPointer(e.ErrorKind.KeywordPath()),
+			Message: e.ErrorKind.LocalizedString(messagePrinter),
+		})
+	}
+	collect(verr)
+	return result, nil
+}
+
+var messagePrinter = message.NewPrinter(language.English)
+
+func jsonPointer(tokens []string) string {
+	var b strings.Builder
+	for _, tok := range tokens {
+		b.WriteByte('/')
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(tok))
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package xtemplate
+
+import (
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"text/template/parse"
+)
+
+// logLevels are the levels of the logging funcs by name.
+var logLevels = map[string]slog.Level{
+	"logDebug": slog.LevelDebug,
+	"logInfo":  slog.LevelInfo,
+	"logWarn":  slog.LevelWarn,
+	"logError": slog.LevelError,
+}
+
+// logFunc returns the logging func of level, which writes a message with
+// key-value pairs to the logger of the current request with the name of the
+// template and the location of the call, so templates can emit server-side
+// diagnostics instead of printing them into the page:
+//
+//	{{logInfo "checkout started" "cart" $cart.id "items" (len $cart.items)}}
+//	{{if not $user}}{{logWarn "missing user" "session" (.Req.Cookie "session")}}{{end}}
+//
+// It returns an empty string. Templates only pass the message and key-value
+// pairs, the dot and the template are added to every call when the template
+// is parsed, see injectLogArgs. Calls in templates that are invoked with a
+// different dot than the route's log with the instance logger.
+func (x *Instance) logFunc(level slog.Level) func(dot any, template, location, msg string, kv ...any) string {
+	return func(dot any, template, location, msg string, kv ...any) string {
+		log, ctx := x.config.Logger, x.config.Ctx
+		if r := dotRequest(dot); r != nil {
+			log, ctx = GetLogger(r.Context()), r.Context()
+		}
+		log.Log(ctx, level, msg, append([]any{slog.String("template", template), slog.String("location", location)}, kv...)...)
+		return ""
+	}
+}
+
+// dotRequest returns the request of a dot value, or nil if it isn't one.
+func dotRequest(dot any) *http.Request {
+	v := reflect.ValueOf(dot)
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	f := v.FieldByName("Req")
+	if !f.IsValid() || !f.CanInterface() {
+		return nil
+	}
+	if req, ok := f.Interface().(DotReq); ok {
+		return req.Request
+	}
+	return nil
+}
+
+// injectLogArgs adds the root dot `$`, the template name, and the location of
+// the call as the first arguments of every call to a logging func in tree,
+// which gives them access to the request without passing it explicitly.
+func injectLogArgs(tree *parse.Tree) {
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok {
+				if _, ok := logLevels[ident.Ident]; ok {
+					location, _ := tree.ErrorContext(n)
+					pos := n.Position()
+					args := []parse.Node{
+						ident,
+						&parse.VariableNode{NodeType: parse.NodeVariable, Pos: pos, Ident: []string{"$"}},
+						&parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(tree.Name), Text: tree.Name},
+						&parse.StringNode{NodeType: parse.NodeString, Pos: pos, Quoted: strconv.Quote(location), Text: location},
+					}
+					n.Args = append(args, n.Args[1:]...)
+				}
+			}
+			for _, c := range n.Args {
+				walk(c)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		}
+	}
+	walk(tree.Root)
+}
@@ -0,0 +1,103 @@
+package xtemplate
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Pagination describes the state of a paginated listing. See [FuncPaginate].
+type Pagination struct {
+	Total   int // total number of items
+	Page    int // current page, starting at 1
+	PerPage int // number of items per page
+	Pages   int // total number of pages, at least 1
+	Offset  int // offset of the first item on the current page
+	Prev    int // previous page number, or 0 if on the first page
+	Next    int // next page number, or 0 if on the last page
+
+	// Items lists the page links to show: the first and last pages, and a
+	// window of pages around the current page, separated by ellipses.
+	Items []PageItem
+}
+
+// PageItem is one entry in a pagination control.
+type PageItem struct {
+	Number   int
+	Current  bool
+	Ellipsis bool
+}
+
+// HasPrev returns true if there is a page before the current page.
+func (p Pagination) HasPrev() bool { return p.Prev > 0 }
+
+// HasNext returns true if there is a page after the current page.
+func (p Pagination) HasNext() bool { return p.Next > 0 }
+
+// paginateWindow is the number of pages shown on either side of the current
+// page.
+const paginateWindow = 2
+
+// paginate computes pagination state for total items split into pages of
+// perPage items with page as the current page. Out of range page numbers are
+// clamped. For example:
+//
+//	{{$p := paginate 95 (.Req.URL.Query.Get "page" | atoi) 10}}
+//	{{range $p.Items}}
+//	  {{if .Ellipsis}}…{{else}}<a href="{{pageURL $.Req.URL .Number}}">{{.Number}}</a>{{end}}
+//	{{end}}
+func FuncPaginate(total, page, perPage int) (Pagination, error) {
+	if perPage <= 0 {
+		return Pagination{}, fmt.Errorf("paginate: perPage must be positive, got %d", perPage)
+	}
+	if total < 0 {
+		total = 0
+	}
+	pages := (total + perPage - 1) / perPage
+	if pages < 1 {
+		pages = 1
+	}
+	page = min(max(page, 1), pages)
+	p := Pagination{
+		Total:   total,
+		Page:    page,
+		PerPage: perPage,
+		Pages:   pages,
+		Offset:  (page - 1) * perPage,
+	}
+	if page > 1 {
+		p.Prev = page - 1
+	}
+	if page < pages {
+		p.Next = page + 1
+	}
+	last := 0
+	for n := 1; n <= pages; n++ {
+		if n != 1 && n != pages && (n < page-paginateWindow || n > page+paginateWindow) {
+			continue
+		}
+		if last != 0 && n > last+1 {
+			p.Items = append(p.Items, PageItem{Ellipsis: true})
+		}
+		p.Items = append(p.Items, PageItem{Number: n, Current: n == page})
+		last = n
+	}
+	return p, nil
+}
+
+// pageURL returns the given url with the page query parameter set to page,
+// preserving all other query parameters. The name of the query parameter can be
+// overridden by passing a third argument. u may be a string or a *url.URL like
+// .Req.URL. For example:
+//
+//	<a href="{{pageURL .Req.URL 2}}">Next</a>
+func FuncPageURL(u any, page int, param ...string) (string, error) {
+	name := "page"
+	switch len(param) {
+	case 0:
+	case 1:
+		name = param[0]
+	default:
+		return "", fmt.Errorf("pageURL: too many arguments")
+	}
+	return FuncSetQuery(u, name, strconv.Itoa(page))
+}
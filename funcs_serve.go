@@ -0,0 +1,90 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// serveFile stops executing the template and responds with the contents of
+// file instead of the template output, with the headers set with .Resp so far.
+// file is the path of a file in the templates directory, or a file opened with
+// an fs provider, so downloads can be gated behind the checks of a template:
+//
+//	{{if not .User}}{{.Resp.ReturnStatus 403}}{{end}}
+//	{{.Resp.SetHeader "Content-Disposition" "attachment"}}
+//	{{serveFile (.Files.Open (print "reports/" (.Req.PathValue "id") ".pdf"))}}
+//
+// The content type is derived from the file extension unless the
+// Content-Type header is set, and range and conditional requests are
+// supported like for static files.
+func (x *Instance) serveFile(file any) (string, error) {
+	var f fs.File
+	switch v := file.(type) {
+	case string:
+		var err error
+		if f, err = x.config.TemplatesFS.Open(path.Clean(v)); err != nil {
+			return "", fmt.Errorf("serveFile: %w", err)
+		}
+	case fs.File:
+		f = v
+	default:
+		return "", fmt.Errorf("serveFile: expected a path or a file, got %T", file)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return "", fmt.Errorf("serveFile: %w", err)
+	}
+	if stat.IsDir() {
+		f.Close()
+		return "", fmt.Errorf("serveFile: '%s' is a directory", stat.Name())
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return "", fmt.Errorf("serveFile: %w", err)
+		}
+		content = bytes.NewReader(b)
+	}
+	return "", serveReturn{name: stat.Name(), modtime: stat.ModTime(), content: content, closer: f}
+}
+
+// serveBytes stops executing the template and responds with data of
+// contentType instead of the template output, with the headers set with .Resp
+// so far. Use it to respond with generated images, archives, and other
+// binary content that must not be escaped or minified:
+//
+//	{{serveBytes (.DB.QueryVal "SELECT image FROM avatars WHERE id = ?" (.Req.PathValue "id")) "image/png"}}
+//
+// If contentType is empty, it's detected from the data.
+func FuncServeBytes(data any, contentType string) (string, error) {
+	var b []byte
+	switch v := data.(type) {
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return "", fmt.Errorf("serveBytes: expected bytes or a string, got %T", data)
+	}
+	return "", serveReturn{contentType: contentType, content: bytes.NewReader(b)}
+}
+
+// serveReturn stops template execution like ReturnError and responds with
+// content instead of the output, see serveFile and FuncServeBytes.
+type serveReturn struct {
+	name        string
+	modtime     time.Time
+	contentType string
+	content     io.ReadSeeker
+	closer      io.Closer
+}
+
+func (serveReturn) Error() string { return "served" }
+func (serveReturn) Unwrap() error { return ReturnError{} }
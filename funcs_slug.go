@@ -0,0 +1,92 @@
+package xtemplate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// transliterations maps letters that don't decompose into an ascii base letter
+// with combining marks to an ascii approximation.
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "ae", 'ø': "o", 'Ø': "o", 'œ': "oe", 'Œ': "oe",
+	'đ': "d", 'Đ': "d", 'ð': "d", 'Ð': "d", 'þ': "th", 'Þ': "th", 'ł': "l",
+	'Ł': "l", 'ı': "i", 'ħ': "h", 'Ħ': "h", 'ŋ': "n", 'Ŋ': "n", '&': "and",
+}
+
+// slugify converts s into a url slug by transliterating letters to ascii,
+// lowercasing, and replacing runs of other characters with a separator, which
+// defaults to "-". Letters that cannot be transliterated are kept as-is. For
+// example:
+//
+//	{{slugify "Crème Brûlée & Straße"}} => creme-brulee-and-strasse
+//	{{slugify "Hello World" "_"}} => hello_world
+func FuncSlugify(s string, separator ...string) (string, error) {
+	sep := "-"
+	switch len(separator) {
+	case 0:
+	case 1:
+		sep = separator[0]
+	default:
+		return "", fmt.Errorf("slugify: too many arguments")
+	}
+	var b strings.Builder
+	pending := false
+	for _, r := range norm.NFKD.String(s) {
+		if unicode.Is(unicode.Mn, r) {
+			continue // drop combining marks left by decomposition
+		}
+		var out string
+		if t, ok := transliterations[r]; ok {
+			out = t
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			out = string(unicode.ToLower(r))
+		} else {
+			pending = b.Len() > 0
+			continue
+		}
+		if pending {
+			b.WriteString(sep)
+			pending = false
+		}
+		b.WriteString(out)
+	}
+	return b.String(), nil
+}
+
+// uniqueSlug returns slug if it is not in existing, otherwise it appends the
+// lowest number starting at 2 that makes it unique, like "my-post-2". existing
+// may be a list or a map with string keys. For example:
+//
+//	{{uniqueSlug "my-post" (list "my-post" "my-post-2")}} => my-post-3
+func FuncUniqueSlug(slug string, existing any) (string, error) {
+	taken := map[string]bool{}
+	if existing != nil {
+		v := reflect.ValueOf(existing)
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := range v.Len() {
+				taken[fmt.Sprint(v.Index(i).Interface())] = true
+			}
+		case reflect.Map:
+			for _, k := range v.MapKeys() {
+				taken[fmt.Sprint(k.Interface())] = true
+			}
+		default:
+			return "", fmt.Errorf("uniqueSlug: expected a list or map of existing slugs, got %T", existing)
+		}
+	}
+	if !taken[slug] {
+		return slug, nil
+	}
+	for i := 2; ; i++ {
+		candidate := slug + "-" + strconv.Itoa(i)
+		if !taken[candidate] {
+			return candidate, nil
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package xtemplate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SQLQuery is a sql statement with positional `?` parameters and their
+// arguments that can be composed safely in templates, then passed to the
+// statement executing methods of [DotDB] in place of a query string. Create
+// one with the sql, sqlIn, or sqlNamed funcs. For example:
+//
+//	{{$q := sql "SELECT id,name FROM contacts"}}
+//	{{with .Req.URL.Query.Get "q"}}{{$q = $q.Where "name LIKE ?" (printf "%%%s%%" .)}}{{end}}
+//	{{with index .Req.URL.Query "tag"}}{{$q = $q.Where "tag IN ?" (sqlIn .)}}{{end}}
+//	{{$q = $q.OrderBy (.Req.URL.Query.Get "sort") "asc" "name" "created_at"}}
+//	{{range .DB.QueryRows $q}}...{{end}}
+//
+// Values are always bound as parameters. Identifiers like column names can't
+// be parameters, so methods that accept them only allow a fixed list.
+type SQLQuery struct {
+	query  string
+	args   []any
+	where  []*SQLQuery
+	order  string
+	limit  int
+	offset int
+}
+
+// sql creates a [SQLQuery] from a query with `?` parameters and the args to
+// bind to them. Args may also be other SQLQuery fragments like the result of
+// sqlIn, which are spliced in place of their placeholder.
+func FuncSQL(query string, args ...any) (*SQLQuery, error) {
+	q, a, err := spliceSQL(query, args)
+	if err != nil {
+		return nil, fmt.Errorf("sql: %w", err)
+	}
+	return &SQLQuery{query: q, args: a, limit: -1}, nil
+}
+
+// sqlIn creates a [SQLQuery] fragment like `(?,?,?)` with one parameter for
+// each item in values, for use with the IN operator.
+func FuncSQLIn(values any) (*SQLQuery, error) {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("sqlIn: expected a list, got %T", values)
+	}
+	if v.Len() == 0 {
+		// `IN (NULL)` is valid sql that never matches
+		return &SQLQuery{query: "(NULL)", limit: -1}, nil
+	}
+	args := make([]any, v.Len())
+	for i := range args {
+		args[i] = v.Index(i).Interface()
+	}
+	return &SQLQuery{query: "(" + strings.Repeat("?,", len(args)-1) + "?)", args: args, limit: -1}, nil
+}
+
+var namedParam = regexp.MustCompile(`'(?:[^']|'')*'|::|:[A-Za-z_][A-Za-z0-9_]*`)
+
+// sqlNamed creates a [SQLQuery] from a query with `:name` parameters and a
+// map of values to bind to them. For example:
+//
+//	{{.DB.Exec (sqlNamed "UPDATE contacts SET name=:name WHERE id=:id" (dict "id" 1 "name" "Ann"))}}
+func FuncSQLNamed(query string, params map[string]any) (*SQLQuery, error) {
+	var args []any
+	var missing []string
+	query = namedParam.ReplaceAllStringFunc(query, func(m string) string {
+		if m[0] == '\'' || m == "::" {
+			return m // string literal or postgres cast
+		}
+		v, ok := params[m[1:]]
+		if !ok {
+			missing = append(missing, m[1:])
+		}
+		args = append(args, v)
+		return "?"
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("sqlNamed: missing parameters: %s", strings.Join(missing, ", "))
+	}
+	return FuncSQL(query, args...)
+}
+
+// spliceSQL replaces `?` placeholders whose arg is a *SQLQuery with the
+// fragment's sql and args.
+func spliceSQL(query string, args []any) (string, []any, error) {
+	if !slices.ContainsFunc(args, func(a any) bool { _, ok := a.(*SQLQuery); return ok }) {
+		return query, args, nil
+	}
+	var b strings.Builder
+	var out []any
+	i := 0
+	inString := false
+	for _, c := range query {
+		switch {
+		case c == '\'':
+			inString = !inString
+		case c == '?' && !inString:
+			if i >= len(args) {
+				return "", nil, fmt.Errorf("more placeholders than args")
+			}
+			if frag, ok := args[i].(*SQLQuery); ok {
+				fq, fa := frag.Build()
+				b.WriteString(fq)
+				out = append(out, fa...)
+				i++
+				continue
+			}
+			out = append(out, args[i])
+			i++
+		}
+		b.WriteRune(c)
+	}
+	if i != len(args) {
+		return "", nil, fmt.Errorf("got %d args for %d placeholders", len(args), i)
+	}
+	return b.String(), out, nil
+}
+
+func (q *SQLQuery) clone() *SQLQuery {
+	c := *q
+	c.args = slices.Clip(c.args)
+	c.where = slices.Clip(c.where)
+	return &c
+}
+
+// Where returns a copy of the query with an additional condition joined to
+// the others with AND. Like sql, args may include fragments. If cond is blank
+// the query is returned unchanged.
+func (q *SQLQuery) Where(cond string, args ...any) (*SQLQuery, error) {
+	if strings.TrimSpace(cond) == "" {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("where: unexpected args without a condition")
+		}
+		return q, nil
+	}
+	w, err := FuncSQL(cond, args...)
+	if err != nil {
+		return nil, fmt.Errorf("where: %w", err)
+	}
+	c := q.clone()
+	c.where = append(c.where, w)
+	return c, nil
+}
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// OrderBy returns a copy of the query ordered by column, which must be one of
+// allowed, in direction "asc" or "desc". If column is empty the query is
+// returned unchanged, so it can be used directly with a query parameter.
+func (q *SQLQuery) OrderBy(column, direction string, allowed ...string) (*SQLQuery, error) {
+	if column == "" {
+		return q, nil
+	}
+	if !slices.Contains(allowed, column) || !sqlIdentifier.MatchString(column) {
+		return nil, fmt.Errorf("orderBy: column not allowed: '%s'", column)
+	}
+	direction = strings.ToUpper(direction)
+	if direction != "ASC" && direction != "DESC" {
+		return nil, fmt.Errorf("orderBy: invalid direction: '%s'", direction)
+	}
+	c := q.clone()
+	if c.order != "" {
+		c.order += ", "
+	}
+	c.order += column + " " + direction
+	return c, nil
+}
+
+// Limit returns a copy of the query with a LIMIT clause.
+func (q *SQLQuery) Limit(n int) *SQLQuery {
+	c := q.clone()
+	c.limit = n
+	return c
+}
+
+// Offset returns a copy of the query with an OFFSET clause. Some databases
+// like sqlite require Limit to be set to use Offset.
+func (q *SQLQuery) Offset(n int) *SQLQuery {
+	c := q.clone()
+	c.offset = n
+	return c
+}
+
+// Build returns the final sql and args.
+func (q *SQLQuery) Build() (string, []any) {
+	if len(q.where) == 0 && q.order == "" && q.limit < 0 && q.offset == 0 {
+		return q.query, q.args
+	}
+	var b strings.Builder
+	args := slices.Clone(q.args)
+	b.WriteString(q.query)
+	for i, w := range q.where {
+		if i == 0 {
+			b.WriteString(" WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		b.WriteString("(" + w.query + ")")
+		args = append(args, w.args...)
+	}
+	if q.order != "" {
+		b.WriteString(" ORDER BY " + q.order)
+	}
+	if q.limit >= 0 {
+		b.WriteString(" LIMIT ?")
+		args = append(args, q.limit)
+	}
+	if q.offset > 0 {
+		b.WriteString(" OFFSET ?")
+		args = append(args, q.offset)
+	}
+	return b.String(), args
+}
+
+// String returns the sql of the query.
+func (q *SQLQuery) String() string {
+	s, _ := q.Build()
+	return s
+}
+
+// Args returns the args of the query.
+func (q *SQLQuery) Args() []any {
+	_, args := q.Build()
+	return args
+}
+
+// sqlArgs accepts either a query string with params or a *SQLQuery.
+func sqlArgs(query any, params []any) (string, []any, error) {
+	switch q := query.(type) {
+	case string:
+		return spliceSQL(q, params)
+	case *SQLQuery:
+		if len(params) > 0 {
+			return "", nil, fmt.Errorf("unexpected params with a prepared sql query")
+		}
+		s, args := q.Build()
+		return s, args, nil
+	default:
+		return "", nil, fmt.Errorf("expected a query string or sql query, got %T", query)
+	}
+}
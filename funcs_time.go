@@ -0,0 +1,65 @@
+package xtemplate
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+var locationCache sync.Map
+
+// loadLocation is like time.LoadLocation but caches loaded locations.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locationCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locationCache.Store(name, loc)
+	return loc, nil
+}
+
+func toLocation(zone any) (*time.Location, error) {
+	switch z := zone.(type) {
+	case *time.Location:
+		return z, nil
+	case string:
+		return loadLocation(z)
+	default:
+		return nil, fmt.Errorf("expected timezone name or location, got %T", zone)
+	}
+}
+
+// inZone converts t to the timezone zone, which may be an IANA zone name like
+// "America/New_York" or a location like .Req.Location. t may be a time.Time,
+// a unix timestamp, or a string in a common date format. For example:
+//
+//	{{(inZone "Europe/Paris" .row.created_at).Format "15:04"}}
+func FuncInZone(zone any, t any) (time.Time, error) {
+	loc, err := toLocation(zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("inZone: %w", err)
+	}
+	tm, err := cast.ToTimeE(t)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("inZone: %w", err)
+	}
+	return tm.In(loc), nil
+}
+
+// parseInZone parses value with the Go time layout, interpreting times without
+// an explicit offset in the timezone zone. For example, to interpret a
+// datetime-local form input in the user's timezone:
+//
+//	{{parseInZone .Req.Location "2006-01-02T15:04" (.Req.FormValue "when")}}
+func FuncParseInZone(zone any, layout, value string) (time.Time, error) {
+	loc, err := toLocation(zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parseInZone: %w", err)
+	}
+	return time.ParseInLocation(layout, value, loc)
+}
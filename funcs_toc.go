@@ -0,0 +1,128 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// TOCEntry is a heading in a table of contents. See [FuncToc].
+type TOCEntry struct {
+	Level    int
+	ID       string
+	Title    string
+	Children []*TOCEntry
+}
+
+// TOC is a table of contents extracted from html.
+type TOC struct {
+	Entries []*TOCEntry
+}
+
+// HTML renders the table of contents as nested lists of links to each
+// heading's anchor. Headings without an id are rendered without a link.
+func (t *TOC) HTML() template.HTML {
+	var buf strings.Builder
+	var render func([]*TOCEntry)
+	render = func(entries []*TOCEntry) {
+		if len(entries) == 0 {
+			return
+		}
+		buf.WriteString("<ul>")
+		for _, e := range entries {
+			buf.WriteString("<li>")
+			if e.ID != "" {
+				fmt.Fprintf(&buf, `<a href="#%s">%s</a>`, html.EscapeString(e.ID), html.EscapeString(e.Title))
+			} else {
+				buf.WriteString(html.EscapeString(e.Title))
+			}
+			render(e.Children)
+			buf.WriteString("</li>")
+		}
+		buf.WriteString("</ul>")
+	}
+	render(t.Entries)
+	return template.HTML(buf.String())
+}
+
+// toc extracts a nested outline of the h1-h6 headings in rendered html, for
+// example the output of the markdown func. Headings are nested under the
+// closest preceding heading with a lower level. For example:
+//
+//	{{$html := markdown .content}}
+//	<nav>{{(toc $html).HTML}}</nav>
+//	<article>{{$html}}</article>
+func FuncToc(input any) (*TOC, error) {
+	var content string
+	switch v := input.(type) {
+	case string:
+		content = v
+	case template.HTML:
+		content = string(v)
+	default:
+		return nil, fmt.Errorf("toc: expected html or string, got %T", input)
+	}
+
+	toc := &TOC{}
+	var stack []*TOCEntry
+	var current *TOCEntry
+	var title bytes.Buffer
+	z := html.NewTokenizer(strings.NewReader(content))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, fmt.Errorf("toc: failed to parse html: %w", err)
+			}
+			return toc, nil
+		case html.StartTagToken:
+			name, hasAttr := z.TagName()
+			level := headingLevel(name)
+			if level == 0 || current != nil {
+				continue
+			}
+			current = &TOCEntry{Level: level}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if string(key) == "id" {
+					current.ID = string(val)
+				}
+			}
+			title.Reset()
+		case html.TextToken:
+			if current != nil {
+				title.Write(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if current == nil || headingLevel(name) != current.Level {
+				continue
+			}
+			current.Title = strings.Join(strings.Fields(title.String()), " ")
+			for len(stack) > 0 && stack[len(stack)-1].Level >= current.Level {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				toc.Entries = append(toc.Entries, current)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, current)
+			}
+			stack = append(stack, current)
+			current = nil
+		}
+	}
+}
+
+func headingLevel(tag []byte) int {
+	if len(tag) == 2 && tag[0] == 'h' && tag[1] >= '1' && tag[1] <= '6' {
+		return int(tag[1] - '0')
+	}
+	return 0
+}
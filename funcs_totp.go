@@ -0,0 +1,106 @@
+package xtemplate
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpSecret generates a random base32 encoded secret for time-based one-time
+// passwords (RFC 6238). The secret should be stored for the user and shown to
+// them once with totpURI.
+func FuncTOTPSecret() (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("totpSecret: %w", err)
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// totpURI returns an `otpauth://` provisioning uri for secret that
+// authenticator apps can import, usually by scanning it as a QR code. For
+// example:
+//
+//	{{totpURI $secret "ann@example.com" "My Site"}}
+func FuncTOTPURI(secret, account, issuer string) string {
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// totpCode returns the current code for secret.
+func FuncTOTPCode(secret string) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", fmt.Errorf("totpCode: %w", err)
+	}
+	return totpAt(key, time.Now().Unix()/totpPeriod), nil
+}
+
+// totpVerify returns true if code is valid for secret at the current time,
+// also accepting codes from window periods before and after now to allow for
+// clock drift. window defaults to 1, that is 30 seconds either way.
+func FuncTOTPVerify(secret, code string, window ...int) (bool, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return false, fmt.Errorf("totpVerify: %w", err)
+	}
+	w := 1
+	if len(window) > 0 {
+		w = max(window[0], 0)
+	}
+	code = strings.ReplaceAll(code, " ", "")
+	counter := time.Now().Unix() / totpPeriod
+	valid := false
+	for i := -w; i <= w; i++ {
+		if subtle.ConstantTimeCompare([]byte(totpAt(key, counter+int64(i))), []byte(code)) == 1 {
+			valid = true
+		}
+	}
+	return valid, nil
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	key, err := totpEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base32 secret: %w", err)
+	}
+	return key, nil
+}
+
+// totpAt computes the HOTP value (RFC 4226) of key for counter.
+func totpAt(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
@@ -0,0 +1,77 @@
+package xtemplate
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+// parseURLArg accepts a string, url.URL, or *url.URL, and returns a copy of
+// it that can be modified safely.
+func parseURLArg(u any) (*url.URL, error) {
+	switch v := u.(type) {
+	case string:
+		return url.Parse(v)
+	case *url.URL:
+		if v == nil {
+			return &url.URL{}, nil
+		}
+		c := *v
+		return &c, nil
+	case url.URL:
+		return &v, nil
+	default:
+		return nil, fmt.Errorf("expected a url or string, got %T", u)
+	}
+}
+
+// setQuery returns the url with the query parameter name set to value,
+// replacing any existing values and preserving other parameters. u may be a
+// string or a *url.URL like .Req.URL. For example:
+//
+//	<a href="{{setQuery .Req.URL "sort" "name"}}">Sort by name</a>
+func FuncSetQuery(u any, name, value string) (string, error) {
+	return modifyQuery(u, func(q url.Values) { q.Set(name, value) })
+}
+
+// delQuery returns the url with the named query parameters removed.
+func FuncDelQuery(u any, names ...string) (string, error) {
+	return modifyQuery(u, func(q url.Values) {
+		for _, name := range names {
+			q.Del(name)
+		}
+	})
+}
+
+// toggleQuery returns the url with value removed from the query parameter
+// name if it is present, or added to it if it is not. Other values of the
+// parameter are preserved, which makes it suitable for multi-select filter
+// links. For example:
+//
+//	<a href="{{toggleQuery .Req.URL "tag" "go"}}">go</a>
+func FuncToggleQuery(u any, name, value string) (string, error) {
+	return modifyQuery(u, func(q url.Values) {
+		values := q[name]
+		if i := slices.Index(values, value); i >= 0 {
+			values = slices.Delete(values, i, i+1)
+		} else {
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			q.Del(name)
+		} else {
+			q[name] = values
+		}
+	})
+}
+
+func modifyQuery(u any, fn func(url.Values)) (string, error) {
+	parsed, err := parseURLArg(u)
+	if err != nil {
+		return "", err
+	}
+	q := parsed.Query()
+	fn(q)
+	parsed.RawQuery = q.Encode()
+	return parsed.String(), nil
+}
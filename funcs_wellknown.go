@@ -0,0 +1,173 @@
+package xtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// Helpers for identity documents commonly served from /.well-known/. Serve them
+// from template files with ServeContent so the output isn't escaped or
+// minified, for example templates/.well-known/nodeinfo.html:
+//
+//	{{.Resp.SetHeader "Content-Type" "application/json"}}
+//	{{.Resp.ServeContent "nodeinfo.json" .Req.Now (nodeinfoLinks "https://example.com")}}
+//
+// A /.well-known/change-password template only needs to redirect:
+//
+//	{{.Resp.Redirect "/account/password"}}
+
+// vcard renders a vCard 4.0 for the person or organization described by the
+// map card, with the keys name (required), given, family, nickname, org,
+// title, email, tel, url, photo, bday, note, and uid. email, tel, and url may
+// be a single value or a list. For example:
+//
+//	{{.Resp.SetHeader "Content-Type" "text/vcard; charset=utf-8"}}
+//	{{.Resp.ServeContent "me.vcf" .Req.Now (vcard (dict "name" "Ada Lovelace" "email" "ada@example.com" "url" "https://example.com"))}}
+func FuncVCard(card map[string]any) (string, error) {
+	str := func(key string) string {
+		if card[key] == nil {
+			return ""
+		}
+		return cast.ToString(card[key])
+	}
+	name := str("name")
+	if name == "" {
+		return "", fmt.Errorf("vcard: name is required")
+	}
+
+	var b icalBuilder
+	b.line("BEGIN:VCARD")
+	b.line("VERSION:4.0")
+	b.line("FN:" + FuncICalEscape(name))
+	if family, given := str("family"), str("given"); family != "" || given != "" {
+		b.line("N:" + FuncICalEscape(family) + ";" + FuncICalEscape(given) + ";;;")
+	}
+	for _, prop := range []struct{ name, key string }{
+		{"NICKNAME", "nickname"}, {"ORG", "org"}, {"TITLE", "title"}, {"NOTE", "note"},
+	} {
+		if v := str(prop.key); v != "" {
+			b.line(prop.name + ":" + FuncICalEscape(v))
+		}
+	}
+	for _, prop := range []struct{ name, key, prefix string }{
+		{"EMAIL", "email", ""}, {"TEL", "tel", "tel:"}, {"URL", "url", ""},
+	} {
+		values, err := stringList(card[prop.key])
+		if err != nil {
+			return "", fmt.Errorf("vcard: %s must be a string or a list: %w", prop.key, err)
+		}
+		for _, v := range values {
+			if prop.name == "TEL" {
+				b.line("TEL;VALUE=uri:" + prop.prefix + strings.ReplaceAll(v, " ", "-"))
+			} else {
+				b.line(prop.name + ":" + FuncICalEscape(v))
+			}
+		}
+	}
+	for _, prop := range []struct{ name, key string }{{"PHOTO", "photo"}, {"BDAY", "bday"}, {"UID", "uid"}} {
+		if v := str(prop.key); v != "" {
+			if strings.ContainsAny(v, "\r\n") {
+				return "", fmt.Errorf("vcard: %s must not contain newlines", prop.key)
+			}
+			b.line(prop.name + ":" + v)
+		}
+	}
+	b.line("END:VCARD")
+	return b.String(), nil
+}
+
+// stringList converts a single string or a list of values to a list of
+// strings. Unlike cast.ToStringSlice it doesn't split strings on whitespace.
+func stringList(v any) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	}
+	return cast.ToStringSliceE(v)
+}
+
+// nodeinfoLinks renders the /.well-known/nodeinfo discovery document that
+// points to a NodeInfo 2.1 document at {baseURL}/nodeinfo/2.1.
+func FuncNodeinfoLinks(baseURL string) (string, error) {
+	doc := map[string]any{"links": []map[string]string{{
+		"rel":  "http://nodeinfo.diaspora.software/ns/schema/2.1",
+		"href": strings.TrimSuffix(baseURL, "/") + "/nodeinfo/2.1",
+	}}}
+	content, err := json.Marshal(doc)
+	return string(content), err
+}
+
+// nodeinfo renders a NodeInfo 2.1 document that describes the site to the
+// fediverse, from a map with the keys name, version, protocols (default
+// none), users (total user count), posts (local post count),
+// open_registrations, and metadata:
+//
+//	{{nodeinfo (dict "name" "myblog" "version" "1.0" "users" 1 "posts" $count)}}
+func FuncNodeinfo(info map[string]any) (string, error) {
+	name := cast.ToString(info["name"])
+	if name == "" {
+		return "", fmt.Errorf("nodeinfo: name is required")
+	}
+	protocols, err := stringList(info["protocols"])
+	if err != nil {
+		return "", fmt.Errorf("nodeinfo: protocols must be a list: %w", err)
+	}
+	if protocols == nil {
+		protocols = []string{}
+	}
+	metadata := map[string]any{}
+	if info["metadata"] != nil {
+		if metadata, err = cast.ToStringMapE(info["metadata"]); err != nil {
+			return "", fmt.Errorf("nodeinfo: metadata must be a map: %w", err)
+		}
+	}
+	usage := map[string]any{"users": map[string]any{}}
+	if info["users"] != nil {
+		usage["users"] = map[string]any{"total": cast.ToInt(info["users"])}
+	}
+	if info["posts"] != nil {
+		usage["localPosts"] = cast.ToInt(info["posts"])
+	}
+	doc := map[string]any{
+		"version":           "2.1",
+		"software":          map[string]any{"name": strings.ToLower(name), "version": cast.ToString(info["version"])},
+		"protocols":         protocols,
+		"services":          map[string]any{"inbound": []string{}, "outbound": []string{}},
+		"openRegistrations": cast.ToBool(info["open_registrations"]),
+		"usage":             usage,
+		"metadata":          metadata,
+	}
+	content, err := json.Marshal(doc)
+	return string(content), err
+}
+
+// webfinger renders a WebFinger document from a map with the keys subject,
+// aliases, and links like [WebFingerConfig], to answer lookups of many
+// accounts from a template instead of a single configured one:
+//
+//	{{$user := .DB.QueryRow "SELECT name FROM users WHERE acct = ?" (.Req.URL.Query.Get "resource")}}
+//	{{.Resp.SetHeader "Content-Type" "application/jrd+json"}}
+//	{{.Resp.ServeContent "webfinger.json" .Req.Now (webfinger (dict "subject" (.Req.URL.Query.Get "resource") "links" (list (dict "rel" "self" "type" "application/activity+json" "href" (print "https://example.com/users/" $user.name)))))}}
+func FuncWebfinger(doc map[string]any) (string, error) {
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("webfinger: %w", err)
+	}
+	var config WebFingerConfig
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", fmt.Errorf("webfinger: invalid document: %w", err)
+	}
+	if config.Subject == "" {
+		return "", fmt.Errorf("webfinger: subject is required")
+	}
+	if config.Links == nil {
+		config.Links = []WebFingerLink{}
+	}
+	content, err = json.Marshal(config)
+	return string(content), err
+}
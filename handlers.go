@@ -4,6 +4,8 @@ package xtemplate
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -27,9 +29,29 @@ func bufferingTemplateHandler(server *Instance, tmpl *template.Template) http.Ha
 	return func(w http.ResponseWriter, r *http.Request) {
 		log := GetLogger(r.Context())
 
+		// error pages are rendered with the original request so they aren't
+		// affected by an expired deadline
+		orig := r
+		limits := server.limits(r)
+		if limits.timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), limits.timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		var body *limitedBody
+		if limits.maxRequestBody > 0 && r.Body != nil {
+			if r.ContentLength > limits.maxRequestBody {
+				server.serveRequestError(w, r, &RequestError{Status: http.StatusRequestEntityTooLarge, Reason: "request body too large"})
+				return
+			}
+			body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limits.maxRequestBody)}
+			r.Body = body
+		}
+
 		dot, err := server.bufferDot.value(server.config.Ctx, w, r)
 		if err != nil {
 			log.Error("failed to initialize dot value", slog.Any("error", err))
+			reportExecuteError(r.Context(), err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -38,11 +60,121 @@ func bufferingTemplateHandler(server *Instance, tmpl *template.Template) http.Ha
 		buf.Reset()
 		defer bufPool.Put(buf)
 
-		err = tmpl.Execute(buf, *dot)
+		page, layout := tmpl, server.layout(r)
+		err = page.Execute(limitedBuffer{buf, limits.maxBuffer, r.Context()}, *dot)
+		for forwards := 0; ; forwards++ {
+			var forward forwardReturn
+			if !errors.As(err, &forward) {
+				break
+			}
+			if forwards == maxForwards {
+				err = fmt.Errorf("request was forwarded more than %d times", maxForwards)
+				break
+			}
+			log.Debug("forwarding request", slog.String("from", page.Name()), slog.String("to", forward.tmpl.Name()))
+			page, layout = forward.tmpl, server.forwardLayout(forward.tmpl.Name())
+			dot.FieldByName("Vars").Interface().(DotVars)["forward"] = forward.data
+			buf.Reset()
+			err = page.Execute(limitedBuffer{buf, limits.maxBuffer, r.Context()}, *dot)
+		}
+		if body != nil && body.err != nil {
+			// fail even if the template ignored the error
+			err = errors.Join(body.err, err)
+		}
+
+		if err == nil && layout != nil {
+			// second pass, see metaLayout
+			dot.FieldByName("Resp").Addr().Interface().(*DotResp).body = template.HTML(buf.String())
+			buf.Reset()
+			err = layout.Execute(limitedBuffer{buf, limits.maxBuffer, r.Context()}, *dot)
+		}
+
+		var halt haltReturn
+		halted := errors.As(err, &halt)
+		if halted {
+			if halt.discard {
+				buf.Reset()
+			}
+			if halt.status != 0 {
+				dot.FieldByName("Resp").Addr().Interface().(*DotResp).status = halt.status
+			}
+		}
+
+		var serve serveReturn
+		if errors.As(err, &serve) {
+			resp := dot.FieldByName("Resp").Addr().Interface().(*DotResp)
+			if serve.contentType != "" {
+				resp.Header.Set("Content-Type", serve.contentType)
+			}
+			_, err = resp.ServeContent(serve.name, serve.modtime, serve.content)
+			if serve.closer != nil {
+				serve.closer.Close()
+			}
+		}
+		if dot.FieldByName("Resp").Interface().(DotResp).served {
+			// the output is discarded since the response was already written
+			if err = server.bufferDot.cleanup(dot, err); err != nil {
+				server.errorLog.log(r.Context(), log, slog.LevelWarn, "error executing template", server.templateError(err))
+			}
+			return
+		}
+
+		var fragment fragmentReturn
+		if errors.As(err, &fragment) {
+			buf.Reset()
+			buf.WriteString(string(fragment.body))
+			err = nil
+			// fragments usually don't start with a tag that content sniffing
+			// recognizes as html
+			if header := dot.FieldByName("Resp").Interface().(DotResp).Header; header.Get("Content-Type") == "" {
+				header.Set("Content-Type", "text/html; charset=utf-8")
+			}
+		}
+
+		if err == nil {
+			for _, oob := range dot.FieldByName("Resp").Interface().(DotResp).oob {
+				buf.WriteString(oob)
+			}
+		}
+
+		// halted output is sent as is, so it's rewritten too
+		if (err == nil || halted) && len(server.config.OutputRewriters) > 0 {
+			// rewriters see headers set by the template, which are copied to the
+			// response writer during cleanup
+			header := dot.FieldByName("Resp").Interface().(DotResp).Header
+			if body, rerr := rewriteOutput(server.config.OutputRewriters, r, header, buf.Bytes()); rerr != nil {
+				err = rerr
+			} else {
+				buf.Reset()
+				buf.Write(body)
+			}
+		}
+
+		// halted output is usually incomplete html by design, so it isn't
+		// validated
+		if err == nil && server.config.ValidateHTML {
+			reportHTMLProblems(r, page.Name(), dot.FieldByName("Resp").Interface().(DotResp).Header, buf.Bytes())
+		}
 
 		if err = server.bufferDot.cleanup(dot, err); err != nil {
-			log.Warn("error executing template", slog.Any("error", err))
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			err = server.templateError(err)
+			server.errorLog.log(r.Context(), log, slog.LevelWarn, "error executing template", err)
+			reportExecuteError(r.Context(), err)
+			var errSt ErrorStatus
+			if errors.As(err, &errSt) {
+				// the status was already written by cleanup
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			reqErr := &RequestError{Status: http.StatusInternalServerError, Reason: "internal server error"}
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				reqErr.Status, reqErr.Reason = http.StatusRequestEntityTooLarge, "request body too large"
+			} else if errors.Is(err, context.DeadlineExceeded) {
+				reqErr.Status, reqErr.Reason = http.StatusServiceUnavailable, "request timed out"
+			}
+			errors.As(err, &reqErr.Template)
+			server.serveRequestError(w, orig, reqErr)
 			return
 		}
 
@@ -66,14 +198,17 @@ func flushingTemplateHandler(server *Instance, tmpl *template.Template) http.Han
 		dot, err := server.flusherDot.value(server.config.Ctx, w, r)
 		if err != nil {
 			log.Error("failed to initialize dot value", slog.Any("error", err))
+			reportExecuteError(r.Context(), err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		err = tmpl.Execute(w, *dot)
+		err = tmpl.Execute(flushWriter{dot.FieldByName("Flush").Interface().(*DotFlush)}, *dot)
 
 		if err = server.flusherDot.cleanup(dot, err); err != nil {
-			log.Info("error executing template", slog.Any("error", err))
+			err = server.templateError(err)
+			server.errorLog.log(r.Context(), log, slog.LevelInfo, "error executing template", err)
+			reportExecuteError(r.Context(), err)
 			http.Error(w, "internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -85,8 +220,9 @@ func staticFileHandler(fs fs.FS, fileinfo *fileInfo) http.HandlerFunc {
 		log := GetLogger(r.Context())
 
 		urlpath := path.Clean(r.URL.Path)
-		if urlpath != fileinfo.identityPath {
-			// should not happen; we only add handlers for existent files
+		if !strings.EqualFold(urlpath, fileinfo.identityPath) {
+			// should not happen; we only add handlers for existent files, and
+			// routers may match paths regardless of case
 			log.LogAttrs(r.Context(), slog.LevelWarn, "tried to serve a file that doesn't exist")
 			http.NotFound(w, r)
 			return
@@ -130,7 +266,11 @@ func staticFileHandler(fs fs.FS, fileinfo *fileInfo) http.HandlerFunc {
 			}
 		}
 
-		w.Header().Add("Etag", `"`+fileinfo.hash+`"`)
+		if fileinfo.weak {
+			w.Header().Add("Etag", `W/"`+fileinfo.hash+`"`)
+		} else {
+			w.Header().Add("Etag", `"`+fileinfo.hash+`"`)
+		}
 		w.Header().Add("Content-Type", fileinfo.contentType)
 		w.Header().Add("Content-Encoding", encoding.encoding)
 		w.Header().Add("Vary", "Accept-Encoding")
@@ -140,7 +280,19 @@ func staticFileHandler(fs fs.FS, fileinfo *fileInfo) http.HandlerFunc {
 			// should be `public` ???
 			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
 		}
-		http.ServeContent(w, r, encoding.path, encoding.modtime, file.(io.ReadSeeker))
+		// ServeContent passes *os.File content to the connection's ReadFrom,
+		// which uses sendfile where the platform supports it
+		content, ok := file.(io.ReadSeeker)
+		if !ok {
+			// stream files of FSs that can't seek, without range support
+			w.Header().Set("Content-Length", strconv.FormatInt(encoding.size, 10))
+			w.Header().Set("Last-Modified", encoding.modtime.UTC().Format(http.TimeFormat))
+			if r.Method != http.MethodHead {
+				io.Copy(w, file)
+			}
+			return
+		}
+		http.ServeContent(w, r, encoding.path, encoding.modtime, content)
 	}
 }
 
@@ -0,0 +1,171 @@
+package xtemplate
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// HeaderRule adds static response headers to requests for paths matching a
+// glob, for both template and static file routes. Headers set by templates
+// take precedence.
+//
+// The embedding fields control whether other sites can embed the paths, so
+// a site can be locked down with a rule for `/**` while a later rule lets
+// partners embed specific fragments:
+//
+//	[{"path": "/**", "frame_ancestors": ["'none'"], "corp": "same-origin"},
+//	 {"path": "/embed/**", "frame_ancestors": ["https://partner.example"], "corp": "cross-origin"}]
+type HeaderRule struct {
+	// A glob like in [AccessRule].
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+
+	// Sources that may embed the paths in frames, like `'none'`, `'self'`, or
+	// `https://partner.example`, sent as the frame-ancestors directive of the
+	// Content-Security-Policy header. X-Frame-Options is set to DENY or
+	// SAMEORIGIN for older browsers if the only source is `'none'` or `'self'`,
+	// and removed otherwise since it can't allow other origins.
+	FrameAncestors []string `json:"frame_ancestors,omitempty"`
+
+	// Value of the Cross-Origin-Resource-Policy header, like `same-origin` or
+	// `cross-origin`.
+	CORP string `json:"corp,omitempty"`
+
+	// Value of the Cross-Origin-Embedder-Policy header, like `require-corp`.
+	COEP string `json:"coep,omitempty"`
+
+	// Name of a Cache-Control preset, see [CachePresets]. Templates can
+	// choose a preset per response with .Resp.CachePreset. The preset only
+	// applies to GET and HEAD requests, and a public preset is removed from
+	// responses that set a cookie, so shared caches don't hand the cookie
+	// of one visitor to others.
+	Cache string `json:"cache,omitempty"`
+}
+
+// CachePresets are the Cache-Control headers selected by name with
+// [HeaderRule.Cache] and .Resp.CachePreset, so sites don't have to work out
+// the directives that browsers and CDNs agree on:
+//
+//   - `static-immutable` for files whose url changes with their content, like
+//     assets linked with .X.StaticFileHash. Cached for a year everywhere and
+//     never revalidated.
+//   - `html-swr` for public pages. Browsers revalidate on every request, while
+//     shared caches serve a copy for a minute and keep serving a stale copy
+//     for a day while they revalidate it in the background or if the origin
+//     fails.
+//   - `private-no-store` for pages that depend on the user, like account
+//     pages. Never stored by any cache, including the response cache.
+var CachePresets = map[string]string{
+	"static-immutable": "public, max-age=31536000, immutable",
+	"html-swr":         "public, max-age=0, s-maxage=60, stale-while-revalidate=86400, stale-if-error=86400",
+	"private-no-store": "private, no-store",
+}
+
+// checkHeaderRules returns an error if a rule names an unknown cache preset.
+func checkHeaderRules(rules []HeaderRule) error {
+	for _, rule := range rules {
+		if _, ok := CachePresets[rule.Cache]; rule.Cache != "" && !ok {
+			return fmt.Errorf("unknown cache preset '%s' in header rule for path '%s'", rule.Cache, rule.Path)
+		}
+	}
+	return nil
+}
+
+func WithHeaderRules(rules ...HeaderRule) Option {
+	return func(c *Config) error {
+		c.HeaderRules = append(c.HeaderRules, rules...)
+		return nil
+	}
+}
+
+// applyHeaderRules sets the headers of every rule that matches the request
+// on w, and returns the writer that the response must be written to.
+func applyHeaderRules(rules []HeaderRule, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	var cache string
+	for _, rule := range rules {
+		if !matchPath(rule.Path, rulePath(r)) {
+			continue
+		}
+		for k, v := range rule.Headers {
+			w.Header().Set(k, v)
+		}
+		if len(rule.FrameAncestors) > 0 {
+			setFrameAncestors(w.Header(), rule.FrameAncestors)
+		}
+		if rule.CORP != "" {
+			w.Header().Set("Cross-Origin-Resource-Policy", rule.CORP)
+		}
+		if rule.COEP != "" {
+			w.Header().Set("Cross-Origin-Embedder-Policy", rule.COEP)
+		}
+		if rule.Cache != "" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			cache = CachePresets[rule.Cache]
+			w.Header().Set("Cache-Control", cache)
+		}
+	}
+	if !strings.HasPrefix(cache, "public") {
+		return w
+	}
+	checked := false
+	check := func() {
+		if !checked {
+			checked = true
+			if w.Header().Get("Set-Cookie") != "" && w.Header().Get("Cache-Control") == cache {
+				w.Header().Del("Cache-Control")
+			}
+		}
+	}
+	return httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				check()
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				check()
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				check()
+				return next(src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				check()
+				next()
+			}
+		},
+	})
+}
+
+// setFrameAncestors replaces the frame-ancestors directive of the
+// Content-Security-Policy header and sets the matching X-Frame-Options.
+func setFrameAncestors(header http.Header, sources []string) {
+	directives := []string{}
+	for _, d := range strings.Split(header.Get("Content-Security-Policy"), ";") {
+		d = strings.TrimSpace(d)
+		if d != "" && !strings.HasPrefix(strings.ToLower(d), "frame-ancestors") {
+			directives = append(directives, d)
+		}
+	}
+	directives = append(directives, "frame-ancestors "+strings.Join(sources, " "))
+	header.Set("Content-Security-Policy", strings.Join(directives, "; "))
+
+	switch {
+	case len(sources) == 1 && sources[0] == "'none'":
+		header.Set("X-Frame-Options", "DENY")
+	case len(sources) == 1 && sources[0] == "'self'":
+		header.Set("X-Frame-Options", "SAMEORIGIN")
+	default:
+		header.Del("X-Frame-Options")
+	}
+}
@@ -0,0 +1,180 @@
+package xtemplate
+
+import (
+	"fmt"
+	"html/template"
+)
+
+// Helpers for htmx requests and responses. See https://htmx.org/reference/
+
+// Htmx reports whether the request was made by htmx, as indicated by the
+// HX-Request header.
+func (d DotReq) Htmx() bool {
+	return d.Header.Get("HX-Request") == "true"
+}
+
+// HxBoosted reports whether the request was made by an element using
+// hx-boost.
+func (d DotReq) HxBoosted() bool {
+	return d.Header.Get("HX-Boosted") == "true"
+}
+
+// HxTarget returns the id of the target element of the htmx request, if it
+// has one.
+func (d DotReq) HxTarget() string {
+	return d.Header.Get("HX-Target")
+}
+
+// HxTrigger returns the id of the element that triggered the htmx request, if
+// it has one.
+func (d DotReq) HxTrigger() string {
+	return d.Header.Get("HX-Trigger")
+}
+
+// HxTriggerName returns the name of the element that triggered the htmx
+// request, if it has one.
+func (d DotReq) HxTriggerName() string {
+	return d.Header.Get("HX-Trigger-Name")
+}
+
+// HxCurrentURL returns the url of the browser when the htmx request was made.
+func (d DotReq) HxCurrentURL() string {
+	return d.Header.Get("HX-Current-URL")
+}
+
+// HxPrompt returns the user's response to an hx-prompt.
+func (d DotReq) HxPrompt() string {
+	return d.Header.Get("HX-Prompt")
+}
+
+// HxLocation makes htmx load url without a full page reload. It returns an
+// empty string.
+func (h *DotResp) HxLocation(url string) string {
+	return h.SetHeader("HX-Location", url)
+}
+
+// HxPushURL makes htmx push url into the browser history. It returns an empty
+// string.
+func (h *DotResp) HxPushURL(url string) string {
+	return h.SetHeader("HX-Push-Url", url)
+}
+
+// HxReplaceURL makes htmx replace the current url in the browser location bar.
+// It returns an empty string.
+func (h *DotResp) HxReplaceURL(url string) string {
+	return h.SetHeader("HX-Replace-Url", url)
+}
+
+// HxRedirect makes htmx redirect the browser to url with a full page load. It
+// returns an empty string.
+func (h *DotResp) HxRedirect(url string) string {
+	return h.SetHeader("HX-Redirect", url)
+}
+
+// HxRefresh makes htmx do a full refresh of the page. It returns an empty
+// string.
+func (h *DotResp) HxRefresh() string {
+	return h.SetHeader("HX-Refresh", "true")
+}
+
+// HxReswap overrides how the response is swapped, like "outerHTML". It returns
+// an empty string.
+func (h *DotResp) HxReswap(swap string) string {
+	return h.SetHeader("HX-Reswap", swap)
+}
+
+// HxRetarget overrides the target element of the response with a css
+// selector. It returns an empty string.
+func (h *DotResp) HxRetarget(selector string) string {
+	return h.SetHeader("HX-Retarget", selector)
+}
+
+// HxReselect chooses which part of the response is swapped in with a css
+// selector. It returns an empty string.
+func (h *DotResp) HxReselect(selector string) string {
+	return h.SetHeader("HX-Reselect", selector)
+}
+
+// HxTrigger triggers a client side event as soon as the response is received.
+// It can be called multiple times to trigger multiple events. It returns an
+// empty string.
+func (h *DotResp) HxTrigger(event string) string {
+	return h.addHxTrigger("HX-Trigger", event)
+}
+
+// HxTriggerAfterSwap triggers a client side event after the response is
+// swapped in. It returns an empty string.
+func (h *DotResp) HxTriggerAfterSwap(event string) string {
+	return h.addHxTrigger("HX-Trigger-After-Swap", event)
+}
+
+// HxTriggerAfterSettle triggers a client side event after the response is
+// settled. It returns an empty string.
+func (h *DotResp) HxTriggerAfterSettle(event string) string {
+	return h.addHxTrigger("HX-Trigger-After-Settle", event)
+}
+
+func (h *DotResp) addHxTrigger(field, event string) string {
+	if prev := h.Header.Get(field); prev != "" {
+		event = prev + ", " + event
+	}
+	return h.SetHeader(field, event)
+}
+
+// fragmentReturn stops template execution like ReturnError and replaces the
+// response body with a rendered fragment.
+type fragmentReturn struct {
+	body template.HTML
+}
+
+func (fragmentReturn) Error() string { return "returned fragment" }
+func (fragmentReturn) Unwrap() error { return ReturnError{} }
+
+// Fragment invokes the template name with the given dot value and responds
+// with only its output, discarding anything rendered by the current template,
+// and stops execution. Use it to render one block of a page for htmx requests:
+//
+//	{{if .Req.Htmx}}{{.X.Fragment "results" .}}{{end}}
+//	<!DOCTYPE html>
+//	...
+//	{{block "results" .}}...{{end}}
+//
+// Since the same url responds with different content, consider setting the
+// "Vary: HX-Request" header. Fragment only works in buffered templates.
+func (c DotX) Fragment(name string, dot any) (string, error) {
+	body, err := c.Template(name, dot)
+	if err != nil {
+		return "", err
+	}
+	return "", fragmentReturn{body}
+}
+
+// SwapOOB adds content to the end of the response as an htmx out-of-band swap
+// into the element with the given id, so one response can update several
+// regions of the page. Call it once for each region, the swaps are emitted
+// after the rest of the response including any Fragment. The swap strategy
+// defaults to "innerHTML". Strings are escaped, render templates with
+// .X.Template:
+//
+//	{{.Resp.SwapOOB "cart-count" (.X.Template "cart-count" .)}}
+//	{{.Resp.SwapOOB "notifications" (.X.Template "notification" .) "beforeend"}}
+//
+// It returns an empty string.
+func (h *DotResp) SwapOOB(id string, content any, swap ...string) (string, error) {
+	if len(swap) > 1 {
+		return "", fmt.Errorf("too many swap arguments")
+	}
+	strategy := "innerHTML"
+	if len(swap) == 1 {
+		strategy = swap[0]
+	}
+	var body string
+	switch c := content.(type) {
+	case template.HTML:
+		body = string(c)
+	default:
+		body = template.HTMLEscapeString(fmt.Sprint(c))
+	}
+	h.oob = append(h.oob, fmt.Sprintf(`<div id="%s" hx-swap-oob="%s">%s</div>`, template.HTMLEscapeString(id), template.HTMLEscapeString(strategy), body))
+	return "", nil
+}
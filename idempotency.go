@@ -0,0 +1,281 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// IdempotencyConfig makes POST, PUT, PATCH, and DELETE requests with an
+// `Idempotency-Key` header safe to retry, like the submissions of payment or
+// order forms: the first response to a key is stored in a table of a
+// database provider and replayed for later requests with the same key until
+// TTL has passed, so a double submit or a client retry doesn't run the
+// handler twice. Replayed responses have the header `Idempotent-Replayed:
+// true`.
+//
+// Keys are scoped to the method, path, and query of the request and to the
+// credentials of the client in its Authorization, Cookie, and api key (see
+// [APIKeysConfig]) headers, so one client can't replay the response to
+// another. A request that reuses a key
+// with a different body is rejected with 422 Unprocessable Entity, and a
+// request whose key is still being handled with 409 Conflict. Server error
+// responses aren't stored, so the request can be retried, and Set-Cookie
+// headers aren't replayed.
+//
+// Forms can send a key generated when the form is rendered:
+//
+//	<form method="post" hx-headers='{"Idempotency-Key": "{{uuidv7}}"}'>
+type IdempotencyConfig struct {
+	// Name of the database provider that stores responses. Defaults to the
+	// first database.
+	Database string `json:"database,omitempty"`
+
+	// Name of the table that stores responses, which is created if it doesn't
+	// exist. Default `idempotency_keys`.
+	Table string `json:"table,omitempty"`
+
+	// How long a response is replayed. Default 24h.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// How long a key is held by a request that is still being handled, after
+	// which the request is assumed to have failed without a response, like
+	// when the server crashed, and the key can be retried. Default
+	// [Config.Timeout], or 1m if that isn't set.
+	InProgressTTL time.Duration `json:"in_progress_ttl,omitempty"`
+
+	// Globs like in [AccessRule] of the paths that accept idempotency keys.
+	// Default all paths.
+	Paths []string `json:"paths,omitempty"`
+
+	// Name of the request header that holds the key. Default
+	// `Idempotency-Key`.
+	Header string `json:"header,omitempty"`
+}
+
+func WithIdempotency(config IdempotencyConfig) Option {
+	return func(c *Config) error {
+		c.Idempotency = &config
+		return nil
+	}
+}
+
+// idempotencyBodyLimit is the maximum size of a request or response body
+// that is fingerprinted or stored. Larger requests are rejected, and larger
+// responses aren't stored.
+const idempotencyBodyLimit = 1 << 20
+
+type idempotency struct {
+	config IdempotencyConfig
+	db     *DotDBConfig
+}
+
+// addIdempotency creates the table in the configured database provider,
+// which must already be initialized, and removes expired keys every hour
+// until the instance is retired.
+func (b *builder) addIdempotency(dot []DotConfig) error {
+	i := &idempotency{config: *b.config.Idempotency}
+	if i.config.Table == "" {
+		i.config.Table = "idempotency_keys"
+	}
+	if i.config.TTL <= 0 {
+		i.config.TTL = 24 * time.Hour
+	}
+	if i.config.InProgressTTL <= 0 {
+		i.config.InProgressTTL = b.config.Timeout
+	}
+	if i.config.InProgressTTL <= 0 {
+		i.config.InProgressTTL = time.Minute
+	}
+	if i.config.Header == "" {
+		i.config.Header = "Idempotency-Key"
+	}
+	i.db = findDotDB(dot, i.config.Database)
+	if i.db == nil {
+		return fmt.Errorf("idempotency database provider not found: '%s'", i.config.Database)
+	}
+	if !sqlIdentifier.MatchString(i.config.Table) {
+		return fmt.Errorf("invalid idempotency table name: '%s'", i.config.Table)
+	}
+	_, err := i.db.DB.ExecContext(b.config.Ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id TEXT NOT NULL PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		header TEXT NOT NULL,
+		body TEXT,
+		expires TIMESTAMP NOT NULL
+	)`, i.config.Table))
+	if err != nil {
+		return fmt.Errorf("failed to create idempotency table: %w", err)
+	}
+	go i.expire(b.config.Ctx, b.config.Logger)
+	b.idempotency = i
+	return nil
+}
+
+func (i *idempotency) expire(ctx context.Context, log *slog.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := i.db.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires < ?", i.config.Table), time.Now().UTC()); err != nil {
+			log.Warn("failed to delete expired idempotency keys", slog.Any("error", err))
+		}
+	}
+}
+
+// wrap handles requests with an idempotency key with next only once per key.
+func (i *idempotency) wrap(instance *Instance, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(i.config.Header)
+		if key == "" || !slices.Contains([]string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}, r.Method) ||
+			(len(i.config.Paths) > 0 && !slices.ContainsFunc(i.config.Paths, func(glob string) bool { return matchPath(glob, rulePath(r)) })) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		log := GetLogger(r.Context()).With(slog.String("idempotency_key", key))
+		ctx := r.Context()
+		table := i.config.Table
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, idempotencyBodyLimit))
+		if err != nil {
+			instance.serveError(w, r, http.StatusRequestEntityTooLarge, "request body too large for an idempotent request")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		credentials := r.Header.Get("Authorization") + "\n" + strings.Join(r.Header.Values("Cookie"), "; ")
+		if instance.apiKeys != nil {
+			credentials += "\n" + r.Header.Get(instance.apiKeys.config.Header)
+		}
+		key = r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + " " + cacheHash(credentials) + " " + key
+		now := time.Now().UTC()
+
+		var stored struct {
+			fingerprint string
+			status      int
+			header      string
+			body        sql.NullString
+			expires     time.Time
+		}
+		err = i.db.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT fingerprint, status, header, body, expires FROM %s WHERE id = ?", table), key).
+			Scan(&stored.fingerprint, &stored.status, &stored.header, &stored.body, &stored.expires)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			log.Warn("failed to look up idempotency key", slog.Any("error", err))
+			instance.serveError(w, r, http.StatusInternalServerError, "internal server error")
+			return
+		case stored.expires.Before(now):
+			i.db.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = ? AND expires < ?", table), key, now)
+		case stored.fingerprint != fingerprint:
+			instance.serveError(w, r, http.StatusUnprocessableEntity, "idempotency key was used with a different request")
+			return
+		case stored.status == 0:
+			instance.serveError(w, r, http.StatusConflict, "a request with this idempotency key is in progress")
+			return
+		default:
+			log.Debug("replaying idempotent response", slog.Int("status", stored.status))
+			var header http.Header
+			json.Unmarshal([]byte(stored.header), &header)
+			instance.replayHeader(w, r, header)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.status)
+			io.WriteString(w, stored.body.String)
+			return
+		}
+
+		// claim the key, status 0 marks it as in progress until it expires
+		_, err = i.db.DB.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id, fingerprint, status, header, body, expires) VALUES (?, ?, 0, '', NULL, ?)", table), key, fingerprint, now.Add(i.config.InProgressTTL))
+		if err != nil {
+			// most likely a concurrent request inserted it first
+			instance.serveError(w, r, http.StatusConflict, "a request with this idempotency key is in progress")
+			return
+		}
+
+		status, respBody, complete := captureResponse(w, r, next, idempotencyBodyLimit)
+
+		if status >= 500 || !complete {
+			// let the client retry
+			_, err = i.db.DB.ExecContext(context.WithoutCancel(ctx), fmt.Sprintf("DELETE FROM %s WHERE id = ?", table), key)
+		} else {
+			stored := instance.storedHeader(w.Header())
+			stored.Del("Set-Cookie")
+			for _, h := range rateLimitHeaders {
+				stored.Del(h)
+			}
+			header, _ := json.Marshal(stored)
+			_, err = i.db.DB.ExecContext(context.WithoutCancel(ctx), fmt.Sprintf("UPDATE %s SET status = ?, header = ?, body = ?, expires = ? WHERE id = ?", table), status, string(header), string(respBody), time.Now().UTC().Add(i.config.TTL), key)
+		}
+		if err != nil {
+			log.Warn("failed to store idempotent response", slog.Any("error", err))
+		}
+	})
+}
+
+// captureResponse serves the request with next, and returns the status and
+// the body of the response if it's at most limit bytes long.
+func captureResponse(w http.ResponseWriter, r *http.Request, next http.Handler, limit int) (status int, body []byte, complete bool) {
+	var buf bytes.Buffer
+	complete = true
+	capture := writerFunc(func(b []byte) {
+		if complete && buf.Len()+len(b) <= limit {
+			buf.Write(b)
+		} else {
+			complete = false
+		}
+	})
+	next.ServeHTTP(httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if status == 0 {
+					status = code
+				}
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				capture(b)
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				return next(io.TeeReader(src, capture))
+			}
+		},
+	}), r)
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if !complete {
+		return status, nil, false
+	}
+	return status, buf.Bytes(), true
+}
+
+type writerFunc func([]byte)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	f(b)
+	return len(b), nil
+}
@@ -0,0 +1,112 @@
+package xtemplate
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// idempotencyInstance returns an instance that stores idempotent responses
+// in a new database and caches responses.
+func idempotencyInstance(t *testing.T, templates fstest.MapFS, options ...Option) *Instance {
+	t.Helper()
+	connstr := "file:" + filepath.Join(t.TempDir(), "idempotency.db")
+	return testInstance(t, templates, append([]Option{
+		func(c *Config) error {
+			c.Databases = append(c.Databases, DotDBConfig{Name: "DB", Driver: "sqlite3", Connstr: connstr})
+			c.RequestIDResponseHeader = "X-Request-Id"
+			return nil
+		},
+		WithIdempotency(IdempotencyConfig{}),
+		WithResponseCache(ResponseCacheConfig{}),
+	}, options...)...)
+}
+
+func TestReplayRequestID(t *testing.T) {
+	instance := idempotencyInstance(t, fstest.MapFS{
+		"index.html": {Data: []byte(`home{{define "POST /order"}}ordered{{end}}`)},
+	})
+	for _, tc := range []struct {
+		name, method, replayHeader string
+	}{
+		{"cache", http.MethodGet, "X-Cache"},
+		{"idempotency", http.MethodPost, "Idempotent-Replayed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var ids []string
+			for i := range 2 {
+				target := "/"
+				if tc.method == http.MethodPost {
+					target = "/order"
+				}
+				r := httptest.NewRequest(tc.method, target, nil)
+				r.Header.Set("Idempotency-Key", "key-1")
+				w := httptest.NewRecorder()
+				instance.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+				}
+				if i == 1 && w.Header().Get(tc.replayHeader) == "" {
+					t.Fatalf("the second response wasn't replayed, missing %s", tc.replayHeader)
+				}
+				ids = append(ids, w.Header().Get("X-Request-Id"))
+			}
+			if ids[0] == "" || ids[0] == ids[1] {
+				t.Errorf("got request ids %q, want the id of each request", ids)
+			}
+		})
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	connstr := "file:" + filepath.Join(t.TempDir(), "idempotency.db")
+	instance := testInstance(t, fstest.MapFS{
+		"index.html": {Data: []byte(`{{define "POST /order"}}{{.Req.APIKey.Name}} {{.Req.URL.Query.Get "a"}}{{end}}`)},
+	},
+		func(c *Config) error {
+			c.Databases = append(c.Databases, DotDBConfig{Name: "DB", Driver: "sqlite3", Connstr: connstr})
+			return nil
+		},
+		WithIdempotency(IdempotencyConfig{}),
+		WithAPIKeys(APIKeysConfig{}),
+	)
+	db, err := sql.Open("sqlite3", connstr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, name := range []string{"alice", "bob"} {
+		sum := sha256.Sum256([]byte(name + "-key"))
+		if _, err := db.Exec(`INSERT INTO api_keys (key_hash, name) VALUES (?, ?)`, hex.EncodeToString(sum[:]), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		apiKey, target, body string
+		replayed             bool
+	}{
+		{"alice-key", "/order?a=1", "alice 1", false},
+		{"alice-key", "/order?a=1", "alice 1", true},
+		{"alice-key", "/order?a=2", "alice 2", false},
+		{"bob-key", "/order?a=1", "bob 1", false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, tc.target, nil)
+		r.Header.Set("Idempotency-Key", "key-1")
+		r.Header.Set("X-API-Key", tc.apiKey)
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, r)
+		if body := strings.TrimSpace(w.Body.String()); body != tc.body {
+			t.Errorf("%s %s: got %q, want %q", tc.apiKey, tc.target, body, tc.body)
+		}
+		if replayed := w.Header().Get("Idempotent-Replayed") != ""; replayed != tc.replayed {
+			t.Errorf("%s %s: got replayed %t, want %t", tc.apiKey, tc.target, replayed, tc.replayed)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package xtemplate
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
@@ -15,14 +16,15 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/Masterminds/sprig/v3"
 	"github.com/felixge/httpsnoop"
-	"github.com/google/uuid"
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go/jetstream"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/minify/v2/css"
 	"github.com/tdewolff/minify/v2/html"
@@ -43,20 +45,71 @@ type Instance struct {
 	config Config
 	id     int64
 
-	router    *http.ServeMux
+	router    Router
 	files     map[string]*fileInfo
+	static    *staticLookup
 	templates *template.Template
 	funcs     template.FuncMap
 
+	// the original funcs that count their calls, see [Config.MaxFuncCalls]
+	budgetedFuncs map[string]any
+
+	// metadata blocks of template files, keyed by template path
+	templateMeta map[string]map[string]any
+
+	// name of the template or path of the static file that handles each route
+	// pattern
+	routeSources map[string]string
+
+	// limits of the route patterns whose templates override them
+	routeLimits map[string]routeLimits
+
+	// alternate representations of pages by their route path
+	alternates map[string][]pageAlternate
+
+	// where each template is defined, see TemplateSource
+	templateSources map[string]TemplateSource
+
+	// contents of the files in the data dir, see [DotX.Data]
+	data map[string]any
+
+	// elements returned by [DotX.Inline] by file path and hash
+	inlined sync.Map
+
+	// where request ids are read from, see requestIDChain
+	requestIDSources []RequestIDSource
+
+	// the settings that [Server.Apply] can change while serving requests
+	settings atomic.Pointer[Settings]
+
+	routes []InstanceRoute
+
+	stats *InstanceStats
+
+	// compiled json schemas, keyed by file path
+	schemas map[string]*jsonschema.Schema
+
 	natsServer *server.Server
 	natsClient *jetstream.JetStream
 
 	bufferDot  dot
 	flusherDot dot
+
+	errorRate *errorRateTracker
+	errorLog  *errorLogLimiter
+	locales   *locales
+	recorder  *recorder
+	access    *accessControl
+	mirror    *mirror
+	mock      *mock
+
+	idempotency   *idempotency
+	apiKeys       *apiKeys
+	responseCache *responseCache
 }
 
 // Instance creates a new *Instance from the given config
-func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []InstanceRoute, error) {
+func (config *Config) Instance(cfgs ...Option) (_ *Instance, _ *InstanceStats, _ []InstanceRoute, err error) {
 	start := time.Now()
 
 	build := &builder{
@@ -65,30 +118,159 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 			id:     nextInstanceIdentity.Add(1),
 		},
 		InstanceStats: &InstanceStats{},
+		stage:         "config",
 	}
+	defer func() {
+		if err != nil {
+			err = build.buildError(err)
+		}
+	}()
 
 	if _, err := build.config.Options(cfgs...); err != nil {
 		return nil, nil, nil, err
 	}
 
 	build.config.Logger = build.config.Logger.With(slog.Int64("instance", build.id))
+	build.requestIDSources = requestIDChain(&build.config)
 	build.config.Logger.Info("initializing")
 
+	if build.config.TemplatesFS == nil && build.config.TemplatesArchive != "" {
+		fsys, err := loadArchive(build.config.Ctx, build.config.TemplatesArchive, build.config.TemplatesArchiveSHA256, build.config.TemplatesArchiveMaxSize)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		build.config.TemplatesFS = fsys
+	}
+	if build.config.TemplatesFS == nil && build.config.TemplatesDB != nil {
+		fsys, err := loadTemplatesDB(build.config.Ctx, build.config.TemplatesDB)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		build.config.TemplatesFS = fsys
+	}
 	if build.config.TemplatesFS == nil {
-		build.config.TemplatesFS = os.DirFS(build.config.TemplatesDir)
+		if _, err := os.Stat(build.config.TemplatesDir); errors.Is(err, fs.ErrNotExist) {
+			if !build.config.Starter {
+				return nil, nil, nil, fmt.Errorf("templates directory '%s' does not exist, create it or set starter to serve the starter site", build.config.TemplatesDir)
+			}
+			build.config.Logger.Info("templates directory does not exist, serving the starter site", slog.String("templates_dir", build.config.TemplatesDir))
+			build.config.TemplatesFS = StarterFS()
+		} else if build.config.Starter {
+			build.config.TemplatesFS = overlayFS{os.DirFS(build.config.TemplatesDir), StarterFS()}
+			build.sourceDir = build.config.TemplatesDir
+		} else {
+			build.config.TemplatesFS = os.DirFS(build.config.TemplatesDir)
+			build.sourceDir = build.config.TemplatesDir
+		}
+	}
+
+	if build.config.DynamicStatic {
+		ttl := build.config.DynamicStaticTTL
+		if ttl <= 0 {
+			ttl = 5 * time.Second
+		}
+		build.static = &staticLookup{
+			fsys:        build.config.TemplatesFS,
+			templateExt: build.config.TemplateExtension,
+			dataDir:     build.config.DataDir,
+			weak:        build.config.StaticValidator == "modtime",
+			hashes:      loadHashCache("", build.config.StaticHashMaxSize),
+			ttl:         ttl,
+			log:         build.config.Logger.WithGroup("static"),
+			entries:     make(map[string]staticLookupEntry),
+		}
+	}
+
+	switch build.config.StaticValidator {
+	case "", "hash", "modtime":
+	default:
+		return nil, nil, nil, fmt.Errorf("invalid static validator '%s', expected 'hash' or 'modtime'", build.config.StaticValidator)
+	}
+
+	switch build.config.RouteConflicts {
+	case "fail", "template", "static":
+	default:
+		return nil, nil, nil, fmt.Errorf("invalid route conflicts policy '%s', expected 'fail', 'template', or 'static'", build.config.RouteConflicts)
 	}
 
 	{
 		build.funcs = template.FuncMap{}
 		maps.Copy(build.funcs, xtemplateFuncs)
 		maps.Copy(build.funcs, sprig.HtmlFuncMap())
+		build.funcs["validateJSON"] = build.Instance.validateJSON
+		build.funcs["invalidateCache"] = build.Instance.invalidateCache
+		build.funcs["forward"] = build.Instance.forward
+		build.funcs["jsonld"] = build.Instance.jsonLD
+		build.funcs["serveFile"] = build.Instance.serveFile
+		for name, level := range logLevels {
+			build.funcs[name] = build.Instance.logFunc(level)
+		}
+		if build.config.AvatarURL != "" {
+			build.funcs["avatar"] = avatarFunc(build.config.AvatarURL)
+		}
 		for _, extra := range build.config.FuncMaps {
 			maps.Copy(build.funcs, extra)
 		}
 	}
 
+	build.errorLog = newErrorLogLimiter(build.config.ErrorLogBurst, build.config.ErrorLogSample)
+
+	if build.config.ErrorAlert != nil {
+		if build.errorRate, err = newErrorRateTracker(*build.config.ErrorAlert, build.id, build.config.Logger); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if err := checkHeaderRules(build.config.HeaderRules); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(build.config.AccessRules) > 0 || len(build.config.TrustedProxies) > 0 {
+		var err error
+		if build.access, err = newAccessControl(build.config.AccessRules, build.config.TrustedProxies, build.config.TLSClientCA); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.Mirror != nil {
+		var err error
+		if build.mirror, err = newMirror(build.config.Ctx, *build.config.Mirror, build.config.Logger); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.Mock != nil {
+		var err error
+		if build.mock, err = newMock(*build.config.Mock, build.config.Logger); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.AssetBaseURL != "" {
+		build.config.OutputRewriters = append(slices.Clone(build.config.OutputRewriters), assetBaseURLRewriter(build.Instance, build.config.AssetBaseURL))
+	}
+
 	build.files = make(map[string]*fileInfo)
-	build.router = http.NewServeMux()
+	build.templateMeta = make(map[string]map[string]any)
+	build.routeSources = make(map[string]string)
+	build.routeLimits = make(map[string]routeLimits)
+	if build.config.NewRouter != nil {
+		build.router = build.config.NewRouter()
+	} else if build.config.CaseInsensitiveRoutes {
+		build.router = NewCaseInsensitiveRouter()
+	} else {
+		build.router = http.NewServeMux()
+	}
+	if build.config.AuditFuncs > 0 {
+		// after every func is registered, so they're all audited
+		auditFuncs(build.funcs, build.config.AuditFuncs, build.config.Logger)
+	}
+	if build.config.MaxFuncCalls > 0 {
+		build.budgetedFuncs = budgetFuncs(build.funcs, build.config.MaxFuncCalls)
+	}
+	if build.config.MaxRangeIterations > 0 {
+		build.funcs[rangeBudgetFunc] = rangeBudget(build.config.MaxRangeIterations)
+	}
 	build.templates = template.New(".").Delims(build.config.LDelim, build.config.RDelim).Funcs(build.funcs)
 
 	if config.Minify {
@@ -102,30 +284,155 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 		build.m = m
 	}
 
+	// errors of individual files are collected so they can all be fixed at
+	// once, and progress is logged periodically so a slow build of a large
+	// tree can be told apart from a hung one
+	build.stage = "files"
+	var paths, staticPaths, dataPaths []string
 	if err := fs.WalkDir(build.config.TemplatesFS, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return err
 		}
+		if isDataPath(build.config.DataDir, path) {
+			dataPaths = append(dataPaths, path)
+			return nil
+		}
+		paths = append(paths, path)
+		if !strings.HasSuffix(path, build.config.TemplateExtension) {
+			staticPaths = append(staticPaths, path)
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, nil, fmt.Errorf("error scanning files: %w", err)
+	}
+	build.sortByRouteConflicts(paths)
+	if !build.config.DynamicStatic && build.config.StaticValidator != "modtime" {
+		build.hashes = loadHashCache(build.config.StaticHashCache, build.config.StaticHashMaxSize)
+		build.hashes.prefill(build.config.TemplatesFS, staticPaths, build.config.BuildWorkers)
+	}
+	var fileErrs []BuildFailure
+	lastProgress := time.Now()
+	for i, path := range paths {
+		if time.Since(lastProgress) >= buildProgressInterval {
+			lastProgress = time.Now()
+			build.config.Logger.Info("loading files", slog.Int("loaded", i), slog.Int("files", len(paths)), slog.String("path", path), slog.Duration("elapsed", time.Since(start)))
+		}
+		var err error
 		if strings.HasSuffix(path, build.config.TemplateExtension) {
 			err = build.addTemplateHandler(path)
 		} else {
-			err = build.addStaticFileHandler(path)
+			if strings.HasSuffix(path, schemaFileSuffix) {
+				build.schemaPaths = append(build.schemaPaths, path)
+			}
+			if !build.config.DynamicStatic {
+				err = build.addStaticFileHandler(path)
+			}
+		}
+		if err != nil {
+			fileErrs = append(fileErrs, build.buildFailure("/"+path, err))
+		}
+	}
+	fileErrs = append(fileErrs, build.loadData(dataPaths)...)
+	if len(fileErrs) > 0 {
+		return nil, nil, nil, &BuildError{Failures: fileErrs}
+	}
+	if err := build.hashes.save(build.config.StaticHashCache, staticPaths); err != nil {
+		build.config.Logger.Warn("failed to save static file hash cache", slog.String("path", build.config.StaticHashCache), slog.Any("error", err))
+	}
+
+	build.stage = "templates"
+	if build.config.Admin != nil {
+		if err := build.addAdminTemplates(); err != nil {
+			return nil, nil, nil, err
 		}
-		return err
-	}); err != nil {
-		return nil, nil, nil, fmt.Errorf("error scanning files: %w", err)
 	}
 
+	if err := build.checkLayouts(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := build.addAlternates(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if schemas, err := compileSchemas(build.config.TemplatesFS, build.schemaPaths); err != nil {
+		return nil, nil, nil, err
+	} else {
+		build.schemas = schemas
+	}
+
+	build.stage = "providers"
 	dcInstance := dotXProvider{build.Instance}
-	dcReq := dotReqProvider{}
+	if build.config.Locale != nil {
+		var err error
+		if build.locales, err = newLocales(*build.config.Locale); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	dcReq := dotReqProvider{location: time.UTC, timezoneCookie: build.config.TimezoneCookie, contextKeys: build.config.ContextKeys, locales: build.locales, instance: build.Instance}
+	if build.config.Timezone != "" {
+		loc, err := loadLocation(build.config.Timezone)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to load timezone '%s': %w", build.config.Timezone, err)
+		}
+		dcReq.location = loc
+	}
+	dcVars := dotVarsProvider{}
 	dcResp := dotRespProvider{}
-	dcFlush := dotFlushProvider{}
+	dcFlush := dotFlushProvider{writeTimeout: build.config.StreamWriteTimeout, slowFlush: build.config.StreamSlowFlush}
 
 	var dot []DotConfig
+	var mentions *webmentions
+	var outbox *outbox
+	var cache *responseCache
+	var counters *counters
 
 	{
 		names := map[string]int{}
+		if build.config.Navigation {
+			pages := build.pages
+			if !build.config.ShowDrafts {
+				// scheduled pages are added to the tree on the next reload after
+				// they're published
+				now := time.Now()
+				pages = slices.DeleteFunc(slices.Clone(pages), func(p pageInfo) bool { return !p.publish.published(now) })
+			}
+			d := dotNavProvider{buildNav(pages, build.config.TemplateExtension)}
+			dot = append(dot, d)
+			names[d.FieldName()] += 1
+		}
+		if build.config.Webmention != nil {
+			mentions = newWebmentions(build.Instance, *build.config.Webmention)
+			d := dotWebmentionsProvider{mentions}
+			dot = append(dot, d)
+			names[d.FieldName()] += 1
+		}
+		if build.config.ResponseCache != nil {
+			cache = newResponseCache(*build.config.ResponseCache)
+			d := dotCacheProvider{cache}
+			dot = append(dot, d)
+			names[d.FieldName()] += 1
+		}
+		if build.config.Tmp != nil {
+			d := dotTmpProvider{*build.config.Tmp}
+			dot = append(dot, d)
+			names[d.FieldName()] += 1
+		}
+		if build.config.Counters != nil {
+			counters = newCounters(*build.config.Counters)
+			d := dotCountersProvider{counters}
+			dot = append(dot, d)
+			names[d.FieldName()] += 1
+		}
+		if build.config.Outbox != nil {
+			outbox = newOutbox(*build.config.Outbox)
+			d := dotWebhooksProvider{outbox}
+			dot = append(dot, d)
+			names[d.FieldName()] += 1
+		}
 		for _, d := range build.config.Databases {
+			d.maxRows = build.config.MaxQueryRows
 			dot = append(dot, &d)
 			names[d.FieldName()] += 1
 		}
@@ -133,7 +440,9 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 			dot = append(dot, &d)
 			names[d.FieldName()] += 1
 		}
+		images := make(chan struct{}, build.config.ImageWorkers)
 		for _, d := range build.config.Directories {
+			d.images = images
 			dot = append(dot, &d)
 			names[d.FieldName()] += 1
 		}
@@ -141,6 +450,30 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 			dot = append(dot, &d)
 			names[d.FieldName()] += 1
 		}
+		for _, d := range build.config.LDAP {
+			dot = append(dot, &d)
+			names[d.FieldName()] += 1
+		}
+		for _, d := range build.config.WebAuthn {
+			dot = append(dot, &d)
+			names[d.FieldName()] += 1
+		}
+		for _, d := range build.config.Audit {
+			dot = append(dot, &d)
+			names[d.FieldName()] += 1
+		}
+		for _, d := range build.config.GraphQL {
+			dot = append(dot, &d)
+			names[d.FieldName()] += 1
+		}
+		for _, d := range build.config.GRPC {
+			dot = append(dot, &d)
+			names[d.FieldName()] += 1
+		}
+		for _, d := range build.config.Fetch {
+			dot = append(dot, &d)
+			names[d.FieldName()] += 1
+		}
 		for _, d := range build.config.CustomProviders {
 			dot = append(dot, d)
 			names[d.FieldName()] += 1
@@ -158,8 +491,111 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 		}
 	}
 
-	build.bufferDot = makeDot(slices.Concat([]DotConfig{dcInstance, dcReq}, dot, []DotConfig{dcResp}))
-	build.flusherDot = makeDot(slices.Concat([]DotConfig{dcInstance, dcReq}, dot, []DotConfig{dcFlush}))
+	if len(build.config.DevProxy) > 0 {
+		if err := build.addDevProxyRoutes(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if err := build.addAssetProxyRoutes(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if build.config.PlaygroundPath != "" {
+		if err := build.addPlaygroundRoutes(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.Admin != nil {
+		if err := build.addAdminRoutes(dot); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if mentions != nil {
+		if err := build.addWebmentionRoute(mentions, dot); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if outbox != nil {
+		if err := build.startOutbox(outbox, dot); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if counters != nil {
+		if err := build.startCounters(counters, dot); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.Idempotency != nil {
+		if err := build.addIdempotency(dot); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.APIKeys != nil {
+		if err := build.addAPIKeys(dot); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if cache != nil {
+		if err := build.addResponseCache(cache, dot); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.CSPReport != nil {
+		if err := build.addCSPReportRoute(dot); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.WebFinger != nil {
+		if err := build.addWebFingerRoute(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.Sitemap != nil {
+		if err := build.addSitemapRoutes(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.MetricsPath != "" {
+		if err := build.addMetricsRoute(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.Webhook != nil {
+		if err := build.addWebhookRoute(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if build.config.Record != nil {
+		var databases []string
+		for _, d := range build.config.Databases {
+			databases = append(databases, d.Name)
+		}
+		var err error
+		build.recorder, err = newRecorder(*build.config.Record, build.id, databases, build.config.Logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	build.bufferDot = makeDot(slices.Concat([]DotConfig{dcInstance, dcReq, dcVars}, dot, []DotConfig{dcResp}))
+	build.flusherDot = makeDot(slices.Concat([]DotConfig{dcInstance, dcReq, dcVars}, dot, []DotConfig{dcFlush}))
+	build.bufferDot.override = build.config.DotOverrides
+	build.flusherDot.override = build.config.DotOverrides
+	build.applySettings(build.config.Settings())
 
 	{
 		// Invoke all initilization templates, aka any template whose name starts
@@ -168,6 +604,7 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 			w, r := httptest.NewRecorder(), httptest.NewRequest("", "/", nil)
 			return build.bufferDot.value(build.config.Ctx, w, r)
 		}
+		build.stage = "init"
 		cleanup := build.bufferDot.cleanup
 		buf := new(bytes.Buffer)
 		for _, tmpl := range build.templates.Templates() {
@@ -179,7 +616,9 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 				}
 				err = tmpl.Execute(buf, *val)
 				if err = cleanup(val, err); err != nil {
-					return nil, nil, nil, fmt.Errorf("template initializer '%s' failed: %w", tmpl.Name(), err)
+					// later initializers may depend on the side effects of this
+					// one, so don't run them on a half initialized instance
+					return nil, nil, nil, &BuildError{Failures: []BuildFailure{build.buildFailure(build.templateSources[tmpl.Name()].File, fmt.Errorf("template initializer '%s' failed: %w", tmpl.Name(), err))}}
 				}
 				// TODO: output buffer somewhere?
 				build.config.Logger.Debug("executed initializer", slog.String("template_name", tmpl.Name()), slog.Int("rendered_len", buf.Len()))
@@ -188,6 +627,22 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 		}
 	}
 
+	build.stage = "routes"
+	if err := build.addVirtualRoutes(); err != nil {
+		return nil, nil, nil, err
+	}
+	if build.locales != nil {
+		if err := build.addLocaleRoutes(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if err := build.addRedirects(); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := build.checkViewModels(); err != nil {
+		return nil, nil, nil, err
+	}
+
 	build.config.Logger.Info("instance loaded",
 		slog.Duration("load_time", time.Since(start)),
 		slog.Group("stats",
@@ -199,9 +654,31 @@ func (config *Config) Instance(cfgs ...Option) (*Instance, *InstanceStats, []Ins
 			slog.Int("staticFilesAlternateEncodings", build.StaticFilesAlternateEncodings),
 		))
 
+	build.stats = build.InstanceStats
+
+	if build.config.BuildSelfTest {
+		build.stage = "selftest"
+		report := SelfTest(build.Instance, build.config.BuildWorkers)
+		if err := report.Err(); err != nil {
+			buildErr := &BuildError{}
+			for _, f := range report.Failures {
+				message := fmt.Sprintf("self-test failed for %s (%s): status %d", f.Page, f.Template, f.Status)
+				if f.Error != "" {
+					message += ": " + f.Error
+				}
+				buildErr.Failures = append(buildErr.Failures, BuildFailure{Stage: build.stage, File: build.templateSources[f.Template].File, Message: message, Err: err})
+			}
+			return nil, nil, nil, buildErr
+		}
+		build.config.Logger.Info("self-test passed", slog.Int("pages", report.Pages), slog.Duration("duration", report.Duration))
+	}
+
 	return build.Instance, build.InstanceStats, build.routes, nil
 }
 
+// Interval of progress logs while loading the files of an instance.
+const buildProgressInterval = 2 * time.Second
+
 // Counter to assign a unique id to each instance of xtemplate created when
 // calling Config.Instance(). This is intended to help distinguish logs from
 // multiple instances in a single process.
@@ -215,6 +692,18 @@ func (x *Instance) Id() int64 {
 	return x.id
 }
 
+// DBStats returns aggregate statistics of the statements executed by each
+// database provider of this instance, keyed by field name.
+func (x *Instance) DBStats() map[string]DBStats {
+	stats := map[string]DBStats{}
+	for _, dp := range x.bufferDot.dps {
+		if d, ok := dp.(*DotDBConfig); ok && d.stats != nil {
+			stats[d.Name] = d.stats.snapshot()
+		}
+	}
+	return stats
+}
+
 var (
 	levelDebug2 slog.Level = slog.LevelDebug + 2
 )
@@ -229,15 +718,19 @@ func (instance *Instance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := r.Context()
-	rid := GetRequestId(ctx)
-	if rid == "" {
-		rid = uuid.NewString()
-		ctx = context.WithValue(ctx, requestIdKey, rid)
+	rid := instance.requestID(r)
+	ctx = context.WithValue(ctx, requestIdKey, rid)
+	if instance.config.RequestIDResponseHeader != "" {
+		w.Header().Set(instance.config.RequestIDResponseHeader, rid)
 	}
 
-	log := instance.config.Logger.With(slog.Group("serve",
-		slog.String("requestid", rid),
-	))
+	serveAttrs := []any{slog.String("requestid", rid)}
+	if instance.config.RequestLogAttrs != nil {
+		for _, attr := range instance.config.RequestLogAttrs(r) {
+			serveAttrs = append(serveAttrs, attr)
+		}
+	}
+	log := instance.config.Logger.With(slog.Group("serve", serveAttrs...))
 	log.LogAttrs(r.Context(), slog.LevelDebug, "serving request",
 		slog.String("user-agent", r.Header.Get("User-Agent")),
 		slog.String("method", r.Method),
@@ -245,8 +738,74 @@ func (instance *Instance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	)
 	ctx = context.WithValue(ctx, loggerKey, log)
 
+	var rec *RecordedRequest
+	if instance.recorder != nil && instance.recorder.matches(r) {
+		rec = instance.recorder.start(r, rid)
+	}
+
+	if instance.locales != nil || instance.config.CaseInsensitiveRoutes {
+		ctx = context.WithValue(ctx, rulePathKey, instance.canonicalPath(r))
+	}
+	if instance.access != nil {
+		ctx = context.WithValue(ctx, clientAddrKey, instance.access.clientIP(r))
+		ctx = context.WithValue(ctx, clientSchemeKey, instance.access.scheme(r))
+	}
+
 	r = r.WithContext(ctx)
-	metrics := httpsnoop.CaptureMetrics(instance.router, w, r)
+	var handler http.Handler = instance.router
+	if instance.responseCache != nil {
+		handler = instance.responseCache.wrap(instance, handler)
+	}
+	if instance.static != nil {
+		handler = instance.static.wrap(instance.router, handler)
+	}
+	if instance.mock != nil {
+		handler = instance.mock.wrap(instance, handler)
+	}
+	if instance.locales != nil {
+		handler = instance.redirectLocale(handler)
+	}
+	if instance.idempotency != nil {
+		handler = instance.idempotency.wrap(instance, handler)
+	}
+	if instance.apiKeys != nil {
+		handler = instance.apiKeys.wrap(instance, handler)
+	}
+	if instance.config.NormalizeUnicode {
+		handler = normalizeUnicode(handler)
+	}
+	allowed := true
+	if instance.access != nil && !instance.access.allowed(r) {
+		log.Info("request denied by access rules", slog.String("ip", instance.access.clientIP(r).String()))
+		allowed = false
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			instance.serveError(w, r, http.StatusForbidden, "access denied")
+		})
+	}
+	var mirrored *http.Request
+	if instance.mirror != nil && allowed && instance.mirror.sample(r) {
+		if _, pattern := instance.router.Handler(r); pattern != "" {
+			mirrored = instance.mirror.capture(r)
+		}
+	}
+
+	w = applyHeaderRules(instance.config.HeaderRules, w, r)
+	instance.withPreview(w, r)
+	metrics := httpsnoop.CaptureMetrics(handler, w, r)
+
+	if mirrored != nil {
+		instance.mirror.send(mirrored)
+	}
+
+	if rec != nil {
+		instance.recorder.finish(rec, metrics.Code)
+	}
+
+	if instance.errorRate != nil {
+		if _, pattern := instance.router.Handler(r); pattern != "" {
+			instance.errorRate.observe(pattern, metrics.Code, time.Now())
+		}
+	}
 
 	log.LogAttrs(r.Context(), levelDebug2, "request served",
 		slog.Group("response",
@@ -258,30 +817,6 @@ func (instance *Instance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		))
 }
 
-type requestIdType struct{}
-
-var requestIdKey = requestIdType{}
-
-func GetRequestId(ctx context.Context) string {
-	// xtemplate request id
-	if av := ctx.Value(requestIdKey); av != nil {
-		if v, ok := av.(string); ok {
-			return v
-		}
-	}
-	// caddy request id
-	if v := ctx.Value("vars"); v != nil {
-		if mv, ok := v.(map[string]any); ok {
-			if anyrid, ok := mv["uuid"]; ok {
-				if rid, ok := anyrid.(string); ok {
-					return rid
-				}
-			}
-		}
-	}
-	return ""
-}
-
 type loggerType struct{}
 
 var loggerKey = loggerType{}
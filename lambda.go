@@ -0,0 +1,186 @@
+package xtemplate
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+)
+
+// LambdaHandler adapts h, usually an [Instance] or [Server.Handler], to handle
+// AWS Lambda events from API Gateway REST APIs (payload format 1.0), HTTP APIs
+// (payload format 2.0), and Function URLs. Pass it to the aws-lambda-go
+// package:
+//
+//	lambda.Start(xtemplate.LambdaHandler(server.Handler()))
+//
+// Responses with binary content types, like images or compressed static files,
+// are base64 encoded.
+func LambdaHandler(h http.Handler) func(ctx context.Context, event json.RawMessage) (any, error) {
+	return func(ctx context.Context, event json.RawMessage) (any, error) {
+		var e lambdaEvent
+		if err := json.Unmarshal(event, &e); err != nil {
+			return nil, fmt.Errorf("failed to decode lambda event: %w", err)
+		}
+		r, err := e.request(ctx)
+		if err != nil {
+			return nil, err
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return e.response(w.Result())
+	}
+}
+
+type lambdaEvent struct {
+	Version                         string              `json:"version"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Path                            string              `json:"path"`
+	RawPath                         string              `json:"rawPath"`
+	RawQueryString                  string              `json:"rawQueryString"`
+	Cookies                         []string            `json:"cookies"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	Body                            string              `json:"body"`
+	IsBase64Encoded                 bool                `json:"isBase64Encoded"`
+	RequestContext                  struct {
+		DomainName string `json:"domainName"`
+		HTTP       struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+	} `json:"requestContext"`
+}
+
+// v2 reports whether the event uses payload format 2.0, which is also used by
+// Function URLs.
+func (e *lambdaEvent) v2() bool {
+	return e.Version == "2.0"
+}
+
+func (e *lambdaEvent) request(ctx context.Context) (*http.Request, error) {
+	method, remote := e.HTTPMethod, e.RequestContext.Identity.SourceIP
+	u := &url.URL{Path: e.Path}
+	if e.v2() {
+		// the raw path and query of format 2.0 are still percent-encoded
+		method, remote = e.RequestContext.HTTP.Method, e.RequestContext.HTTP.SourceIP
+		path, err := url.PathUnescape(e.RawPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lambda event path: %w", err)
+		}
+		if _, err := url.ParseQuery(e.RawQueryString); err != nil {
+			return nil, fmt.Errorf("invalid lambda event query string: %w", err)
+		}
+		u.Path, u.RawPath, u.RawQuery = path, e.RawPath, e.RawQueryString
+	} else if len(e.MultiValueQueryStringParameters) > 0 {
+		u.RawQuery = url.Values(e.MultiValueQueryStringParameters).Encode()
+	} else {
+		query := url.Values{}
+		for k, v := range e.QueryStringParameters {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+	}
+
+	var body io.Reader = strings.NewReader(e.Body)
+	if e.IsBase64Encoded {
+		b, err := base64.StdEncoding.DecodeString(e.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lambda event body: %w", err)
+		}
+		body = strings.NewReader(string(b))
+	}
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lambda event request: %w", err)
+	}
+	for k, vs := range e.MultiValueHeaders {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	for k, v := range e.Headers {
+		if _, ok := e.MultiValueHeaders[k]; !ok {
+			r.Header.Set(k, v)
+		}
+	}
+	if len(e.Cookies) > 0 {
+		r.Header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+	r.Host = r.Header.Get("Host")
+	if r.Host == "" {
+		r.Host = e.RequestContext.DomainName
+	}
+	r.RemoteAddr = remote
+	return r, nil
+}
+
+type lambdaResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+func (e *lambdaEvent) response(res *http.Response) (*lambdaResponse, error) {
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.Header.Get("Content-Type") == "" && len(body) > 0 {
+		// like http.ResponseWriter, since the gateway would default to json
+		res.Header.Set("Content-Type", http.DetectContentType(body))
+	}
+	resp := &lambdaResponse{StatusCode: res.StatusCode}
+	if lambdaBinary(res.Header) {
+		resp.Body, resp.IsBase64Encoded = base64.StdEncoding.EncodeToString(body), true
+	} else {
+		resp.Body = string(body)
+	}
+	if e.v2() {
+		resp.Headers = make(map[string]string, len(res.Header))
+		for k, vs := range res.Header {
+			if k == "Set-Cookie" {
+				resp.Cookies = vs
+				continue
+			}
+			resp.Headers[k] = strings.Join(vs, ", ")
+		}
+	} else {
+		resp.MultiValueHeaders = res.Header
+	}
+	return resp, nil
+}
+
+// lambdaBinary reports whether a response with header must be base64 encoded
+// because it isn't text.
+func lambdaBinary(header http.Header) bool {
+	if enc := header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return true
+	}
+	mediatype, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return header.Get("Content-Type") != ""
+	}
+	switch {
+	case strings.HasPrefix(mediatype, "text/"),
+		strings.HasSuffix(mediatype, "+json"), strings.HasSuffix(mediatype, "+xml"),
+		strings.HasSuffix(mediatype, "/json"), strings.HasSuffix(mediatype, "/xml"),
+		strings.HasSuffix(mediatype, "/javascript"):
+		return false
+	}
+	return true
+}
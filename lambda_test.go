@@ -0,0 +1,73 @@
+package xtemplate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// echoHandler responds with the request that it received, and sets a cookie.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: "seen", Value: "1"})
+	fmt.Fprintf(w, "%s %s %s %s %s %s", r.Method, r.URL.Path, r.URL.EscapedPath(), r.URL.Query().Get("q"), r.Header.Get("Cookie"), r.RemoteAddr)
+})
+
+func TestLambdaHandlerV1(t *testing.T) {
+	event := `{
+		"version": "1.0",
+		"resource": "/{proxy+}",
+		"path": "/blog/100% off",
+		"httpMethod": "GET",
+		"headers": {"Host": "example.com", "Cookie": "a=1"},
+		"multiValueHeaders": {"Host": ["example.com"], "Cookie": ["a=1"]},
+		"queryStringParameters": {"q": "a b"},
+		"multiValueQueryStringParameters": {"q": ["a b"]},
+		"requestContext": {"identity": {"sourceIp": "192.0.2.1"}},
+		"body": null,
+		"isBase64Encoded": false
+	}`
+	resp := invokeLambda(t, event)
+	if want := "GET /blog/100% off /blog/100%25%20off a b a=1 192.0.2.1"; resp.Body != want {
+		t.Errorf("got body %q, want %q", resp.Body, want)
+	}
+	if cookies := resp.MultiValueHeaders["Set-Cookie"]; len(cookies) != 1 || cookies[0] != "seen=1" {
+		t.Errorf("got set-cookie headers %q, want seen=1", cookies)
+	}
+}
+
+func TestLambdaHandlerV2(t *testing.T) {
+	event := `{
+		"version": "2.0",
+		"routeKey": "$default",
+		"rawPath": "/blog/a%2Fb/100%25%20off",
+		"rawQueryString": "q=a+b&x=%26",
+		"cookies": ["a=1", "b=2"],
+		"headers": {"host": "example.com"},
+		"queryStringParameters": {"q": "a b", "x": "&"},
+		"requestContext": {"domainName": "example.com", "http": {"method": "POST", "path": "/blog/a/b/100% off", "sourceIp": "192.0.2.1"}},
+		"body": "aGk=",
+		"isBase64Encoded": true
+	}`
+	resp := invokeLambda(t, event)
+	if want := "POST /blog/a/b/100% off /blog/a%2Fb/100%25%20off a b a=1; b=2 192.0.2.1"; resp.Body != want {
+		t.Errorf("got body %q, want %q", resp.Body, want)
+	}
+	if len(resp.Cookies) != 1 || resp.Cookies[0] != "seen=1" {
+		t.Errorf("got cookies %q, want seen=1", resp.Cookies)
+	}
+}
+
+func invokeLambda(t *testing.T, event string) *lambdaResponse {
+	t.Helper()
+	result, err := LambdaHandler(echoHandler)(context.Background(), json.RawMessage(event))
+	if err != nil {
+		t.Fatalf("failed to handle event: %v", err)
+	}
+	resp := result.(*lambdaResponse)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want 200", resp.StatusCode)
+	}
+	return resp
+}
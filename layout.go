@@ -0,0 +1,61 @@
+package xtemplate
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/spf13/cast"
+)
+
+// Template files can choose a layout template with the front matter key
+// `layout` to render in two passes: the page renders first, then the layout
+// renders with the same dot. This lets the layout use values that the page set
+// in .Vars, like its title or the stylesheets it needs, and insert the page
+// output with [DotResp.Body]. The layout isn't rendered if the page returns a
+// Fragment.
+
+type layoutType struct{}
+
+var layoutKey = layoutType{}
+
+// metaLayout returns the name of the layout template in the front matter meta,
+// if it has one.
+func metaLayout(meta map[string]any) (string, error) {
+	v, ok := meta["layout"]
+	if !ok {
+		return "", nil
+	}
+	name, err := cast.ToStringE(v)
+	if err != nil || name == "" {
+		return "", fmt.Errorf("invalid layout: '%v'", v)
+	}
+	return name, nil
+}
+
+// checkLayouts checks that the layouts of all template files are defined.
+func (b *builder) checkLayouts() error {
+	for path_, meta := range b.templateMeta {
+		name, _ := metaLayout(meta)
+		if name != "" && b.templates.Lookup(name) == nil {
+			return fmt.Errorf("layout template '%s' of template file '%s' is not defined", name, path_)
+		}
+	}
+	return nil
+}
+
+func withLayout(handler http.HandlerFunc, name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(context.WithValue(r.Context(), layoutKey, name)))
+	}
+}
+
+// layout returns the layout template for the request, if its route has one.
+func (instance *Instance) layout(r *http.Request) *template.Template {
+	name, ok := r.Context().Value(layoutKey).(string)
+	if !ok {
+		return nil
+	}
+	return instance.templates.Lookup(name)
+}
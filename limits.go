@@ -0,0 +1,121 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cast"
+)
+
+// routeLimits are the limits applied to requests served by buffered
+// templates. The defaults are set by [Config.Timeout], [Config.MaxRequestBody],
+// and [Config.MaxBufferSize], and template files can override them for their
+// routes with the front matter keys `timeout`, `max_request_body`, and
+// `max_buffer`:
+//
+//	---
+//	timeout: 2m
+//	max_buffer: 200MB
+//	---
+//	{{range .DB.QueryRows "SELECT * FROM orders"}}...{{end}}
+type routeLimits struct {
+	timeout        time.Duration
+	maxRequestBody int64
+	maxBuffer      int64
+}
+
+type routeLimitsType struct{}
+
+var routeLimitsKey = routeLimitsType{}
+
+var errBufferLimit = errors.New("template output exceeded the buffer limit")
+
+// limits returns the limits for the request, which are the route's limits if
+// they were overridden, otherwise the limits of the config.
+func (instance *Instance) limits(r *http.Request) routeLimits {
+	if l, ok := r.Context().Value(routeLimitsKey).(routeLimits); ok {
+		return l
+	}
+	s := instance.settings.Load()
+	return routeLimits{s.Timeout, s.MaxRequestBody, s.MaxBufferSize}
+}
+
+// metaLimits returns the limits of the config overridden by the front matter
+// meta, and whether any were overridden.
+func (b *builder) metaLimits(meta map[string]any) (routeLimits, bool, error) {
+	limits := routeLimits{b.config.Timeout, b.config.MaxRequestBody, b.config.MaxBufferSize}
+	overridden := false
+	if v, ok := meta["timeout"]; ok {
+		d, err := cast.ToDurationE(v)
+		if err != nil {
+			return limits, false, fmt.Errorf("invalid timeout: %w", err)
+		}
+		limits.timeout, overridden = d, true
+	}
+	for key, field := range map[string]*int64{"max_request_body": &limits.maxRequestBody, "max_buffer": &limits.maxBuffer} {
+		v, ok := meta[key]
+		if !ok {
+			continue
+		}
+		var size int64
+		if s, isString := v.(string); isString {
+			n, err := humanize.ParseBytes(s)
+			if err != nil {
+				return limits, false, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			size = int64(n)
+		} else {
+			n, err := cast.ToInt64E(v)
+			if err != nil {
+				return limits, false, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			size = n
+		}
+		*field, overridden = size, true
+	}
+	return limits, overridden, nil
+}
+
+// limitedBuffer fails writes that would grow the buffer past max, if max is
+// positive, or that happen after ctx is done, which stops template execution
+// at the next write after the deadline.
+type limitedBuffer struct {
+	*bytes.Buffer
+	max int64
+	ctx context.Context
+}
+
+func (b limitedBuffer) Write(p []byte) (int, error) {
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if b.max > 0 && int64(b.Len()+len(p)) > b.max {
+		return 0, errBufferLimit
+	}
+	return b.Buffer.Write(p)
+}
+
+// limitedBody records the error of reading past the request body limit.
+type limitedBody struct {
+	io.ReadCloser
+	err *http.MaxBytesError
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	errors.As(err, &b.err)
+	return n, err
+}
+
+// withLimits overrides the limits of requests served by handler.
+func withLimits(handler http.HandlerFunc, limits routeLimits) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(context.WithValue(r.Context(), routeLimitsKey, limits)))
+	}
+}
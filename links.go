@@ -0,0 +1,190 @@
+package xtemplate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// BrokenLink is an internal link found in the output of a template route that
+// doesn't resolve to a route or static file. See [CheckLinks].
+type BrokenLink struct {
+	// Path of the page that contains the link.
+	Page string `json:"page"`
+
+	// Name of the template that renders the page.
+	Template string `json:"template"`
+
+	// The link as it's written in the page, and the path it resolves to.
+	Link     string `json:"link"`
+	Resolved string `json:"resolved"`
+
+	// Status of the response to the resolved link. It's 200 OK when the link
+	// is only served by the catch-all route of a directory index template.
+	Status int `json:"status"`
+}
+
+// linkAttrs are the attributes that link to other urls, by element.
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"link":   "href",
+	"area":   "href",
+	"script": "src",
+	"img":    "src",
+	"source": "src",
+	"iframe": "src",
+	"video":  "src",
+	"audio":  "src",
+}
+
+// CheckLinks renders every GET route of the instance that's served by a
+// template and doesn't have path wildcards, and requests every internal link
+// in the html they render. Links that respond with 404 Not Found, 405 Method
+// Not Allowed, or 410 Gone are returned, as well as links that are only served
+// because an index template like `/docs/index.html` handles every path under
+// its directory. Like any other request, rendering the pages runs their
+// templates, so only check sites without side effects on GET.
+func CheckLinks(instance *Instance) []BrokenLink {
+	statuses := map[string]int{}
+	status := func(u *url.URL) int {
+		if s, ok := statuses[u.RequestURI()]; ok {
+			return s
+		}
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, getRequest(u))
+		statuses[u.RequestURI()] = w.Code
+		return w.Code
+	}
+
+	var broken []BrokenLink
+	instance.renderPages(func(page, pattern string, body []byte) {
+		base := &url.URL{Path: page}
+		for _, link := range pageLinks(body) {
+			u, err := url.Parse(link)
+			if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+				// skip external links and links within the page
+				continue
+			}
+			u = base.ResolveReference(u)
+			u.Fragment = ""
+			resolved := u.RequestURI()
+			switch s := status(u); s {
+			case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusGone:
+				broken = append(broken, BrokenLink{page, instance.routeSources[pattern], link, resolved, s})
+			default:
+				if instance.caughtByIndex(u) {
+					broken = append(broken, BrokenLink{page, instance.routeSources[pattern], link, resolved, s})
+				}
+			}
+		}
+	})
+	return broken
+}
+
+// renderPages renders every GET route served by a template that doesn't have
+// path wildcards, in order of pattern, and calls fn with the body of each one
+// that responds with html.
+func (instance *Instance) renderPages(fn func(page, pattern string, body []byte)) {
+	for _, pattern := range instance.pagePatterns() {
+		page := strings.TrimSuffix(strings.TrimPrefix(pattern, "GET "), "{$}")
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, getRequest(&url.URL{Path: page}))
+		ct := w.Header().Get("Content-Type")
+		if ct == "" {
+			ct = http.DetectContentType(w.Body.Bytes())
+		}
+		if w.Code == http.StatusOK && strings.HasPrefix(ct, "text/html") {
+			fn(page, pattern, w.Body.Bytes())
+		}
+	}
+}
+
+// pagePatterns returns the sorted patterns of the GET routes served by a
+// template that don't have path wildcards.
+func (instance *Instance) pagePatterns() []string {
+	var patterns []string
+	for pattern, source := range instance.routeSources {
+		path, ok := strings.CutPrefix(pattern, "GET ")
+		if !ok || !strings.HasPrefix(path, "/") {
+			continue
+		}
+		if _, static := instance.files[source]; static {
+			continue
+		}
+		if strings.Contains(strings.TrimSuffix(path, "{$}"), "{") {
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+	return patterns
+}
+
+// getRequest returns a synthetic GET request for u, which is used as is
+// instead of parsing its string form, so paths with characters that have to
+// be escaped are requested correctly.
+func getRequest(u *url.URL) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.URL, r.RequestURI = u, u.RequestURI()
+	return r
+}
+
+// caughtByIndex reports whether a GET request to u is only routed to a
+// template because its pattern ends in a slash, like `GET /docs/` of
+// `/docs/index.html`, and matches every path in the directory.
+func (instance *Instance) caughtByIndex(u *url.URL) bool {
+	if _, ok := instance.file(u.Path); ok {
+		return false
+	}
+	_, pattern := instance.router.Handler(getRequest(&url.URL{Path: u.Path, RawPath: u.RawPath}))
+	path, ok := strings.CutPrefix(pattern, "GET ")
+	if !ok || !strings.HasSuffix(path, "/") || path == u.Path {
+		return false
+	}
+	source, ok := instance.routeSources[pattern]
+	if !ok {
+		return false
+	}
+	_, static := instance.files[source]
+	return !static
+}
+
+// endpointRel reports whether a is the rel attribute of a <link> to an
+// endpoint that's meant to be POSTed to instead of fetched.
+func endpointRel(a html.Attribute) bool {
+	return a.Key == "rel" && slices.ContainsFunc(strings.Fields(a.Val), func(rel string) bool {
+		return rel == "webmention" || rel == "pingback" || rel == "micropub"
+	})
+}
+
+// pageLinks returns the distinct urls linked from an html page.
+func pageLinks(body []byte) []string {
+	var links []string
+	z := html.NewTokenizer(strings.NewReader(string(body)))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return links
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		token := z.Token()
+		attr, ok := linkAttrs[token.Data]
+		if !ok {
+			continue
+		}
+		if token.Data == "link" && slices.ContainsFunc(token.Attr, endpointRel) {
+			continue
+		}
+		for _, a := range token.Attr {
+			if a.Key == attr && a.Val != "" && !slices.Contains(links, a.Val) {
+				links = append(links, a.Val)
+			}
+		}
+	}
+}
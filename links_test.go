@@ -0,0 +1,29 @@
+package xtemplate
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheckLinks(t *testing.T) {
+	instance := testInstance(t, fstest.MapFS{
+		"index.html":        {Data: []byte(`<a href="/100%25%20off">sale</a><a href="/docs/missing">docs</a><a href="/gone">gone</a>`)},
+		"100% off.html":     {Data: []byte(`<a href="/">home</a><a href="/50%25%20off">half</a><img src="a%20b.png" alt="">`)},
+		"docs/index.html":   {Data: []byte(`docs`)},
+		"docs/install.html": {Data: []byte(`<a href="../">docs</a><a href="./install">self</a>`)},
+	})
+	var got []string
+	for _, l := range CheckLinks(instance) {
+		got = append(got, l.Page+" "+l.Resolved)
+	}
+	want := []string{
+		"/ /docs/missing",
+		"/ /gone",
+		"/100% off /50%25%20off",
+		"/100% off /a%20b.png",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got broken links %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,219 @@
+package xtemplate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// LocaleConfig configures a multilingual site where every template route is
+// also served under a path prefix for each locale, like `/de/blog` for
+// `/blog`, so each language has its own indexable urls. GET and HEAD requests
+// to the bare path are redirected to the prefix of the locale negotiated from
+// the Accept-Language header, and other requests are served with the default
+// locale. Static files and builtin endpoints aren't prefixed. Path globs of
+// rules, like [AccessRule] and [HeaderRule], match the path without the
+// prefix, so the rules of `/admin/**` also apply to `/de/admin/users`.
+//
+// Templates read the active locale with .Req.Locale and build links with
+// .Req.LocalePath and .Req.AlternatePath, see [DotReq.Locale].
+type LocaleConfig struct {
+	// Supported locales as BCP 47 tags like `en` or `pt-BR`, which are used as
+	// path prefixes as written. The first one is the default.
+	Locales []string `json:"locales"`
+
+	// If set, the name of a cookie that holds the preferred locale of the
+	// client, which takes precedence over Accept-Language when redirecting
+	// bare paths.
+	Cookie string `json:"cookie,omitempty"`
+
+	// Globs like in [AccessRule] of route paths that aren't localized, like
+	// `/api/**` or `/ready`.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+func WithLocales(config LocaleConfig) Option {
+	return func(c *Config) error {
+		c.Locale = &config
+		return nil
+	}
+}
+
+type locales struct {
+	config  LocaleConfig
+	matcher language.Matcher
+
+	// patterns of the routes that are served under a locale prefix
+	localized map[string]bool
+	// patterns of the variants of those routes under each locale prefix
+	prefixed map[string]bool
+}
+
+func newLocales(config LocaleConfig) (*locales, error) {
+	if len(config.Locales) == 0 {
+		return nil, fmt.Errorf("no locales configured")
+	}
+	tags := make([]language.Tag, len(config.Locales))
+	for i, l := range config.Locales {
+		tag, err := language.Parse(l)
+		if err != nil {
+			return nil, fmt.Errorf("invalid locale '%s': %w", l, err)
+		}
+		if strings.Contains(l, "/") || slices.Index(config.Locales, l) != i {
+			return nil, fmt.Errorf("invalid locale '%s'", l)
+		}
+		tags[i] = tag
+	}
+	return &locales{config: config, matcher: language.NewMatcher(tags), localized: map[string]bool{}, prefixed: map[string]bool{}}, nil
+}
+
+type localeType struct{}
+
+var localeKey = localeType{}
+
+// activeLocale is stored in the request context of localized routes.
+type activeLocale struct {
+	locale string
+	// the request path without the locale prefix
+	path string
+}
+
+// split returns the locale that urlpath is prefixed with and the rest of the
+// path.
+func (l *locales) split(urlpath string) (string, string, bool) {
+	first, rest, _ := strings.Cut(strings.TrimPrefix(urlpath, "/"), "/")
+	if !slices.Contains(l.config.Locales, first) {
+		return "", urlpath, false
+	}
+	return first, "/" + rest, true
+}
+
+// negotiate returns the preferred supported locale of the client.
+func (l *locales) negotiate(r *http.Request) string {
+	if l.config.Cookie != "" {
+		if c, err := r.Cookie(l.config.Cookie); err == nil && slices.Contains(l.config.Locales, c.Value) {
+			return c.Value
+		}
+	}
+	tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	_, i, _ := l.matcher.Match(tags...)
+	return l.config.Locales[i]
+}
+
+// localizePattern inserts the locale prefix into the path of a route pattern.
+func localizePattern(pattern, locale string) string {
+	i := strings.Index(pattern, "/")
+	return pattern[:i] + "/" + locale + pattern[i:]
+}
+
+// addLocaleRoutes registers a variant of every template, stream, and virtual
+// route under the prefix of each locale.
+func (b *builder) addLocaleRoutes() error {
+	l := b.locales
+	for _, route := range slices.Clone(b.routes) {
+		if route.Kind != RouteTemplate && route.Kind != RouteStream && route.Kind != RouteVirtual {
+			continue
+		}
+		if slices.ContainsFunc(l.config.Exclude, func(glob string) bool { return matchPath(glob, route.Path) }) {
+			continue
+		}
+		l.localized[route.Pattern] = true
+		for _, locale := range l.config.Locales {
+			pattern, next := localizePattern(route.Pattern, locale), route.Handler
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, rest, _ := l.split(r.URL.Path)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), localeKey, activeLocale{locale, rest})))
+			})
+			if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+				return err
+			}
+			l.prefixed[pattern] = true
+			localized := newInstanceRoute(pattern, handler, route.Kind)
+			localized.Source, localized.File, localized.ContentType, localized.Metadata = route.Source, route.File, route.ContentType, route.Metadata
+			localized.NoIndex, localized.Private = route.NoIndex, route.Private
+			b.routes = append(b.routes, localized)
+			b.routeSources[pattern] = b.routeSources[route.Pattern]
+			b.Routes += 1
+		}
+	}
+	return nil
+}
+
+// redirectLocale redirects GET and HEAD requests to the bare path of a
+// localized route to the path under the negotiated locale.
+func (instance *Instance) redirectLocale(next http.Handler) http.Handler {
+	l := instance.locales
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			if _, _, ok := l.split(r.URL.Path); !ok {
+				if _, static := instance.file(path.Clean(r.URL.Path)); static {
+					next.ServeHTTP(w, r)
+					return
+				}
+				if _, pattern := instance.router.Handler(r); l.localized[pattern] {
+					w.Header().Add("Vary", "Accept-Language")
+					if l.config.Cookie != "" {
+						w.Header().Add("Vary", "Cookie")
+					}
+					u := *r.URL
+					u.Path, u.RawPath = "/"+l.negotiate(r)+r.URL.Path, ""
+					base, _ := r.Context().Value(basePathKey).(string)
+					http.Redirect(w, r, base+u.RequestURI(), http.StatusFound)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Locale returns the locale of the path prefix of the current request when
+// [Config.Locale] is set, or the default locale for requests without one. It
+// returns an empty string if no locales are configured.
+//
+//	<html lang="{{.Req.Locale}}">
+func (d DotReq) Locale() string {
+	if a, ok := d.Context().Value(localeKey).(activeLocale); ok {
+		return a.locale
+	}
+	if d.locales == nil {
+		return ""
+	}
+	return d.locales.config.Locales[0]
+}
+
+// Locales returns the supported locales, the default first.
+func (d DotReq) Locales() []string {
+	if d.locales == nil {
+		return nil
+	}
+	return d.locales.config.Locales
+}
+
+// LocalePath returns the path p under the prefix of the active locale, or p
+// if no locales are configured:
+//
+//	<a href="{{.Req.LocalePath "/blog"}}">Blog</a>
+func (d DotReq) LocalePath(p string) string {
+	if locale := d.Locale(); locale != "" {
+		return "/" + locale + p
+	}
+	return p
+}
+
+// AlternatePath returns the path of the current page under the prefix of
+// another locale, for language switchers and alternate links:
+//
+//	{{range .Req.Locales}}<link rel="alternate" hreflang="{{.}}" href="{{$.Req.AlternatePath .}}">{{end}}
+func (d DotReq) AlternatePath(locale string) string {
+	p := d.URL.Path
+	if a, ok := d.Context().Value(localeKey).(activeLocale); ok {
+		p = a.path
+	}
+	return "/" + locale + p
+}
@@ -71,7 +71,7 @@ task: mktemp: {
 
 	mktemp: file.MkdirTemp & {dir: vars.testdir, pattern: "temp-"}
 	copy: exec.Run & {
-		cmd: "cp -r templates/ data/ migrations/ " + mktemp.path
+		cmd: "cp -r templates/ data/ migrations/ redirects.csv redirects.map " + mktemp.path
 		dir: vars.testdir
 		$done: bool
 	}
@@ -93,12 +93,13 @@ task: test: {
 	vars: #vars
 
 	port:       int | *8080
+	opsport:    int | *9090
 	reportpath: string | *"report"
 
 	testfiles: file.Glob & {glob: "\(vars.testdir)/tests/*.hurl"}
 	ready: exec.Run & {cmd: "curl -X GET --retry-all-errors --retry 5 --retry-connrefused --retry-delay 1 http://localhost:\(port)/ready --silent", stdout: "OK"}
 	hurl: exec.Run & {
-		cmd: list.Concat([["hurl", "--continue-on-error", "--no-output", "--test", "--report-html", reportpath, "--connect-to", "localhost:8080:localhost:\(port)"], testfiles.files])
+		cmd: list.Concat([["hurl", "--continue-on-error", "--no-output", "--test", "--report-html", reportpath, "--connect-to", "localhost:8080:localhost:\(port)", "--connect-to", "localhost:9090:localhost:\(opsport)"], testfiles.files])
 		dir:   vars.testdir
 		after: ready.$done
 	}
@@ -171,7 +172,7 @@ task: test_docker: {
 		dir: vars.rootdir
 	}
 	run: exec.Run & {
-		cmd: ["bash", "-c", "docker run -d --rm --name xtemplate-test -p 8081:80 -v \(mktemp.mktemp.path):/app/dataw xtemplate-test"]
+		cmd: ["bash", "-c", "docker run -d --rm --name xtemplate-test -p 8081:80 -p 9091:9090 -v \(mktemp.mktemp.path):/app/dataw xtemplate-test"]
 		$after: build.$done && mktemp.copy.$done
 	}
 	logs: exec.Run & {
@@ -179,7 +180,7 @@ task: test_docker: {
 		dir:    mktemp.mktemp.path
 		$after: run.$done
 	}
-	test: task.test & {"vars": vars, port: 8081, reportpath: "\(mktemp.mktemp.path)/report", ready: $after: run.$done}
+	test: task.test & {"vars": vars, port: 8081, opsport: 9091, reportpath: "\(mktemp.mktemp.path)/report", ready: $after: run.$done}
 	stop: exec.Run & {cmd: "docker stop xtemplate-test", $after: test.hurl.$done} // be nice if we can always run this even if previous steps fail
 }
 
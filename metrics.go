@@ -0,0 +1,165 @@
+package xtemplate
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OperationMetrics are the counters of one kind of operation of a dot
+// provider, like the queries of a database or the requests to an API.
+type OperationMetrics struct {
+	Count    int64         `json:"count"`
+	Errors   int64         `json:"errors"`
+	Duration time.Duration `json:"duration"`
+}
+
+// MetricsDotProvider is implemented by dot providers that count their
+// operations. The metrics of all providers are included in
+// [Instance.ProviderMetrics], [Instance.Stats], and the metrics endpoint
+// configured by [Config.MetricsPath]. Implementations can use
+// [ProviderMetrics] to collect them.
+type MetricsDotProvider interface {
+	DotConfig
+	Metrics() map[string]OperationMetrics
+}
+
+// ProviderMetrics collects [OperationMetrics] by operation name and is safe
+// for concurrent use. The zero value is ready to use, and a nil
+// *ProviderMetrics discards observations.
+type ProviderMetrics struct {
+	mu  sync.Mutex
+	ops map[string]*OperationMetrics
+}
+
+// Observe counts an operation that took dur and failed if err isn't nil.
+func (m *ProviderMetrics) Observe(op string, dur time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ops == nil {
+		m.ops = map[string]*OperationMetrics{}
+	}
+	o, ok := m.ops[op]
+	if !ok {
+		o = &OperationMetrics{}
+		m.ops[op] = o
+	}
+	o.Count += 1
+	o.Duration += dur
+	if err != nil {
+		o.Errors += 1
+	}
+}
+
+// Snapshot returns a copy of the metrics of each operation.
+func (m *ProviderMetrics) Snapshot() map[string]OperationMetrics {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := make(map[string]OperationMetrics, len(m.ops))
+	for op, o := range m.ops {
+		s[op] = *o
+	}
+	return s
+}
+
+// ProviderMetrics returns the metrics of each dot provider of this instance
+// that implements [MetricsDotProvider], keyed by field name.
+func (x *Instance) ProviderMetrics() map[string]map[string]OperationMetrics {
+	metrics := map[string]map[string]OperationMetrics{}
+	for _, dp := range x.bufferDot.dps {
+		if m, ok := dp.(MetricsDotProvider); ok {
+			metrics[dp.FieldName()] = m.Metrics()
+		}
+	}
+	return metrics
+}
+
+// Stats returns the statistics of the instance from when it was built, with
+// the current metrics of its dot providers.
+func (x *Instance) Stats() InstanceStats {
+	var stats InstanceStats
+	if x.stats != nil {
+		stats = *x.stats
+	}
+	stats.Providers = x.ProviderMetrics()
+	return stats
+}
+
+// addMetricsRoute registers an endpoint at [Config.MetricsPath] that serves
+// the stats and provider metrics of the instance in the Prometheus text
+// format.
+func (b *builder) addMetricsRoute() error {
+	pattern := "GET " + b.config.MetricsPath
+	handler := http.HandlerFunc(b.Instance.serveMetrics)
+	if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+		return err
+	}
+	b.routes = append(b.routes, newInstanceRoute(pattern, handler, RouteBuiltin))
+	b.Routes += 1
+	return nil
+}
+
+func (x *Instance) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	metric := func(name, typ, help string, samples func(sample func(labels string, value any))) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		samples(func(labels string, value any) {
+			fmt.Fprintf(&b, "%s{%s} %v\n", name, labels, value)
+		})
+	}
+	instance := fmt.Sprintf(`instance="%d"`, x.id)
+
+	stats := x.Stats()
+	for _, stat := range []struct {
+		name, help string
+		value      int
+	}{
+		{"routes", "Number of routes.", stats.Routes},
+		{"template_files", "Number of template files.", stats.TemplateFiles},
+		{"template_definitions", "Number of template definitions.", stats.TemplateDefinitions},
+		{"static_files", "Number of static files.", stats.StaticFiles},
+	} {
+		metric("xtemplate_"+stat.name, "gauge", stat.help, func(sample func(string, any)) { sample(instance, stat.value) })
+	}
+
+	type row struct {
+		labels string
+		m      OperationMetrics
+	}
+	var rows []row
+	for provider, ops := range stats.Providers {
+		for op, m := range ops {
+			rows = append(rows, row{fmt.Sprintf(`%s,provider=%q,operation=%q`, instance, provider, op), m})
+		}
+	}
+	slices.SortFunc(rows, func(a, b row) int { return strings.Compare(a.labels, b.labels) })
+	for _, counter := range []struct {
+		name, help string
+		value      func(OperationMetrics) any
+	}{
+		{"operations_total", "Number of operations of dot providers.", func(m OperationMetrics) any { return m.Count }},
+		{"operation_errors_total", "Number of failed operations of dot providers.", func(m OperationMetrics) any { return m.Errors }},
+		{"operation_duration_seconds_total", "Total duration of operations of dot providers.", func(m OperationMetrics) any { return m.Duration.Seconds() }},
+	} {
+		metric("xtemplate_provider_"+counter.name, "counter", counter.help, func(sample func(string, any)) {
+			for _, row := range rows {
+				sample(row.labels, counter.value(row.m))
+			}
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		GetLogger(r.Context()).Debug("failed to write metrics", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,27 @@
+package xtemplate
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStatsProviderMetrics(t *testing.T) {
+	instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte("home")}}, WithResponseCache(ResponseCacheConfig{}))
+	for range 3 {
+		if status := serve(instance, http.MethodGet, "/", "192.0.2.1:1234"); status != http.StatusOK {
+			t.Fatalf("got status %d, want 200", status)
+		}
+	}
+	stats := instance.Stats()
+	if stats.Routes == 0 {
+		t.Error("expected the build stats to be included")
+	}
+	cache := stats.Providers["Cache"]
+	if cache["miss"].Count != 1 || cache["hit"].Count != 2 {
+		t.Errorf("got cache metrics %+v, want 1 miss and 2 hits", cache)
+	}
+	if snap := instance.Snapshot(); snap.Stats.Providers["Cache"]["hit"].Count != 2 {
+		t.Errorf("got snapshot stats %+v, want the cache metrics", snap.Stats)
+	}
+}
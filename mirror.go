@@ -0,0 +1,182 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+)
+
+// MirrorConfig configures asynchronously mirroring a sample of requests that
+// match a route to another server or handler and discarding the responses,
+// for example to load test a new template tree with the shape of production
+// traffic.
+type MirrorConfig struct {
+	// Base url to send mirrored requests to. The request path and query are
+	// appended to it.
+	URL string `json:"url,omitempty"`
+
+	// Handler to send mirrored requests to instead of URL, for example another
+	// [Instance].
+	Handler http.Handler `json:"-"`
+
+	// Percentage of matched requests to mirror, from 0 to 100.
+	Percent float64 `json:"percent"`
+
+	// Only mirror requests whose url path matches one of these globs, like in
+	// [AccessRule]. Mirrors all matched requests if empty.
+	Paths []string `json:"paths,omitempty"`
+
+	// Requests with larger bodies are not mirrored. Default 1MiB.
+	MaxBody int64 `json:"max_body,omitempty"`
+
+	// Maximum number of mirrored requests in flight, additional requests are
+	// dropped. Default 16.
+	MaxInFlight int `json:"max_in_flight,omitempty"`
+
+	// Timeout of each mirrored request. Default 10s.
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// Keep the Authorization, Cookie, and Proxy-Authorization headers of
+	// mirrored requests, which are removed by default. Only enable it if the
+	// mirror is as trusted as the site, since it receives the credentials of
+	// every mirrored visitor. Default `false`.
+	ForwardCredentials bool `json:"forward_credentials,omitempty"`
+}
+
+func WithMirror(mirror MirrorConfig) Option {
+	return func(c *Config) error {
+		if mirror.URL == "" && mirror.Handler == nil {
+			return fmt.Errorf("mirror requires a url or handler")
+		}
+		c.Mirror = &mirror
+		return nil
+	}
+}
+
+type mirror struct {
+	config MirrorConfig
+	target *url.URL
+	client *http.Client
+	log    *slog.Logger
+	ctx    context.Context
+	sem    chan struct{}
+}
+
+func newMirror(ctx context.Context, config MirrorConfig, log *slog.Logger) (*mirror, error) {
+	if config.MaxBody <= 0 {
+		config.MaxBody = 1 << 20
+	}
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = 16
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	m := &mirror{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		log:    log.WithGroup("mirror"),
+		ctx:    ctx,
+		sem:    make(chan struct{}, config.MaxInFlight),
+	}
+	if config.Handler == nil {
+		target, err := url.Parse(config.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mirror url: %w", err)
+		}
+		m.target = target
+	}
+	return m, nil
+}
+
+// sample decides whether to mirror r. Requests that were already mirrored are
+// never mirrored again to avoid loops.
+func (m *mirror) sample(r *http.Request) bool {
+	if r.Header.Get("X-Xtemplate-Mirror") != "" || rand.Float64()*100 >= m.config.Percent {
+		return false
+	}
+	if len(m.config.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range m.config.Paths {
+		if matchPath(pattern, r.URL.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// capture copies r with its body so it can be sent after the original request
+// is served, and replaces the original body so it can still be read by the
+// handler. The credentials of the copy are removed unless
+// [MirrorConfig.ForwardCredentials] is set. It returns nil if the body is too
+// large.
+func (m *mirror) capture(r *http.Request) *http.Request {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, m.config.MaxBody+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || int64(len(body)) > m.config.MaxBody {
+			return nil
+		}
+	}
+	req := r.Clone(m.ctx)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("X-Xtemplate-Mirror", "1")
+	if !m.config.ForwardCredentials {
+		for _, name := range credentialHeaders {
+			req.Header.Del(name)
+		}
+	}
+	if m.target != nil {
+		u := *m.target
+		u.Path = m.target.JoinPath(r.URL.Path).Path
+		u.RawQuery = r.URL.RawQuery
+		req.URL = &u
+		req.Host = u.Host
+		req.RequestURI = ""
+	}
+	return req
+}
+
+// send mirrors req in the background unless too many requests are in flight.
+func (m *mirror) send(req *http.Request) {
+	select {
+	case m.sem <- struct{}{}:
+	default:
+		m.log.Debug("dropped mirrored request, too many in flight", slog.String("path", req.URL.Path))
+		return
+	}
+	go func() {
+		defer func() { <-m.sem }()
+		start := time.Now()
+		if m.config.Handler != nil {
+			ctx, cancel := context.WithTimeout(m.ctx, m.config.Timeout)
+			defer cancel()
+			w := httptest.NewRecorder()
+			m.config.Handler.ServeHTTP(w, req.WithContext(ctx))
+			m.log.Debug("mirrored request", slog.String("path", req.URL.Path), slog.Int("status", w.Code), slog.Duration("duration", time.Since(start)))
+			return
+		}
+		resp, err := m.client.Do(req)
+		if err != nil {
+			m.log.Debug("failed to mirror request", slog.String("path", req.URL.Path), slog.Any("error", err))
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		m.log.Debug("mirrored request", slog.String("path", req.URL.Path), slog.Int("status", resp.StatusCode), slog.Duration("duration", time.Since(start)))
+	}()
+}
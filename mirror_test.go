@@ -0,0 +1,40 @@
+package xtemplate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMirrorCredentials(t *testing.T) {
+	for _, forward := range []bool{false, true} {
+		mirrored := make(chan http.Header, 1)
+		instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte("home")}}, WithMirror(MirrorConfig{
+			Handler:            http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { mirrored <- r.Header }),
+			Percent:            100,
+			ForwardCredentials: forward,
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		r.Header.Set("Cookie", "session=1")
+		r.Header.Set("X-Client", "test")
+		instance.ServeHTTP(httptest.NewRecorder(), r)
+
+		select {
+		case header := <-mirrored:
+			if header.Get("X-Client") != "test" {
+				t.Errorf("forward %t: mirrored request lost its headers: %v", forward, header)
+			}
+			if got := header.Get("Authorization") != "" && header.Get("Cookie") != ""; got != forward {
+				t.Errorf("forward %t: mirrored request has credentials %t: %v", forward, got, header)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("forward %t: request wasn't mirrored", forward)
+		}
+		if r.Header.Get("Authorization") == "" || r.Header.Get("Cookie") == "" {
+			t.Errorf("forward %t: credentials were removed from the original request", forward)
+		}
+	}
+}
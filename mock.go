@@ -0,0 +1,149 @@
+package xtemplate
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// MockConfig turns the template routes of some paths into a mock API server,
+// so frontend teams can develop against templates that return canned or
+// generated responses before the real API exists, and test how the frontend
+// handles slow and failing requests. Responses are delayed by Latency plus
+// up to Jitter, and ErrorPercent of them fail with ErrorStatus instead of
+// running the template. Injected errors are rendered like other errors, with
+// an `ERROR <status>` or `ERROR` template if there is one.
+//
+// Each request can override the config with query parameters, which are
+// removed before the template sees the query:
+//
+//	GET /api/users?_delay=2s            respond after 2s, or `_delay=500` ms
+//	GET /api/users?_status=503          fail with 503
+//	GET /api/users?_error_percent=50    fail half of the time
+//
+// Not intended for production.
+type MockConfig struct {
+	// Globs like in [AccessRule] of the paths that are mocked. Default all
+	// paths.
+	Paths []string `json:"paths,omitempty"`
+
+	// How long responses are delayed.
+	Latency time.Duration `json:"latency,omitempty"`
+
+	// Maximum random delay that is added to Latency.
+	Jitter time.Duration `json:"jitter,omitempty"`
+
+	// Percentage of requests that fail with ErrorStatus, from 0 to 100.
+	ErrorPercent float64 `json:"error_percent,omitempty"`
+
+	// Status of injected errors. Default 500.
+	ErrorStatus int `json:"error_status,omitempty"`
+}
+
+func WithMock(config MockConfig) Option {
+	return func(c *Config) error {
+		c.Mock = &config
+		return nil
+	}
+}
+
+// maxMockDelay bounds the delay that a query parameter can request.
+const maxMockDelay = time.Minute
+
+// mockParams are the query parameters that control a mocked request.
+var mockParams = []string{"_delay", "_status", "_error_percent"}
+
+type mock struct {
+	config MockConfig
+}
+
+func newMock(config MockConfig, log *slog.Logger) (*mock, error) {
+	if config.ErrorStatus == 0 {
+		config.ErrorStatus = http.StatusInternalServerError
+	}
+	if config.ErrorStatus < 400 || config.ErrorStatus > 599 {
+		return nil, fmt.Errorf("invalid mock error status %d, expected a 4xx or 5xx status", config.ErrorStatus)
+	}
+	if config.ErrorPercent < 0 || config.ErrorPercent > 100 {
+		return nil, fmt.Errorf("invalid mock error percent %v, expected 0 to 100", config.ErrorPercent)
+	}
+	log.Warn("mock mode is enabled, don't use it in production", slog.Any("paths", config.Paths), slog.Duration("latency", config.Latency), slog.Float64("error_percent", config.ErrorPercent))
+	return &mock{config: config}, nil
+}
+
+// wrap delays and fails requests to the mocked paths before passing them to
+// next.
+func (m *mock) wrap(instance *Instance, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(m.config.Paths) > 0 && !slices.ContainsFunc(m.config.Paths, func(glob string) bool { return matchPath(glob, rulePath(r)) }) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		delay, status, percent := m.config.Latency, 0, m.config.ErrorPercent
+		if m.config.Jitter > 0 {
+			delay += rand.N(m.config.Jitter)
+		}
+
+		query := r.URL.Query()
+		if v := query.Get("_delay"); v != "" {
+			d, err := time.ParseDuration(v)
+			if ms, merr := strconv.Atoi(v); merr == nil {
+				d, err = time.Duration(ms)*time.Millisecond, nil
+			}
+			if err != nil || d < 0 {
+				instance.serveError(w, r, http.StatusBadRequest, "invalid _delay, expected a duration like 500ms")
+				return
+			}
+			delay = min(d, maxMockDelay)
+		}
+		if v := query.Get("_status"); v != "" {
+			s, err := strconv.Atoi(v)
+			if err != nil || s < 400 || s > 599 {
+				instance.serveError(w, r, http.StatusBadRequest, "invalid _status, expected a 4xx or 5xx status")
+				return
+			}
+			status = s
+		}
+		if v := query.Get("_error_percent"); v != "" {
+			p, err := strconv.ParseFloat(v, 64)
+			if err != nil || p < 0 || p > 100 {
+				instance.serveError(w, r, http.StatusBadRequest, "invalid _error_percent, expected 0 to 100")
+				return
+			}
+			percent = p
+		}
+		if status == 0 && percent > 0 && rand.Float64()*100 < percent {
+			status = m.config.ErrorStatus
+		}
+
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		if status != 0 {
+			GetLogger(r.Context()).Debug("injected mock error", slog.Int("status", status), slog.Duration("delay", delay))
+			instance.serveError(w, r, status, "mock error")
+			return
+		}
+
+		if slices.ContainsFunc(mockParams, query.Has) {
+			for _, param := range mockParams {
+				query.Del(param)
+			}
+			u := *r.URL
+			u.RawQuery = query.Encode()
+			r = r.WithContext(r.Context())
+			r.URL = &u
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,58 @@
+package xtemplate
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Mount returns a handler that serves h, usually an [Instance] or
+// [Server.Handler], under the path prefix of a route in another router. The
+// prefix is stripped from the request path so templates are routed the same
+// as when served at the root, and templates can build links with
+// .Req.BasePath. Routers that accept an http.Handler can mount it directly:
+//
+//	// net/http and chi
+//	mux.Handle("/app/", xtemplate.Mount("/app", server.Handler()))
+//	r.Mount("/app", xtemplate.Mount("/app", server.Handler()))
+//	// echo
+//	e.Any("/app/*", echo.WrapHandler(xtemplate.Mount("/app", server.Handler())))
+//	// gin
+//	g.Any("/app/*path", gin.WrapH(xtemplate.Mount("/app", server.Handler())))
+//
+// If bridge is set it returns the context to serve each request with, which
+// can copy values that the router keeps outside the request context into it,
+// like values set on a gin.Context by earlier middleware. Templates can read
+// them with .Req.ContextValue, see [WithContextKey].
+func Mount(prefix string, h http.Handler, bridge ...func(r *http.Request) context.Context) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	strip := http.StripPrefix(prefix, h)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		for _, b := range bridge {
+			ctx = b(r.WithContext(ctx))
+		}
+		r = r.WithContext(context.WithValue(ctx, basePathKey, prefix))
+		if r.URL.Path == prefix {
+			// serve the root of the mounted handler instead of a 404
+			r.URL.Path += "/"
+			if r.URL.RawPath != "" {
+				r.URL.RawPath += "/"
+			}
+		}
+		strip.ServeHTTP(w, r)
+	})
+}
+
+type basePathType struct{}
+
+var basePathKey = basePathType{}
+
+// BasePath returns the path prefix that the instance is mounted under with
+// [Mount], otherwise an empty string. Prepend it to absolute links:
+//
+//	<a href="{{.Req.BasePath}}/posts">Posts</a>
+func (d DotReq) BasePath() string {
+	p, _ := d.Context().Value(basePathKey).(string)
+	return p
+}
@@ -0,0 +1,93 @@
+package xtemplate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// ClientCert describes the TLS client certificate presented with a request.
+// See [DotReq.ClientCert].
+type ClientCert struct {
+	// Distinguished names like `CN=alice,O=Example`.
+	Subject string
+	Issuer  string
+
+	CommonName     string
+	Organization   []string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+	IPAddresses    []string
+	SerialNumber   string
+	NotBefore      time.Time
+	NotAfter       time.Time
+
+	// Whether the certificate was verified against the trusted client CAs,
+	// see [Config.TLSClientCA].
+	Verified bool
+}
+
+// ClientCert returns the TLS client certificate presented with the request,
+// otherwise nil. Protect paths with [AccessRule.ClientCert] to reject requests
+// without a verified certificate.
+//
+//	{{with .Req.ClientCert}}Signed in as {{.CommonName}}{{end}}
+func (d DotReq) ClientCert() *ClientCert {
+	if d.TLS == nil || len(d.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := d.TLS.PeerCertificates[0]
+	c := &ClientCert{
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		CommonName:     cert.Subject.CommonName,
+		Organization:   cert.Subject.Organization,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		SerialNumber:   cert.SerialNumber.String(),
+		NotBefore:      cert.NotBefore,
+		NotAfter:       cert.NotAfter,
+		Verified:       verifiedClientCert(d.Request),
+	}
+	for _, u := range cert.URIs {
+		c.URIs = append(c.URIs, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		c.IPAddresses = append(c.IPAddresses, ip.String())
+	}
+	return c
+}
+
+// verifiedClientCert reports whether the request has a client certificate that
+// was verified during the handshake.
+func verifiedClientCert(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// tlsConfig returns the TLS config of the server with its certificate, which
+// requests client certificates and verifies them against [Config.TLSClientCA]
+// if it's set.
+func (config *Config) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if config.TLSClientCA != "" {
+		pem, err := os.ReadFile(config.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file '%s'", config.TLSClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
@@ -0,0 +1,166 @@
+package xtemplate
+
+import (
+	"cmp"
+	"context"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// NavNode is a node in the navigation tree generated from the hierarchy of
+// routed template files. Directories are represented by their index page if
+// they have one.
+type NavNode struct {
+	// Title of the page from the `title` key in the template file's metadata,
+	// or derived from its file name.
+	Title string
+
+	// Url path of the page. Empty for directories without an index page.
+	Path string
+
+	// The metadata block of the template file, if any.
+	Meta map[string]any
+
+	Children []*NavNode
+
+	dir   string
+	order int
+}
+
+type dotNavProvider struct {
+	root *NavNode
+}
+
+func (dotNavProvider) FieldName() string              { return "Nav" }
+func (dotNavProvider) Init(_ context.Context) error   { return nil }
+func (p dotNavProvider) Value(r Request) (any, error) { return DotNav{p.root, r.R.URL.Path}, nil }
+
+var _ DotConfig = dotNavProvider{}
+
+// DotNav is used as the .Nav field when navigation is enabled with
+// [Config.Navigation]. It exposes a tree of pages generated from the template
+// file hierarchy, so sites don't need to maintain a separate menu. Template
+// files can set `title`, `order`, and `nav` (set to false to exclude the page)
+// in their metadata block. Pages marked `private` are excluded as well:
+//
+//	---
+//	title: Getting Started
+//	order: 1
+//	---
+type DotNav struct {
+	root *NavNode
+	path string
+}
+
+// Tree returns the root node of the navigation tree.
+func (n DotNav) Tree() *NavNode {
+	return n.root
+}
+
+// Breadcrumbs returns the list of nodes from the root to the page serving the
+// current request, skipping directories without an index page.
+func (n DotNav) Breadcrumbs() []*NavNode {
+	var crumbs []*NavNode
+	node := n.root
+	for node != nil {
+		if node.Path != "" {
+			crumbs = append(crumbs, node)
+		}
+		var next *NavNode
+		for _, child := range node.Children {
+			if child.Path == n.path || (child.dir != "" && (n.path == child.dir || strings.HasPrefix(n.path, child.dir+"/"))) {
+				next = child
+				break
+			}
+		}
+		node = next
+	}
+	return crumbs
+}
+
+// Active returns true if node is the current page or one of its ancestors.
+func (n DotNav) Active(node *NavNode) bool {
+	if node == nil {
+		return false
+	}
+	if node.Path == n.path {
+		return true
+	}
+	if node.dir != "" {
+		return node.dir == "/" || n.path == node.dir || strings.HasPrefix(n.path, node.dir+"/")
+	}
+	return false
+}
+
+// buildNav builds a navigation tree out of the pages routed by template file
+// path.
+func buildNav(pages []pageInfo, ext string) *NavNode {
+	root := &NavNode{Title: "Home", dir: "/"}
+	dirs := map[string]*NavNode{"/": root}
+	var ensureDir func(dir string) *NavNode
+	ensureDir = func(dir string) *NavNode {
+		if node, ok := dirs[dir]; ok {
+			return node
+		}
+		parent := ensureDir(path.Dir(dir))
+		node := &NavNode{Title: titleFromName(path.Base(dir)), dir: dir}
+		parent.Children = append(parent.Children, node)
+		dirs[dir] = node
+		return node
+	}
+	for _, page := range pages {
+		if strings.ContainsAny(page.routePath, "{}") && !strings.HasSuffix(page.routePath, "{$}") {
+			continue // paths with wildcards can't be linked to
+		}
+		if include, ok := page.meta["nav"].(bool); (ok && !include) || page.visibility.private {
+			continue
+		}
+		name := strings.TrimSuffix(path.Base(page.templatePath), ext)
+		var node *NavNode
+		if name == "index" || name == "index{$}" {
+			node = ensureDir(path.Dir(page.templatePath))
+			node.Path = strings.TrimSuffix(page.routePath, "{$}")
+		} else {
+			parent := ensureDir(path.Dir(page.templatePath))
+			node = &NavNode{Title: titleFromName(name), Path: page.routePath}
+			parent.Children = append(parent.Children, node)
+		}
+		node.Meta = page.meta
+		if title, ok := page.meta["title"].(string); ok && title != "" {
+			node.Title = title
+		}
+		switch order := page.meta["order"].(type) {
+		case int:
+			node.order = order
+		case int64:
+			node.order = int(order)
+		case float64:
+			node.order = int(order)
+		}
+	}
+	var sortNodes func(*NavNode)
+	sortNodes = func(node *NavNode) {
+		slices.SortStableFunc(node.Children, func(a, b *NavNode) int {
+			return cmp.Or(cmp.Compare(a.order, b.order), cmp.Compare(a.Title, b.Title))
+		})
+		for _, child := range node.Children {
+			sortNodes(child)
+		}
+	}
+	sortNodes(root)
+	return root
+}
+
+// titleFromName makes a readable title out of a file name like
+// "getting-started".
+func titleFromName(name string) string {
+	name = strings.NewReplacer("-", " ", "_", " ").Replace(name)
+	r, size := utf8.DecodeRuneInString(name)
+	if r == utf8.RuneError {
+		return name
+	}
+	return string(unicode.ToUpper(r)) + name[size:]
+}
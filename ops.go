@@ -0,0 +1,96 @@
+package xtemplate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// opsMux returns the endpoints of [Config.Ops]:
+//
+//   - `/livez` responds with 200 OK while the process serves requests.
+//   - `/readyz` responds with 200 OK while the server accepts new requests,
+//     and with 503 Service Unavailable while it drains them, so the
+//     orchestrator stops routing traffic to it.
+//   - `/metrics` serves the metrics of the current instance like
+//     [Config.MetricsPath].
+//   - `/buildz` responds with the [BuildError] of the last reload as json,
+//     with no failures if it succeeded. Failures include file paths and
+//     template source, which is why the endpoints are only served on
+//     [Config.OpsListen].
+func (x *Server) opsMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /livez", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if x.draining.Load() || x.Instance() == nil {
+			http.Error(w, "draining", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		x.Instance().serveMetrics(w, r)
+	})
+	mux.HandleFunc("GET /buildz", func(w http.ResponseWriter, r *http.Request) {
+		buildErr := x.BuildError()
+		if buildErr == nil {
+			buildErr = &BuildError{Failures: []BuildFailure{}}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(buildErr)
+	})
+	return mux
+}
+
+// drain fails the readiness check, keeps serving for [Config.ShutdownDelay] so
+// the orchestrator sees it, then stops accepting connections and waits up to
+// [Config.ShutdownGracePeriod] for requests in flight to complete before
+// closing the remaining connections and stopping the server.
+func (x *Server) drain(srv *http.Server, h3 *http3.Server, ops *http.Server) error {
+	grace := x.config.ShutdownGracePeriod
+	if grace <= 0 {
+		grace = 25 * time.Second
+	}
+	delay := x.config.ShutdownDelay
+	if delay <= 0 {
+		delay = 5 * time.Second
+	}
+	log := x.config.Logger.WithGroup("shutdown")
+	log.Info("draining requests", slog.Duration("delay", delay), slog.Duration("grace_period", grace))
+	x.draining.Store(true)
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	var err error
+	if h3 != nil {
+		err = h3.Shutdown(ctx)
+	}
+	if serr := srv.Shutdown(ctx); serr != nil {
+		err = errors.Join(err, serr)
+		// streams like SSE are still open at the deadline
+		srv.Close()
+	}
+	if ops != nil {
+		ops.Close()
+	}
+
+	x.Stop()
+
+	if err != nil {
+		log.Warn("requests didn't complete within the grace period", slog.Any("error", err))
+	} else {
+		log.Info("drained all requests")
+	}
+	return nil
+}
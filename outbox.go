@@ -0,0 +1,410 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxConfig configures outbound webhooks: templates send events with the
+// .Webhooks dot field, see [DotWebhooks], which are stored in an outbox table
+// of a database provider and delivered to the matching subscribers by a
+// background worker, so a slow or failing subscriber doesn't fail the request
+// and deliveries survive restarts.
+//
+// Each delivery is a POST request with the JSON payload as the body and the
+// headers `X-Webhook-Event`, `X-Webhook-Id`, and `X-Webhook-Signature`, which
+// is `sha256=` followed by the hex encoded HMAC-SHA256 of the body keyed by
+// the secret of the subscriber, like the signatures [WebhookConfig] accepts.
+// Failed deliveries are retried with exponential backoff.
+type OutboxConfig struct {
+	// Name of the database provider that stores the outbox. Defaults to the
+	// first database.
+	Database string `json:"database,omitempty"`
+
+	// Name of the outbox table, which is created if it doesn't exist. Default
+	// `webhook_outbox`.
+	Table string `json:"table,omitempty"`
+
+	// Receivers of events.
+	Subscribers []WebhookSubscriber `json:"subscribers"`
+
+	// Number of attempts after which a delivery is marked as failed. Default
+	// 8.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	// Delay before the first retry, which doubles with every attempt up to an
+	// hour. Default 30s.
+	RetryBackoff time.Duration `json:"retry_backoff,omitempty"`
+
+	// How often the worker checks for due deliveries. Events sent by this
+	// instance are delivered immediately. Default 5s.
+	PollInterval time.Duration `json:"poll_interval,omitempty"`
+
+	// Timeout of each delivery attempt. Default 10s.
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// WebhookSubscriber receives the events that match one of its Events.
+type WebhookSubscriber struct {
+	URL string `json:"url"`
+
+	// Key of the signature of each delivery.
+	Secret string `json:"secret,omitempty"`
+
+	// Event names or [path.Match] patterns like `order.*`. Default all
+	// events.
+	Events []string `json:"events,omitempty"`
+}
+
+func WithOutbox(outbox OutboxConfig) Option {
+	return func(c *Config) error {
+		if len(outbox.Subscribers) == 0 {
+			return fmt.Errorf("cannot create webhook outbox without subscribers")
+		}
+		c.Outbox = &outbox
+		return nil
+	}
+}
+
+// WebhookDelivery is the state of the delivery of an event to a subscriber.
+type WebhookDelivery struct {
+	// The id returned by [DotWebhooks.Send], shared by the deliveries of an
+	// event to all of its subscribers.
+	ID    string
+	Event string
+	URL   string
+
+	// `pending`, `delivered`, or `failed`.
+	Status   string
+	Attempts int
+	// The response status of the last attempt, 0 if it got no response.
+	LastStatus int
+	LastError  string
+
+	Created     time.Time
+	NextAttempt time.Time
+	Delivered   *time.Time
+}
+
+type outbox struct {
+	config OutboxConfig
+	db     *DotDBConfig
+	client *http.Client
+	wake   chan struct{}
+	// number of concurrent deliveries
+	workers int
+}
+
+func newOutbox(config OutboxConfig) *outbox {
+	if config.Table == "" {
+		config.Table = "webhook_outbox"
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 8
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = 30 * time.Second
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 5 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	return &outbox{config: config, client: &http.Client{Timeout: config.Timeout}, wake: make(chan struct{}, 1)}
+}
+
+// dotWebhooksProvider provides the .Webhooks dot field. Its db is set when the
+// outbox is started.
+type dotWebhooksProvider struct {
+	*outbox
+}
+
+func (dotWebhooksProvider) FieldName() string            { return "Webhooks" }
+func (dotWebhooksProvider) Init(_ context.Context) error { return nil }
+func (p dotWebhooksProvider) Value(r Request) (any, error) {
+	return DotWebhooks{p.outbox, r.R.Context()}, nil
+}
+
+var _ DotConfig = dotWebhooksProvider{}
+
+// DotWebhooks is used as the .Webhooks dot field when [Config.Outbox] is set,
+// and sends outbound webhooks and reports their delivery status:
+//
+//	{{$id := .Webhooks.Send "order.paid" (dict "order" $order.id "total" $order.total)}}
+//	{{range .Webhooks.Status $id}}<li>{{.URL}}: {{.Status}} after {{.Attempts}} attempts{{end}}
+type DotWebhooks struct {
+	o   *outbox
+	ctx context.Context
+}
+
+// Send stores a delivery of the event with the JSON encoded payload for each
+// subscriber of the event, and returns the id of the event. It returns an
+// empty id if no subscriber matches.
+func (d DotWebhooks) Send(event string, payload any) (string, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	var urls []string
+	for _, s := range d.o.config.Subscribers {
+		if s.subscribes(event) {
+			urls = append(urls, s.URL)
+		}
+	}
+	if len(urls) == 0 {
+		return "", nil
+	}
+	id := uuid.NewString()
+	now := time.Now().UTC()
+	tx, err := d.o.db.DB.BeginTx(d.ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+	for _, url := range urls {
+		_, err := tx.ExecContext(d.ctx, fmt.Sprintf("INSERT INTO %s (id, event, url, payload, status, attempts, next_attempt, last_status, last_error, created) VALUES (?, ?, ?, ?, 'pending', 0, ?, 0, '', ?)", d.o.config.Table),
+			id, event, url, string(body), now, now)
+		if err != nil {
+			return "", fmt.Errorf("failed to store webhook: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to store webhook: %w", err)
+	}
+	select {
+	case d.o.wake <- struct{}{}:
+	default:
+	}
+	return id, nil
+}
+
+// Status returns the deliveries of the event with the given id.
+func (d DotWebhooks) Status(id string) ([]WebhookDelivery, error) {
+	return d.o.deliveries(d.ctx, "WHERE id = ? ORDER BY url", id)
+}
+
+// Recent returns the most recently sent deliveries, newest first, optionally
+// only those with the given status.
+func (d DotWebhooks) Recent(limit int, status ...string) ([]WebhookDelivery, error) {
+	if len(status) > 1 {
+		return nil, fmt.Errorf("too many status arguments")
+	}
+	if len(status) == 1 {
+		return d.o.deliveries(d.ctx, "WHERE status = ? ORDER BY created DESC LIMIT ?", status[0], limit)
+	}
+	return d.o.deliveries(d.ctx, "ORDER BY created DESC LIMIT ?", limit)
+}
+
+func (s WebhookSubscriber) subscribes(event string) bool {
+	return len(s.Events) == 0 || slices.ContainsFunc(s.Events, func(pattern string) bool {
+		ok, _ := path.Match(pattern, event)
+		return ok
+	})
+}
+
+func (o *outbox) deliveries(ctx context.Context, where string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := o.db.DB.QueryContext(ctx, fmt.Sprintf("SELECT id, event, url, status, attempts, last_status, last_error, created, next_attempt, delivered FROM %s %s", o.config.Table, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		var delivered sql.NullTime
+		if err := rows.Scan(&d.ID, &d.Event, &d.URL, &d.Status, &d.Attempts, &d.LastStatus, &d.LastError, &d.Created, &d.NextAttempt, &delivered); err != nil {
+			return nil, err
+		}
+		if delivered.Valid {
+			d.Delivered = &delivered.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// startOutbox creates the outbox table in the configured database provider,
+// which must already be initialized, and starts the delivery worker, which
+// runs until the instance is retired.
+func (b *builder) startOutbox(o *outbox, dot []DotConfig) error {
+	o.db = findDotDB(dot, o.config.Database)
+	o.workers = b.config.WebhookWorkers
+	if o.db == nil {
+		return fmt.Errorf("outbox database provider not found: '%s'", o.config.Database)
+	}
+	if !sqlIdentifier.MatchString(o.config.Table) {
+		return fmt.Errorf("invalid outbox table name: '%s'", o.config.Table)
+	}
+	for _, s := range o.config.Subscribers {
+		if s.URL == "" {
+			return fmt.Errorf("outbox subscriber url is required")
+		}
+	}
+	_, err := o.db.DB.ExecContext(b.config.Ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id TEXT NOT NULL,
+		event TEXT NOT NULL,
+		url TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL,
+		next_attempt TIMESTAMP NOT NULL,
+		last_status INTEGER NOT NULL,
+		last_error TEXT NOT NULL,
+		created TIMESTAMP NOT NULL,
+		delivered TIMESTAMP,
+		PRIMARY KEY (id, url)
+	)`, o.config.Table))
+	if err != nil {
+		return fmt.Errorf("failed to create outbox table: %w", err)
+	}
+	go o.run(b.config.Ctx, b.config.Logger.WithGroup("outbox"))
+	return nil
+}
+
+// run delivers due deliveries every PollInterval and whenever an event is
+// sent, until ctx is cancelled.
+func (o *outbox) run(ctx context.Context, log *slog.Logger) {
+	ticker := time.NewTicker(o.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		o.deliverDue(ctx, log)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+type outboxRow struct {
+	id, event, url, payload string
+	attempts                int
+}
+
+func (o *outbox) deliverDue(ctx context.Context, log *slog.Logger) {
+	rows, err := o.db.DB.QueryContext(ctx, fmt.Sprintf("SELECT id, event, url, payload, attempts FROM %s WHERE status = 'pending' AND next_attempt <= ? ORDER BY next_attempt LIMIT 100", o.config.Table), time.Now().UTC())
+	if err != nil {
+		log.Warn("failed to query due webhooks", slog.Any("error", err))
+		return
+	}
+	var due []outboxRow
+	for rows.Next() {
+		var r outboxRow
+		if err := rows.Scan(&r.id, &r.event, &r.url, &r.payload, &r.attempts); err != nil {
+			log.Warn("failed to read due webhook", slog.Any("error", err))
+			continue
+		}
+		due = append(due, r)
+	}
+	rows.Close()
+	sem := make(chan struct{}, max(o.workers, 1))
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, r := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		// claim the delivery so another instance sharing the database, like a
+		// staged candidate, doesn't deliver it at the same time
+		now := time.Now().UTC()
+		res, err := o.db.DB.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET next_attempt = ? WHERE id = ? AND url = ? AND status = 'pending' AND next_attempt <= ?", o.config.Table),
+			now.Add(2*o.config.Timeout), r.id, r.url, now)
+		if err != nil {
+			log.Warn("failed to claim due webhook", slog.Any("error", err))
+			continue
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			o.deliver(ctx, log, r)
+			<-sem
+		}()
+	}
+}
+
+// deliver attempts a delivery and records its outcome.
+func (o *outbox) deliver(ctx context.Context, log *slog.Logger, r outboxRow) {
+	log = log.With(slog.String("id", r.id), slog.String("event", r.event), slog.String("url", r.url))
+	status, err := o.post(ctx, r)
+	attempts := r.attempts + 1
+	now := time.Now().UTC()
+	table := o.config.Table
+	switch {
+	case err == nil:
+		_, err = o.db.DB.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET status = 'delivered', attempts = ?, last_status = ?, last_error = '', delivered = ? WHERE id = ? AND url = ?", table), attempts, status, now, r.id, r.url)
+		log.Debug("delivered webhook", slog.Int("attempts", attempts))
+	case attempts >= o.config.MaxAttempts:
+		log.Warn("failed to deliver webhook, giving up", slog.Int("attempts", attempts), slog.Any("error", err))
+		_, err = o.db.DB.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET status = 'failed', attempts = ?, last_status = ?, last_error = ? WHERE id = ? AND url = ?", table), attempts, status, err.Error(), r.id, r.url)
+	default:
+		backoff := retryBackoff(o.config.RetryBackoff, attempts)
+		log.Info("failed to deliver webhook, retrying", slog.Int("attempts", attempts), slog.Duration("backoff", backoff), slog.Any("error", err))
+		_, err = o.db.DB.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET attempts = ?, last_status = ?, last_error = ?, next_attempt = ? WHERE id = ? AND url = ?", table), attempts, status, err.Error(), now.Add(backoff), r.id, r.url)
+	}
+	if err != nil {
+		log.Warn("failed to update webhook delivery", slog.Any("error", err))
+	}
+}
+
+// retryBackoff returns how long to wait after the given number of failed
+// attempts: base doubled for each attempt after the first, up to an hour.
+func retryBackoff(base time.Duration, attempts int) time.Duration {
+	// capping the shift keeps it from overflowing with many attempts
+	shift := min(attempts-1, 20)
+	if base > time.Hour>>shift {
+		return time.Hour
+	}
+	return base << shift
+}
+
+// post sends a delivery and returns the response status, and an error unless
+// the status is 2xx.
+func (o *outbox) post(ctx context.Context, r outboxRow) (int, error) {
+	i := slices.IndexFunc(o.config.Subscribers, func(s WebhookSubscriber) bool { return s.URL == r.url })
+	if i < 0 {
+		return 0, fmt.Errorf("no subscriber with this url is configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader([]byte(r.payload)))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", r.event)
+	req.Header.Set("X-Webhook-Id", r.id)
+	if secret := o.config.Subscribers[i].Secret; secret != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(r.payload))
+		req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
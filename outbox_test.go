@@ -0,0 +1,26 @@
+package xtemplate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		base     time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{time.Second, 1, time.Second},
+		{time.Second, 3, 4 * time.Second},
+		{time.Second, 13, time.Hour},
+		{time.Second, 64, time.Hour},
+		{time.Second, 1000, time.Hour},
+		{2 * time.Hour, 1, time.Hour},
+		{time.Nanosecond, 100, time.Nanosecond << 20},
+	} {
+		if got := retryBackoff(tc.base, tc.attempts); got != tc.want {
+			t.Errorf("retryBackoff(%s, %d) = %s, want %s", tc.base, tc.attempts, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package xtemplate
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+//go:embed playground.html
+var playgroundHTML string
+
+var playgroundPage = template.Must(template.New("playground").Parse(playgroundHTML))
+
+type playground struct {
+	instance *Instance
+	path     string
+}
+
+type playgroundData struct {
+	Path, Route, Source string
+	Routes              []string
+
+	Ran      bool
+	Output   string
+	Duration time.Duration
+	Error    string
+}
+
+// addPlaygroundRoutes registers the template playground at
+// [Config.PlaygroundPath].
+func (b *builder) addPlaygroundRoutes() error {
+	p := &playground{instance: b.Instance, path: b.config.PlaygroundPath}
+	handler := b.Instance.authorizeAdmin(p.ServeHTTP)
+	for _, pattern := range []string{"GET " + p.path, "POST " + p.path} {
+		if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+			return err
+		}
+		b.routes = append(b.routes, newInstanceRoute(pattern, handler, RouteBuiltin))
+		b.Routes += 1
+	}
+	b.config.Logger.Warn("added template playground, don't use it in production", slog.String("path", p.path))
+	return nil
+}
+
+func (p *playground) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := playgroundData{Path: p.path, Route: "/"}
+	for pattern, source := range p.instance.routeSources {
+		if _, static := p.instance.files[source]; static {
+			continue
+		}
+		if path, ok := strings.CutPrefix(pattern, "GET "); ok && strings.HasPrefix(path, "/") {
+			data.Routes = append(data.Routes, strings.TrimSuffix(path, "{$}"))
+		}
+	}
+	slices.Sort(data.Routes)
+
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+		data.Route, data.Source = r.PostForm.Get("route"), r.PostForm.Get("source")
+		start := time.Now()
+		output, err := p.run(r, data.Route, data.Source)
+		data.Ran, data.Output, data.Duration = true, output, time.Since(start).Round(time.Microsecond)
+		if err != nil {
+			data.Error = err.Error()
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := playgroundPage.Execute(w, data); err != nil {
+		GetLogger(r.Context()).Error("failed to render playground", slog.Any("error", err))
+	}
+}
+
+// run evaluates source against the dot of a GET request to route with the
+// headers of r. It's limited by the timeout and buffer size of the route, or
+// cancelled after 10 seconds if there's no timeout.
+func (p *playground) run(r *http.Request, route, source string) (string, error) {
+	instance := p.instance
+	if !strings.HasPrefix(route, "/") {
+		return "", fmt.Errorf("route must be a url path like /blog")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, route, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header = r.Header.Clone()
+	req.RemoteAddr = r.RemoteAddr
+	if _, pattern := instance.router.Handler(req); pattern != "" {
+		if limits, ok := instance.routeLimits[pattern]; ok {
+			req = req.WithContext(context.WithValue(req.Context(), routeLimitsKey, limits))
+		}
+	}
+	timeout := instance.limits(req).timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	return instance.Eval(req.WithContext(ctx), source, false)
+}
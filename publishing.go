@@ -0,0 +1,229 @@
+package xtemplate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// previewCookie holds the preview token after it was passed in the `preview`
+// query parameter, so links from a previewed page can be followed.
+const previewCookie = "xtemplate-preview"
+
+// publishState is read from the `draft` and `publishDate` (or
+// `publish_date`) front matter keys of a template file or content document.
+// Unpublished content is hidden unless the request is a preview, see
+// [Config.ShowDrafts] and [Config.PreviewToken].
+type publishState struct {
+	draft     bool
+	publishAt time.Time
+}
+
+func metaPublishState(meta map[string]any) (publishState, error) {
+	var s publishState
+	if v, ok := meta["draft"]; ok {
+		draft, err := cast.ToBoolE(v)
+		if err != nil {
+			return s, fmt.Errorf("invalid draft: '%v'", v)
+		}
+		s.draft = draft
+	}
+	for _, key := range []string{"publishDate", "publish_date"} {
+		if v, ok := meta[key]; ok {
+			t, err := cast.ToTimeE(v)
+			if err != nil {
+				return s, fmt.Errorf("invalid %s: '%v'", key, v)
+			}
+			s.publishAt = t
+		}
+	}
+	return s, nil
+}
+
+// scheduled reports whether the content may be unpublished at some time.
+func (s publishState) scheduled() bool {
+	return s.draft || !s.publishAt.IsZero()
+}
+
+func (s publishState) published(now time.Time) bool {
+	return !s.draft && !now.Before(s.publishAt)
+}
+
+// preview reports whether unpublished content is shown for the request.
+func (instance *Instance) preview(r *http.Request) bool {
+	return instance.config.ShowDrafts || instance.previewToken(r) != ""
+}
+
+// previewToken returns the valid preview token of the request from the
+// `preview` query parameter or the preview cookie, if any. Signed tokens are
+// only valid for the path they were created for and the paths below it.
+func (instance *Instance) previewToken(r *http.Request) string {
+	if instance.config.PreviewToken == "" && instance.config.PreviewSecret == "" {
+		return ""
+	}
+	for _, token := range []string{r.URL.Query().Get("preview"), cookieValue(r, previewCookie)} {
+		if token == "" {
+			continue
+		}
+		if t := instance.config.PreviewToken; t != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return token
+		}
+		if scope, _, ok := verifyPreviewToken(instance.config.PreviewSecret, token, time.Now()); ok && inPreviewScope(scope, rulePath(r)) {
+			return token
+		}
+	}
+	return ""
+}
+
+// inPreviewScope reports whether urlpath is scope or below it.
+func inPreviewScope(scope, urlpath string) bool {
+	scope = strings.TrimSuffix(scope, "/")
+	return scope == "" || urlpath == scope || strings.HasPrefix(urlpath, scope+"/")
+}
+
+func cookieValue(r *http.Request, name string) string {
+	if c, err := r.Cookie(name); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// withPreview marks the responses to preview requests as uncacheable and
+// remembers a preview token passed in the query in a cookie, so links from a
+// previewed page can be followed.
+func (instance *Instance) withPreview(w http.ResponseWriter, r *http.Request) {
+	token := instance.previewToken(r)
+	if token == "" {
+		return
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if r.URL.Query().Get("preview") != token {
+		return
+	}
+	cookie := &http.Cookie{Name: previewCookie, Value: token, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode, Secure: clientScheme(r) == "https"}
+	if scope, expires, ok := verifyPreviewToken(instance.config.PreviewSecret, token, time.Now()); ok {
+		cookie.Path = scope
+		cookie.Expires = expires
+	}
+	http.SetCookie(w, cookie)
+}
+
+// withPublishing responds with 404 Not Found to requests for unpublished
+// content, unless the request is a preview.
+func withPublishing(instance *Instance, handler http.HandlerFunc, state publishState) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !state.published(time.Now()) && !instance.preview(r) {
+			instance.serveError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// PreviewLink returns path with a `preview` query parameter that shows
+// unpublished content at path and the paths below it until ttl has passed,
+// signed with [Config.PreviewSecret], so editors can share links to drafts
+// without sharing a permanent secret or unlocking the rest of the site:
+//
+//	https://example.com/blog/next-post?preview=...
+func (config *Config) PreviewLink(path string, ttl time.Duration) (string, error) {
+	if config.PreviewSecret == "" {
+		return "", fmt.Errorf("preview links require a preview secret")
+	}
+	if ttl <= 0 {
+		return "", fmt.Errorf("preview link ttl must be positive")
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	scope := u.Path
+	if !strings.HasPrefix(scope, "/") {
+		return "", fmt.Errorf("preview link path must start with /: '%s'", path)
+	}
+	q := u.Query()
+	q.Set("preview", signPreviewToken(config.PreviewSecret, scope, time.Now().Add(ttl)))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// signPreviewToken returns a token of the expiration time, the path it's
+// scoped to, and their signature.
+func signPreviewToken(secret, scope string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("preview:" + exp + ":" + scope))
+	return exp + "." + base64.RawURLEncoding.EncodeToString([]byte(scope)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyPreviewToken returns the path scope and expiration time of a token
+// signed with secret, and whether it's valid at now.
+func verifyPreviewToken(secret, token string, now time.Time) (string, time.Time, bool) {
+	if secret == "" {
+		return "", time.Time{}, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	scope, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	expires := time.Unix(unix, 0)
+	if !now.Before(expires) || !hmac.Equal([]byte(token), []byte(signPreviewToken(secret, string(scope), expires))) {
+		return "", time.Time{}, false
+	}
+	return string(scope), expires, true
+}
+
+// Preview reports whether the current request is a preview, which shows
+// unpublished content. Templates can use it to bypass their own caches or to
+// show a preview banner.
+func (d DotReq) Preview() bool {
+	return d.instance != nil && d.instance.preview(d.Request)
+}
+
+// PreviewLink returns a signed link to path that shows unpublished content
+// until ttl has passed, like `24h`. See [Config.PreviewLink].
+func (d DotReq) PreviewLink(path string, ttl any) (string, error) {
+	if d.instance == nil {
+		return "", fmt.Errorf("no instance")
+	}
+	dur, err := cast.ToDurationE(ttl)
+	if err != nil {
+		return "", err
+	}
+	return d.instance.config.PreviewLink(path, dur)
+}
+
+// Published reports whether content with the given front matter is visible
+// to the current request: it's not a `draft` and its `publishDate` has
+// passed, or the request is a preview. Use it to filter content that
+// templates list themselves, like markdown posts:
+//
+//	{{range .FS.List "posts"}}
+//	{{$doc := splitFrontMatter ($.FS.Read (print "posts/" .Name))}}
+//	{{if $.Req.Published $doc.Meta}}<li>{{$doc.Meta.title}}{{end}}
+//	{{end}}
+func (d DotReq) Published(meta map[string]any) (bool, error) {
+	state, err := metaPublishState(meta)
+	if err != nil {
+		return false, err
+	}
+	return state.published(time.Now()) || (d.instance != nil && d.instance.preview(d.Request)), nil
+}
@@ -0,0 +1,58 @@
+package xtemplate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestPreviewLinkScope(t *testing.T) {
+	draft := &fstest.MapFile{Data: []byte("---\ndraft: true\n---\ndraft")}
+	instance := testInstance(t, fstest.MapFS{"blog/next.html": draft, "blog/other.html": draft},
+		WithTrustedProxies("10.0.0.0/8"),
+		func(c *Config) error {
+			c.PreviewSecret = "secret"
+			return nil
+		},
+	)
+	link, err := instance.config.PreviewLink("/blog/next", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(link)
+	token := u.Query().Get("preview")
+
+	request := func(target string, cookie bool) (*httptest.ResponseRecorder, *http.Cookie) {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Forwarded-Proto", "https")
+		if cookie {
+			r.AddCookie(&http.Cookie{Name: previewCookie, Value: token})
+		}
+		w := httptest.NewRecorder()
+		instance.ServeHTTP(w, r)
+		for _, c := range w.Result().Cookies() {
+			if c.Name == previewCookie {
+				return w, c
+			}
+		}
+		return w, nil
+	}
+
+	w, cookie := request(link, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d for the previewed page, want 200", w.Code)
+	}
+	if cookie == nil || cookie.Path != "/blog/next" || !cookie.Secure {
+		t.Errorf("got preview cookie %+v, want a secure cookie for /blog/next", cookie)
+	}
+	if w, _ := request("/blog/other?preview="+url.QueryEscape(token), false); w.Code != http.StatusNotFound {
+		t.Errorf("got status %d for another page with the token, want 404", w.Code)
+	}
+	if w, _ := request("/blog/other", true); w.Code != http.StatusNotFound {
+		t.Errorf("got status %d for another page with the cookie, want 404", w.Code)
+	}
+}
@@ -0,0 +1,200 @@
+package xtemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// RecordConfig configures an opt-in recorder that saves requests to disk so
+// they can be replayed against another Instance with [Instance.Replay] to
+// reproduce bugs reported by users. Credentials in the Authorization, Cookie,
+// and Proxy-Authorization headers are redacted, so recordings can't be used
+// to take over a user's session.
+type RecordConfig struct {
+	// Directory to write recordings into. Required.
+	Dir string `json:"dir"`
+
+	// Only record requests whose url path matches one of these [path.Match]
+	// patterns. Records all requests if empty.
+	Paths []string `json:"paths,omitempty"`
+
+	// Maximum request body size to record. Requests with larger bodies are
+	// recorded without a body. Default 1MiB.
+	MaxBody int64 `json:"max_body,omitempty"`
+}
+
+func WithRecorder(record RecordConfig) Option {
+	return func(c *Config) error {
+		if record.Dir == "" {
+			return fmt.Errorf("recorder requires a directory")
+		}
+		c.Record = &record
+		return nil
+	}
+}
+
+// RecordedRequest is a request captured by the recorder.
+type RecordedRequest struct {
+	RequestId     string      `json:"request_id"`
+	Time          time.Time   `json:"time"`
+	Instance      int64       `json:"instance"`
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	Host          string      `json:"host"`
+	RemoteAddr    string      `json:"remote_addr"`
+	Header        http.Header `json:"header"`
+	Body          []byte      `json:"body,omitempty"`
+	BodyTruncated bool        `json:"body_truncated,omitempty"`
+	Status        int         `json:"status"`
+	Databases     []string    `json:"databases,omitempty"`
+}
+
+// ReadRecording reads a recorded request from the file at path.
+func ReadRecording(path string) (*RecordedRequest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recording '%s': %w", path, err)
+	}
+	var rec RecordedRequest
+	if err := json.Unmarshal(content, &rec); err != nil {
+		return nil, fmt.Errorf("failed to decode recording '%s': %w", path, err)
+	}
+	return &rec, nil
+}
+
+// Request reconstructs the recorded http request.
+func (rec *RecordedRequest) Request() *http.Request {
+	r := httptest.NewRequest(rec.Method, rec.URL, bytes.NewReader(rec.Body))
+	r.Header = rec.Header.Clone()
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	r.Host = rec.Host
+	r.RemoteAddr = rec.RemoteAddr
+	return r
+}
+
+// Replay re-executes a recorded request against this instance and returns the
+// recorded response.
+func (instance *Instance) Replay(rec *RecordedRequest) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	instance.ServeHTTP(w, rec.Request())
+	return w
+}
+
+type recorder struct {
+	config    RecordConfig
+	instance  int64
+	databases []string
+	log       *slog.Logger
+}
+
+func newRecorder(config RecordConfig, instance int64, databases []string, log *slog.Logger) (*recorder, error) {
+	if config.MaxBody <= 0 {
+		config.MaxBody = 1 << 20
+	}
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory '%s': %w", config.Dir, err)
+	}
+	return &recorder{config, instance, databases, log.WithGroup("recorder")}, nil
+}
+
+func (rc *recorder) matches(r *http.Request) bool {
+	if len(rc.config.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range rc.config.Paths {
+		if ok, _ := path.Match(pattern, r.URL.Path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// start captures the request and replaces its body so it can still be read by
+// the handler.
+func (rc *recorder) start(r *http.Request, rid string) *RecordedRequest {
+	rec := &RecordedRequest{
+		RequestId:  rid,
+		Time:       time.Now(),
+		Instance:   rc.instance,
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Header:     redactHeader(r.Header),
+		Databases:  rc.databases,
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(r.Body, rc.config.MaxBody+1))
+		if err != nil {
+			rc.log.Warn("failed to read request body", slog.Any("error", err))
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if int64(len(body)) > rc.config.MaxBody {
+			rec.BodyTruncated = true
+		} else {
+			rec.Body = body
+		}
+	}
+	return rec
+}
+
+func (rc *recorder) finish(rec *RecordedRequest, status int) {
+	rec.Status = status
+	content, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		rc.log.Warn("failed to encode recording", slog.Any("error", err))
+		return
+	}
+	name := filepath.Join(rc.config.Dir, fmt.Sprintf("%s-%s.json", rec.Time.UTC().Format("20060102T150405.000000000"), recordingName(rec.RequestId)))
+	if err := os.WriteFile(name, content, 0o644); err != nil {
+		rc.log.Warn("failed to write recording", slog.String("file", name), slog.Any("error", err))
+		return
+	}
+	rc.log.Debug("recorded request", slog.String("file", name))
+}
+
+// maxRecordingName bounds the length of the request id in a recording's file
+// name.
+const maxRecordingName = 128
+
+// recordingName returns the request id rid with every byte that isn't a
+// letter, digit, dot, underscore, or dash replaced, so request ids that
+// clients control can't name a file outside of the recording directory.
+func recordingName(rid string) string {
+	name := []byte(rid[:min(len(rid), maxRecordingName)])
+	for i, c := range name {
+		if !requestIDByte(c) {
+			name[i] = '_'
+		}
+	}
+	return string(name)
+}
+
+// credentialHeaders are the request headers that carry credentials.
+var credentialHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// redactHeader returns a copy of header with the values of credentialHeaders
+// redacted.
+func redactHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range credentialHeaders {
+		if _, ok := header[name]; ok {
+			header[name] = []string{"<redacted>"}
+		}
+	}
+	return header
+}
@@ -0,0 +1,284 @@
+package xtemplate
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// redirect is a rule loaded from one of [Config.RedirectFiles].
+type redirect struct {
+	from, to string
+	status   int
+	file     string
+	line     int
+}
+
+// addRedirects loads the rules of [Config.RedirectFiles] and registers a
+// route for each. All invalid rules and conflicts between rules are
+// collected, so a migration can be fixed in one pass.
+func (b *builder) addRedirects() error {
+	if len(b.config.RedirectFiles) == 0 {
+		return nil
+	}
+	var failures []BuildFailure
+	fail := func(r redirect, format string, args ...any) {
+		failures = append(failures, BuildFailure{Stage: b.stage, File: r.file, Line: r.line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var rules []redirect
+	for _, name := range b.config.RedirectFiles {
+		rs, fails := b.loadRedirectFile(name)
+		rules, failures = append(rules, rs...), append(failures, fails...)
+	}
+
+	byFrom := make(map[string]redirect, len(rules))
+	var unique []redirect
+	for _, r := range rules {
+		if prev, ok := byFrom[r.from]; ok {
+			if prev.to != r.to || prev.status != r.status {
+				fail(r, "redirect from '%s' to '%s' conflicts with the redirect to '%s' at %s:%d", r.from, r.to, prev.to, prev.file, prev.line)
+			}
+			continue
+		}
+		byFrom[r.from] = r
+		unique = append(unique, r)
+	}
+
+	for _, r := range unique {
+		// follow redirects to paths that are redirected again, a loop would
+		// never resolve and a chain costs clients a round trip per hop
+		final, seen := r.to, map[string]bool{r.from: true}
+		for {
+			next, ok := byFrom[redirectTargetPath(final)]
+			if !ok {
+				break
+			}
+			if seen[next.from] {
+				fail(r, "redirect from '%s' to '%s' leads into a redirect loop at '%s'", r.from, r.to, next.from)
+				break
+			}
+			seen[next.from], final = true, next.to
+		}
+		if final != r.to && redirectTargetPath(final) != r.from {
+			b.config.Logger.Warn("redirect leads to another redirect, point it at the final target instead",
+				slog.String("from", r.from), slog.String("to", r.to), slog.String("final", final), slog.String("file", fmt.Sprintf("%s:%d", r.file, r.line)))
+		}
+	}
+	if len(failures) > 0 {
+		return &BuildError{Failures: failures}
+	}
+
+	for _, r := range unique {
+		pattern := "GET " + r.from
+		if strings.HasSuffix(r.from, "/") {
+			pattern += "{$}"
+		}
+		route := newInstanceRoute(pattern, redirectHandler(r.to, r.status), RouteRedirect)
+		route.Source, route.File = r.to, fmt.Sprintf("%s:%d", r.file, r.line)
+		added, err := b.handleRoute(route)
+		if err != nil {
+			fail(r, "%s", err)
+			continue
+		}
+		if added {
+			b.routes = append(b.routes, route)
+			b.Routes += 1
+		}
+	}
+	if len(failures) > 0 {
+		return &BuildError{Failures: failures}
+	}
+	b.config.Logger.Debug("added redirects", slog.Int("count", len(unique)), slog.Any("files", b.config.RedirectFiles))
+	return nil
+}
+
+// redirectHandler redirects to to with status, keeping the query of the
+// request if to doesn't have one.
+func redirectHandler(to string, status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := to
+		if r.URL.RawQuery != "" && !strings.Contains(to, "?") {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, status)
+	}
+}
+
+// redirectTargetPath returns the path of the redirect target to if it's on
+// the same site, otherwise an empty string.
+func redirectTargetPath(to string) string {
+	if !strings.HasPrefix(to, "/") || strings.HasPrefix(to, "//") {
+		return ""
+	}
+	p, _, _ := strings.Cut(to, "?")
+	p, _, _ = strings.Cut(p, "#")
+	return p
+}
+
+// loadRedirectFile reads the rules in the file name by its extension: `.csv`
+// for rows of `from,to[,status]`, and `.map` or `.conf` for an nginx map. It
+// returns the valid rules and a failure for each invalid one.
+func (b *builder) loadRedirectFile(name string) ([]redirect, []BuildFailure) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, []BuildFailure{b.buildFailure(name, fmt.Errorf("failed to open redirect file: %w", err))}
+	}
+	defer f.Close()
+	var rules []redirect
+	var failures []BuildFailure
+	add := func(line int, fields []string) {
+		r, err := newRedirect(fields)
+		if err != nil {
+			failures = append(failures, BuildFailure{Stage: b.stage, File: name, Line: line, Message: err.Error(), Err: err})
+			return
+		}
+		r.file, r.line = name, line
+		rules = append(rules, r)
+	}
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".csv":
+		err = readRedirectCSV(f, add)
+	case ".map", ".conf":
+		err = readRedirectNginxMap(f, add)
+	default:
+		err = fmt.Errorf("unsupported redirect file extension '%s', expected .csv, .map, or .conf", ext)
+	}
+	if err != nil {
+		failures = append(failures, b.buildFailure(name, err))
+	}
+	return rules, failures
+}
+
+// redirectCSVHeaders are the names of the from and to columns in header rows
+// of redirect exports, after lowercasing and replacing `_` and `-` by spaces.
+var redirectCSVHeaders = [2]map[string]bool{
+	{"from": true, "source": true, "old": true, "old url": true, "source url": true, "redirect from": true, "url": true, "path": true},
+	{"to": true, "target": true, "new": true, "new url": true, "target url": true, "redirect to": true, "destination": true},
+}
+
+// isRedirectCSVHeader reports whether record is a header row, with known
+// names of the from and to columns.
+func isRedirectCSVHeader(record []string) bool {
+	if len(record) < 2 {
+		return false
+	}
+	for i, names := range redirectCSVHeaders {
+		name := strings.NewReplacer("_", " ", "-", " ").Replace(strings.ToLower(strings.TrimSpace(record[i])))
+		if !names[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// readRedirectCSV reads rows of `from,to[,status]`, like exports of redirect
+// plugins and spreadsheets. A first row with known column names like
+// `from,to` or `source,target` is a header and skipped, as are lines starting
+// with `#`.
+func readRedirectCSV(r io.Reader, add func(line int, fields []string)) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	for first := true; ; first = false {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read redirect csv: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if first && isRedirectCSVHeader(record) {
+			continue
+		}
+		add(line, record)
+	}
+}
+
+// readRedirectNginxMap reads the entries of an nginx map block like
+//
+//	map $uri $redirect_uri {
+//	    /old-page    /new-page;
+//	    /old-blog/   https://blog.example.com/;
+//	}
+//
+// or just its entries. The `default`, `hostnames`, and `volatile` parameters
+// are ignored, and regex keys aren't supported.
+func readRedirectNginxMap(r io.Reader, add func(line int, fields []string)) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" || text == "}" || (strings.HasPrefix(text, "map ") && strings.HasSuffix(text, "{")) {
+			continue
+		}
+		for _, entry := range strings.Split(text, ";") {
+			fields := strings.Fields(entry)
+			if len(fields) == 0 {
+				continue
+			}
+			switch fields[0] {
+			case "default", "hostnames", "volatile":
+				continue
+			}
+			for i, field := range fields {
+				fields[i] = strings.Trim(field, `"'`)
+			}
+			add(line, fields)
+		}
+	}
+	return scanner.Err()
+}
+
+// newRedirect validates the fields of a rule: the path or url redirected
+// from, the target, and optionally the status.
+func newRedirect(fields []string) (redirect, error) {
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "~") {
+		return redirect{}, fmt.Errorf("regex keys of nginx maps are not supported: '%s'", fields[0])
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		return redirect{}, fmt.Errorf("expected a path to redirect from, a target, and optionally a status, got %d fields", len(fields))
+	}
+	r := redirect{from: strings.TrimSpace(fields[0]), to: strings.TrimSpace(fields[1]), status: http.StatusMovedPermanently}
+
+	// only the path of urls redirected from is matched, so exports of legacy
+	// sites with full urls can be used as is
+	if u, err := url.Parse(r.from); err == nil && u.IsAbs() {
+		r.from = u.Path
+		if r.from == "" {
+			r.from = "/"
+		}
+	}
+	if !strings.HasPrefix(r.from, "/") || strings.ContainsAny(r.from, "{}?# \t") {
+		return redirect{}, fmt.Errorf("invalid path to redirect from '%s', it must start with / and not contain a query or braces", fields[0])
+	}
+	if u, err := url.Parse(r.to); err != nil || r.to == "" || (!u.IsAbs() && !strings.HasPrefix(r.to, "/")) || (u.IsAbs() && u.Scheme != "http" && u.Scheme != "https") {
+		return redirect{}, fmt.Errorf("invalid redirect target '%s', it must be a path or an http(s) url", r.to)
+	}
+	if r.from == redirectTargetPath(r.to) {
+		return redirect{}, fmt.Errorf("redirect from '%s' to itself", r.from)
+	}
+	if len(fields) == 3 {
+		status, err := strconv.Atoi(strings.TrimSpace(fields[2]))
+		switch status {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			if err == nil {
+				err = fmt.Errorf("%d is not a redirect status", status)
+			}
+			return redirect{}, fmt.Errorf("invalid redirect status '%s': %w", fields[2], err)
+		}
+		r.status = status
+	}
+	return r, nil
+}
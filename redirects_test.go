@@ -0,0 +1,89 @@
+package xtemplate
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRedirectFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name, file, content string
+		// the line and a part of the message of each build failure
+		failures map[int]string
+	}{
+		{"header", "r.csv", "Source,Target,Status\n/a,/b,302\n", nil},
+		{"no header", "r.csv", "/a,/b\n/c,/d,308\n", nil},
+		{"malformed first row", "r.csv", "old,/new\n/a,/b\n", map[int]string{1: "invalid path to redirect from 'old'"}},
+		{"conflict", "r.csv", "/a,/b\n/a,/c\n/a,/b\n", map[int]string{2: "conflicts with the redirect to '/b' at"}},
+		{"loop", "r.map", "map $uri $new {\n  /a /b;\n  /b /c;\n  /c /a;\n}\n", map[int]string{
+			2: "leads into a redirect loop",
+			3: "leads into a redirect loop",
+			4: "leads into a redirect loop",
+		}},
+		{"invalid status", "r.csv", "/a,/b,200\n/c,/d,gone\n", map[int]string{
+			1: "200 is not a redirect status",
+			2: "invalid redirect status 'gone'",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), tc.file)
+			if err := os.WriteFile(file, []byte(tc.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			_, _, _, err := New().Instance(
+				WithTemplateFS(fstest.MapFS{"index.html": {Data: []byte("home")}}),
+				WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+				func(c *Config) error {
+					c.RedirectFiles = []string{file}
+					return nil
+				},
+			)
+			if tc.failures == nil {
+				if err != nil {
+					t.Fatalf("failed to build instance: %v", err)
+				}
+				return
+			}
+			var buildErr *BuildError
+			if !errors.As(err, &buildErr) {
+				t.Fatalf("got error %v, want a build error", err)
+			}
+			got := map[int]string{}
+			for _, f := range buildErr.Failures {
+				if f.File != file {
+					t.Errorf("got failure in file %q, want %q", f.File, file)
+				}
+				got[f.Line] = f.Message
+			}
+			if len(got) != len(tc.failures) {
+				t.Errorf("got failures %v, want lines %v", got, tc.failures)
+			}
+			for line, msg := range tc.failures {
+				if !strings.Contains(got[line], msg) {
+					t.Errorf("line %d: got failure %q, want it to contain %q", line, got[line], msg)
+				}
+			}
+		})
+	}
+}
+
+func TestRedirectFilesServe(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "r.csv")
+	if err := os.WriteFile(file, []byte("from,to,status\n/a,/b,302\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	instance := testInstance(t, fstest.MapFS{"b.html": {Data: []byte("b")}}, func(c *Config) error {
+		c.RedirectFiles = []string{file}
+		return nil
+	})
+	if status := serve(instance, http.MethodGet, "/a", "192.0.2.1:1234"); status != http.StatusFound {
+		t.Errorf("got status %d, want %d", status, http.StatusFound)
+	}
+}
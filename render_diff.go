@@ -0,0 +1,151 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxRenderDiffLines bounds the outlines that are diffed, because the diff
+// takes time and memory proportional to the product of their lengths.
+const maxRenderDiffLines = 5000
+
+// serveRenderDiff renders the route in the `path` query parameter with the
+// previous and the current instance and responds with a diff of their html
+// outlines. See [Config.RenderDiffPath].
+func (x *Server) serveRenderDiff(w http.ResponseWriter, r *http.Request) {
+	target, err := url.Parse(r.URL.Query().Get("path"))
+	if err != nil || target.IsAbs() || target.Host != "" || !strings.HasPrefix(target.Path, "/") {
+		http.Error(w, "the path query parameter must be a url path like /blog", http.StatusBadRequest)
+		return
+	}
+	old, current := x.previous.Load(), x.Instance()
+	if old == nil {
+		http.Error(w, "there is no previous instance yet, reload the server first", http.StatusConflict)
+		return
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		http.Error(w, "invalid path: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header, req.Host, req.RemoteAddr = r.Header, r.Host, r.RemoteAddr
+	render := func(instance *Instance) (int, []string) {
+		rec := httptest.NewRecorder()
+		instance.ServeHTTP(rec, req.Clone(req.Context()))
+		return rec.Code, htmlOutline(rec.Body.Bytes())
+	}
+	oldStatus, oldLines := render(old)
+	newStatus, newLines := render(current)
+	if len(oldLines) > maxRenderDiffLines || len(newLines) > maxRenderDiffLines {
+		http.Error(w, fmt.Sprintf("the page has more than %d lines of html outline, which is too long to diff", maxRenderDiffLines), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "--- instance %d %s: %d\n", old.id, target, oldStatus)
+	fmt.Fprintf(w, "+++ instance %d %s: %d\n", current.id, target, newStatus)
+	for _, line := range diffLines(oldLines, newLines, 3) {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// htmlOutline formats an html document with one tag or text node per line,
+// indented by depth, so a line diff shows structural changes independent of
+// the original formatting. Attributes are sorted and whitespace in text is
+// collapsed.
+func htmlOutline(body []byte) []string {
+	var lines []string
+	depth := 0
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return lines
+		}
+		token := z.Token()
+		indent := strings.Repeat("  ", depth)
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			attrs := make([]string, 0, len(token.Attr))
+			for _, a := range token.Attr {
+				attrs = append(attrs, fmt.Sprintf(" %s=%q", a.Key, a.Val))
+			}
+			slices.Sort(attrs)
+			lines = append(lines, indent+"<"+token.Data+strings.Join(attrs, "")+">")
+			if tt == html.StartTagToken && !slices.Contains(voidElements, token.Data) {
+				depth++
+			}
+		case html.EndTagToken:
+			if depth > 0 {
+				depth--
+			}
+			lines = append(lines, strings.Repeat("  ", depth)+"</"+token.Data+">")
+		case html.TextToken:
+			if text := strings.Join(strings.Fields(token.Data), " "); text != "" {
+				lines = append(lines, indent+text)
+			}
+		case html.DoctypeToken:
+			lines = append(lines, "<!DOCTYPE "+token.Data+">")
+		}
+	}
+}
+
+// diffLines returns a unified diff of a and b with n lines of context around
+// each change, with lines prefixed by a space, -, or +, and hunks separated
+// by `@@` lines. It returns nil if they're equal.
+func diffLines(a, b []string, n int) []string {
+	// longest common subsequence table of the suffixes of a and b
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var all []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			all, i, j = append(all, " "+a[i]), i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			all, i = append(all, "-"+a[i]), i+1
+		default:
+			all, j = append(all, "+"+b[j]), j+1
+		}
+	}
+
+	var out []string
+	last := -1
+	for k, line := range all {
+		if line[0] == ' ' {
+			continue
+		}
+		start := max(k-n, last+1)
+		if last >= 0 && start > last+1 {
+			out = append(out, "@@")
+		}
+		out = append(out, all[start:k]...)
+		out = append(out, line)
+		last = k
+		// include trailing context up to the next change
+		for c := k + 1; c < len(all) && c <= k+n && all[c][0] == ' '; c++ {
+			out = append(out, all[c])
+			last = c
+		}
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package xtemplate
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderDiff(t *testing.T) {
+	templates := fstest.MapFS{
+		"index.html": {Data: []byte("<p>old</p>")},
+		"big.html":   {Data: []byte(strings.Repeat("<p>a</p>", maxRenderDiffLines))},
+	}
+	server, err := New().Server(WithTemplateFS(templates), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))), func(c *Config) error {
+		c.RenderDiffPath = "/_diff"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	defer server.Stop()
+	templates["index.html"] = &fstest.MapFile{Data: []byte("<p>new</p>")}
+	if err := server.Reload(); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	for _, tc := range []struct {
+		target, remoteAddr string
+		status             int
+		body               string
+	}{
+		{"/_diff?path=/", "127.0.0.1:1234", http.StatusOK, "-  old\n+  new\n"},
+		{"/_diff?path=/big", "127.0.0.1:1234", http.StatusUnprocessableEntity, "too long"},
+		{"/_diff?path=/", "192.0.2.1:1234", http.StatusForbidden, ""},
+		{"/_diff?path=//example.com/", "127.0.0.1:1234", http.StatusBadRequest, ""},
+		{"/_diff?path=%25zz", "127.0.0.1:1234", http.StatusBadRequest, ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		r.RemoteAddr = tc.remoteAddr
+		w := httptest.NewRecorder()
+		server.Handler().ServeHTTP(w, r)
+		if w.Code != tc.status || !strings.Contains(w.Body.String(), tc.body) {
+			t.Errorf("GET %s from %s: got status %d and body %q, want %d and %q", tc.target, tc.remoteAddr, w.Code, w.Body.String(), tc.status, tc.body)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package xtemplate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDSource returns the id that something in front of xtemplate, like a
+// proxy or middleware, assigned to a request, or "" if it has none. The id is
+// logged with every message of the request so they can be correlated with the
+// logs of other services. See [Config.RequestIDSources].
+type RequestIDSource func(r *http.Request) string
+
+// RequestIDFromHeader returns a source that reads the request id from the
+// header name, like `X-Request-Id` set by a load balancer.
+func RequestIDFromHeader(name string) RequestIDSource {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RequestIDFromContext returns a source that reads the request id from the
+// request context value of key, which must be a string or a [fmt.Stringer].
+func RequestIDFromContext(key any) RequestIDSource {
+	return func(r *http.Request) string {
+		switch v := r.Context().Value(key).(type) {
+		case string:
+			return v
+		case fmt.Stringer:
+			return v.String()
+		}
+		return ""
+	}
+}
+
+// CaddyRequestID reads the id that Caddy assigns to every request from its
+// `vars` context value. It's the default source.
+func CaddyRequestID(r *http.Request) string {
+	if mv, ok := r.Context().Value("vars").(map[string]any); ok {
+		if rid, ok := mv["uuid"].(string); ok {
+			return rid
+		}
+	}
+	return ""
+}
+
+// WithRequestIDSource adds sources that request ids are read from, in order.
+func WithRequestIDSource(sources ...RequestIDSource) Option {
+	return func(c *Config) error {
+		for _, s := range sources {
+			if s == nil {
+				return fmt.Errorf("nil request id source")
+			}
+		}
+		c.RequestIDSources = append(c.RequestIDSources, sources...)
+		return nil
+	}
+}
+
+// WithRequestIDGenerator sets the func that generates ids for requests that
+// none of the sources has an id for.
+func WithRequestIDGenerator(fn func() string) Option {
+	return func(c *Config) error {
+		if fn == nil {
+			return fmt.Errorf("nil request id generator")
+		}
+		c.RequestIDGenerator = fn
+		return nil
+	}
+}
+
+// maxRequestIDLength limits the ids read from requests, which can be sent by
+// clients.
+const maxRequestIDLength = 128
+
+// requestID returns the id of r from the first source that has a valid one,
+// or a new id.
+func (instance *Instance) requestID(r *http.Request) string {
+	if rid := GetRequestId(r.Context()); rid != "" {
+		return rid
+	}
+	for _, source := range instance.requestIDSources {
+		if rid := source(r); validRequestID(rid) {
+			return rid
+		}
+	}
+	if instance.config.RequestIDGenerator != nil {
+		return instance.config.RequestIDGenerator()
+	}
+	return uuid.NewString()
+}
+
+// requestIDChain returns the sources of request ids configured in config:
+// RequestIDSources, or CaddyRequestID if there are none, then
+// RequestIDHeaders.
+func requestIDChain(config *Config) []RequestIDSource {
+	sources := slices.Clone(config.RequestIDSources)
+	if len(sources) == 0 {
+		sources = []RequestIDSource{CaddyRequestID}
+	}
+	for _, name := range config.RequestIDHeaders {
+		sources = append(sources, RequestIDFromHeader(name))
+	}
+	return sources
+}
+
+// validRequestID reports whether rid is short and only has letters, digits,
+// dots, underscores, and dashes, so ids sent by clients can't forge log lines
+// or response headers, or name files outside of a directory, like recordings.
+func validRequestID(rid string) bool {
+	if rid == "" || len(rid) > maxRequestIDLength || strings.Contains(rid, "..") {
+		return false
+	}
+	for i := 0; i < len(rid); i++ {
+		if !requestIDByte(rid[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDByte reports whether c is a letter, digit, dot, underscore, or
+// dash.
+func requestIDByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-'
+}
+
+type requestIdType struct{}
+
+var requestIdKey = requestIdType{}
+
+// GetRequestId returns the id of the request that ctx belongs to, which is
+// logged with all of its messages. See [Config.RequestIDSources].
+func GetRequestId(ctx context.Context) string {
+	if v, ok := ctx.Value(requestIdKey).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// storedHeader returns a copy of header to store with a response that is
+// replayed to other requests, without the id of the request that rendered it.
+func (instance *Instance) storedHeader(header http.Header) http.Header {
+	header = header.Clone()
+	if name := instance.config.RequestIDResponseHeader; name != "" {
+		header.Del(name)
+	}
+	return header
+}
+
+// replayHeader copies the header of a stored response to w, with the id of
+// the current request r.
+func (instance *Instance) replayHeader(w http.ResponseWriter, r *http.Request, header http.Header) {
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	if name := instance.config.RequestIDResponseHeader; name != "" {
+		w.Header().Set(name, GetRequestId(r.Context()))
+	}
+}
@@ -0,0 +1,571 @@
+package xtemplate
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ResponseCacheConfig caches the responses to GET and HEAD requests of
+// template routes, so pages that are expensive to render are rendered once
+// per TTL instead of once per request.
+//
+// Each instance keeps recently used responses in memory. If Nats is set,
+// responses are also stored in a JetStream key value bucket of that nats
+// provider, so replicas behind a load balancer share cached pages, and purging
+// a page on one replica purges it on all of them. Purge pages after their
+// content changes with the .Cache dot field, see [DotCache].
+//
+// Requests with a Cookie or Authorization header, requests with an api key
+// (see [APIKeysConfig]), and preview requests bypass the cache, so pages
+// rendered for one user are never served to another, and
+// only 200 OK responses without Set-Cookie and without a `private`,
+// `no-store`, or `no-cache` Cache-Control header are stored. Responses are
+// cached separately for each value of the request headers named by their Vary
+// header and of the HX-Request header. Responses have an `X-Cache` header of
+// `HIT` or `MISS`. The `RateLimit-*` and `Retry-After` headers of api keys
+// aren't stored.
+//
+// Templates declare what content a page shows by tagging its response with
+// .Cache.Tag, so mutations can purge exactly the pages that show the changed
+// content with .Cache.PurgeTag or the `invalidateCache` func. Other services,
+// like a CMS, can purge paths and tags with the purge endpoint if PurgeToken
+// is set:
+//
+//	curl -X POST -H "Authorization: Bearer $TOKEN" -d tag=post:42 -d path=/blog https://example.com/_cache/purge
+type ResponseCacheConfig struct {
+	// Globs like in [AccessRule] of the paths to cache. Default all paths.
+	Paths []string `json:"paths,omitempty"`
+
+	// How long a response is cached. Default 1m.
+	TTL time.Duration `json:"ttl,omitempty"`
+
+	// Maximum number of responses kept in memory. Default 1000.
+	MaxEntries int `json:"max_entries,omitempty"`
+
+	// Name of the nats provider whose JetStream stores the shared cache. If
+	// empty, responses are only cached in memory.
+	Nats string `json:"nats,omitempty"`
+
+	// Name of the key value bucket of the shared cache, which is created if
+	// it doesn't exist. Default `xtemplate_cache`.
+	Bucket string `json:"bucket,omitempty"`
+
+	// Path of the purge endpoint, which accepts POST requests with `path` and
+	// `tag` form values. Default `/_cache/purge`.
+	PurgePath string `json:"purge_path,omitempty"`
+
+	// Bearer token that authenticates requests to the purge endpoint, which
+	// is only added if it's set.
+	PurgeToken string `json:"purge_token,omitempty"`
+}
+
+func WithResponseCache(config ResponseCacheConfig) Option {
+	return func(c *Config) error {
+		c.ResponseCache = &config
+		return nil
+	}
+}
+
+// responseCacheBodyLimit is the maximum size of a cached response body.
+const responseCacheBodyLimit = 1 << 20
+
+type cachedResponse struct {
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Body    []byte      `json:"body"`
+	Expires time.Time   `json:"expires"`
+	Tags    []string    `json:"tags,omitempty"`
+	// Names of the request headers that the response varies by. If set, the
+	// entry only records them, and the response is cached at the key of the
+	// request with variantKey.
+	Vary []string `json:"vary,omitempty"`
+}
+
+type responseCache struct {
+	config ResponseCacheConfig
+
+	mu sync.Mutex
+	// responses in memory by key, see cacheKey
+	local map[string]*cachedResponse
+	// keys of the responses in memory by tag
+	tagged map[string]map[string]struct{}
+
+	// the shared bucket, nil if responses are only cached in memory
+	kv jetstream.KeyValue
+
+	// hits and misses, reported as metrics of the .Cache dot provider
+	metrics ProviderMetrics
+}
+
+func newResponseCache(config ResponseCacheConfig) *responseCache {
+	if config.TTL <= 0 {
+		config.TTL = time.Minute
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+	if config.Bucket == "" {
+		config.Bucket = "xtemplate_cache"
+	}
+	if config.PurgePath == "" {
+		config.PurgePath = "/_cache/purge"
+	}
+	return &responseCache{config: config, local: map[string]*cachedResponse{}, tagged: map[string]map[string]struct{}{}}
+}
+
+// addResponseCache adds the purge endpoint, and connects the cache to the
+// bucket of the configured nats provider, which must already be initialized,
+// and drops responses from memory when another instance purges them, until
+// the instance is retired.
+func (b *builder) addResponseCache(c *responseCache, dot []DotConfig) error {
+	b.responseCache = c
+	if c.config.PurgeToken != "" {
+		pattern := "POST " + c.config.PurgePath
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { c.servePurge(b.Instance, w, r) })
+		if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+			return err
+		}
+		b.routes = append(b.routes, newInstanceRoute(pattern, handler, RouteBuiltin))
+		b.Routes += 1
+	}
+	if c.config.Nats == "" {
+		return nil
+	}
+	i := slices.IndexFunc(dot, func(d DotConfig) bool {
+		n, ok := d.(*DotNatsConfig)
+		return ok && n.Name == c.config.Nats
+	})
+	if i < 0 {
+		return fmt.Errorf("response cache nats provider not found: '%s'", c.config.Nats)
+	}
+	kv, err := dot[i].(*DotNatsConfig).js.CreateOrUpdateKeyValue(b.config.Ctx, jetstream.KeyValueConfig{Bucket: c.config.Bucket, TTL: c.config.TTL})
+	if err != nil {
+		return fmt.Errorf("failed to create response cache bucket '%s': %w", c.config.Bucket, err)
+	}
+	watcher, err := kv.WatchAll(b.config.Ctx, jetstream.UpdatesOnly(), jetstream.MetaOnly())
+	if err != nil {
+		return fmt.Errorf("failed to watch response cache bucket '%s': %w", c.config.Bucket, err)
+	}
+	c.kv = kv
+	go func() {
+		for entry := range watcher.Updates() {
+			if entry != nil && entry.Operation() != jetstream.KeyValuePut {
+				c.mu.Lock()
+				c.deleteLocal(entry.Key())
+				c.mu.Unlock()
+			}
+		}
+	}()
+	return nil
+}
+
+// cacheKey returns the key of a request, which is the hash of its path and a
+// hash of its host, query, and HX-Request header separated by a dot, so all
+// variants of a path can be purged together. Keys are valid key value bucket
+// keys. The bucket also has a key for each tag of a response, see tagKey.
+func cacheKey(r *http.Request) string {
+	return cacheHash(r.URL.Path) + "." + cacheHash(r.Host+"?"+r.URL.RawQuery+"\n"+r.Header.Get("HX-Request"))
+}
+
+// variantKey returns the key of the response to r for the request headers
+// named by its Vary header, under the key of the request.
+func variantKey(key string, vary []string, r *http.Request) string {
+	var values strings.Builder
+	for _, name := range vary {
+		values.WriteString(name + ":" + strings.Join(r.Header.Values(name), ",") + "\n")
+	}
+	return key + "." + cacheHash(values.String())
+}
+
+// responseVary returns the canonical names of the request headers in the Vary
+// header, and false if the response varies by `*` and can't be cached.
+func responseVary(header http.Header) ([]string, bool) {
+	var vary []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			switch {
+			case name == "*":
+				return nil, false
+			case name != "" && !slices.Contains(vary, name):
+				vary = append(vary, name)
+			}
+		}
+	}
+	slices.Sort(vary)
+	return vary, true
+}
+
+func cacheHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:16])
+}
+
+// tagKey returns the bucket key that records that the response with the
+// given key has tag.
+func tagKey(tag, key string) string {
+	return "t." + cacheHash(tag) + "." + key
+}
+
+type cacheTagsType struct{}
+
+var cacheTagsKey = cacheTagsType{}
+
+// cacheTags collects the tags of a response while it renders.
+type cacheTags struct {
+	mu   sync.Mutex
+	tags []string
+}
+
+// rateLimitHeaders describe the quota of the api key of the request that
+// rendered a response, so they're never stored with it.
+var rateLimitHeaders = []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}
+
+// withAPIKey reports whether r is authenticated with an api key, whose
+// responses are specific to the key like responses to requests with cookies.
+func (instance *Instance) withAPIKey(r *http.Request) bool {
+	if r.Context().Value(apiKeyUsageKey) != nil {
+		return true
+	}
+	return instance.apiKeys != nil && r.Header.Get(instance.apiKeys.config.Header) != ""
+}
+
+// wrap serves cached responses and caches the responses of next.
+func (c *responseCache) wrap(instance *Instance, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" || instance.withAPIKey(r) || instance.preview(r) ||
+			(len(c.config.Paths) > 0 && !slices.ContainsFunc(c.config.Paths, func(glob string) bool { return matchPath(glob, rulePath(r)) })) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, static := instance.file(path.Clean(r.URL.Path)); static {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		key := cacheKey(r)
+		cached := c.get(r.Context(), key)
+		if cached != nil && len(cached.Vary) > 0 {
+			cached = c.get(r.Context(), variantKey(key, cached.Vary, r))
+		}
+		if cached != nil {
+			instance.replayHeader(w, r, cached.Header)
+			w.Header().Set("X-Cache", "HIT")
+			w.WriteHeader(cached.Status)
+			if r.Method != http.MethodHead {
+				w.Write(cached.Body)
+			}
+			c.metrics.Observe("hit", time.Since(start), nil)
+			return
+		}
+		w.Header().Set("X-Cache", "MISS")
+		defer func() { c.metrics.Observe("miss", time.Since(start), nil) }()
+		tags := &cacheTags{}
+		r = r.WithContext(context.WithValue(r.Context(), cacheTagsKey, tags))
+		status, body, complete := captureResponse(w, r, next, responseCacheBodyLimit)
+		if !complete || status != http.StatusOK || r.Method == http.MethodHead || !cacheable(w.Header()) {
+			return
+		}
+		vary, ok := responseVary(w.Header())
+		if !ok {
+			return
+		}
+		header := instance.storedHeader(w.Header())
+		header.Del("X-Cache")
+		for _, h := range rateLimitHeaders {
+			header.Del(h)
+		}
+		expires := time.Now().Add(instance.settings.Load().ResponseCacheTTL)
+		if len(vary) > 0 {
+			c.put(r.Context(), key, &cachedResponse{Expires: expires, Vary: vary})
+			key = variantKey(key, vary, r)
+		}
+		c.put(r.Context(), key, &cachedResponse{Status: status, Header: header, Body: body, Expires: expires, Tags: tags.tags})
+	})
+}
+
+func cacheable(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	cc := strings.ToLower(header.Get("Cache-Control"))
+	return !strings.Contains(cc, "private") && !strings.Contains(cc, "no-store") && !strings.Contains(cc, "no-cache")
+}
+
+func (c *responseCache) get(ctx context.Context, key string) *cachedResponse {
+	now := time.Now()
+	c.mu.Lock()
+	cached, ok := c.local[key]
+	if ok && now.After(cached.Expires) {
+		c.deleteLocal(key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if ok {
+		return cached
+	}
+	if c.kv == nil {
+		return nil
+	}
+	entry, err := c.kv.Get(ctx, key)
+	if err != nil {
+		return nil
+	}
+	cached = &cachedResponse{}
+	if err := json.Unmarshal(entry.Value(), cached); err != nil || now.After(cached.Expires) {
+		return nil
+	}
+	c.putLocal(key, cached)
+	return cached
+}
+
+func (c *responseCache) put(ctx context.Context, key string, cached *cachedResponse) {
+	c.putLocal(key, cached)
+	if c.kv == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	value, err := json.Marshal(cached)
+	if err == nil {
+		_, err = c.kv.Put(ctx, key, value)
+	}
+	for _, tag := range cached.Tags {
+		if err == nil {
+			_, err = c.kv.Put(ctx, tagKey(tag, key), nil)
+		}
+	}
+	if err != nil {
+		GetLogger(ctx).Warn("failed to store response in shared cache", slog.Any("error", err))
+	}
+}
+
+func (c *responseCache) putLocal(key string, cached *cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.local[key]; !ok && len(c.local) >= c.config.MaxEntries {
+		// evict expired responses, or an arbitrary one if none expired
+		now := time.Now()
+		for k, v := range c.local {
+			if now.After(v.Expires) {
+				c.deleteLocal(k)
+			}
+		}
+		for k := range c.local {
+			if len(c.local) < c.config.MaxEntries {
+				break
+			}
+			c.deleteLocal(k)
+		}
+	}
+	c.deleteLocal(key)
+	c.local[key] = cached
+	for _, tag := range cached.Tags {
+		if c.tagged[tag] == nil {
+			c.tagged[tag] = map[string]struct{}{}
+		}
+		c.tagged[tag][key] = struct{}{}
+	}
+}
+
+// deleteLocal removes a response from memory. c.mu must be held.
+func (c *responseCache) deleteLocal(key string) {
+	cached, ok := c.local[key]
+	if !ok {
+		return
+	}
+	delete(c.local, key)
+	for _, tag := range cached.Tags {
+		delete(c.tagged[tag], key)
+		if len(c.tagged[tag]) == 0 {
+			delete(c.tagged, tag)
+		}
+	}
+}
+
+// purge removes the cached responses to all requests for urlpath.
+func (c *responseCache) purge(ctx context.Context, urlpath string) error {
+	prefix := cacheHash(urlpath) + "."
+	c.mu.Lock()
+	for k := range c.local {
+		if strings.HasPrefix(k, prefix) {
+			c.deleteLocal(k)
+		}
+	}
+	c.mu.Unlock()
+	if c.kv == nil {
+		return nil
+	}
+	keys, err := c.keys(ctx, prefix+">")
+	if err != nil {
+		return err
+	}
+	return c.purgeKeys(ctx, keys)
+}
+
+// purgeTag removes the cached responses that are tagged with tag.
+func (c *responseCache) purgeTag(ctx context.Context, tag string) error {
+	c.mu.Lock()
+	for k := range c.tagged[tag] {
+		c.deleteLocal(k)
+	}
+	c.mu.Unlock()
+	if c.kv == nil {
+		return nil
+	}
+	prefix := "t." + cacheHash(tag) + "."
+	tagKeys, err := c.keys(ctx, prefix+">")
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, k := range tagKeys {
+		keys = append(keys, strings.TrimPrefix(k, prefix), k)
+	}
+	return c.purgeKeys(ctx, keys)
+}
+
+// keys returns the keys of the shared bucket that match a subject filter.
+func (c *responseCache) keys(ctx context.Context, filter string) ([]string, error) {
+	watcher, err := c.kv.Watch(ctx, filter, jetstream.MetaOnly(), jetstream.IgnoreDeletes())
+	if err != nil {
+		return nil, err
+	}
+	defer watcher.Stop()
+	var keys []string
+	for entry := range watcher.Updates() {
+		if entry == nil {
+			break
+		}
+		keys = append(keys, entry.Key())
+	}
+	return keys, nil
+}
+
+func (c *responseCache) purgeKeys(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := c.kv.Purge(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// servePurge purges the paths and tags of an authenticated request.
+func (c *responseCache) servePurge(instance *Instance, w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.config.PurgeToken)) != 1 {
+		instance.serveError(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		instance.serveError(w, r, http.StatusBadRequest, "invalid form")
+		return
+	}
+	log := GetLogger(r.Context())
+	for _, p := range r.Form["path"] {
+		if err := c.purge(r.Context(), p); err != nil {
+			log.Warn("failed to purge path from cache", slog.String("path", p), slog.Any("error", err))
+			instance.serveError(w, r, http.StatusInternalServerError, "failed to purge")
+			return
+		}
+	}
+	for _, tag := range r.Form["tag"] {
+		if err := c.purgeTag(r.Context(), tag); err != nil {
+			log.Warn("failed to purge tag from cache", slog.String("tag", tag), slog.Any("error", err))
+			instance.serveError(w, r, http.StatusInternalServerError, "failed to purge")
+			return
+		}
+	}
+	log.Info("purged cache", slog.Any("paths", r.Form["path"]), slog.Any("tags", r.Form["tag"]))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidateCache purges the cached responses to a path if keyOrTag starts
+// with a slash, otherwise the responses tagged with it:
+//
+//	{{invalidateCache (print "post:" $id)}}
+//	{{invalidateCache "/blog"}}
+//
+// It's a func instead of a .Cache method so it can be called from shared
+// templates that don't get the dot.
+func (x *Instance) invalidateCache(keyOrTag string) (string, error) {
+	if x.responseCache == nil {
+		return "", fmt.Errorf("invalidateCache: the response cache is not configured")
+	}
+	if strings.HasPrefix(keyOrTag, "/") {
+		return "", x.responseCache.purge(x.config.Ctx, keyOrTag)
+	}
+	return "", x.responseCache.purgeTag(x.config.Ctx, keyOrTag)
+}
+
+// dotCacheProvider provides the .Cache dot field.
+type dotCacheProvider struct {
+	*responseCache
+}
+
+func (dotCacheProvider) FieldName() string            { return "Cache" }
+func (dotCacheProvider) Init(_ context.Context) error { return nil }
+func (p dotCacheProvider) Value(r Request) (any, error) {
+	return DotCache{p.responseCache, r.R.Context()}, nil
+}
+
+// Metrics returns the number of response cache hits and misses and how long
+// they took to serve, see [MetricsDotProvider].
+func (p dotCacheProvider) Metrics() map[string]OperationMetrics {
+	return p.metrics.Snapshot()
+}
+
+var _ MetricsDotProvider = dotCacheProvider{}
+
+// DotCache is used as the .Cache dot field when [Config.ResponseCache] is set.
+// It tags the response of the current request with the content it shows, and
+// purges cached responses, like after a form changes that content:
+//
+//	{{.Cache.Tag (print "post:" $post.id) "posts"}}
+//
+//	{{define "POST /posts/{id}"}}
+//	{{.DB.Exec "UPDATE posts SET body = ? WHERE id = ?" (.Req.FormValue "body") (.Req.PathValue "id")}}
+//	{{.Cache.PurgeTag (print "post:" (.Req.PathValue "id"))}}
+//	{{end}}
+type DotCache struct {
+	c   *responseCache
+	ctx context.Context
+}
+
+// Purge removes the cached responses to all requests for the path, with any
+// host and query, from this instance and the shared cache. It returns an
+// empty string.
+func (d DotCache) Purge(urlpath string) (string, error) {
+	return "", d.c.purge(d.ctx, urlpath)
+}
+
+// PurgeTag removes the cached responses tagged with tag from this instance
+// and the shared cache. It returns an empty string.
+func (d DotCache) PurgeTag(tag string) (string, error) {
+	return "", d.c.purgeTag(d.ctx, tag)
+}
+
+// Tag tags the response to the current request, so it's purged with any of
+// the tags. It returns an empty string, and does nothing if the response
+// isn't cached.
+func (d DotCache) Tag(tags ...string) string {
+	if t, ok := d.ctx.Value(cacheTagsKey).(*cacheTags); ok {
+		t.mu.Lock()
+		t.tags = append(t.tags, tags...)
+		t.mu.Unlock()
+	}
+	return ""
+}
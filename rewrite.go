@@ -0,0 +1,101 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// OutputRewriter is called with the buffered output of a template handler
+// after successful execution, including execution stopped with the halt and
+// abort funcs, and before it is written to the client. It
+// returns the new body, and can also modify the response headers. Returning an
+// error fails the request as if template execution failed.
+type OutputRewriter func(r *http.Request, header http.Header, body []byte) ([]byte, error)
+
+func WithOutputRewriters(rewriters ...OutputRewriter) Option {
+	return func(c *Config) error {
+		c.OutputRewriters = append(c.OutputRewriters, rewriters...)
+		return nil
+	}
+}
+
+// HTMLTokenRewriter creates an [OutputRewriter] that streams html output
+// through a tokenizer and calls fn with each token. fn may write additional
+// content to out before the token is written. If fn returns true the token is
+// rendered from its modified fields, otherwise the original bytes are written
+// unchanged. Responses with a Content-Type header that is not html are skipped.
+//
+// This can be used to inject toolbars, rewrite asset urls, or add attributes
+// like nonces to script tags.
+func HTMLTokenRewriter(fn func(r *http.Request, out io.Writer, token *html.Token) bool) OutputRewriter {
+	return func(r *http.Request, header http.Header, body []byte) ([]byte, error) {
+		if ct := header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "text/html") {
+			return body, nil
+		}
+		out := bytes.NewBuffer(make([]byte, 0, len(body)))
+		z := html.NewTokenizer(bytes.NewReader(body))
+		for {
+			tt := z.Next()
+			if tt == html.ErrorToken {
+				if err := z.Err(); err != io.EOF {
+					return nil, err
+				}
+				return out.Bytes(), nil
+			}
+			raw := z.Raw()
+			token := z.Token()
+			if fn(r, out, &token) {
+				out.WriteString(token.String())
+			} else {
+				out.Write(raw)
+			}
+		}
+	}
+}
+
+func rewriteOutput(rewriters []OutputRewriter, r *http.Request, header http.Header, body []byte) ([]byte, error) {
+	var err error
+	for _, rewrite := range rewriters {
+		if body, err = rewrite(r, header, body); err != nil {
+			return nil, fmt.Errorf("failed to rewrite output: %w", err)
+		}
+	}
+	return body, nil
+}
+
+// assetBaseURLRewriter rewrites src and href attributes that refer to a
+// fingerprinted static file to be served from baseURL.
+func assetBaseURLRewriter(instance *Instance, baseURL string) OutputRewriter {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return HTMLTokenRewriter(func(_ *http.Request, _ io.Writer, token *html.Token) bool {
+		if token.Type != html.StartTagToken && token.Type != html.SelfClosingTagToken {
+			return false
+		}
+		modified := false
+		for i, attr := range token.Attr {
+			if attr.Namespace != "" || (attr.Key != "src" && attr.Key != "href") {
+				continue
+			}
+			if !strings.HasPrefix(attr.Val, "/") || strings.HasPrefix(attr.Val, "//") {
+				continue
+			}
+			u, err := url.Parse(attr.Val)
+			if err != nil || u.Query().Get("hash") == "" {
+				continue
+			}
+			if _, ok := instance.file(path.Clean(u.Path)); !ok {
+				continue
+			}
+			token.Attr[i].Val = baseURL + attr.Val
+			modified = true
+		}
+		return modified
+	})
+}
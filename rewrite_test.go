@@ -0,0 +1,26 @@
+package xtemplate
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOutputRewritersOnHalt(t *testing.T) {
+	instance := testInstance(t, fstest.MapFS{"index.html": {Data: []byte(`<p>before{{halt 202}}<p>after`)}},
+		WithOutputRewriters(func(r *http.Request, header http.Header, body []byte) ([]byte, error) {
+			return bytes.ToUpper(body), nil
+		}),
+	)
+	w := httptest.NewRecorder()
+	instance.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("got status %d, want 202", w.Code)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != "<P>BEFORE" {
+		t.Errorf("got body %q, want the halted output rewritten", body)
+	}
+}
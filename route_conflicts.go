@@ -0,0 +1,58 @@
+package xtemplate
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// conflictPattern finds the registered pattern in the panic of
+// [http.ServeMux] when a pattern conflicts with it.
+var conflictPattern = regexp.MustCompile(`conflicts with pattern "([^"]+)"`)
+
+// handleRoute registers the handler of route with the router. If its pattern
+// conflicts with a route that was registered before, it returns an error that
+// names the files of both routes, or false if [Config.RouteConflicts] prefers
+// the other route.
+func (b *builder) handleRoute(route InstanceRoute) (bool, error) {
+	err := catch(fmt.Sprintf("add handler to servemux '%s'", route.Pattern), func() { b.router.Handle(route.Pattern, route.Handler) })
+	if err == nil {
+		return true, nil
+	}
+	i := slices.IndexFunc(b.routes, func(r InstanceRoute) bool { return r.Pattern == route.Pattern })
+	if m := conflictPattern.FindStringSubmatch(err.Error()); i < 0 && m != nil {
+		i = slices.IndexFunc(b.routes, func(r InstanceRoute) bool { return r.Pattern == m[1] })
+	}
+	if i < 0 {
+		return false, err
+	}
+	other := b.routes[i]
+	fileRoutes := route.Kind != RouteRedirect && other.Kind != RouteRedirect
+	if fileRoutes && (route.Kind == RouteStatic) != (other.Kind == RouteStatic) && b.config.RouteConflicts != "fail" {
+		// the preferred kind is loaded first, so the route that came later
+		// is the one to skip
+		b.config.Logger.Warn("skipped route that conflicts with a route of the preferred kind",
+			slog.String("pattern", route.Pattern), slog.String("file", route.File),
+			slog.String("preferred_pattern", other.Pattern), slog.String("preferred_file", other.File))
+		return false, nil
+	}
+	return false, fmt.Errorf("route '%s' of '%s' conflicts with route '%s' of '%s'", route.Pattern, route.File, other.Pattern, other.File)
+}
+
+// sortByRouteConflicts orders paths so the files of the kind preferred by
+// [Config.RouteConflicts] are loaded first, keeping the order of paths of the
+// same kind.
+func (b *builder) sortByRouteConflicts(paths []string) {
+	if b.config.RouteConflicts == "fail" {
+		return
+	}
+	rank := func(p string) int {
+		if strings.HasSuffix(p, b.config.TemplateExtension) == (b.config.RouteConflicts == "template") {
+			return 0
+		}
+		return 1
+	}
+	slices.SortStableFunc(paths, func(a, c string) int { return rank(a) - rank(c) })
+}
@@ -0,0 +1,160 @@
+package xtemplate
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Router routes the requests of an instance to the handlers of its routes.
+// The default is [http.ServeMux], and sites whose url semantics don't match
+// it can provide another implementation with [WithRouter], like a radix tree,
+// or a router that strips a locale prefix.
+//
+// Patterns use the syntax of [http.ServeMux] like `GET /blog/{slug}`, and the
+// router must set the values of wildcards on the request with
+// [http.Request.SetPathValue] before calling the handler, so templates can
+// read them with .Req.PathValue.
+type Router interface {
+	http.Handler
+
+	// Handle registers the handler for the pattern. It panics if the pattern
+	// is invalid or conflicts with a registered pattern, which fails the
+	// build of the instance.
+	Handle(pattern string, handler http.Handler)
+
+	// Handler returns the handler that would serve r and the pattern it was
+	// registered with, without serving it. The pattern is empty if no route
+	// matches.
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+var _ Router = (*http.ServeMux)(nil)
+
+// WithRouter sets the func that creates the router of each instance.
+func WithRouter(newRouter func() Router) Option {
+	return func(c *Config) error {
+		c.NewRouter = newRouter
+		return nil
+	}
+}
+
+// NewCaseInsensitiveRouter returns a [Router] that matches the literal
+// segments of patterns regardless of case, so `/About` is served by the route
+// of `/about`. GET and HEAD requests are redirected to the path with the case
+// of the pattern, so each page has one canonical url, and wildcard values keep
+// the case of the request path. See [Config.CaseInsensitiveRoutes].
+func NewCaseInsensitiveRouter() Router {
+	return &caseInsensitiveRouter{mux: http.NewServeMux(), patterns: map[string]string{}}
+}
+
+type caseInsensitiveRouter struct {
+	mux *http.ServeMux
+
+	// registered patterns by their lower case form
+	patterns map[string]string
+}
+
+func (c *caseInsensitiveRouter) Handle(pattern string, handler http.Handler) {
+	// lower case everything but the names of wildcards
+	var b strings.Builder
+	for rest := pattern; ; {
+		before, after, ok := strings.Cut(rest, "{")
+		if !ok {
+			b.WriteString(strings.ToLower(rest))
+			break
+		}
+		b.WriteString(strings.ToLower(before) + "{")
+		name, next, _ := strings.Cut(after, "}")
+		b.WriteString(name + "}")
+		rest = next
+	}
+	// methods are case sensitive
+	lowered := b.String()
+	if method, rest, ok := strings.Cut(lowered, " "); ok && !strings.Contains(method, "/") {
+		lowered = strings.ToUpper(method) + " " + rest
+	}
+	c.mux.Handle(lowered, handler)
+	c.patterns[lowered] = pattern
+}
+
+func (c *caseInsensitiveRouter) Handler(r *http.Request) (http.Handler, string) {
+	lower := r.Clone(r.Context())
+	lower.URL.Path = strings.ToLower(r.URL.Path)
+	lower.URL.RawPath = ""
+	lower.Host = strings.ToLower(r.Host)
+	h, pattern := c.mux.Handler(lower)
+	if original, ok := c.patterns[pattern]; ok {
+		pattern = original
+	}
+	return h, pattern
+}
+
+func (c *caseInsensitiveRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, pattern := c.Handler(r)
+	if pattern != "" {
+		if canonical := canonicalCase(pattern, r.URL.Path); canonical != r.URL.Path && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			redirectPath(w, r, canonical)
+			return
+		}
+		setPathValues(r, pattern)
+	}
+	h.ServeHTTP(w, r)
+}
+
+// canonicalCase returns urlpath with the case of the literal segments of the
+// path of pattern.
+func canonicalCase(pattern, urlpath string) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+	if i := strings.Index(pattern, "/"); i > 0 {
+		// strip the host
+		pattern = pattern[i:]
+	}
+	segments := strings.Split(urlpath, "/")
+	for i, seg := range strings.Split(pattern, "/") {
+		if i >= len(segments) || strings.HasPrefix(seg, "{$") {
+			break
+		}
+		if strings.HasPrefix(seg, "{") {
+			if strings.HasSuffix(seg, "...}") {
+				break
+			}
+			continue
+		}
+		if strings.EqualFold(seg, segments[i]) {
+			segments[i] = seg
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// normalizeUnicode redirects GET and HEAD requests whose path isn't in Unicode
+// normalization form C to the normalized path, and serves other requests
+// with the normalized path. See [Config.NormalizeUnicode].
+func normalizeUnicode(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if norm.NFC.IsNormalString(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		normalized := norm.NFC.String(r.URL.Path)
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			redirectPath(w, r, normalized)
+			return
+		}
+		r.URL.Path, r.URL.RawPath = normalized, ""
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectPath permanently redirects the request to the same url with a
+// different path, under the prefix the instance is mounted at, if any.
+func redirectPath(w http.ResponseWriter, r *http.Request, urlpath string) {
+	base, _ := r.Context().Value(basePathKey).(string)
+	u := *r.URL
+	u.Path, u.RawPath = base+urlpath, ""
+	http.Redirect(w, r, u.RequestURI(), http.StatusMovedPermanently)
+}
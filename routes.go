@@ -0,0 +1,106 @@
+package xtemplate
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// RouteKind describes what serves an [InstanceRoute].
+type RouteKind string
+
+const (
+	// A template file or a template definition named like `GET /path`.
+	RouteTemplate RouteKind = "template"
+	// A template definition named like `SSE /path` that streams its output.
+	RouteStream RouteKind = "stream"
+	// A static file.
+	RouteStatic RouteKind = "static"
+	// A shared template served for a [VirtualRoute].
+	RouteVirtual RouteKind = "virtual"
+	// A redirect loaded from one of [Config.RedirectFiles].
+	RouteRedirect RouteKind = "redirect"
+	// A proxy to an upstream server, see [Config.DevProxy] and
+	// [Config.AssetProxies].
+	RouteProxy RouteKind = "proxy"
+	// An endpoint built into xtemplate, like the webmention or metrics
+	// endpoints.
+	RouteBuiltin RouteKind = "builtin"
+)
+
+// InstanceRoute describes a route of an instance, as returned by
+// [Config.Instance] and [Instance.InstanceRoutes], so tools like route diffs
+// or API documentation generators don't have to parse patterns and template
+// names.
+type InstanceRoute struct {
+	// The [http.ServeMux] pattern of the route, like `GET /blog/{slug}`.
+	Pattern string
+	Handler http.Handler
+
+	// The method, host, and path of Pattern. Method is empty for routes that
+	// match any method.
+	Method string
+	Host   string
+	Path   string
+
+	Kind RouteKind
+
+	// The name of the template or the path of the static file that serves
+	// the route, and the path of the file that contains it. Empty for
+	// builtin and proxy routes.
+	Source string
+	File   string
+
+	// The content type of the response if it's known in advance: the type of
+	// a static file or a stream, or the `content_type` front matter key of a
+	// template file.
+	ContentType string
+
+	// The front matter of the template file that serves the route.
+	Metadata map[string]any
+
+	// Whether the template file is marked with `noindex` or `private` in its
+	// front matter. Tools that list routes should leave out private routes.
+	NoIndex bool
+	Private bool
+}
+
+// newInstanceRoute describes a route with the given pattern, splitting it
+// into its method, host, and path.
+func newInstanceRoute(pattern string, handler http.Handler, kind RouteKind) InstanceRoute {
+	route := InstanceRoute{Pattern: pattern, Handler: handler, Kind: kind}
+	rest := pattern
+	if method, after, ok := strings.Cut(pattern, " "); ok && !strings.Contains(method, "/") {
+		route.Method, rest = method, strings.TrimLeft(after, " ")
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		route.Host, route.Path = rest[:i], rest[i:]
+	} else {
+		route.Host = rest
+	}
+	return route
+}
+
+// MarshalJSON encodes the route without its Handler, with lower case keys
+// and empty fields omitted.
+func (r InstanceRoute) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Pattern     string         `json:"pattern"`
+		Method      string         `json:"method,omitempty"`
+		Host        string         `json:"host,omitempty"`
+		Path        string         `json:"path"`
+		Kind        RouteKind      `json:"kind"`
+		Source      string         `json:"source,omitempty"`
+		File        string         `json:"file,omitempty"`
+		ContentType string         `json:"content_type,omitempty"`
+		Metadata    map[string]any `json:"metadata,omitempty"`
+		NoIndex     bool           `json:"noindex,omitempty"`
+		Private     bool           `json:"private,omitempty"`
+	}{r.Pattern, r.Method, r.Host, r.Path, r.Kind, r.Source, r.File, r.ContentType, r.Metadata, r.NoIndex, r.Private})
+}
+
+// InstanceRoutes returns the routes of this instance in the order they were
+// added.
+func (x *Instance) InstanceRoutes() []InstanceRoute {
+	return x.routes
+}
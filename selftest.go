@@ -0,0 +1,127 @@
+package xtemplate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SelfTestReport is the result of [SelfTest].
+type SelfTestReport struct {
+	// Number of pages rendered.
+	Pages int `json:"pages"`
+
+	// Pages that failed, in order of pattern.
+	Failures []SelfTestFailure `json:"failures"`
+
+	Duration time.Duration `json:"duration"`
+}
+
+// SelfTestFailure is a page that failed to render in a [SelfTest].
+type SelfTestFailure struct {
+	// Path of the page, and the name of the template that renders it.
+	Page     string `json:"page"`
+	Template string `json:"template"`
+
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SelfTest renders every GET route of the instance that's served by a template
+// and doesn't have path wildcards with a synthetic request, at most
+// concurrency at a time or [Config.BuildWorkers] if it's 0, and reports the
+// pages that fail to execute or respond with a server error status. Pages are
+// served by the router directly, so access rules, mocks, and the response
+// cache don't apply. Like any other request, rendering the pages runs their
+// templates, so only test sites without side effects on GET.
+func SelfTest(instance *Instance, concurrency int) SelfTestReport {
+	start := time.Now()
+	patterns := instance.pagePatterns()
+	failures := make([]*SelfTestFailure, len(patterns))
+	if concurrency <= 0 {
+		concurrency = instance.config.BuildWorkers
+	}
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, pattern := range patterns {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			page := strings.TrimSuffix(strings.TrimPrefix(pattern, "GET "), "{$}")
+			status, err := instance.selfTestPage(page)
+			if err == nil && status < 500 {
+				return
+			}
+			f := &SelfTestFailure{Page: page, Template: instance.routeSources[pattern], Status: status}
+			if err != nil {
+				f.Error = err.Error()
+			}
+			failures[i] = f
+		}()
+	}
+	wg.Wait()
+
+	report := SelfTestReport{Pages: len(patterns), Failures: []SelfTestFailure{}, Duration: time.Since(start)}
+	for _, f := range failures {
+		if f != nil {
+			report.Failures = append(report.Failures, *f)
+		}
+	}
+	return report
+}
+
+// selfTestPage serves a synthetic GET request for page with the router and
+// returns the response status and the error of the template, or of the
+// handler if it panicked.
+func (instance *Instance) selfTestPage(page string) (status int, err error) {
+	ctx := context.WithValue(instance.config.Ctx, loggerKey, instance.config.Logger.With(slog.String("selftest", page)))
+	ctx = context.WithValue(ctx, executeErrorKey, &err)
+	req, rerr := http.NewRequestWithContext(ctx, http.MethodGet, (&url.URL{Path: page}).String(), nil)
+	if rerr != nil {
+		return 0, fmt.Errorf("failed to create request: %w", rerr)
+	}
+	req.Header.Set("User-Agent", "xtemplate-self-test")
+	w := httptest.NewRecorder()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("handler panicked: %v", p)
+		}
+		status = w.Code
+	}()
+	instance.router.ServeHTTP(w, req)
+	return
+}
+
+// ByTemplate returns the failures grouped by the template that renders them.
+func (r SelfTestReport) ByTemplate() map[string][]SelfTestFailure {
+	groups := map[string][]SelfTestFailure{}
+	for _, f := range r.Failures {
+		groups[f.Template] = append(groups[f.Template], f)
+	}
+	return groups
+}
+
+// Err returns an error that summarizes the failures, or nil if every page
+// passed.
+func (r SelfTestReport) Err() error {
+	if len(r.Failures) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "self-test failed for %d of %d pages:", len(r.Failures), r.Pages)
+	for _, f := range r.Failures {
+		fmt.Fprintf(&b, "\n  %s (%s): status %d", f.Template, f.Page, f.Status)
+		if f.Error != "" {
+			fmt.Fprintf(&b, ": %s", f.Error)
+		}
+	}
+	return fmt.Errorf("%s", b.String())
+}
@@ -0,0 +1,27 @@
+package xtemplate
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestSelfTest(t *testing.T) {
+	instance := testInstance(t, fstest.MapFS{
+		"index.html":     {Data: []byte("home")},
+		"100% off.html":  {Data: []byte("sale")},
+		"broken.html":    {Data: []byte(`{{fail "boom"}}`)},
+		"panics.html":    {Data: []byte(`{{index .Req.Header "x" 5}}`)},
+		"user/{id}.html": {Data: []byte(`{{fail "not rendered"}}`)},
+	}, WithAccessRules(AccessRule{Path: "/**", Allow: []string{"10.0.0.0/8"}}))
+	report := SelfTest(instance, 0)
+	if report.Pages != 4 {
+		t.Errorf("got %d pages, want 4", report.Pages)
+	}
+	var pages []string
+	for _, f := range report.Failures {
+		pages = append(pages, f.Page)
+	}
+	if len(pages) != 2 || pages[0] != "/broken" || pages[1] != "/panics" {
+		t.Errorf("got failures %v, want /broken and /panics", pages)
+	}
+}
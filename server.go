@@ -2,11 +2,21 @@ package xtemplate
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
+
+	"github.com/quic-go/quic-go/http3"
 )
 
 // Server is a configured, *reloadable*, xtemplate request handler ready to
@@ -20,11 +30,24 @@ import (
 //
 // The only way to create a valid *Server is to call [Config.Server].
 type Server struct {
-	instance atomic.Pointer[Instance]
-	cancel   func()
+	instance  atomic.Pointer[Instance]
+	cancel    func()
+	candidate atomic.Pointer[stagedInstance]
+
+	// the instance replaced by the last reload, kept running to render diffs
+	// if [Config.RenderDiffPath] is set
+	previous       atomic.Pointer[Instance]
+	previousCancel func()
 
 	mutex  sync.Mutex
 	config Config
+
+	// the endpoints of [Config.Ops], and whether the server is shutting down
+	ops      *http.ServeMux
+	draining atomic.Bool
+
+	// the failures of the last reload, nil if it succeeded
+	buildErr atomic.Pointer[BuildError]
 }
 
 // Build creates a new Server from an xtemplate.Config.
@@ -35,10 +58,18 @@ func (config Config) Server(cfgs ...Option) (*Server, error) {
 
 	config.Logger = config.Logger.WithGroup("xtemplate")
 
+	var err error
+	if config.WebAuthn, err = withWebAuthnSecrets(config.WebAuthn); err != nil {
+		return nil, err
+	}
+
 	server := &Server{
 		config: config,
 	}
-	err := server.Reload()
+	if config.Ops {
+		server.ops = server.opsMux()
+	}
+	err = server.Reload()
 
 	if err != nil {
 		return nil, err
@@ -52,22 +83,115 @@ func (x *Server) Instance() *Instance {
 	return x.instance.Load()
 }
 
-// Serve opens a net listener on `listen_addr` and serves requests from it.
+// Serve opens a net listener on `listen_addr` and serves requests from it, with
+// TLS if [Config.TLSCert] is set and also over HTTP/3 if [Config.HTTP3] is set.
+// If [Config.Ops] is set, it also serves the ops endpoints on
+// [Config.OpsListen] and returns nil after draining requests on SIGTERM or an
+// interrupt.
 func (x *Server) Serve(listen_addr string) error {
+	if x.config.PlaygroundPath != "" && x.config.AdminToken == "" && !loopbackAddr(listen_addr) {
+		return fmt.Errorf("the template playground runs any template source, set an admin token or listen on a loopback address like 127.0.0.1:8080 instead of '%s'", listen_addr)
+	}
+	if (x.config.Admin != nil || x.config.RenderDiffPath != "") && x.config.AdminToken == "" && !loopbackAddr(listen_addr) {
+		return fmt.Errorf("the admin pages and the render diff endpoint can read and change anything, set an admin token or listen on a loopback address like 127.0.0.1:8080 instead of '%s'", listen_addr)
+	}
+	if x.config.Ops && x.config.OpsListen == "" {
+		return fmt.Errorf("ops endpoints require a separate listener, set ops_listen to an address like :9090")
+	}
 	x.config.Logger.Info("starting server")
-	return http.ListenAndServe(listen_addr, x.Handler())
+	srv := &http.Server{Addr: listen_addr, Handler: x.Handler(), WriteTimeout: x.config.WriteTimeout}
+	var h3 *http3.Server
+	if x.config.TLSCert == "" {
+		if x.config.HTTP3 {
+			return fmt.Errorf("http3 requires a tls certificate")
+		}
+	} else {
+		tlsConfig, err := x.config.tlsConfig()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+		if x.config.HTTP3 {
+			h3 = &http3.Server{Addr: listen_addr, Handler: x.Handler(), TLSConfig: tlsConfig}
+			handler := srv.Handler
+			srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// advertise http3 with the Alt-Svc header
+				h3.SetQUICHeaders(w.Header())
+				handler.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	errs := make(chan error, 3)
+	go func() {
+		if srv.TLSConfig != nil {
+			errs <- srv.ListenAndServeTLS("", "")
+		} else {
+			errs <- srv.ListenAndServe()
+		}
+	}()
+	if h3 != nil {
+		go func() { errs <- h3.ListenAndServe() }()
+	}
+	var ops *http.Server
+	var stop <-chan struct{}
+	if x.config.Ops {
+		ops = &http.Server{Addr: x.config.OpsListen, Handler: x.ops}
+		go func() { errs <- ops.ListenAndServe() }()
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+		defer cancel()
+		stop = ctx.Done()
+	}
+
+	select {
+	case err := <-errs:
+		srv.Close()
+		if h3 != nil {
+			h3.Close()
+		}
+		if ops != nil {
+			ops.Close()
+		}
+		return err
+	case <-stop:
+		return x.drain(srv, h3, ops)
+	}
+}
+
+// loopbackAddr reports whether the listen address addr only accepts
+// connections from the local machine.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
 }
 
 // Handler returns a `http.Handler` that always routes new requests to the
-// current Instance.
+// current Instance, or to the staged candidate Instance according to the
+// current [Rollout].
 func (x *Server) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if x.config.RenderDiffPath != "" && r.URL.Path == x.config.RenderDiffPath {
+			x.Instance().authorizeAdmin(x.serveRenderDiff)(w, r)
+			return
+		}
+		if staged := x.candidate.Load(); staged != nil && staged.rollout.selects(r) {
+			staged.instance.ServeHTTP(w, r)
+			return
+		}
 		x.Instance().ServeHTTP(w, r)
 	})
 }
 
 // Reload creates a new Instance from the config and swaps it with the
-// current instance if successful, otherwise returns the error.
+// current instance if successful, otherwise returns the error. Any staged
+// candidate instance is discarded.
 func (x *Server) Reload(cfgs ...Option) error {
 	start := time.Now()
 
@@ -80,37 +204,180 @@ func (x *Server) Reload(cfgs ...Option) error {
 		log = log.With(slog.Int64("old_id", old.id))
 	}
 
-	var newcancel func()
-	var new_ *Instance
-	{
-		var err error
-		config := x.config
-		config.Ctx, newcancel = context.WithCancel(x.config.Ctx)
-		new_, _, _, err = config.Instance(cfgs...)
-		if err != nil {
-			newcancel()
-			log.Info("failed to load", slog.Any("error", err), slog.Duration("rebuild_time", time.Since(start)))
-			return err
-		}
+	new_, newcancel, err := x.build(cfgs...)
+	if err != nil {
+		log.Info("failed to load", slog.Any("error", err), slog.Duration("rebuild_time", time.Since(start)))
+		var buildErr *BuildError
+		errors.As(err, &buildErr)
+		x.buildErr.Store(buildErr)
+		return err
 	}
+	x.buildErr.Store(nil)
 
+	x.abort()
 	x.instance.CompareAndSwap(old, new_)
-	if x.cancel != nil {
+	x.retire(old, newcancel)
+
+	log.Info("rebuild succeeded", slog.Int64("new_id", new_.id), slog.Duration("rebuild_time", time.Since(start)))
+	return nil
+}
+
+// BuildError returns the failures of the last reload, or nil if it
+// succeeded. The server keeps serving the previous instance after a failed
+// reload, so this is how tools find out that changes weren't applied.
+func (x *Server) BuildError() *BuildError {
+	return x.buildErr.Load()
+}
+
+// retire cancels the old instance after it was swapped for a new instance with
+// cancel func newcancel, or keeps it as the previous instance to render diffs.
+func (x *Server) retire(old *Instance, newcancel func()) {
+	if x.config.RenderDiffPath != "" && old != nil {
+		if x.previousCancel != nil {
+			x.previousCancel()
+		}
+		x.previous.Store(old)
+		x.previousCancel = x.cancel
+	} else if x.cancel != nil {
 		x.cancel()
 	}
 	x.cancel = newcancel
+}
 
-	log.Info("rebuild succeeded", slog.Int64("new_id", new_.id), slog.Duration("rebuild_time", time.Since(start)))
+func (x *Server) build(cfgs ...Option) (*Instance, func(), error) {
+	config := x.config
+	var cancel func()
+	config.Ctx, cancel = context.WithCancel(x.config.Ctx)
+	config.reload = func() { go x.Reload() }
+	instance, _, _, err := config.Instance(cfgs...)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return instance, cancel, nil
+}
+
+// Rollout configures which requests are routed to a staged candidate
+// Instance. See [Server.Stage].
+type Rollout struct {
+	// Percentage of requests from 0 to 100 that are routed to the candidate.
+	Percent int `json:"percent"`
+
+	// If set, requests that have a non-empty value for this header are always
+	// routed to the candidate.
+	Header string `json:"header,omitempty"`
+}
+
+func (r Rollout) selects(req *http.Request) bool {
+	if r.Header != "" && req.Header.Get(r.Header) != "" {
+		return true
+	}
+	return r.Percent > 0 && rand.IntN(100) < r.Percent
+}
+
+type stagedInstance struct {
+	instance *Instance
+	cancel   func()
+	rollout  Rollout
+}
+
+// Stage creates a new Instance from the config and runs it alongside the
+// current Instance as a candidate, routing the share of requests selected by
+// rollout to it. Call [Server.Promote] to cut over to the candidate or
+// [Server.Abort] to discard it. Staging replaces any previous candidate.
+func (x *Server) Stage(rollout Rollout, cfgs ...Option) error {
+	start := time.Now()
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	log := x.config.Logger.WithGroup("stage")
+
+	new_, newcancel, err := x.build(cfgs...)
+	if err != nil {
+		log.Info("failed to load", slog.Any("error", err), slog.Duration("rebuild_time", time.Since(start)))
+		return err
+	}
+
+	x.abort()
+	x.candidate.Store(&stagedInstance{new_, newcancel, rollout})
+
+	log.Info("staged candidate", slog.Int64("candidate_id", new_.id), slog.Int("percent", rollout.Percent), slog.String("header", rollout.Header), slog.Duration("rebuild_time", time.Since(start)))
 	return nil
 }
 
+// Candidate returns the staged candidate Instance, or nil if there is none.
+func (x *Server) Candidate() *Instance {
+	if staged := x.candidate.Load(); staged != nil {
+		return staged.instance
+	}
+	return nil
+}
+
+// SetRollout changes which requests are routed to the staged candidate.
+func (x *Server) SetRollout(rollout Rollout) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	staged := x.candidate.Load()
+	if staged == nil {
+		return fmt.Errorf("no staged candidate instance")
+	}
+	x.candidate.Store(&stagedInstance{staged.instance, staged.cancel, rollout})
+	x.config.Logger.WithGroup("stage").Info("updated rollout", slog.Int64("candidate_id", staged.instance.id), slog.Int("percent", rollout.Percent), slog.String("header", rollout.Header))
+	return nil
+}
+
+// Promote swaps the staged candidate in as the current Instance, cancelling
+// the old one.
+func (x *Server) Promote() error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	staged := x.candidate.Load()
+	if staged == nil {
+		return fmt.Errorf("no staged candidate instance")
+	}
+	old := x.instance.Swap(staged.instance)
+	x.candidate.Store(nil)
+	x.retire(old, staged.cancel)
+
+	log := x.config.Logger.WithGroup("stage")
+	if old != nil {
+		log = log.With(slog.Int64("old_id", old.id))
+	}
+	log.Info("promoted candidate", slog.Int64("new_id", staged.instance.id))
+	return nil
+}
+
+// Abort discards the staged candidate Instance, if any.
+func (x *Server) Abort() {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	x.abort()
+}
+
+func (x *Server) abort() {
+	if staged := x.candidate.Swap(nil); staged != nil {
+		staged.cancel()
+		x.config.Logger.WithGroup("stage").Info("discarded candidate", slog.Int64("candidate_id", staged.instance.id))
+	}
+}
+
 func (x *Server) Stop() {
 	x.mutex.Lock()
 	defer x.mutex.Unlock()
 
+	x.abort()
 	if x.cancel != nil {
 		x.cancel()
 	}
 	x.cancel = nil
+	if x.previousCancel != nil {
+		x.previousCancel()
+	}
+	x.previousCancel = nil
+	x.previous.Store(nil)
 	x.instance.Store(nil)
 }
@@ -0,0 +1,102 @@
+package xtemplate
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Settings are the parts of a [Config] that don't affect how templates are
+// parsed and routed, so [Server.Apply] can change them on the running
+// instance. Rebuilding the instance to change them would drop its caches and
+// restart its background work.
+type Settings struct {
+	// See [Config.Timeout], [Config.MaxRequestBody], and
+	// [Config.MaxBufferSize]. Routes that override any of them in their front
+	// matter keep the limits they were built with.
+	Timeout        time.Duration `json:"timeout,omitempty"`
+	MaxRequestBody int64         `json:"max_request_body,omitempty"`
+	MaxBufferSize  int64         `json:"max_buffer,omitempty"`
+
+	// How long new responses are kept in the response cache, see
+	// [ResponseCacheConfig]. Responses that are already cached keep their
+	// expiry, and so does the shared bucket. Default 1m.
+	ResponseCacheTTL time.Duration `json:"response_cache_ttl,omitempty"`
+
+	// Values of the flags providers by name, see [Config.Flags]. Providers
+	// that aren't listed keep their values.
+	Flags map[string]map[string]string `json:"flags,omitempty"`
+}
+
+// Settings returns the settings of config.
+func (config *Config) Settings() Settings {
+	s := Settings{
+		Timeout:        config.Timeout,
+		MaxRequestBody: config.MaxRequestBody,
+		MaxBufferSize:  config.MaxBufferSize,
+		Flags:          make(map[string]map[string]string, len(config.Flags)),
+	}
+	if config.ResponseCache != nil {
+		s.ResponseCacheTTL = config.ResponseCache.TTL
+	}
+	for _, f := range config.Flags {
+		s.Flags[f.Name] = f.Values
+	}
+	return s
+}
+
+// Apply changes the settings of the current instance and the staged
+// candidate without rebuilding them, and keeps the changes for later reloads.
+// Use it for changes that are frequent or urgent, like raising a limit or
+// turning off a flag during an incident, and [Server.Reload] for everything
+// else.
+func (x *Server) Apply(s Settings) error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	for name := range s.Flags {
+		if !slices.ContainsFunc(x.config.Flags, func(f DotFlagsConfig) bool { return f.Name == name }) {
+			return fmt.Errorf("no flags provider named '%s'", name)
+		}
+	}
+
+	// copy the slice and the cache config since they're shared with the
+	// instances that were built from them
+	x.config.Flags = slices.Clone(x.config.Flags)
+	for i, f := range x.config.Flags {
+		if values, ok := s.Flags[f.Name]; ok {
+			x.config.Flags[i].Values = maps.Clone(values)
+		}
+	}
+	x.config.Timeout, x.config.MaxRequestBody, x.config.MaxBufferSize = s.Timeout, s.MaxRequestBody, s.MaxBufferSize
+	if x.config.ResponseCache != nil {
+		cache := *x.config.ResponseCache
+		cache.TTL = s.ResponseCacheTTL
+		x.config.ResponseCache = &cache
+	}
+
+	settings := x.config.Settings()
+	x.Instance().applySettings(settings)
+	if staged := x.candidate.Load(); staged != nil {
+		staged.instance.applySettings(settings)
+	}
+	x.config.Logger.Info("applied settings", slog.Any("settings", settings))
+	return nil
+}
+
+// applySettings makes requests that start after it returns use s.
+func (x *Instance) applySettings(s Settings) {
+	if s.ResponseCacheTTL <= 0 {
+		s.ResponseCacheTTL = time.Minute
+	}
+	for _, dp := range x.bufferDot.dps {
+		if f, ok := dp.(*DotFlagsConfig); ok && f.values != nil {
+			if values, ok := s.Flags[f.Name]; ok {
+				f.values.Store(&values)
+			}
+		}
+	}
+	x.settings.Store(&s)
+}
@@ -0,0 +1,252 @@
+package xtemplate
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// SitemapConfig configures a generated sitemap that lists the pages of the
+// site for search engines. See https://www.sitemaps.org/protocol.html.
+//
+// The sitemap includes the template files that handle a fixed path outside of
+// hidden directories like /.well-known, except unpublished drafts and those
+// with `sitemap: false`, `noindex: true`, or `private: true` in their front
+// matter, using `updated` or `date` from the front matter as the last
+// modification time. Dynamic pages are added by a template named
+// "SITEMAP", which calls .Req.Sitemap.Add for each url:
+//
+//	{{define "SITEMAP"}}
+//	{{range .DB.QueryRows "SELECT slug, updated FROM posts"}}{{$.Req.Sitemap.Add (print "/posts/" .slug) .updated}}{{end}}
+//	{{end}}
+//
+// If there are more urls than fit in one sitemap, the sitemap path serves a
+// sitemap index that links to numbered shards, for example /sitemap/1.xml.
+// Sitemaps are streamed to the client as urls are added instead of being
+// buffered, so the SITEMAP template is executed once to count the urls and
+// again to write them.
+type SitemapConfig struct {
+	// Path of the sitemap or sitemap index. Default `/sitemap.xml`.
+	Path string `json:"path,omitempty"`
+
+	// Base url that relative urls are resolved against, like
+	// `https://example.com`. Defaults to the scheme and host of the request.
+	BaseURL string `json:"base_url,omitempty"`
+
+	// Maximum number of urls in each sitemap shard. Default and maximum 50000.
+	MaxURLs int `json:"max_urls,omitempty"`
+}
+
+func WithSitemap(sitemap SitemapConfig) Option {
+	return func(c *Config) error {
+		c.Sitemap = &sitemap
+		return nil
+	}
+}
+
+type sitemapType struct{}
+
+var sitemapKey = sitemapType{}
+
+// Sitemap returns the writer that urls are added to while the "SITEMAP"
+// template is executed, otherwise nil. See [SitemapConfig].
+func (d DotReq) Sitemap() *SitemapWriter {
+	w, _ := d.Context().Value(sitemapKey).(*SitemapWriter)
+	return w
+}
+
+// SitemapWriter adds urls to the sitemap being generated.
+type SitemapWriter struct {
+	base  string
+	out   *bufio.Writer
+	skip  int
+	limit int
+	count int
+}
+
+// Add adds the url loc with an optional last modification time to the
+// sitemap. Relative urls are resolved against the base url. It returns an
+// empty string.
+func (s *SitemapWriter) Add(loc string, lastmod ...any) (string, error) {
+	if len(lastmod) > 1 {
+		return "", fmt.Errorf("too many lastmod arguments")
+	}
+	s.count += 1
+	if s.out == nil || s.count <= s.skip || s.count > s.skip+s.limit {
+		return "", nil
+	}
+	if strings.HasPrefix(loc, "/") {
+		loc = s.base + loc
+	}
+	s.out.WriteString("<url><loc>")
+	xml.EscapeText(s.out, []byte(loc))
+	s.out.WriteString("</loc>")
+	if len(lastmod) == 1 && lastmod[0] != nil && lastmod[0] != "" {
+		t, err := cast.ToTimeE(lastmod[0])
+		if err != nil {
+			return "", fmt.Errorf("invalid sitemap lastmod for '%s': %w", loc, err)
+		}
+		s.out.WriteString("<lastmod>" + t.UTC().Format(time.RFC3339) + "</lastmod>")
+	}
+	s.out.WriteString("</url>\n")
+	return "", nil
+}
+
+type sitemapPage struct {
+	path    string
+	lastmod any
+	publish publishState
+}
+
+type sitemap struct {
+	instance *Instance
+	config   SitemapConfig
+	pages    []sitemapPage
+}
+
+// addSitemapRoutes registers the sitemap and its shards.
+func (b *builder) addSitemapRoutes() error {
+	s := &sitemap{instance: b.Instance, config: *b.config.Sitemap}
+	if s.config.Path == "" {
+		s.config.Path = "/sitemap.xml"
+	}
+	if s.config.MaxURLs <= 0 || s.config.MaxURLs > 50000 {
+		s.config.MaxURLs = 50000
+	}
+	s.config.BaseURL = strings.TrimSuffix(s.config.BaseURL, "/")
+	for _, page := range b.pages {
+		path := strings.TrimSuffix(page.routePath, "{$}")
+		if include, ok := page.meta["sitemap"].(bool); (ok && !include) || page.visibility.noindex || strings.Contains(path, "{") || strings.Contains(path, "/.") {
+			continue
+		}
+		lastmod := page.meta["updated"]
+		if lastmod == nil {
+			lastmod = page.meta["date"]
+		}
+		s.pages = append(s.pages, sitemapPage{path, lastmod, page.publish})
+	}
+
+	for _, route := range []struct {
+		pattern string
+		handler http.HandlerFunc
+	}{
+		{"GET " + s.config.Path, s.serveIndex},
+		{"GET " + strings.TrimSuffix(s.config.Path, ".xml") + "/{shard}", s.serveShard},
+	} {
+		pattern, handler := route.pattern, route.handler
+		if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+			return err
+		}
+		b.routes = append(b.routes, newInstanceRoute(pattern, handler, RouteBuiltin))
+		b.Routes += 1
+	}
+	return nil
+}
+
+func (s *sitemap) base(r *http.Request) string {
+	if s.config.BaseURL != "" {
+		return s.config.BaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// generate adds the pages and the urls of the SITEMAP template to w and
+// returns the total number of urls.
+func (s *sitemap) generate(r *http.Request, w *SitemapWriter) (int, error) {
+	now := time.Now()
+	for _, page := range s.pages {
+		if !page.publish.published(now) && !s.instance.config.ShowDrafts {
+			continue
+		}
+		if _, err := w.Add(page.path, page.lastmod); err != nil {
+			return 0, err
+		}
+	}
+	if tmpl := s.instance.templates.Lookup("SITEMAP"); tmpl != nil {
+		var err error
+		ctx := context.WithValue(r.Context(), sitemapKey, w)
+		ctx = context.WithValue(ctx, executeErrorKey, &err)
+		rec := httptest.NewRecorder()
+		bufferingTemplateHandler(s.instance, tmpl)(rec, r.WithContext(ctx))
+		if err == nil && rec.Code >= 400 {
+			err = fmt.Errorf("sitemap template responded with status %d", rec.Code)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return w.count, nil
+}
+
+func (s *sitemap) serveIndex(w http.ResponseWriter, r *http.Request) {
+	base := s.base(r)
+	total, err := s.generate(r, &SitemapWriter{base: base})
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if total <= s.config.MaxURLs {
+		s.write(w, r, base, 0)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	out := bufio.NewWriter(w)
+	out.WriteString(xml.Header + `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+	prefix := base + strings.TrimSuffix(s.config.Path, ".xml")
+	for shard := 1; (shard-1)*s.config.MaxURLs < total; shard++ {
+		fmt.Fprintf(out, "<sitemap><loc>%s/%d.xml</loc></sitemap>\n", prefix, shard)
+	}
+	out.WriteString("</sitemapindex>\n")
+	out.Flush()
+}
+
+func (s *sitemap) serveShard(w http.ResponseWriter, r *http.Request) {
+	shard, err := strconv.Atoi(strings.TrimSuffix(r.PathValue("shard"), ".xml"))
+	if err != nil || shard < 1 {
+		s.instance.serveError(w, r, http.StatusNotFound, "sitemap not found")
+		return
+	}
+	base := s.base(r)
+	total, err := s.generate(r, &SitemapWriter{base: base})
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if (shard-1)*s.config.MaxURLs >= total {
+		s.instance.serveError(w, r, http.StatusNotFound, "sitemap not found")
+		return
+	}
+	s.write(w, r, base, (shard-1)*s.config.MaxURLs)
+}
+
+// write streams a sitemap of the urls after the first skip.
+func (s *sitemap) write(w http.ResponseWriter, r *http.Request, base string, skip int) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	out := bufio.NewWriter(w)
+	out.WriteString(xml.Header + `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+	if _, err := s.generate(r, &SitemapWriter{base: base, out: out, skip: skip, limit: s.config.MaxURLs}); err != nil {
+		// the response has already started, so it can only be cut short
+		GetLogger(r.Context()).Error("failed to write sitemap", slog.Any("error", err))
+		return
+	}
+	out.WriteString("</urlset>\n")
+	out.Flush()
+}
+
+func (s *sitemap) fail(w http.ResponseWriter, r *http.Request, err error) {
+	GetLogger(r.Context()).Error("failed to generate sitemap", slog.Any("error", err))
+	s.instance.serveError(w, r, http.StatusInternalServerError, "internal server error")
+}
@@ -0,0 +1,109 @@
+package xtemplate
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// InstanceSnapshot is a serializable summary of the state of an instance that
+// can be logged or attached to bug reports. See [Instance.Snapshot].
+type InstanceSnapshot struct {
+	Id   int64     `json:"id"`
+	Time time.Time `json:"time"`
+
+	// Digest of the template or static file that handles each route pattern.
+	Routes map[string]string `json:"routes"`
+
+	// Digest of the parsed body of each template definition by name.
+	Templates map[string]string `json:"templates"`
+
+	// Hash of each static file by path, as used in .X.StaticFileHash.
+	Files map[string]string `json:"files"`
+
+	// The config with connection strings, passwords, and secrets redacted.
+	Config map[string]any `json:"config"`
+
+	Stats   InstanceStats      `json:"stats"`
+	DBStats map[string]DBStats `json:"db_stats,omitempty"`
+}
+
+// Snapshot returns a summary of the routes, templates, static files, config,
+// and statistics of the instance, for debugging production behavior that can't
+// be reproduced locally.
+func (x *Instance) Snapshot() *InstanceSnapshot {
+	snap := &InstanceSnapshot{
+		Id:        x.id,
+		Time:      time.Now(),
+		Routes:    x.routeDigests(),
+		Templates: x.templateDigests(),
+		Files:     make(map[string]string, len(x.files)),
+		Config:    redactedConfig(&x.config),
+		DBStats:   x.DBStats(),
+		Stats:     x.Stats(),
+	}
+	for path, file := range x.files {
+		snap.Files[path] = file.hash
+	}
+	return snap
+}
+
+var sensitiveKey = regexp.MustCompile(`(?i)connstr|replicas|password|secret|token|credential|api_?key|private`)
+
+// redactedConfig converts the json fields of config to a generic map and
+// redacts sensitive values. Fields that can't be serialized are replaced with a
+// placeholder instead of failing the whole snapshot.
+func redactedConfig(config *Config) map[string]any {
+	result := map[string]any{}
+	v := reflect.ValueOf(config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		encoded, err := json.Marshal(v.Field(i).Interface())
+		if err != nil {
+			result[name] = "<unserializable>"
+			continue
+		}
+		var value any
+		json.Unmarshal(encoded, &value)
+		result[name] = redact(name, value)
+	}
+	return result
+}
+
+// redact replaces value with a placeholder if key names a secret or a header
+// that carries credentials, and the user info of urls in strings, recursively.
+func redact(key string, value any) any {
+	if value == nil || value == "" {
+		return value
+	}
+	if sensitiveKey.MatchString(key) || slices.ContainsFunc(credentialHeaders, func(h string) bool { return strings.EqualFold(h, key) }) {
+		return "<redacted>"
+	}
+	switch v := value.(type) {
+	case string:
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			u.User = url.User("redacted")
+			return u.String()
+		}
+	case map[string]any:
+		for k, item := range v {
+			v[k] = redact(k, item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redact(key, item)
+		}
+	}
+	return value
+}
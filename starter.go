@@ -0,0 +1,62 @@
+package xtemplate
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+)
+
+//go:embed all:starter
+var starterFiles embed.FS
+
+// StarterFS returns the templates of the built-in starter site, which is served
+// when [Config.Starter] is set.
+func StarterFS() fs.FS {
+	fsys, _ := fs.Sub(starterFiles, "starter")
+	return fsys
+}
+
+// WithStarter layers the templates directory on top of the starter site.
+func WithStarter() Option {
+	return func(c *Config) error {
+		c.Starter = true
+		return nil
+	}
+}
+
+// overlayFS serves files from upper, falling back to lower for files that
+// don't exist in upper. Directories list the entries of both.
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+var _ fs.ReadDirFS = overlayFS{}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.lower.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, uerr := fs.ReadDir(o.upper, name)
+	lower, lerr := fs.ReadDir(o.lower, name)
+	if uerr != nil && lerr != nil {
+		return nil, uerr
+	}
+	entries := slices.Clone(upper)
+	for _, e := range lower {
+		if !slices.ContainsFunc(upper, func(u fs.DirEntry) bool { return u.Name() == e.Name() }) {
+			entries = append(entries, e)
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
@@ -0,0 +1,188 @@
+package xtemplate
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hashCache holds the content hashes of static files keyed by path, which
+// are valid as long as the size and modification time of the file match. It
+// can be persisted to a file between builds, see [Config.StaticHashCache]. A
+// nil *hashCache caches nothing.
+type hashCache struct {
+	mu      sync.Mutex
+	entries map[string]hashCacheEntry
+	dirty   bool
+
+	// files larger than this aren't hashed, see [Config.StaticHashMaxSize]
+	maxSize int64
+}
+
+type hashCacheEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modtime"`
+	Hash    string    `json:"hash"`
+}
+
+// loadHashCache reads the cache file at name, if name isn't empty. A missing
+// or invalid cache file results in an empty cache, since it will be rewritten
+// anyway.
+func loadHashCache(name string, maxSize int64) *hashCache {
+	c := &hashCache{entries: map[string]hashCacheEntry{}, maxSize: maxSize}
+	if name == "" {
+		return c
+	}
+	if data, err := os.ReadFile(name); err == nil {
+		if json.Unmarshal(data, &c.entries) != nil {
+			c.entries = map[string]hashCacheEntry{}
+		}
+	}
+	return c
+}
+
+// tooLarge reports whether a file of size bytes shouldn't be read to hash it.
+func (c *hashCache) tooLarge(size int64) bool {
+	return c != nil && c.maxSize > 0 && size > c.maxSize
+}
+
+func (c *hashCache) get(name string, stat fs.FileInfo) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok || e.Size != stat.Size() || !e.ModTime.Equal(stat.ModTime()) {
+		return "", false
+	}
+	return e.Hash, true
+}
+
+func (c *hashCache) put(name string, stat fs.FileInfo, hash string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[name] = hashCacheEntry{stat.Size(), stat.ModTime(), hash}
+	c.dirty = true
+}
+
+// save writes the entries of the files in names to the cache file if any
+// changed, dropping entries of files that no longer exist.
+func (c *hashCache) save(name string, names []string) error {
+	if c == nil || name == "" {
+		return nil
+	}
+	exists := make(map[string]bool, len(names))
+	for _, n := range names {
+		exists[n] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n := range c.entries {
+		if !exists[n] {
+			delete(c.entries, n)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file and rename it so a concurrent build never
+	// reads a partial cache
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err = errors.Join(err, tmp.Close()); err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// prefill hashes the static files in names that aren't cached yet with the
+// given number of workers, so loading them one by one afterwards only hits the
+// cache. Errors are ignored because they are reported when the file is loaded.
+func (c *hashCache) prefill(fsys fs.FS, names []string, workers int) {
+	exists := make(map[string]bool, len(names))
+	for _, n := range names {
+		exists[n] = true
+	}
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range next {
+				ext := path.Ext(name)
+				c.hash(fsys, name, slices.Contains(alternateEncodingExts, ext) && exists[strings.TrimSuffix(name, ext)])
+			}
+		}()
+	}
+	for _, name := range names {
+		next <- name
+	}
+	close(next)
+	wg.Wait()
+}
+
+// hash caches the content hash of the file, which is decoded first if it's an
+// alternate encoding of another file.
+func (c *hashCache) hash(fsys fs.FS, name string, encoded bool) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if _, ok := c.get(name, stat); ok || c.tooLarge(stat.Size()) {
+		return
+	}
+	var reader io.Reader = f
+	if encoded {
+		if identity, err := fs.Stat(fsys, strings.TrimSuffix(name, path.Ext(name))); err != nil || c.tooLarge(identity.Size()) {
+			return
+		}
+		if reader, _, err = decodingReader(path.Ext(name), f.(io.ReadSeeker)); err != nil {
+			return
+		}
+	}
+	if sri, err := contentHash(reader); err == nil {
+		c.put(name, stat, sri)
+	}
+}
+
+// contentHash returns the subresource integrity hash of the contents of r.
+func contentHash(r io.Reader) (string, error) {
+	hash := sha512.New384()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return "sha384-" + base64.URLEncoding.EncodeToString(hash.Sum(nil)), nil
+}
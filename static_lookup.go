@@ -0,0 +1,135 @@
+package xtemplate
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticLookup resolves static files against the FS when they're requested
+// instead of when the instance is built, so files can be added, changed, or
+// removed without rebuilding the instance. Results are cached for ttl, both
+// files that were found and paths that don't exist. See
+// [Config.DynamicStatic].
+type staticLookup struct {
+	fsys        fs.FS
+	templateExt string
+	dataDir     string
+	weak        bool
+	hashes      *hashCache
+	ttl         time.Duration
+	log         *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]staticLookupEntry
+}
+
+type staticLookupEntry struct {
+	file    *fileInfo // nil if the file doesn't exist
+	expires time.Time
+}
+
+// maxStaticLookupEntries bounds the cache so requests for random paths can't
+// grow it without limit. The cache is cleared when it's full.
+const maxStaticLookupEntries = 10000
+
+var alternateEncodingExts = []string{".gz", ".zst", ".br"}
+
+// file returns the static file for the clean url path, or nil.
+func (s *staticLookup) file(urlpath string) *fileInfo {
+	now := time.Now()
+	s.mu.Lock()
+	entry, ok := s.entries[urlpath]
+	s.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.file
+	}
+
+	file, err := s.load(urlpath)
+	if err != nil {
+		s.log.Warn("failed to load static file", slog.String("path", urlpath), slog.Any("error", err))
+	}
+	s.mu.Lock()
+	if len(s.entries) >= maxStaticLookupEntries {
+		clear(s.entries)
+	}
+	s.entries[urlpath] = staticLookupEntry{file, now.Add(s.ttl)}
+	s.mu.Unlock()
+	return file
+}
+
+// load reads the static file at urlpath and its alternate encodings like the
+// instance builder does for static files, returning nil if there is no file.
+func (s *staticLookup) load(urlpath string) (*fileInfo, error) {
+	name := strings.TrimPrefix(urlpath, "/")
+	if name == "" || !fs.ValidPath(name) || strings.HasSuffix(name, s.templateExt) || isDataPath(s.dataDir, name) {
+		return nil, nil
+	}
+	// alternate encodings are only served for their identity file
+	if ext := path.Ext(name); slices.Contains(alternateEncodingExts, ext) {
+		if s.isFile(strings.TrimSuffix(name, ext)) {
+			return nil, nil
+		}
+	}
+	if !s.isFile(name) {
+		return nil, nil
+	}
+	file, _, err := loadStaticFile(s.fsys, name, nil, s.weak, s.hashes)
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range alternateEncodingExts {
+		if !s.isFile(name + ext) {
+			continue
+		}
+		if _, _, err := loadStaticFile(s.fsys, name+ext, file, s.weak, s.hashes); err != nil {
+			return nil, err
+		}
+	}
+	return file, nil
+}
+
+func (s *staticLookup) isFile(name string) bool {
+	stat, err := fs.Stat(s.fsys, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		s.log.Warn("failed to stat static file", slog.String("name", name), slog.Any("error", err))
+	}
+	return err == nil && stat.Mode().IsRegular()
+}
+
+// file returns the static file served at the clean url path, if any.
+func (instance *Instance) file(urlpath string) (*fileInfo, bool) {
+	if file, ok := instance.files[urlpath]; ok {
+		return file, true
+	}
+	if instance.static != nil {
+		if file := instance.static.file(urlpath); file != nil {
+			return file, true
+		}
+	}
+	return nil, false
+}
+
+// wrap serves static files for GET and HEAD requests that aren't handled by a
+// route with an exact path of router, otherwise it passes the request to next.
+func (s *staticLookup) wrap(router Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			_, pattern := router.Handler(r)
+			exact := pattern != "" && !strings.HasSuffix(pattern, "/") && !strings.Contains(pattern, "{")
+			if !exact {
+				if file := s.file(path.Clean(r.URL.Path)); file != nil {
+					staticFileHandler(s.fsys, file)(w, r)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package xtemplate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// TemplateSource is where a template definition lives, so errors can point at
+// it even if it's called from other files or overrides a definition of the
+// same name in another file.
+type TemplateSource struct {
+	// Path of the template file like `/blog/post.html`, and its path on disk
+	// if it was loaded from [Config.TemplatesDir].
+	File string `json:"file"`
+	Path string `json:"path,omitempty"`
+
+	// Line of the unminified file where the definition starts. 0 if it's
+	// unknown.
+	Line int `json:"line"`
+}
+
+// String returns the location as `path:line`, using File if it's not on disk.
+func (s TemplateSource) String() string {
+	p := s.Path
+	if p == "" {
+		p = s.File
+	}
+	return fmt.Sprintf("%s:%d", p, s.Line)
+}
+
+// addTemplateSource records the source of the template name defined in file.
+// source is the text of the file before it was minified, and dir the
+// directory on disk that it was loaded from, if any.
+func (b *builder) addTemplateSource(file, source, dir, name string) {
+	if b.templateSources == nil {
+		b.templateSources = map[string]TemplateSource{}
+	}
+	src := TemplateSource{File: file, Line: 1}
+	if dir != "" {
+		p := filepath.Join(dir, filepath.FromSlash(strings.TrimPrefix(file, "/")))
+		if _, err := os.Stat(p); err == nil {
+			src.Path = p
+		}
+	}
+	if name != file {
+		src.Line = definitionLine(source, name, b.config.LDelim)
+	}
+	b.templateSources[name] = src
+}
+
+// definitionLine returns the line of the define or block action of name in
+// source, or 0 if it isn't found.
+func definitionLine(source, name, ldelim string) int {
+	quoted := `(?:"` + regexp.QuoteMeta(strings.ReplaceAll(name, `"`, `\"`)) + `"|` + "`" + regexp.QuoteMeta(name) + "`)"
+	re, err := regexp.Compile(regexp.QuoteMeta(ldelim) + `-?\s*(?:define|block)\s+` + quoted)
+	if err != nil {
+		return 0
+	}
+	loc := re.FindStringIndex(source)
+	if loc == nil {
+		return 0
+	}
+	return strings.Count(source[:loc[0]], "\n") + 1
+}
+
+// templateError wraps err like wrapTemplateError and adds where the failed
+// template and file are on disk.
+func (x *Instance) templateError(err error) error {
+	err = wrapTemplateError(err)
+	var tmplErr *TemplateError
+	if !errors.As(err, &tmplErr) {
+		return err
+	}
+	if src, ok := x.templateSources[tmplErr.Name]; ok && tmplErr.Definition == nil {
+		tmplErr.Definition = &src
+	}
+	if src, ok := x.templateSources[tmplErr.File]; ok && tmplErr.Path == "" {
+		tmplErr.Path = src.Path
+	}
+	return err
+}
@@ -0,0 +1,3 @@
+CREATE TABLE IF NOT EXISTS form_notes(id INTEGER PRIMARY KEY, title TEXT, body TEXT, secret TEXT DEFAULT 'none');
+
+PRAGMA user_version = 11;
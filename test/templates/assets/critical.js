@@ -0,0 +1,2 @@
+// mark that scripts run
+document.documentElement.className = "js";
@@ -0,0 +1,63 @@
+package xtemplate
+
+import (
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+)
+
+// Helpers for Hotwire Turbo Streams. See https://turbo.hotwired.dev/handbook/streams
+
+const turboStreamContentType = "text/vnd.turbo-stream.html"
+
+var turboStreamActions = []string{"append", "prepend", "replace", "update", "remove", "before", "after", "refresh"}
+
+// TurboStream reports whether the request accepts a Turbo Stream response, as
+// sent by Turbo for form submissions.
+func (d DotReq) TurboStream() bool {
+	return strings.Contains(d.Header.Get("Accept"), turboStreamContentType)
+}
+
+// TurboStream returns a <turbo-stream> element that performs action on the
+// element with the target id, and sets the response content type to Turbo
+// Stream. Content is required for all actions except "remove" and "refresh".
+// Strings are escaped, render templates with .X.Template:
+//
+//	{{.Resp.TurboStream "append" "messages" (.X.Template "message" .)}}
+//	{{.Resp.TurboStream "remove" "flash"}}
+func (h *DotResp) TurboStream(action, target string, content ...any) (template.HTML, error) {
+	if !slices.Contains(turboStreamActions, action) {
+		return "", fmt.Errorf("unknown turbo stream action '%s'", action)
+	}
+	if len(content) > 1 {
+		return "", fmt.Errorf("too many content arguments")
+	}
+	needsContent := action != "remove" && action != "refresh"
+	if needsContent != (len(content) == 1) {
+		if needsContent {
+			return "", fmt.Errorf("turbo stream action '%s' requires content", action)
+		}
+		return "", fmt.Errorf("turbo stream action '%s' does not take content", action)
+	}
+	h.Header.Set("Content-Type", turboStreamContentType)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<turbo-stream action="%s"`, action)
+	if target != "" {
+		fmt.Fprintf(&b, ` target="%s"`, template.HTMLEscapeString(target))
+	}
+	b.WriteString(">")
+	if needsContent {
+		b.WriteString("<template>")
+		switch c := content[0].(type) {
+		case template.HTML:
+			b.WriteString(string(c))
+		default:
+			b.WriteString(template.HTMLEscapeString(fmt.Sprint(c)))
+		}
+		b.WriteString("</template>")
+	}
+	b.WriteString("</turbo-stream>")
+	return template.HTML(b.String()), nil
+}
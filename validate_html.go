@@ -0,0 +1,115 @@
+package xtemplate
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Elements that have no end tag.
+var voidElements = []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "param", "source", "track", "wbr"}
+
+// Elements whose end tag can be omitted, which the minifier does.
+var optionalEndElements = []string{"html", "head", "body", "p", "li", "dt", "dd", "option", "optgroup", "tr", "td", "th", "thead", "tbody", "tfoot", "colgroup", "caption", "rt", "rp"}
+
+// validateHTML checks rendered html for structural problems that browsers
+// silently repair: elements that aren't closed, end tags without a matching
+// start tag, duplicate ids, and images without alt text. It returns a
+// description of each problem with the line of the output it was found on.
+// See [Config.ValidateHTML].
+func validateHTML(body []byte) []string {
+	var problems []string
+	report := func(line int, format string, args ...any) {
+		problems = append(problems, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+	}
+	type open struct {
+		name string
+		line int
+	}
+	var stack []open
+	ids := map[string]int{}
+	line := 1
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				report(line, "failed to tokenize: %v", err)
+			}
+			break
+		}
+		start := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+		token := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for _, attr := range token.Attr {
+				if attr.Key != "id" {
+					continue
+				}
+				if prev, ok := ids[attr.Val]; ok {
+					report(start, "duplicate id '%s', first used on line %d", attr.Val, prev)
+				} else {
+					ids[attr.Val] = start
+				}
+			}
+			if token.Data == "img" && !slices.ContainsFunc(token.Attr, func(a html.Attribute) bool { return a.Key == "alt" }) {
+				report(start, "<img> without alt attribute")
+			}
+			// the self-closing flag is ignored on html elements, and the
+			// tokenizer also sets it for unquoted attribute values ending in a
+			// slash like <a href=/docs/>
+			isForeign := func(name string) bool { return name == "svg" || name == "math" }
+			foreign := isForeign(token.Data) || slices.ContainsFunc(stack, func(o open) bool { return isForeign(o.name) })
+			if (tt == html.StartTagToken || !foreign) && !slices.Contains(voidElements, token.Data) {
+				stack = append(stack, open{token.Data, start})
+			}
+		case html.EndTagToken:
+			if slices.Contains(voidElements, token.Data) {
+				report(start, "end tag </%s> of void element", token.Data)
+				continue
+			}
+			// the end tag closes the innermost open element of its name
+			i := len(stack) - 1
+			for i >= 0 && stack[i].name != token.Data {
+				i--
+			}
+			if i < 0 {
+				// a stray </p> creates an empty paragraph
+				if token.Data == "p" || !slices.Contains(optionalEndElements, token.Data) {
+					report(start, "end tag </%s> without matching start tag", token.Data)
+				}
+				continue
+			}
+			for _, o := range stack[i+1:] {
+				if !slices.Contains(optionalEndElements, o.name) {
+					report(o.line, "<%s> is not closed before </%s>", o.name, token.Data)
+				}
+			}
+			stack = stack[:i]
+		}
+	}
+	for _, o := range stack {
+		if !slices.Contains(optionalEndElements, o.name) {
+			report(o.line, "<%s> is not closed", o.name)
+		}
+	}
+	return problems
+}
+
+// reportHTMLProblems logs the problems found by validateHTML in the output of
+// tmpl if it's html.
+func reportHTMLProblems(r *http.Request, tmpl string, header http.Header, body []byte) {
+	if ct := header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "text/html") {
+		return
+	}
+	if problems := validateHTML(body); len(problems) > 0 {
+		GetLogger(r.Context()).Warn("rendered html has problems", slog.String("template", tmpl), slog.Any("problems", problems))
+	}
+}
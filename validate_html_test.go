@@ -0,0 +1,29 @@
+package xtemplate
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateHTML(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		problems   []string
+	}{
+		{"nested", "<div><div><span>a</span></div>\n<div>b</div></div>", nil},
+		{"nested unclosed", "<div>\n<div><span>a</div></div>", []string{"line 2: <span> is not closed before </div>"}},
+		{"void", `<p>a<br>b<img src="x.png" alt=""><input name="q"></p>`, nil},
+		{"void self-closing", `<div><br/><hr /><img src="x.png" alt="x"/></div>`, nil},
+		{"void end tag", "<div>a<br></br></div>", []string{"line 1: end tag </br> of void element"}},
+		{"optional end", "<ul><li>a<li>b</ul><p>c", nil},
+		{"unclosed", "<div>\n<section>a</div>", []string{"line 2: <section> is not closed before </div>"}},
+		{"stray end", "<div>a</div></span>", []string{"line 1: end tag </span> without matching start tag"}},
+		{"svg", `<svg><path d="M0 0"/><circle r="1"/></svg>`, nil},
+		{"duplicate id", "<p id=\"a\">x</p>\n<p id=\"a\">y</p>", []string{"line 2: duplicate id 'a', first used on line 1"}},
+		{"img alt", `<img src="x.png">`, []string{"line 1: <img> without alt attribute"}},
+	} {
+		if problems := validateHTML([]byte(tc.body)); !slices.Equal(problems, tc.problems) {
+			t.Errorf("%s: got problems %q, want %q", tc.name, problems, tc.problems)
+		}
+	}
+}
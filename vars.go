@@ -0,0 +1,61 @@
+package xtemplate
+
+import (
+	"context"
+)
+
+type dotVarsProvider struct{}
+
+func (dotVarsProvider) FieldName() string            { return "Vars" }
+func (dotVarsProvider) Init(_ context.Context) error { return nil }
+func (dotVarsProvider) Value(r Request) (any, error) { return DotVars{}, nil }
+
+var _ DotConfig = dotVarsProvider{}
+
+// DotVars is used as the .Vars field of every template invocation. It's a map
+// of variables scoped to the request, so a value computed in one template can
+// be used by any template invoked later in the same request, for example a
+// page can set the title that its layout renders. Since dot is often rebound
+// inside range and with blocks, refer to it as $.Vars there.
+//
+//	{{.Vars.Set "title" "About"}}
+//	{{template "layout" .}}
+//
+//	{{define "layout"}}<title>{{.Vars.title}}</title>{{end}}
+//
+// The funcs setVar and getVar do the same with the map as the first argument.
+// Variables named Set or Get can only be read with the Get method.
+type DotVars map[string]any
+
+// Set sets the variable key to value. It returns an empty string.
+func (v DotVars) Set(key string, value any) string {
+	v[key] = value
+	return ""
+}
+
+// Get returns the variable key, or the default value if it's not set.
+func (v DotVars) Get(key string, default_ ...any) any {
+	if value, ok := v[key]; ok {
+		return value
+	}
+	if len(default_) > 0 {
+		return default_[0]
+	}
+	return nil
+}
+
+// FuncSetVar sets the variable key in vars to value. It returns an empty
+// string.
+//
+//	{{setVar .Vars "title" "About"}}
+func FuncSetVar(vars DotVars, key string, value any) string {
+	return vars.Set(key, value)
+}
+
+// FuncGetVar returns the variable key from vars, or the default value if it's
+// not set.
+//
+//	{{getVar .Vars "title" "Untitled"}}
+func FuncGetVar(vars DotVars, key string, default_ ...any) any {
+	return vars.Get(key, default_...)
+}
@@ -0,0 +1,82 @@
+package xtemplate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// ViewModelFunc prepares the data of a request in Go before its template
+// renders, see [WithViewModel].
+type ViewModelFunc func(r *http.Request) (any, error)
+
+// WithViewModel registers fn to prepare the view model of the route with the
+// given pattern, like `GET /posts/{id}`, which must be served by a template. Its
+// result is available to the template as .Req.Model, so data can be loaded and
+// validated with typed Go code while xtemplate handles routing and rendering:
+//
+//	xtemplate.WithViewModel("GET /posts/{id}", func(r *http.Request) (*Post, error) {
+//		return store.Post(r.Context(), r.PathValue("id"))
+//	})
+//
+// If fn returns an error the template isn't rendered, and the request fails
+// with the status of an [ErrorStatus] error, otherwise with status 500.
+func WithViewModel[T any](pattern string, fn func(r *http.Request) (T, error)) Option {
+	return func(c *Config) error {
+		if fn == nil {
+			return fmt.Errorf("nil view model func for pattern '%s'", pattern)
+		}
+		if strings.HasPrefix(pattern, "/") {
+			pattern = "GET " + pattern
+		}
+		if c.ViewModels == nil {
+			c.ViewModels = make(map[string]ViewModelFunc)
+		}
+		c.ViewModels[pattern] = func(r *http.Request) (any, error) { return fn(r) }
+		return nil
+	}
+}
+
+type viewModelType struct{}
+
+var viewModelKey = viewModelType{}
+
+// Model returns the view model prepared for the request by the func
+// registered for its route, otherwise nil. See [WithViewModel].
+func (d DotReq) Model() any {
+	return d.Context().Value(viewModelKey)
+}
+
+// withViewModel calls fn before handler and passes its result to the template
+// in the request context.
+func withViewModel(instance *Instance, handler http.HandlerFunc, fn ViewModelFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		model, err := fn(r)
+		if err != nil {
+			GetLogger(r.Context()).Warn("failed to prepare view model", slog.Any("error", err))
+			reportExecuteError(r.Context(), err)
+			status := http.StatusInternalServerError
+			var errSt ErrorStatus
+			if errors.As(err, &errSt) {
+				status = int(errSt)
+			}
+			instance.serveError(w, r, status, http.StatusText(status))
+			return
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), viewModelKey, model)))
+	}
+}
+
+// checkViewModels checks that the route of every view model func is served by
+// a template.
+func (b *builder) checkViewModels() error {
+	for pattern := range b.config.ViewModels {
+		if _, ok := b.routeSources[pattern]; !ok {
+			return fmt.Errorf("view model route '%s' is not served by a template", pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// VirtualRoute is a route that is registered at build time and served by a
+// shared template, like one route per row of a database table. See
+// [Config.VirtualRoutes] and [RouteList].
+type VirtualRoute struct {
+	// The route pattern like `/posts/hello-world` or `POST /posts/hello-world`.
+	// The method defaults to GET.
+	Pattern string `json:"pattern"`
+
+	// Name of the template that serves the route.
+	Template string `json:"template"`
+
+	// Data available to the template as .Req.RouteData.
+	Data any `json:"data,omitempty"`
+}
+
+func WithVirtualRoutes(fn func(ctx context.Context) ([]VirtualRoute, error)) Option {
+	return func(c *Config) error {
+		if fn == nil {
+			return fmt.Errorf("nil virtual routes func")
+		}
+		c.VirtualRoutes = fn
+		return nil
+	}
+}
+
+type routeListType struct{}
+
+var routeListKey = routeListType{}
+
+// RouteList collects the routes added by the "ROUTES" template, which is
+// executed at build time after the "INIT" templates. It enables pretty urls
+// for dynamic content without a catch-all route:
+//
+//	{{define "ROUTES"}}
+//	{{range .DB.QueryRows "SELECT id, slug FROM posts"}}{{$.Req.Routes.Add (print "/" .slug) "post" .}}{{end}}
+//	{{end}}
+//
+//	{{define "post"}}
+//	{{$post := .DB.QueryRow "SELECT title, body FROM posts WHERE id = ?" .Req.RouteData.id}}
+//	...
+//	{{end}}
+//
+// Since routes are only added at build time, reload the instance when the
+// content changes.
+type RouteList struct {
+	routes []VirtualRoute
+}
+
+// Routes returns the list that the "ROUTES" template adds routes to, otherwise
+// nil.
+func (d DotReq) Routes() *RouteList {
+	l, _ := d.Context().Value(routeListKey).(*RouteList)
+	return l
+}
+
+// Add adds a route with pattern served by the template name, which can read
+// data as .Req.RouteData. It returns an empty string.
+func (l *RouteList) Add(pattern, name string, data ...any) (string, error) {
+	if len(data) > 1 {
+		return "", fmt.Errorf("too many data arguments")
+	}
+	route := VirtualRoute{Pattern: pattern, Template: name}
+	if len(data) == 1 {
+		route.Data = data[0]
+	}
+	l.routes = append(l.routes, route)
+	return "", nil
+}
+
+type routeDataType struct{}
+
+var routeDataKey = routeDataType{}
+
+// RouteData returns the data of the virtual route being served, otherwise nil.
+// See [VirtualRoute].
+func (d DotReq) RouteData() any {
+	return d.Context().Value(routeDataKey)
+}
+
+// addVirtualRoutes collects routes from the VirtualRoutes callback and the
+// ROUTES template and registers them.
+func (b *builder) addVirtualRoutes() error {
+	var routes []VirtualRoute
+	if b.config.VirtualRoutes != nil {
+		rs, err := b.config.VirtualRoutes(b.config.Ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get virtual routes: %w", err)
+		}
+		routes = append(routes, rs...)
+	}
+	if tmpl := b.templates.Lookup("ROUTES"); tmpl != nil {
+		list := &RouteList{}
+		r := httptest.NewRequest("", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), routeListKey, list))
+		val, err := b.bufferDot.value(b.config.Ctx, httptest.NewRecorder(), r)
+		if err != nil {
+			return fmt.Errorf("failed to initialize dot value: %w", err)
+		}
+		err = tmpl.Execute(&bytes.Buffer{}, *val)
+		if err = b.bufferDot.cleanup(val, err); err != nil {
+			return fmt.Errorf("template 'ROUTES' failed: %w", err)
+		}
+		routes = append(routes, list.routes...)
+	}
+
+	for _, route := range routes {
+		tmpl := b.templates.Lookup(route.Template)
+		if tmpl == nil {
+			return fmt.Errorf("template '%s' of virtual route '%s' not found", route.Template, route.Pattern)
+		}
+		pattern := route.Pattern
+		if strings.HasPrefix(pattern, "/") {
+			pattern = "GET " + pattern
+		}
+		data, serve := route.Data, bufferingTemplateHandler(b.Instance, tmpl)
+		if fn, ok := b.config.ViewModels[pattern]; ok {
+			serve = withViewModel(b.Instance, serve, fn)
+		}
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serve(w, r.WithContext(context.WithValue(r.Context(), routeDataKey, data)))
+		})
+		if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+			return err
+		}
+		instanceRoute := newInstanceRoute(pattern, handler, RouteVirtual)
+		instanceRoute.Source = route.Template
+		b.routes = append(b.routes, instanceRoute)
+		b.routeSources[pattern] = route.Template
+		b.Routes += 1
+	}
+	if len(routes) > 0 {
+		b.config.Logger.Debug("added virtual routes", slog.Int("count", len(routes)))
+	}
+	return nil
+}
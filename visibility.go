@@ -0,0 +1,43 @@
+package xtemplate
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cast"
+)
+
+// visibility is read from the `noindex` and `private` front matter keys of a
+// template file. Pages with `noindex: true` are served with an X-Robots-Tag
+// header and left out of the sitemap. Pages with `private: true` are also left
+// out of the navigation tree, and are marked in [InstanceRoute] so route
+// listings can hide them. Both apply to every route of the file.
+type visibility struct {
+	noindex, private bool
+}
+
+func metaVisibility(meta map[string]any) (visibility, error) {
+	var v visibility
+	for key, field := range map[string]*bool{"noindex": &v.noindex, "private": &v.private} {
+		value, ok := meta[key]
+		if !ok {
+			continue
+		}
+		b, err := cast.ToBoolE(value)
+		if err != nil {
+			return v, fmt.Errorf("invalid %s: '%v'", key, value)
+		}
+		*field = b
+	}
+	// private pages aren't indexed either
+	v.noindex = v.noindex || v.private
+	return v, nil
+}
+
+// withNoIndex tells search engines not to index the response.
+func withNoIndex(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Robots-Tag", "noindex")
+		handler(w, r)
+	}
+}
@@ -0,0 +1,79 @@
+package xtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// WebFingerConfig configures a WebFinger endpoint at /.well-known/webfinger
+// that describes the site owner, so they can be discovered by an address like
+// `acct:me@example.com` from the fediverse and other services. See
+// https://www.rfc-editor.org/rfc/rfc7033.
+type WebFingerConfig struct {
+	// The resource that is described, like `acct:me@example.com`.
+	Subject string `json:"subject"`
+
+	// Other resources that are also answered with this document, like the url
+	// of the owner's profile page.
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Links of the document, like a `self` link to an ActivityPub actor or a
+	// `http://webfinger.net/rel/profile-page` link.
+	Links []WebFingerLink `json:"links"`
+}
+
+// WebFingerLink is a link of a WebFinger document.
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href,omitempty"`
+}
+
+func WithWebFinger(webfinger WebFingerConfig) Option {
+	return func(c *Config) error {
+		if webfinger.Subject == "" {
+			return fmt.Errorf("cannot create webfinger endpoint without a subject")
+		}
+		c.WebFinger = &webfinger
+		return nil
+	}
+}
+
+// addWebFingerRoute registers the WebFinger endpoint.
+func (b *builder) addWebFingerRoute() error {
+	config := *b.config.WebFinger
+	if config.Subject == "" {
+		return fmt.Errorf("webfinger subject is required")
+	}
+	if config.Links == nil {
+		config.Links = []WebFingerLink{}
+	}
+	document, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode webfinger document: %w", err)
+	}
+	instance := b.Instance
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resource := r.URL.Query().Get("resource")
+		if resource == "" {
+			instance.serveError(w, r, http.StatusBadRequest, "missing resource parameter")
+			return
+		}
+		if resource != config.Subject && !slices.Contains(config.Aliases, resource) {
+			instance.serveError(w, r, http.StatusNotFound, "resource not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/jrd+json")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Write(document)
+	})
+	pattern := "GET /.well-known/webfinger"
+	if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, handler) }); err != nil {
+		return err
+	}
+	b.routes = append(b.routes, newInstanceRoute(pattern, handler, RouteBuiltin))
+	b.Routes += 1
+	return nil
+}
@@ -0,0 +1,144 @@
+package xtemplate
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// WebhookConfig configures an authenticated endpoint for content webhooks, like
+// those sent by a headless CMS when an entry is published, so edits show up
+// without waiting for a scheduled rebuild.
+//
+// Each accepted webhook invokes the "WEBHOOK" template if it is defined, with
+// the decoded JSON payload available as .Req.Webhook, which can purge
+// the affected entries from caches kept in a database or key value store. If
+// Reload is set, the server then reloads the instance. The output of the
+// template is the response, otherwise it responds with 204 No Content.
+type WebhookConfig struct {
+	// Path of the endpoint, which accepts POST requests. Default
+	// `/_webhook`.
+	Path string `json:"path,omitempty"`
+
+	// Shared secret that authenticates webhooks. Required.
+	Secret string `json:"secret"`
+
+	// Header that holds the hex encoded HMAC-SHA256 signature of the request
+	// body keyed by Secret, optionally prefixed with `sha256=`, like
+	// `X-Hub-Signature-256`. If empty, the request must instead have an
+	// `Authorization: Bearer <secret>` header.
+	SignatureHeader string `json:"signature_header,omitempty"`
+
+	// Reload the instance after the webhook is handled. Only takes effect when
+	// the instance is managed by a [Server], and discards any staged
+	// candidate instance.
+	Reload bool `json:"reload,omitempty"`
+}
+
+func WithWebhook(webhook WebhookConfig) Option {
+	return func(c *Config) error {
+		if webhook.Secret == "" {
+			return fmt.Errorf("cannot create webhook endpoint without a secret")
+		}
+		c.Webhook = &webhook
+		return nil
+	}
+}
+
+type webhookPayloadType struct{}
+
+var webhookPayloadKey = webhookPayloadType{}
+
+// Webhook returns the decoded JSON payload of the webhook being handled by the
+// "WEBHOOK" template, otherwise nil. See [WebhookConfig].
+func (d DotReq) Webhook() any {
+	return d.Context().Value(webhookPayloadKey)
+}
+
+type webhook struct {
+	instance *Instance
+	config   WebhookConfig
+}
+
+// addWebhookRoute registers the webhook endpoint.
+func (b *builder) addWebhookRoute() error {
+	h := &webhook{instance: b.Instance, config: *b.config.Webhook}
+	if h.config.Secret == "" {
+		return fmt.Errorf("webhook secret is required")
+	}
+	if h.config.Path == "" {
+		h.config.Path = "/_webhook"
+	}
+	pattern := "POST " + h.config.Path
+	if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, h) }); err != nil {
+		return err
+	}
+	b.routes = append(b.routes, newInstanceRoute(pattern, h, RouteBuiltin))
+	b.Routes += 1
+	return nil
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log := GetLogger(r.Context())
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 10<<20))
+	if err != nil {
+		h.instance.serveError(w, r, http.StatusRequestEntityTooLarge, "webhook body too large")
+		return
+	}
+	if !h.authenticate(r, body) {
+		log.Warn("rejected webhook with invalid credentials")
+		h.instance.serveError(w, r, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var payload any
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			h.instance.serveError(w, r, http.StatusBadRequest, "webhook body is not json")
+			return
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	log.Info("accepted webhook", "reload", h.config.Reload)
+
+	if tmpl := h.instance.templates.Lookup("WEBHOOK"); tmpl != nil {
+		ctx := context.WithValue(r.Context(), webhookPayloadKey, payload)
+		metrics := httpsnoop.CaptureMetrics(bufferingTemplateHandler(h.instance, tmpl), w, r.WithContext(ctx))
+		if metrics.Code >= 400 {
+			return
+		}
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	if h.config.Reload {
+		if h.instance.config.reload == nil {
+			log.Warn("webhook cannot reload an instance that isn't managed by a server")
+		} else {
+			h.instance.config.reload()
+		}
+	}
+}
+
+func (h *webhook) authenticate(r *http.Request, body []byte) bool {
+	if h.config.SignatureHeader == "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Secret)) == 1
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(h.config.SignatureHeader), "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(h.config.Secret))
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
@@ -0,0 +1,352 @@
+package xtemplate
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// WebmentionConfig configures an endpoint that receives webmentions, which
+// other sites send to notify this site that they link to one of its pages. See
+// https://www.w3.org/TR/webmention/.
+//
+// Mentions are verified in the background by fetching the source and checking
+// that it links to the target, then stored in a table of a database provider,
+// which is created if it doesn't exist. Sources are only fetched from public
+// ip addresses, by [Config.JobWorkers] workers from a bounded queue, and each
+// source host is fetched at most once per second, so the endpoint can't be
+// used to reach internal services or to flood other sites. Render them with the .Webmentions dot
+// field, see [DotWebmentions]. Advertise the endpoint in the head of pages:
+//
+//	<link rel="webmention" href="/webmention">
+type WebmentionConfig struct {
+	// Path of the receiving endpoint. Default `/webmention`.
+	Path string `json:"path,omitempty"`
+
+	// Name of the database provider that stores mentions. Defaults to the
+	// first database.
+	Database string `json:"database,omitempty"`
+
+	// Name of the table that stores mentions. Default `webmentions`.
+	Table string `json:"table,omitempty"`
+
+	// Hosts that targets may point to. Defaults to the Host of the request
+	// that sends the mention.
+	Hosts []string `json:"hosts,omitempty"`
+
+	// Fetch sources on loopback, private, and link-local addresses, for
+	// testing. Default `false`.
+	AllowPrivateSources bool `json:"allow_private_sources,omitempty"`
+}
+
+func WithWebmention(webmention WebmentionConfig) Option {
+	return func(c *Config) error {
+		c.Webmention = &webmention
+		return nil
+	}
+}
+
+// Webmention is a verified mention of a page on this site.
+type Webmention struct {
+	// The url of the page that links to Target.
+	Source string
+	// The url of the page on this site.
+	Target string
+	// The title of the Source page, if it has one.
+	Title string
+	// When the mention was last received and verified.
+	Received time.Time
+}
+
+const (
+	// webmentionQueueSize bounds the mentions waiting to be verified, further
+	// mentions are rejected until the queue drains.
+	webmentionQueueSize = 100
+	// webmentionSourceInterval is the minimum time between fetches of sources
+	// on the same host.
+	webmentionSourceInterval = time.Second
+)
+
+type webmentions struct {
+	instance *Instance
+	config   WebmentionConfig
+	db       *DotDBConfig
+	client   *http.Client
+	queue    chan webmentionJob
+
+	mu sync.Mutex
+	// when a mention with a source on each host was last accepted
+	sources map[string]time.Time
+}
+
+type webmentionJob struct {
+	log    *slog.Logger
+	source string
+	target *url.URL
+}
+
+// dotWebmentionsProvider provides the .Webmentions dot field. Its db is set
+// when the webmention endpoint is added.
+type dotWebmentionsProvider struct {
+	*webmentions
+}
+
+func (dotWebmentionsProvider) FieldName() string            { return "Webmentions" }
+func (dotWebmentionsProvider) Init(_ context.Context) error { return nil }
+func (p dotWebmentionsProvider) Value(r Request) (any, error) {
+	return DotWebmentions{p.webmentions, r.R.Context()}, nil
+}
+
+var _ DotConfig = dotWebmentionsProvider{}
+
+// DotWebmentions is used as the .Webmentions dot field when [Config.Webmention]
+// is set, and lists the verified mentions of pages on this site:
+//
+//	{{with .Webmentions.For .Req.URL.Path}}
+//	<h2>Mentions</h2>
+//	<ul>{{range .}}<li><a href="{{.Source}}">{{or .Title .Source}}</a> {{.Received.Format "Jan 2, 2006"}}{{end}}</ul>
+//	{{end}}
+type DotWebmentions struct {
+	w   *webmentions
+	ctx context.Context
+}
+
+// Endpoint returns the path of the receiving endpoint.
+func (d DotWebmentions) Endpoint() string {
+	return d.w.config.Path
+}
+
+// For returns the verified mentions of the page with the given path or url,
+// oldest first.
+func (d DotWebmentions) For(target string) ([]Webmention, error) {
+	path := target
+	if u, err := url.Parse(target); err == nil {
+		path = u.Path
+	}
+	rows, err := d.w.db.DB.QueryContext(d.ctx, fmt.Sprintf("SELECT source, target, title, received FROM %s WHERE path = ? ORDER BY received", d.w.config.Table), path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var mentions []Webmention
+	for rows.Next() {
+		var m Webmention
+		if err := rows.Scan(&m.Source, &m.Target, &m.Title, &m.Received); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+// Count returns the number of verified mentions of the page with the given
+// path or url.
+func (d DotWebmentions) Count(target string) (int, error) {
+	mentions, err := d.For(target)
+	return len(mentions), err
+}
+
+// addWebmentionRoute registers the webmention endpoint and creates the table
+// in the configured database provider, which must already be initialized.
+func (b *builder) addWebmentionRoute(w *webmentions, dot []DotConfig) error {
+	w.db = findDotDB(dot, w.config.Database)
+	if w.db == nil {
+		return fmt.Errorf("webmention database provider not found: '%s'", w.config.Database)
+	}
+	if !sqlIdentifier.MatchString(w.config.Table) {
+		return fmt.Errorf("invalid webmention table name: '%s'", w.config.Table)
+	}
+	_, err := w.db.DB.ExecContext(b.config.Ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		source TEXT NOT NULL,
+		target TEXT NOT NULL,
+		path TEXT NOT NULL,
+		title TEXT NOT NULL,
+		received TIMESTAMP NOT NULL,
+		PRIMARY KEY (source, target)
+	)`, w.config.Table))
+	if err != nil {
+		return fmt.Errorf("failed to create webmention table: %w", err)
+	}
+	for range b.config.JobWorkers {
+		go w.work(b.config.Ctx)
+	}
+	pattern := "POST " + w.config.Path
+	if err := catch(fmt.Sprintf("add handler to servemux '%s'", pattern), func() { b.router.Handle(pattern, w) }); err != nil {
+		return err
+	}
+	b.routes = append(b.routes, newInstanceRoute(pattern, w, RouteBuiltin))
+	b.Routes += 1
+	return nil
+}
+
+func newWebmentions(instance *Instance, config WebmentionConfig) *webmentions {
+	if config.Path == "" {
+		config.Path = "/webmention"
+	}
+	if config.Table == "" {
+		config.Table = "webmentions"
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	if !config.AllowPrivateSources {
+		client.Transport = &http.Transport{DialContext: publicDialer().DialContext, TLSHandshakeTimeout: 10 * time.Second}
+	}
+	return &webmentions{instance: instance, config: config, client: client, queue: make(chan webmentionJob, webmentionQueueSize), sources: map[string]time.Time{}}
+}
+
+// publicDialer returns a dialer that refuses to connect to addresses that
+// aren't public unicast addresses, like loopback, private, link-local, and
+// shared addresses. It checks the resolved address of each connection, so a
+// host name that resolves to an internal address can't bypass it.
+func publicDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if !publicAddr(addr.Unmap()) {
+				return fmt.Errorf("refusing to connect to non-public address %s", addr)
+			}
+			return nil
+		},
+	}
+}
+
+// sharedAddrs is the address space shared by carrier-grade NATs, RFC 6598.
+var sharedAddrs = netip.MustParsePrefix("100.64.0.0/10")
+
+func publicAddr(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddrs.Contains(addr)
+}
+
+func (w *webmentions) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	source, err1 := url.Parse(r.PostFormValue("source"))
+	target, err2 := url.Parse(r.PostFormValue("target"))
+	switch {
+	case err1 != nil || err2 != nil || !slices.Contains([]string{"http", "https"}, source.Scheme) || !slices.Contains([]string{"http", "https"}, target.Scheme):
+		w.instance.serveError(rw, r, http.StatusBadRequest, "source and target must be http urls")
+		return
+	case source.String() == target.String():
+		w.instance.serveError(rw, r, http.StatusBadRequest, "source and target must differ")
+		return
+	case !w.acceptsHost(r, target.Host):
+		w.instance.serveError(rw, r, http.StatusBadRequest, "target is not on this site")
+		return
+	}
+	if !w.allowSource(source.Host, time.Now()) {
+		rw.Header().Set("Retry-After", "1")
+		w.instance.serveError(rw, r, http.StatusTooManyRequests, "too many webmentions from this source")
+		return
+	}
+	log := GetLogger(r.Context()).With(slog.String("source", source.String()), slog.String("target", target.String()))
+	select {
+	case w.queue <- webmentionJob{log, source.String(), target}:
+	default:
+		log.Warn("webmention queue is full")
+		rw.Header().Set("Retry-After", "60")
+		w.instance.serveError(rw, r, http.StatusServiceUnavailable, "too many webmentions, try again later")
+		return
+	}
+	log.Info("received webmention")
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// allowSource reports whether a mention with a source on host can be
+// accepted at now, and records it if so.
+func (w *webmentions) allowSource(host string, now time.Time) bool {
+	host = strings.ToLower(host)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if last, ok := w.sources[host]; ok && now.Sub(last) < webmentionSourceInterval {
+		return false
+	}
+	if len(w.sources) >= webmentionQueueSize {
+		for h, last := range w.sources {
+			if now.Sub(last) >= webmentionSourceInterval {
+				delete(w.sources, h)
+			}
+		}
+	}
+	w.sources[host] = now
+	return true
+}
+
+// work verifies queued mentions until ctx is done.
+func (w *webmentions) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-w.queue:
+			w.verify(job.log, job.source, job.target)
+		}
+	}
+}
+
+func (w *webmentions) acceptsHost(r *http.Request, host string) bool {
+	if len(w.config.Hosts) == 0 {
+		return strings.EqualFold(host, r.Host)
+	}
+	return slices.ContainsFunc(w.config.Hosts, func(h string) bool { return strings.EqualFold(h, host) })
+}
+
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// verify fetches source and stores the mention if it links to target, or
+// deletes a previously stored mention if it no longer does.
+func (w *webmentions) verify(log *slog.Logger, source string, target *url.URL) {
+	ctx := w.instance.config.Ctx
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		log.Warn("failed to verify webmention", slog.Any("error", err))
+		return
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		log.Warn("failed to verify webmention", slog.Any("error", err))
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		log.Warn("failed to verify webmention", slog.Any("error", err))
+		return
+	}
+
+	links := resp.StatusCode == http.StatusOK && strings.Contains(html.UnescapeString(string(body)), target.String())
+	if !links {
+		_, err = w.db.DB.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE source = ? AND target = ?", w.config.Table), source, target.String())
+		log.Info("webmention source doesn't link to target", slog.Int("status", resp.StatusCode), slog.Any("error", err))
+		return
+	}
+	var title string
+	if m := titlePattern.FindSubmatch(body); m != nil {
+		title = strings.TrimSpace(html.UnescapeString(string(m[1])))
+	}
+	_, err = w.db.DB.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (source, target, path, title, received) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (source, target) DO UPDATE SET title = excluded.title, received = excluded.received`, w.config.Table),
+		source, target.String(), target.Path, title, time.Now().UTC())
+	if err != nil {
+		log.Warn("failed to store webmention", slog.Any("error", err))
+		return
+	}
+	log.Info("verified webmention")
+}